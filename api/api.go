@@ -3,12 +3,34 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/EliasManj/orderbook/audit"
+	"github.com/EliasManj/orderbook/candles"
+	"github.com/EliasManj/orderbook/history"
+	"github.com/EliasManj/orderbook/journal"
+	"github.com/EliasManj/orderbook/metrics"
 	"github.com/EliasManj/orderbook/orderbook"
+	"github.com/gorilla/mux"
 )
 
-var ob *orderbook.OrderBook = orderbook.NewOrderBook()
+// mu serializes access to the order book between concurrent requests
+var mu sync.Mutex
+var ob *orderbook.OrderBook = newOrderBook()
+var trades *history.Store = history.NewStore(history.DefaultCapacity, nil)
+var bars *candles.Aggregator = candles.NewAggregator(candles.DefaultIntervals...)
+
+func newOrderBook() *orderbook.OrderBook {
+	book := orderbook.NewOrderBook()
+	book.Fees = orderbook.NewFeeLedger(orderbook.StandardFeeSchedule)
+	book.Events = orderbook.NewEventBus()
+	return book
+}
 
 type createOrderJson struct {
 	OrderType string  `json:"order_type" binding:"required"`
@@ -16,6 +38,7 @@ type createOrderJson struct {
 	Price     float64 `json:"price"`
 	Qty       int     `json:"qty" binding:"required"`
 	OrderId   int     `json:"order_id"`
+	Account   string  `json:"account"`
 }
 
 type createOrderResponse struct {
@@ -23,46 +46,361 @@ type createOrderResponse struct {
 	Order  createOrderJson   `json:"order"`
 }
 
-func executeOrder(order orderbook.Order) createOrderResponse {
-	trades := ob.AddOrder(order)
+// NewRouter registers the API routes, instrumented with request metrics
+func NewRouter() *mux.Router {
+	r := mux.NewRouter()
+	r.Use(MetricsMiddleware)
+	r.HandleFunc("/bids/", GetBids)
+	r.HandleFunc("/asks/", GetAsks)
+	r.HandleFunc("/order/", CreateOrder).Methods("POST")
+	r.HandleFunc("/order/{id}", ModifyOrder).Methods("PUT")
+	r.HandleFunc("/order/{id}", CancelOrder).Methods("DELETE")
+	r.HandleFunc("/orders", CancelOrders).Methods("DELETE")
+	r.HandleFunc("/admin/kill", KillSwitch).Methods("GET", "POST", "DELETE")
+	r.HandleFunc("/fees/", GetFees)
+	r.HandleFunc("/trades", GetTrades).Methods("GET")
+	r.HandleFunc("/candles", GetCandles).Methods("GET")
+	r.HandleFunc("/ticker", GetTicker).Methods("GET")
+	r.HandleFunc("/ws", ServeFeed)
+	r.Handle("/metrics", metrics.Handler()).Methods("GET")
+	r.HandleFunc("/health", GetHealth).Methods("GET")
+	r.HandleFunc("/healthz", GetHealthz).Methods("GET")
+	r.HandleFunc("/readyz", GetReadyz).Methods("GET")
+	r.HandleFunc("/debug/engine", GetEngine).Methods("GET")
+	return r
+}
+
+// ConfigureBook sets the symbol traded by the book and the increments of its prices and
+// quantities. It has to be called before the journal is opened and any order is added
+func ConfigureBook(symbol string, tickSize orderbook.Price, lotSize orderbook.Quantity) {
+	mu.Lock()
+	defer mu.Unlock()
+	ob.Symbol = symbol
+	ob.TickSize = tickSize
+	ob.LotSize = lotSize
+}
+
+// OpenJournal restores the trade history from the journal at path and records new trades to
+// it. /readyz reports ready from then on
+func OpenJournal(path string) (*journal.Journal, error) {
+	j, err := journal.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	store := history.NewStore(history.DefaultCapacity, j)
+	if err := store.Restore(path); err != nil {
+		j.Close()
+		return nil, err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	trades = store
+	tradeJournal = j
+	ob.ResumeTradeIds(store.LastId(ob.Symbol))
+	bars = candles.NewAggregator(candles.DefaultIntervals...)
+	bars.Backfill(store.All(ob.Symbol))
+	ob.RestoreStats(store.All(ob.Symbol))
+	return j, nil
+}
+
+func executeOrder(src audit.Source, order orderbook.Order) createOrderResponse {
+	executed := exchange.AddOrder(src, order)
 	orderResponse := createOrderJson{
 		OrderType: order.OrderType.String(),
 		Side:      order.Side.String(),
 		Price:     float64(order.Price),
 		Qty:       int(order.GetInitialQty()),
 		OrderId:   int(order.GetOrderId()),
+		Account:   order.Account,
 	}
 	return createOrderResponse{
-		Trades: trades,
+		Trades: executed,
 		Order:  orderResponse,
 	}
 }
 
 func GetBids(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
+	mu.Lock()
 	bids := ob.GetOrderInfos().Bids
+	mu.Unlock()
 	json.NewEncoder(w).Encode(bids)
 }
 
 func GetAsks(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
+	mu.Lock()
 	asks := ob.GetOrderInfos().Asks
+	mu.Unlock()
 	json.NewEncoder(w).Encode(asks)
 }
 
 func CreateOrder(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
+	body, err := io.ReadAll(r.Body)
+	src := httpSource(r, body)
 	var req createOrderJson
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err == nil {
+		err = json.Unmarshal(body, &req)
+	}
+	if err != nil {
+		exchange.Refuse(src, audit.CommandNewOrder, nil, err.Error())
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	account, err := requestAccount(r, req.Account)
+	if err != nil {
+		exchange.Refuse(src, audit.CommandNewOrder, nil, err.Error())
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
 	order := orderbook.NewOrder(req.OrderType, req.Side, req.Price, req.Qty)
-	orderResonse := executeOrder(*order)
+	if order == nil {
+		exchange.Refuse(src, audit.CommandNewOrder, nil, errInvalidOrder.Error())
+		http.Error(w, errInvalidOrder.Error(), http.StatusBadRequest)
+		return
+	}
+	order.Account = account
+	if exchange.Draining() {
+		exchange.Refuse(src, audit.CommandNewOrder, order, errDraining.Error())
+		http.Error(w, errDraining.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if exchange.AuditError() != nil {
+		exchange.Refuse(src, audit.CommandNewOrder, order, errAuditLog.Error())
+		http.Error(w, errAuditLog.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if exchange.Blocked(*order) {
+		exchange.Refuse(src, audit.CommandNewOrder, order, errKilled.Error())
+		http.Error(w, errKilled.Error(), http.StatusForbidden)
+		return
+	}
+	orderResonse := executeOrder(src, *order)
 	w.WriteHeader(http.StatusCreated)
 	if err := json.NewEncoder(w).Encode(orderResonse); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
+
+type modifyOrderJson struct {
+	Price float64 `json:"price"`
+	Qty   int     `json:"qty"`
+}
+
+// orderJson describes a resting order with its remaining quantity
+func orderJson(order orderbook.Order) createOrderJson {
+	return createOrderJson{
+		OrderType: order.OrderType.String(),
+		Side:      order.Side.String(),
+		Price:     float64(order.Price),
+		Qty:       int(order.GetRemainingQty()),
+		OrderId:   int(order.GetOrderId()),
+		Account:   order.Account,
+	}
+}
+
+func orderIdVar(r *http.Request) (orderbook.OrderId, error) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		return 0, errors.New("invalid order id")
+	}
+	return orderbook.OrderId(id), nil
+}
+
+// ModifyOrder changes the price and total quantity of a resting order
+func ModifyOrder(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	body, err := io.ReadAll(r.Body)
+	src := httpSource(r, body)
+	var id orderbook.OrderId
+	if err == nil {
+		id, err = orderIdVar(r)
+	}
+	var req modifyOrderJson
+	if err == nil {
+		err = json.Unmarshal(body, &req)
+	}
+	if err != nil {
+		exchange.Refuse(src, audit.CommandModifyOrder, nil, err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if order, ok := exchange.GetOrder(id); ok && !ownsOrder(r, order.Account) {
+		exchange.Refuse(src, audit.CommandModifyOrder, &order, errOtherAccount.Error())
+		http.Error(w, errOtherAccount.Error(), http.StatusForbidden)
+		return
+	}
+	executed, err := exchange.ModifyOrder(src, id, orderbook.Price(req.Price), orderbook.Quantity(req.Qty))
+	if errors.Is(err, errDraining) || errors.Is(err, errAuditLog) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if errors.Is(err, errUnknownOrder) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	response := createOrderResponse{Trades: executed}
+	if order, ok := exchange.GetOrder(id); ok {
+		response.Order = orderJson(order)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// CancelOrder removes a resting order and returns it as it was before the cancel
+func CancelOrder(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	src := httpSource(r, nil)
+	id, err := orderIdVar(r)
+	if err != nil {
+		exchange.Refuse(src, audit.CommandCancelOrder, nil, err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if order, ok := exchange.GetOrder(id); ok && !ownsOrder(r, order.Account) {
+		exchange.Refuse(src, audit.CommandCancelOrder, &order, errOtherAccount.Error())
+		http.Error(w, errOtherAccount.Error(), http.StatusForbidden)
+		return
+	}
+	order, ok := exchange.CancelOrder(src, id)
+	if !ok {
+		http.Error(w, errUnknownOrder.Error(), http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(orderJson(order))
+}
+
+func GetTicker(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mu.Lock()
+	ticker := ob.Ticker()
+	mu.Unlock()
+	json.NewEncoder(w).Encode(ticker)
+}
+
+func GetFees(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	account, err := requestAccount(r, r.URL.Query().Get("account"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if account == "" {
+		json.NewEncoder(w).Encode(ob.Fees.Accounts())
+		return
+	}
+	fees, ok := ob.Fees.Get(account)
+	if !ok {
+		http.Error(w, "unknown account: "+account, http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(fees)
+}
+
+func GetTrades(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	query, err := parseTradeQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if query.Account, err = requestAccount(r, query.Account); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	page := trades.Query(query)
+	hideOtherAccounts(r, page.Trades)
+	json.NewEncoder(w).Encode(page)
+}
+
+func GetCandles(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	params := r.URL.Query()
+	interval := time.Minute
+	if v := params.Get("interval"); v != "" {
+		var err error
+		if interval, err = candles.ParseInterval(v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	from, err := parseTime(params.Get("from"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := parseTime(params.Get("to"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	result, err := bars.Candles(interval, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// SubscribeCandles streams every update to the bars of an interval until cancel is called
+func SubscribeCandles(interval time.Duration) (<-chan candles.Candle, func(), error) {
+	return bars.Subscribe(interval)
+}
+
+func parseTradeQuery(r *http.Request) (history.Query, error) {
+	params := r.URL.Query()
+	query := history.Query{
+		Symbol:  params.Get("symbol"),
+		Account: params.Get("account"),
+	}
+	if query.Symbol == "" {
+		query.Symbol = ob.Symbol
+	}
+	var err error
+	if query.From, err = parseTime(params.Get("from")); err != nil {
+		return query, err
+	}
+	if query.To, err = parseTime(params.Get("to")); err != nil {
+		return query, err
+	}
+	if v := params.Get("order_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return query, err
+		}
+		query.OrderId = orderbook.OrderId(id)
+	}
+	if v := params.Get("cursor"); v != "" {
+		cursor, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return query, err
+		}
+		query.Cursor = orderbook.TradeId(cursor)
+	}
+	if v := params.Get("limit"); v != "" {
+		if query.Limit, err = strconv.Atoi(v); err != nil {
+			return query, err
+		}
+	}
+	return query, nil
+}
+
+// parseTime accepts RFC3339 timestamps or unix milliseconds
+func parseTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
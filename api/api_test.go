@@ -0,0 +1,655 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EliasManj/orderbook/audit"
+	"github.com/EliasManj/orderbook/auth"
+	"github.com/EliasManj/orderbook/history"
+	"github.com/EliasManj/orderbook/orderbook"
+	"github.com/EliasManj/orderbook/ratelimit"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func doRequest(t *testing.T, method string, path string, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	NewRouter().ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return rec
+}
+
+// scrape fetches /metrics and returns the value of every sample keyed by name and labels
+func scrape(t *testing.T) map[string]float64 {
+	rec := doRequest(t, "GET", "/metrics", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	samples := make(map[string]float64)
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") || line == "" {
+			continue
+		}
+		i := strings.LastIndex(line, " ")
+		value, err := strconv.ParseFloat(line[i+1:], 64)
+		require.NoError(t, err, line)
+		samples[line[:i]] = value
+	}
+	return samples
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	before := scrape(t)
+	rec := doRequest(t, "POST", "/order/", `{"order_type":"GoodTilCancelled","side":"Sell","price":5000,"qty":3}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	rec = doRequest(t, "POST", "/order/", `{"order_type":"FillOrKill","side":"Buy","price":5000,"qty":3}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	rec = doRequest(t, "POST", "/order/", `{"order_type":"FillAndKill","side":"Buy","price":1,"qty":3}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	after := scrape(t)
+
+	delta := func(sample string) float64 {
+		return after[sample] - before[sample]
+	}
+	require.Equal(t, 1.0, delta(`orderbook_orders_total{type="GoodTilCancelled",side="Sell",outcome="resting"}`))
+	require.Equal(t, 1.0, delta(`orderbook_orders_total{type="FillOrKill",side="Buy",outcome="filled"}`))
+	require.Equal(t, 1.0, delta(`orderbook_orders_total{type="FillAndKill",side="Buy",outcome="rejected"}`))
+	require.Equal(t, 1.0, delta(`orderbook_trades_total{symbol="DEFAULT"}`))
+	require.Equal(t, 3.0, delta(`orderbook_traded_volume_total{symbol="DEFAULT"}`))
+	require.Equal(t, 3.0, delta(`http_requests_total{route="/order/",method="POST",code="201"}`))
+	require.Equal(t, 3.0, delta(`http_request_duration_seconds_count{route="/order/",method="POST"}`))
+	require.Greater(t, after[`orderbook_match_duration_seconds_count`], 0.0)
+	require.Contains(t, after, `orderbook_depth{symbol="DEFAULT",side="Buy"}`)
+	require.Contains(t, after, `orderbook_levels{symbol="DEFAULT",side="Sell"}`)
+}
+
+func TestModifyAndCancelOrder(t *testing.T) {
+	rec := doRequest(t, "POST", "/order/", `{"order_type":"GoodTilCancelled","side":"Sell","price":9000,"qty":4,"account":"sim"}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var created createOrderResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+	path := "/order/" + strconv.Itoa(created.Order.OrderId)
+
+	rec = doRequest(t, "PUT", path, `{"price":9001,"qty":6}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var modified createOrderResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&modified))
+	require.Equal(t, 9001.0, modified.Order.Price)
+	require.Equal(t, 6, modified.Order.Qty)
+	rec = doRequest(t, "PUT", path, `{"price":9001,"qty":0}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = doRequest(t, "DELETE", path, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var cancelled createOrderJson
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&cancelled))
+	require.Equal(t, 6, cancelled.Qty)
+	require.Equal(t, "sim", cancelled.Account)
+
+	rec = doRequest(t, "DELETE", path, "")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	rec = doRequest(t, "PUT", path, `{"price":9001,"qty":6}`)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	rec = doRequest(t, "DELETE", "/order/abc", "")
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestModifyRejected(t *testing.T) {
+	mu.Lock()
+	ob.TickSize = 0.5
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		ob.TickSize = 0
+		mu.Unlock()
+	})
+	rec := doRequest(t, "POST", "/order/", `{"order_type":"GoodTilCancelled","side":"Sell","price":9100,"qty":10,"account":"sim"}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var created createOrderResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+	id := orderbook.OrderId(created.Order.OrderId)
+	t.Cleanup(func() { exchange.CancelOrder(testSource, id) })
+	before, ok := exchange.GetOrder(id)
+	require.True(t, ok)
+
+	rec = doRequest(t, "PUT", "/order/"+strconv.Itoa(int(id)), `{"price":9100.3,"qty":10}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), orderbook.RejectTickSize)
+	after, ok := exchange.GetOrder(id)
+	require.True(t, ok, "a rejected modify leaves the order resting")
+	require.Equal(t, before, after)
+}
+
+// signedRequest sends a request through a router with authentication, signed by key unless
+// it is empty
+func signedRequest(t *testing.T, keys *auth.KeyStore, key auth.Key, method string, path string, body string) *httptest.ResponseRecorder {
+	r := NewRouter()
+	r.Use(AuthMiddleware(keys))
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, signRequest(key, httptest.NewRequest(method, path, strings.NewReader(body)), body))
+	return rec
+}
+
+// signRequest signs req with key unless the key is empty
+func signRequest(key auth.Key, req *http.Request, body string) *http.Request {
+	if key.Key != "" {
+		timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		nonce := strconv.Itoa(rand.Int())
+		req.Header.Set(auth.HeaderKey, key.Key)
+		req.Header.Set(auth.HeaderTimestamp, timestamp)
+		req.Header.Set(auth.HeaderNonce, nonce)
+		req.Header.Set(auth.HeaderSignature, auth.Sign(key.Secret, timestamp, nonce, req.Method, req.URL.RequestURI(), []byte(body)))
+	}
+	return req
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	viewer := auth.Key{Key: "viewer", Secret: "s1", Account: "viewer", Permission: auth.Read}
+	alice := auth.Key{Key: "alice", Secret: "s2", Account: "alice", Permission: auth.Trade}
+	bob := auth.Key{Key: "bob", Secret: "s3", Account: "bob", Permission: auth.Trade}
+	admin := auth.Key{Key: "admin", Secret: "s4", Account: "ops", Permission: auth.Admin}
+	keys := auth.NewKeyStore(viewer, alice, bob, admin)
+	order := `{"order_type":"GoodTilCancelled","side":"Sell","price":7000,"qty":2}`
+
+	rec := signedRequest(t, keys, auth.Key{}, "GET", "/bids/", "")
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec = signedRequest(t, keys, auth.Key{Key: "alice", Secret: "wrong"}, "GET", "/bids/", "")
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec = signedRequest(t, keys, auth.Key{}, "GET", "/metrics", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = signedRequest(t, keys, viewer, "GET", "/bids/", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = signedRequest(t, keys, viewer, "POST", "/order/", order)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	// Orders are placed for the account of the key
+	rec = signedRequest(t, keys, alice, "POST", "/order/", order)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var created createOrderResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+	require.Equal(t, "alice", created.Order.Account)
+	rec = signedRequest(t, keys, alice, "POST", "/order/", `{"order_type":"GoodTilCancelled","side":"Sell","price":7000,"qty":2,"account":"bob"}`)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	rec = signedRequest(t, keys, admin, "POST", "/order/", `{"order_type":"GoodTilCancelled","side":"Sell","price":7001,"qty":2,"account":"bob"}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var placedForBob createOrderResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&placedForBob))
+	require.Equal(t, "bob", placedForBob.Order.Account)
+
+	// Only the owner or an admin can change an order
+	path := "/order/" + strconv.Itoa(created.Order.OrderId)
+	rec = signedRequest(t, keys, bob, "PUT", path, `{"price":7002,"qty":3}`)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	rec = signedRequest(t, keys, bob, "DELETE", path, "")
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	rec = signedRequest(t, keys, alice, "PUT", path, `{"price":7002,"qty":3}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = signedRequest(t, keys, alice, "DELETE", path, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = signedRequest(t, keys, admin, "DELETE", "/order/"+strconv.Itoa(placedForBob.Order.OrderId), "")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	// Fees of other accounts are only visible to admins
+	rec = signedRequest(t, keys, alice, "GET", "/fees/?account=bob", "")
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	rec = signedRequest(t, keys, admin, "GET", "/fees/", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestTradeVisibility(t *testing.T) {
+	alice := auth.Key{Key: "alice", Secret: "s1", Account: "alice", Permission: auth.Read}
+	bob := auth.Key{Key: "bob", Secret: "s2", Account: "bob", Permission: auth.Read}
+	admin := auth.Key{Key: "admin", Secret: "s3", Account: "ops", Permission: auth.Admin}
+	keys := auth.NewKeyStore(alice, bob, admin)
+	server := httptest.NewServer(NewRouter())
+	defer server.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	sell := placeOrder("alice", "Sell", 65000)
+	placeOrder("bob", "Buy", 65000)
+
+	// The public feed does not tell who traded
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var msg struct {
+			Type string
+			Data json.RawMessage
+		}
+		require.NoError(t, conn.ReadJSON(&msg))
+		if msg.Type != "trade" {
+			continue
+		}
+		var trade orderbook.Trade
+		require.NoError(t, json.Unmarshal(msg.Data, &trade))
+		require.Equal(t, sell, trade.AskTrade.OrderId)
+		require.Equal(t, orderbook.TradeInfo{}, orderbook.TradeInfo{Account: trade.BidTrade.Account, Fee: trade.BidTrade.Fee})
+		require.Equal(t, orderbook.TradeInfo{}, orderbook.TradeInfo{Account: trade.AskTrade.Account, Fee: trade.AskTrade.Fee})
+		break
+	}
+
+	// Keys see the trades of their account, without the account and fee of the other side
+	trades := func(key auth.Key) []orderbook.Trade {
+		rec := signedRequest(t, keys, key, "GET", "/trades?order_id="+strconv.Itoa(int(sell)), "")
+		require.Equal(t, http.StatusOK, rec.Code)
+		var page history.Page
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+		require.Len(t, page.Trades, 1)
+		return page.Trades
+	}
+	seen := trades(alice)[0]
+	require.Equal(t, "alice", seen.AskTrade.Account)
+	require.Empty(t, seen.BidTrade.Account)
+	seen = trades(bob)[0]
+	require.Empty(t, seen.AskTrade.Account)
+	require.Equal(t, "bob", seen.BidTrade.Account)
+	seen = trades(admin)[0]
+	require.Equal(t, "alice", seen.AskTrade.Account)
+	require.Equal(t, "bob", seen.BidTrade.Account)
+	rec := signedRequest(t, keys, alice, "GET", "/trades?account=bob", "")
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	rec = signedRequest(t, keys, admin, "GET", "/trades?account=bob", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	alice := auth.Key{Key: "alice", Secret: "s", Account: "alice", Permission: auth.Trade, Tier: "slow"}
+	keys := auth.NewKeyStore(alice)
+	cfg := ratelimit.DefaultConfig()
+	cfg.IP = ratelimit.Tier{Reads: ratelimit.Rate{PerSecond: 0.5, Burst: 2}}
+	cfg.Tiers["slow"] = ratelimit.Tier{Orders: ratelimit.Rate{PerSecond: 0.1, Burst: 1}}
+	limiter := ratelimit.New(cfg)
+	r := NewRouter()
+	r.Use(AuthMiddleware(keys))
+	r.Use(RateLimitMiddleware(limiter))
+	send := func(key auth.Key, method string, path string, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, signRequest(key, httptest.NewRequest(method, path, strings.NewReader(body)), body))
+		return rec
+	}
+	before := httpThrottled.Value("/order/", "orders", "key")
+
+	order := `{"order_type":"GoodTilCancelled","side":"Sell","price":8000,"qty":1}`
+	require.Equal(t, http.StatusCreated, send(alice, "POST", "/order/", order).Code)
+	rec := send(alice, "POST", "/order/", order)
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	require.Equal(t, "10", rec.Header().Get("Retry-After"))
+	require.Equal(t, before+1, httpThrottled.Value("/order/", "orders", "key"))
+	// Reads of the same key have their own bucket, unlimited in this tier
+	for i := 0; i < 5; i++ {
+		require.Equal(t, http.StatusOK, send(alice, "GET", "/bids/", "").Code)
+	}
+
+	// Without authentication every IP address is limited, routes outside the API are not
+	open := NewRouter()
+	open.Use(RateLimitMiddleware(limiter))
+	codes := []int{}
+	for _, path := range []string{"/bids/", "/asks/", "/bids/", "/metrics"} {
+		rec := httptest.NewRecorder()
+		open.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		codes = append(codes, rec.Code)
+	}
+	require.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests, http.StatusOK}, codes)
+	require.Equal(t, 1.0, httpThrottled.Value("/bids/", "reads", "ip"))
+}
+
+func TestKillSwitch(t *testing.T) {
+	for _, order := range []string{
+		`{"order_type":"GoodTilCancelled","side":"Buy","price":100,"qty":1,"account":"carol"}`,
+		`{"order_type":"GoodTilCancelled","side":"Sell","price":50000,"qty":2,"account":"carol"}`,
+		`{"order_type":"GoodTilCancelled","side":"Buy","price":101,"qty":3,"account":"dave"}`,
+	} {
+		rec := doRequest(t, "POST", "/order/", order)
+		require.Equal(t, http.StatusCreated, rec.Code)
+	}
+
+	rec := doRequest(t, "DELETE", "/orders?account=carol&side=buy", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var cancelled []createOrderJson
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&cancelled))
+	require.Len(t, cancelled, 1)
+	require.Equal(t, "Buy", cancelled[0].Side)
+	rec = doRequest(t, "DELETE", "/orders?side=up", "")
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// The kill switch cancels what is left of carol and refuses her new orders
+	rec = doRequest(t, "POST", "/admin/kill?account=carol", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&cancelled))
+	require.Len(t, cancelled, 1)
+	require.Equal(t, 2, cancelled[0].Qty)
+	t.Cleanup(func() { exchange.Revive(testSource, CancelFilter{Account: "carol"}) })
+	rec = doRequest(t, "POST", "/order/", `{"order_type":"GoodTilCancelled","side":"Buy","price":100,"qty":1,"account":"carol"}`)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	_, ok := exchange.GetOrder(placeOrder("carol", "Sell", 50000))
+	require.False(t, ok)
+	rec = doRequest(t, "GET", "/admin/kill", "")
+	require.JSONEq(t, `[{"account":"carol"}]`, rec.Body.String())
+
+	rec = doRequest(t, "DELETE", "/admin/kill?account=carol", "")
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	rec = doRequest(t, "DELETE", "/admin/kill?account=carol", "")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	rec = doRequest(t, "POST", "/order/", `{"order_type":"GoodTilCancelled","side":"Buy","price":100,"qty":1,"account":"carol"}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	// Keys only mass cancel their own orders, the kill switch is for admins
+	carol := auth.Key{Key: "carol", Secret: "s1", Account: "carol", Permission: auth.Trade}
+	admin := auth.Key{Key: "admin", Secret: "s2", Account: "ops", Permission: auth.Admin}
+	keys := auth.NewKeyStore(carol, admin)
+	rec = signedRequest(t, keys, carol, "DELETE", "/orders?account=dave", "")
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	rec = signedRequest(t, keys, carol, "DELETE", "/orders", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&cancelled))
+	require.Len(t, cancelled, 1)
+	require.Equal(t, "carol", cancelled[0].Account)
+	rec = signedRequest(t, keys, carol, "POST", "/admin/kill", "")
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	rec = signedRequest(t, keys, admin, "DELETE", "/orders?account=dave", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&cancelled))
+	require.Len(t, cancelled, 1)
+}
+
+// placeOrder adds a resting order for account straight to the exchange and returns its id
+// testSource is the audit source of the commands the tests send straight to the exchange
+var testSource = audit.Source{Gateway: "test"}
+
+func placeOrder(account string, side string, price float64) orderbook.OrderId {
+	order := orderbook.NewOrder("GoodTilCancelled", side, price, 1)
+	order.Account = account
+	exchange.AddOrder(testSource, *order)
+	return order.GetOrderId()
+}
+
+func TestCancelOnDisconnect(t *testing.T) {
+	filter := CancelFilter{Account: "erin"}
+	resting := func(id orderbook.OrderId) bool {
+		_, ok := exchange.GetOrder(id)
+		return ok
+	}
+	id := placeOrder("erin", "Sell", 60000)
+
+	// The orders stay while another session is connected, or when the session is back in time
+	first := exchange.CancelOnDisconnect(testSource, filter, 20*time.Millisecond)
+	second := exchange.CancelOnDisconnect(testSource, filter, 20*time.Millisecond)
+	first()
+	first()
+	time.Sleep(50 * time.Millisecond)
+	require.True(t, resting(id))
+	second()
+	third := exchange.CancelOnDisconnect(testSource, filter, 20*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	require.True(t, resting(id))
+
+	third()
+	require.Eventually(t, func() bool { return !resting(id) }, time.Second, 5*time.Millisecond)
+
+	// A feed connection asking for it has the orders of its account cancelled once closed
+	server := httptest.NewServer(NewRouter())
+	defer server.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws?cancel_on_disconnect=10ms&account=erin", nil)
+	require.NoError(t, err)
+	id = placeOrder("erin", "Sell", 60000)
+	time.Sleep(50 * time.Millisecond)
+	require.True(t, resting(id))
+	conn.Close()
+	require.Eventually(t, func() bool { return !resting(id) }, time.Second, 5*time.Millisecond)
+
+	rec := doRequest(t, "GET", "/ws?cancel_on_disconnect=5s", "")
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = doRequest(t, "GET", "/ws?cancel_on_disconnect=soon&account=erin", "")
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestExchangeSubscribe(t *testing.T) {
+	events := make(chan orderbook.Event, 16)
+	subscription := exchange.Subscribe("test", orderbook.SubscriberFunc(func(e orderbook.Event) { events <- e }), orderbook.SubscribeOptions{})
+	id := placeOrder("frank", "Sell", 70000)
+	exchange.CancelOrder(testSource, id)
+	subscription.Close()
+
+	types := []orderbook.EventType{}
+	var last uint64
+	for len(events) > 0 {
+		e := <-events
+		if last > 0 {
+			require.Equal(t, last+1, e.Seq)
+		}
+		last = e.Seq
+		types = append(types, e.Type)
+	}
+	require.Equal(t, []orderbook.EventType{
+		orderbook.EventOrderAccepted, orderbook.EventBookLevelChanged,
+		orderbook.EventOrderCancelled, orderbook.EventBookLevelChanged,
+	}, types)
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	server := httptest.NewServer(NewRouter())
+	defer server.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws?cancel_on_disconnect=0s&account=grace", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	id := placeOrder("grace", "Sell", 80000)
+	t.Cleanup(func() {
+		mu.Lock()
+		exchange.draining = false
+		mu.Unlock()
+		feed = &feedHub{clients: make(map[*feedClient]struct{})}
+		exchange.CancelOrder(testSource, id)
+	})
+
+	rec := doRequest(t, "GET", "/health", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"status":"ok"}`, rec.Body.String())
+
+	// New orders are refused while the resting ones can still be cancelled
+	exchange.Drain()
+	rec = doRequest(t, "GET", "/health", "")
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.JSONEq(t, `{"status":"draining"}`, rec.Body.String())
+	rec = doRequest(t, "POST", "/order/", `{"order_type":"GoodTilCancelled","side":"Buy","price":100,"qty":1}`)
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	// The feeds end with a close frame and new ones are refused
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, CloseFeeds(ctx))
+	for {
+		if _, _, err = conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+	require.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway))
+	// Closing the feed does not cancel the orders of its account while the exchange drains
+	time.Sleep(50 * time.Millisecond)
+	_, ok := exchange.GetOrder(id)
+	require.True(t, ok)
+	refused, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	require.NoError(t, err)
+	defer refused.Close()
+	_, _, err = refused.ReadMessage()
+	require.True(t, websocket.IsCloseError(err, websocket.CloseTryAgainLater))
+
+	// The final snapshot brings the resting orders back in a new book
+	path := filepath.Join(t.TempDir(), "orderbook.snapshot")
+	require.NoError(t, WriteSnapshot(path))
+	require.ErrorContains(t, RestoreSnapshot(path), "book with orders")
+	saved := ob
+	mu.Lock()
+	ob = newOrderBook()
+	mu.Unlock()
+	defer func() {
+		mu.Lock()
+		ob = saved
+		mu.Unlock()
+	}()
+	require.NoError(t, RestoreSnapshot(path))
+	order, ok := exchange.GetOrder(id)
+	require.True(t, ok)
+	require.Equal(t, "grace", order.Account)
+}
+
+func TestProbesAndEngine(t *testing.T) {
+	rec := doRequest(t, "GET", "/healthz", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	savedTrades, savedBars := trades, bars
+	t.Cleanup(func() {
+		mu.Lock()
+		trades, bars, tradeJournal = savedTrades, savedBars, nil
+		mu.Unlock()
+	})
+	rec = doRequest(t, "GET", "/readyz", "")
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.JSONEq(t, `{"status":"replaying journal"}`, rec.Body.String())
+	j, err := OpenJournal(filepath.Join(t.TempDir(), "orderbook.journal"))
+	require.NoError(t, err)
+	defer j.Close()
+	rec = doRequest(t, "GET", "/readyz", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"status":"ready"}`, rec.Body.String())
+
+	placeOrder("henry", "Sell", 90000)
+	placeOrder("henry", "Sell", 90000)
+	placeOrder("henry", "Buy", 1)
+	rec = doRequest(t, "GET", "/debug/engine", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var engine engineJson
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &engine))
+	mu.Lock()
+	stats := ob.Stats()
+	mu.Unlock()
+	require.Equal(t, stats.Orders, engine.Orders)
+	require.Equal(t, stats.BidLevels+stats.AskLevels, engine.BidLevels+engine.AskLevels)
+	require.Equal(t, stats.LastEventSeq, engine.LastEventSeq)
+	require.NotNil(t, engine.LargestLevel)
+	require.Positive(t, engine.MemoryBytes)
+	require.Zero(t, engine.JournalLag)
+	require.True(t, engine.Ready)
+
+	// The profiles are only served once registered, and need the admin permission
+	rec = doRequest(t, "GET", "/debug/pprof/", "")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	r := NewRouter()
+	RegisterPprof(r)
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/pprof/goroutine?debug=1", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, auth.Admin, routePermissions["/debug/pprof/"])
+	require.Equal(t, auth.Admin, routePermissions["/debug/engine"])
+}
+
+func TestAuditLog(t *testing.T) {
+	dir := t.TempDir()
+	l, err := audit.Open(dir, 0)
+	require.NoError(t, err)
+	exchange.SetAuditLog(l)
+	t.Cleanup(func() { exchange.SetAuditLog(nil) })
+
+	rec := doRequest(t, "POST", "/order/", `{"order_type":"GoodTilCancelled","side":"Sell","price":95000,"qty":2,"account":"ivan"}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var created createOrderResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	rec = doRequest(t, "POST", "/order/", `{"order_type":"FillOrKill","side":"Buy","price":1,"qty":2}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	rec = doRequest(t, "POST", "/order/", `{"order_type":"Sometimes","side":"Buy","price":1,"qty":2}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = doRequest(t, "DELETE", "/order/"+strconv.Itoa(created.Order.OrderId), "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, l.Close())
+
+	summary, err := audit.Verify(dir)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), summary.Records)
+	files, err := audit.Files(dir)
+	require.NoError(t, err)
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	records := []audit.Record{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var r audit.Record
+		require.NoError(t, json.Unmarshal([]byte(line), &r))
+		records = append(records, r)
+	}
+
+	require.Equal(t, "http", records[0].Gateway)
+	require.Contains(t, records[0].Request, `POST /order/ {"order_type":"GoodTilCancelled"`)
+	require.Equal(t, audit.CommandNewOrder, records[0].Command)
+	require.Equal(t, audit.Accepted, records[0].Outcome)
+	require.Equal(t, orderbook.OutcomeResting, records[0].Status)
+	require.Equal(t, "ivan", records[0].Order.Account)
+	require.Equal(t, audit.Rejected, records[1].Outcome)
+	require.Equal(t, orderbook.RejectCannotFillUp, records[1].Reason)
+	require.Equal(t, errInvalidOrder.Error(), records[2].Reason)
+	require.Nil(t, records[2].Order)
+	require.Equal(t, audit.CommandCancelOrder, records[3].Command)
+	require.Equal(t, orderbook.OutcomeCancelled, records[3].Status)
+	require.Equal(t, orderbook.OrderId(created.Order.OrderId), records[3].Order.OrderId)
+}
+
+func TestAuditLogUnavailable(t *testing.T) {
+	dir := t.TempDir()
+	l, err := audit.Open(dir, 0)
+	require.NoError(t, err)
+	exchange.SetAuditLog(l)
+	t.Cleanup(func() { exchange.SetAuditLog(nil) })
+
+	placed := []int{}
+	place := func(code int) {
+		rec := doRequest(t, "POST", "/order/", `{"order_type":"GoodTilCancelled","side":"Sell","price":97000,"qty":1,"account":"judy"}`)
+		require.Equal(t, code, rec.Code, rec.Body.String())
+		if code == http.StatusCreated {
+			var created createOrderResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+			placed = append(placed, created.Order.OrderId)
+		}
+	}
+	t.Cleanup(func() {
+		for _, id := range placed {
+			exchange.CancelOrder(testSource, orderbook.OrderId(id))
+		}
+	})
+	place(http.StatusCreated)
+
+	// The log cannot start its next file once its directory is gone
+	require.NoError(t, l.Close())
+	require.NoError(t, os.RemoveAll(dir))
+	place(http.StatusCreated)
+	require.Error(t, exchange.AuditError())
+	rec := doRequest(t, "GET", "/health", "")
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.Contains(t, rec.Body.String(), `"status":"audit log unavailable"`)
+
+	// New orders and modifies are refused, cancels still go through
+	place(http.StatusServiceUnavailable)
+	rec = doRequest(t, "PUT", "/order/"+strconv.Itoa(placed[0]), `{"price":97000,"qty":5}`)
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	rec = doRequest(t, "DELETE", "/order/"+strconv.Itoa(placed[1]), "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	placed = placed[:1]
+
+	// The record of a refusal tries the log again, orders are taken once it is written
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	place(http.StatusServiceUnavailable)
+	require.NoError(t, exchange.AuditError())
+	rec = doRequest(t, "GET", "/health", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	place(http.StatusCreated)
+	seq, _ := l.Seq()
+	require.Equal(t, uint64(3), seq, "only the first order, the last refusal and the last order were recorded")
+	require.NoError(t, l.Close())
+}
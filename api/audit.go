@@ -0,0 +1,86 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/EliasManj/orderbook/audit"
+	"github.com/EliasManj/orderbook/auth"
+	"github.com/EliasManj/orderbook/orderbook"
+)
+
+// errAuditLog refuses new orders and modifies while the audit log cannot be written
+var errAuditLog = errors.New("audit log unavailable")
+
+// SetAuditLog records every command sent to the exchange from then on in l, nil to stop
+func (e *Exchange) SetAuditLog(l *audit.Log) {
+	mu.Lock()
+	defer mu.Unlock()
+	e.auditLog = l
+}
+
+// Refuse records a command a gateway turned down before it reached the exchange, such as
+// a request that does not parse. order is the order of the command, nil when there is none
+func (e *Exchange) Refuse(src audit.Source, command string, order *orderbook.Order, reason string) {
+	mu.Lock()
+	defer mu.Unlock()
+	rec := audit.Record{Command: command}
+	if order != nil {
+		rec.Order = audit.NewOrder(*order)
+	}
+	e.audit(src, rec.Reject(reason))
+}
+
+// AuditError returns the error of the last write to the audit log, nil when it succeeded
+// or there is no audit log. While it is not nil the exchange refuses new orders and
+// modifies from every gateway, still taking cancels, and the record of each refusal tries
+// the log again
+func (e *Exchange) AuditError() error {
+	mu.Lock()
+	defer mu.Unlock()
+	return e.auditError()
+}
+
+// auditError is AuditError for callers holding mu
+func (e *Exchange) auditError() error {
+	if e.auditLog == nil {
+		return nil
+	}
+	return e.auditLog.Err()
+}
+
+// audit writes rec for a command sent by src. Callers must hold mu, which keeps the records
+// in the order the commands ran
+func (e *Exchange) audit(src audit.Source, rec audit.Record) {
+	if e.auditLog == nil {
+		return
+	}
+	rec.Source = src
+	if err := e.auditLog.Write(rec); err != nil {
+		log.Printf("writing audit record: %v", err)
+	}
+}
+
+// orderOutcome completes the record of an order command with what the book made of it
+func orderOutcome(rec audit.Record, executed []orderbook.Trade) audit.Record {
+	outcome, reason := ob.LastOutcome()
+	if outcome == orderbook.OutcomeRejected {
+		return rec.Reject(reason)
+	}
+	return rec.Accept(outcome, executed)
+}
+
+// httpSource identifies the client of an HTTP request for the audit log by its API key, or
+// its address without one, with the request line and body as received
+func httpSource(r *http.Request, body []byte) audit.Source {
+	client := clientIP(r)
+	if key, ok := auth.FromContext(r.Context()); ok {
+		client = "key " + key.Key
+	}
+	request := r.Method + " " + r.URL.RequestURI()
+	if len(body) > 0 {
+		request += " " + string(body)
+	}
+	return audit.Source{Gateway: "http", Client: client, Request: request}
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/EliasManj/orderbook/auth"
+	"github.com/EliasManj/orderbook/orderbook"
+	"github.com/gorilla/mux"
+)
+
+// maxSignedBody bounds the request bodies read to check their signature
+const maxSignedBody = 1 << 20
+
+// routePermissions is the permission each API route needs when authentication is on.
+// Routes missing from it, such as the static files and /metrics, stay open
+var routePermissions = map[string]auth.Permission{
+	"/bids/":      auth.Read,
+	"/asks/":      auth.Read,
+	"/fees/":      auth.Read,
+	"/trades":     auth.Read,
+	"/candles":    auth.Read,
+	"/ticker":     auth.Read,
+	"/ws":         auth.Read,
+	"/order/":     auth.Trade,
+	"/order/{id}": auth.Trade,
+	"/orders":     auth.Trade,
+	"/admin/kill": auth.Admin,
+	// The profiles and the engine internals are for operators only
+	"/debug/engine":        auth.Admin,
+	"/debug/pprof/":        auth.Admin,
+	"/debug/pprof/cmdline": auth.Admin,
+	"/debug/pprof/profile": auth.Admin,
+	"/debug/pprof/symbol":  auth.Admin,
+	"/debug/pprof/trace":   auth.Admin,
+}
+
+// AuthMiddleware only lets through requests signed by a key of keys with the permission
+// their route needs, passing the key on in the request context
+func AuthMiddleware(keys *auth.KeyStore) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			need, ok := routePermissions[routeTemplate(r)]
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxSignedBody))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			key, err := keys.Verify(r, body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			if !key.Permission.Allows(need) {
+				http.Error(w, "API key does not have the "+string(need)+" permission", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(auth.WithKey(r.Context(), key)))
+		})
+	}
+}
+
+var errOtherAccount = errors.New("API key cannot act for another account")
+
+// requestAccount returns the account a request acts for. Without authentication or with an
+// admin key it is the account asked for, otherwise the account of the key
+func requestAccount(r *http.Request, account string) (string, error) {
+	key, ok := auth.FromContext(r.Context())
+	if !ok || key.Permission == auth.Admin {
+		return account, nil
+	}
+	if account != "" && account != key.Account {
+		return "", errOtherAccount
+	}
+	return key.Account, nil
+}
+
+// hideOtherAccounts removes from trades the accounts and fees of the orders the key of a
+// request does not own, admin keys seeing everything
+func hideOtherAccounts(r *http.Request, trades []orderbook.Trade) {
+	key, ok := auth.FromContext(r.Context())
+	if !ok || key.Permission == auth.Admin {
+		return
+	}
+	for i, trade := range trades {
+		trades[i] = trade.VisibleTo(key.Account)
+	}
+}
+
+// ownsOrder reports whether the key of a request may cancel or modify an order of account
+func ownsOrder(r *http.Request, account string) bool {
+	key, ok := auth.FromContext(r.Context())
+	return !ok || key.Permission == auth.Admin || key.Account == account
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+
+	"github.com/EliasManj/orderbook/journal"
+	"github.com/gorilla/mux"
+)
+
+// tradeJournal is the journal opened by OpenJournal, nil until then
+var tradeJournal *journal.Journal
+
+type levelJson struct {
+	Side     string  `json:"side"`
+	Price    float64 `json:"price"`
+	Quantity int     `json:"quantity"`
+	Orders   int     `json:"orders"`
+}
+
+type engineJson struct {
+	Symbol       string     `json:"symbol"`
+	BidLevels    int        `json:"bid_levels"`
+	AskLevels    int        `json:"ask_levels"`
+	BidOrders    int        `json:"bid_orders"`
+	AskOrders    int        `json:"ask_orders"`
+	Orders       int        `json:"orders"`
+	LargestLevel *levelJson `json:"largest_level"`
+	MemoryBytes  int        `json:"memory_bytes"`
+	LastOrderSeq uint64     `json:"last_order_seq"`
+	LastEventSeq uint64     `json:"last_event_seq"`
+	LastTradeId  int64      `json:"last_trade_id"`
+	// JournalSeq is the last entry written to the journal and JournalLag the entries not yet
+	// synced to disk
+	JournalSeq uint64 `json:"journal_seq"`
+	JournalLag uint64 `json:"journal_lag"`
+	Goroutines int    `json:"goroutines"`
+	HeapBytes  uint64 `json:"heap_bytes"`
+	Ready      bool   `json:"ready"`
+	Draining   bool   `json:"draining"`
+}
+
+// GetHealthz reports that the process is alive and serving, whatever the state of the book
+func GetHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// GetReadyz reports whether the server takes orders: once the journal is replayed and until
+// it starts shutting down, with 503 otherwise
+func GetReadyz(w http.ResponseWriter, r *http.Request) {
+	mu.Lock()
+	status := "ready"
+	switch {
+	case tradeJournal == nil:
+		status = "replaying journal"
+	case exchange.draining:
+		status = "draining"
+	}
+	mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	if status != "ready" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": status})
+}
+
+// GetEngine returns the size of the book, its sequence numbers and how far the journal is
+// from being on disk, along with the memory of the process
+func GetEngine(w http.ResponseWriter, r *http.Request) {
+	mu.Lock()
+	stats := ob.Stats()
+	result := engineJson{
+		Symbol:       ob.Symbol,
+		BidLevels:    stats.BidLevels,
+		AskLevels:    stats.AskLevels,
+		BidOrders:    stats.BidOrders,
+		AskOrders:    stats.AskOrders,
+		Orders:       stats.Orders,
+		MemoryBytes:  stats.MemoryBytes,
+		LastOrderSeq: stats.LastOrderSeq,
+		LastEventSeq: stats.LastEventSeq,
+		LastTradeId:  int64(stats.LastTradeId),
+		Ready:        tradeJournal != nil && !exchange.draining,
+		Draining:     exchange.draining,
+	}
+	if tradeJournal != nil {
+		result.JournalSeq = tradeJournal.Seq()
+		result.JournalLag = tradeJournal.Lag()
+	}
+	mu.Unlock()
+	if level := stats.LargestLevel; level != nil {
+		result.LargestLevel = &levelJson{Side: level.Side.String(), Price: float64(level.Price), Quantity: int(level.Quantity), Orders: level.Orders}
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	result.HeapBytes = mem.HeapAlloc
+	result.Goroutines = runtime.NumGoroutine()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// RegisterPprof serves the runtime profiles under /debug/pprof/ on r. It has to be called
+// before a catch-all route such as the static files
+func RegisterPprof(r *mux.Router) {
+	r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	r.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	r.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	r.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	r.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index)
+}
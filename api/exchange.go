@@ -0,0 +1,200 @@
+package api
+
+import (
+	"errors"
+	"log"
+
+	"github.com/EliasManj/orderbook/audit"
+	"github.com/EliasManj/orderbook/orderbook"
+)
+
+// Exchange gives other order entry gateways access to the book shared with the HTTP API.
+// Every command records its trades in the history, candles and market data feed
+type Exchange struct {
+	listeners      []func([]orderbook.Trade)
+	depthListeners []func(orderbook.OrderBookLevelInfos)
+	// kills are the kill switches in force
+	kills       []CancelFilter
+	disconnects disconnects
+	draining    bool
+	auditLog    *audit.Log
+}
+
+var exchange = &Exchange{}
+
+var (
+	errUnknownOrder = errors.New("unknown order")
+	errInvalidOrder = errors.New("invalid order type or side")
+)
+
+// DefaultExchange returns the exchange backing the HTTP API
+func DefaultExchange() *Exchange {
+	return exchange
+}
+
+// Symbol returns the symbol traded on the exchange
+func (e *Exchange) Symbol() string {
+	mu.Lock()
+	defer mu.Unlock()
+	return ob.Symbol
+}
+
+// AddOrder matches and rests an order sent by src. An order refused by a kill switch, while
+// draining or while the audit log cannot be written never reaches the book, it neither
+// trades nor rests
+func (e *Exchange) AddOrder(src audit.Source, order orderbook.Order) []orderbook.Trade {
+	mu.Lock()
+	defer mu.Unlock()
+	rec := audit.Record{Command: audit.CommandNewOrder, Order: audit.NewOrder(order)}
+	if err := e.refusal(order); err != nil {
+		e.audit(src, rec.Reject(err.Error()))
+		return nil
+	}
+	executed := ob.AddOrder(order)
+	e.record(executed)
+	e.audit(src, orderOutcome(rec, executed))
+	return executed
+}
+
+// refusal returns why order cannot reach the book, nil when it can. Callers must hold mu
+func (e *Exchange) refusal(order orderbook.Order) error {
+	if e.draining {
+		return errDraining
+	}
+	if e.auditError() != nil {
+		return errAuditLog
+	}
+	if e.blocked(order) {
+		return errKilled
+	}
+	return nil
+}
+
+// CancelOrder cancels a resting order for src, returning it as it was before the cancel
+func (e *Exchange) CancelOrder(src audit.Source, orderId orderbook.OrderId) (orderbook.Order, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	rec := audit.Record{Command: audit.CommandCancelOrder}
+	order, ok := ob.GetOrder(orderId)
+	if !ok {
+		e.audit(src, rec.Reject(errUnknownOrder.Error()))
+		return order, false
+	}
+	ob.CancelOrder(orderId)
+	e.record(nil)
+	rec.Order = audit.NewOrder(order)
+	e.audit(src, rec.Accept(orderbook.OutcomeCancelled, nil))
+	return order, true
+}
+
+// ModifyOrder changes the price and total quantity of a resting order for src. A change
+// the book rejects returns an orderbook.Rejection and leaves the order as it was
+func (e *Exchange) ModifyOrder(src audit.Source, orderId orderbook.OrderId, price orderbook.Price, qty orderbook.Quantity) ([]orderbook.Trade, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	rec := audit.Record{Command: audit.CommandModifyOrder}
+	executed, err := e.modifyOrder(&rec, orderId, price, qty)
+	if err != nil {
+		e.audit(src, rec.Reject(err.Error()))
+		return nil, err
+	}
+	e.audit(src, orderOutcome(rec, executed))
+	return executed, nil
+}
+
+// modifyOrder is ModifyOrder for callers holding mu, setting the order of rec once known
+func (e *Exchange) modifyOrder(rec *audit.Record, orderId orderbook.OrderId, price orderbook.Price, qty orderbook.Quantity) ([]orderbook.Trade, error) {
+	if e.draining {
+		return nil, errDraining
+	}
+	if e.auditError() != nil {
+		return nil, errAuditLog
+	}
+	order, ok := ob.GetOrder(orderId)
+	if !ok {
+		return nil, errUnknownOrder
+	}
+	rec.Order = audit.NewOrder(order)
+	if err := order.Amend(price, qty); err != nil {
+		return nil, err
+	}
+	rec.Order = audit.NewOrder(order)
+	if reason := ob.Check(order); reason != "" {
+		return nil, orderbook.Rejection(reason)
+	}
+	executed := ob.ModifyOrder(order)
+	e.record(executed)
+	if outcome, reason := ob.LastOutcome(); outcome == orderbook.OutcomeRejected {
+		return executed, orderbook.Rejection(reason)
+	}
+	return executed, nil
+}
+
+func (e *Exchange) GetOrder(orderId orderbook.OrderId) (orderbook.Order, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	return ob.GetOrder(orderId)
+}
+
+// Depth returns the quantity at each price, best first, limited to levels per side when positive
+func (e *Exchange) Depth(levels int) orderbook.OrderBookLevelInfos {
+	mu.Lock()
+	defer mu.Unlock()
+	return ob.Depth(levels)
+}
+
+// OnTrades registers fn to be called with the trades of every command.
+// It runs while the book is locked so it must not call back into the exchange
+func (e *Exchange) OnTrades(fn func([]orderbook.Trade)) {
+	mu.Lock()
+	defer mu.Unlock()
+	e.listeners = append(e.listeners, fn)
+}
+
+// OnDepth registers fn to be called with the full depth of the book after every command.
+// It runs while the book is locked so it must not call back into the exchange
+func (e *Exchange) OnDepth(fn func(orderbook.OrderBookLevelInfos)) {
+	mu.Lock()
+	defer mu.Unlock()
+	e.depthListeners = append(e.depthListeners, fn)
+}
+
+// OnBookChange registers l to be notified of every change to the resting orders of the book,
+// after telling it of the orders resting already. It runs while the book is locked so it
+// must not call back into the exchange
+func (e *Exchange) OnBookChange(l orderbook.BookListener) {
+	mu.Lock()
+	defer mu.Unlock()
+	ob.AddListener(l)
+}
+
+// Subscribe registers sub for the events of the book from the next command on, see
+// orderbook.EventBus for the delivery guarantees
+func (e *Exchange) Subscribe(name string, sub orderbook.Subscriber, opts orderbook.SubscribeOptions) *orderbook.Subscription {
+	mu.Lock()
+	defer mu.Unlock()
+	return ob.Events.Subscribe(name, sub, opts)
+}
+
+// record stores and publishes the trades of a command. Callers must hold mu
+func (e *Exchange) record(executed []orderbook.Trade) {
+	if err := trades.Add(ob.Symbol, executed); err != nil {
+		log.Printf("recording trades: %v", err)
+	}
+	for _, trade := range executed {
+		bars.AddTrade(trade)
+	}
+	publishMarketData(executed)
+	if len(e.depthListeners) > 0 {
+		depth := ob.Depth(0)
+		for _, fn := range e.depthListeners {
+			fn(depth)
+		}
+	}
+	if len(executed) == 0 {
+		return
+	}
+	for _, fn := range e.listeners {
+		fn(executed)
+	}
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/EliasManj/orderbook/orderbook"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// feedBuffer is the number of messages a client can fall behind before it is disconnected
+	feedBuffer = 256
+	writeWait  = 10 * time.Second
+	pingPeriod = 30 * time.Second
+)
+
+type feedMessage struct {
+	Type string `json:"type"`
+	Data any    `json:"data"`
+}
+
+type feedClient struct {
+	conn *websocket.Conn
+	send chan feedMessage
+	// closeMsg is the payload of the close frame sent once send is closed
+	closeMsg []byte
+}
+
+// feedHub fans market data messages out to every connected WebSocket client
+type feedHub struct {
+	mu      sync.Mutex
+	clients map[*feedClient]struct{}
+	closed  bool
+	// pumps counts the clients still writing
+	pumps sync.WaitGroup
+}
+
+var upgrader = websocket.Upgrader{}
+var feed = &feedHub{clients: make(map[*feedClient]struct{})}
+
+// register adds a client, unless the hub is closed
+func (h *feedHub) register(c *feedClient) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return false
+	}
+	h.clients[c] = struct{}{}
+	h.pumps.Add(1)
+	return true
+}
+
+// close ends every client with a close frame carrying msg and refuses new clients
+func (h *feedHub) close(msg []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for c := range h.clients {
+		c.closeMsg = msg
+		delete(h.clients, c)
+		close(c.send)
+	}
+}
+
+func (h *feedHub) unregister(c *feedClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[c]; ok {
+		delete(h.clients, c)
+		close(c.send)
+	}
+}
+
+// broadcast queues a message for every client, dropping clients that are too slow to keep up
+func (h *feedHub) broadcast(msgType string, data any) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	msg := feedMessage{Type: msgType, Data: data}
+	for c := range h.clients {
+		select {
+		case c.send <- msg:
+		default:
+			delete(h.clients, c)
+			close(c.send)
+		}
+	}
+}
+
+// publishMarketData sends the trades of an order, without their accounts and fees, followed
+// by the resulting depth and ticker. Callers must hold mu
+func publishMarketData(executed []orderbook.Trade) {
+	for _, trade := range executed {
+		feed.broadcast("trade", trade.VisibleTo(""))
+	}
+	feed.broadcast("depth", ob.GetOrderInfos())
+	feed.broadcast("ticker", ob.Ticker())
+}
+
+// ServeFeed upgrades the request to a WebSocket streaming trade, depth and ticker messages.
+// With cancel_on_disconnect set to a grace period, such as 5s, the resting orders of the
+// account are cancelled once the connection has been gone for that long
+func ServeFeed(w http.ResponseWriter, r *http.Request) {
+	disconnected := func() {}
+	if v := r.URL.Query().Get("cancel_on_disconnect"); v != "" {
+		grace, err := time.ParseDuration(v)
+		if err != nil || grace < 0 {
+			http.Error(w, "invalid cancel_on_disconnect grace period", http.StatusBadRequest)
+			return
+		}
+		account, err := requestAccount(r, r.URL.Query().Get("account"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if account == "" {
+			http.Error(w, "cancel_on_disconnect needs an account", http.StatusBadRequest)
+			return
+		}
+		disconnected = exchange.CancelOnDisconnect(httpSource(r, nil), CancelFilter{Account: account}, grace)
+	}
+	defer disconnected()
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("feed upgrade: %v", err)
+		return
+	}
+	client := &feedClient{conn: conn, send: make(chan feedMessage, feedBuffer)}
+	mu.Lock()
+	client.send <- feedMessage{Type: "depth", Data: ob.GetOrderInfos()}
+	client.send <- feedMessage{Type: "ticker", Data: ob.Ticker()}
+	registered := feed.register(client)
+	mu.Unlock()
+	if !registered {
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, errDraining.Error()))
+		conn.Close()
+		return
+	}
+
+	go client.writePump()
+	client.readPump()
+}
+
+// readPump discards client messages and unregisters the client once the connection closes
+func (c *feedClient) readPump() {
+	defer func() {
+		feed.unregister(c)
+		c.conn.Close()
+	}()
+	c.conn.SetReadDeadline(time.Now().Add(pingPeriod * 2))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pingPeriod * 2))
+	})
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func (c *feedClient) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+		feed.pumps.Done()
+	}()
+	for {
+		select {
+		case msg, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, c.closeMsg)
+				return
+			}
+			if err := c.conn.WriteJSON(msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
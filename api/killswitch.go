@@ -0,0 +1,237 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/EliasManj/orderbook/audit"
+	"github.com/EliasManj/orderbook/orderbook"
+)
+
+// CancelFilter selects resting orders by account, symbol and side. Empty fields match
+// every order, so the zero filter matches the whole book
+type CancelFilter struct {
+	Account string `json:"account,omitempty"`
+	Symbol  string `json:"symbol,omitempty"`
+	Side    string `json:"side,omitempty"`
+}
+
+// parseCancelFilter reads a filter from the account, symbol and side query parameters
+func parseCancelFilter(params url.Values) (CancelFilter, error) {
+	f := CancelFilter{
+		Account: params.Get("account"),
+		Symbol:  params.Get("symbol"),
+		Side:    params.Get("side"),
+	}
+	if f.Side != "" {
+		side, err := orderbook.StringToOrderSide(f.Side)
+		if err != nil {
+			return f, err
+		}
+		f.Side = side.String()
+	}
+	return f, nil
+}
+
+func (f CancelFilter) matches(symbol string, order orderbook.Order) bool {
+	return (f.Account == "" || f.Account == order.Account) &&
+		(f.Symbol == "" || f.Symbol == symbol) &&
+		(f.Side == "" || f.Side == order.Side.String())
+}
+
+// CancelOrders cancels every resting order matching f for src and returns them as they were
+// before the cancel
+func (e *Exchange) CancelOrders(src audit.Source, f CancelFilter) []orderbook.Order {
+	mu.Lock()
+	defer mu.Unlock()
+	cancelled := e.cancelOrders(f)
+	e.audit(src, audit.Record{Command: audit.CommandMassCancel, Cancelled: audit.Orders(cancelled)}.Accept("", nil))
+	return cancelled
+}
+
+// cancelOrders is CancelOrders for callers holding mu
+func (e *Exchange) cancelOrders(f CancelFilter) []orderbook.Order {
+	cancelled := ob.CancelOrders(func(order orderbook.Order) bool { return f.matches(ob.Symbol, order) })
+	if len(cancelled) > 0 {
+		e.record(nil)
+	}
+	return cancelled
+}
+
+// Kill cancels every resting order matching f and refuses new orders matching it until
+// Revive is called with the same filter
+func (e *Exchange) Kill(src audit.Source, f CancelFilter) []orderbook.Order {
+	mu.Lock()
+	defer mu.Unlock()
+	if !e.killed(f) {
+		e.kills = append(e.kills, f)
+	}
+	cancelled := e.cancelOrders(f)
+	e.audit(src, audit.Record{Command: audit.CommandKill, Cancelled: audit.Orders(cancelled)}.Accept("", nil))
+	return cancelled
+}
+
+// Revive lifts the kill switch set with f, reporting whether there was one
+func (e *Exchange) Revive(src audit.Source, f CancelFilter) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	rec := audit.Record{Command: audit.CommandRevive}
+	for i, kill := range e.kills {
+		if kill == f {
+			e.kills = append(e.kills[:i], e.kills[i+1:]...)
+			e.audit(src, rec.Accept("", nil))
+			return true
+		}
+	}
+	e.audit(src, rec.Reject(errNoKillSwitch.Error()))
+	return false
+}
+
+// KillSwitches returns the filters of the kill switches in force
+func (e *Exchange) KillSwitches() []CancelFilter {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]CancelFilter{}, e.kills...)
+}
+
+// Blocked reports whether a kill switch refuses order
+func (e *Exchange) Blocked(order orderbook.Order) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return e.blocked(order)
+}
+
+// blocked is Blocked for callers holding mu
+func (e *Exchange) blocked(order orderbook.Order) bool {
+	for _, kill := range e.kills {
+		if kill.matches(ob.Symbol, order) {
+			return true
+		}
+	}
+	return false
+}
+
+// killed reports whether a kill switch is set with f. Callers must hold mu
+func (e *Exchange) killed(f CancelFilter) bool {
+	for _, kill := range e.kills {
+		if kill == f {
+			return true
+		}
+	}
+	return false
+}
+
+// disconnects tracks the streaming sessions that asked for their orders to be cancelled
+// when they go away, by the filter they cancel
+type disconnects struct {
+	mu       sync.Mutex
+	sessions map[CancelFilter]int
+	timers   map[CancelFilter]*time.Timer
+}
+
+// CancelOnDisconnect registers a streaming session of src that wants the orders matching f
+// cancelled when it goes away. The session calls the returned function when it disconnects,
+// the orders are cancelled after grace unless another session with the same filter is
+// connected by then. Once the exchange drains they are kept for the final snapshot instead
+func (e *Exchange) CancelOnDisconnect(src audit.Source, f CancelFilter, grace time.Duration) (disconnected func()) {
+	d := &e.disconnects
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.sessions == nil {
+		d.sessions = make(map[CancelFilter]int)
+		d.timers = make(map[CancelFilter]*time.Timer)
+	}
+	d.sessions[f]++
+	if timer, ok := d.timers[f]; ok {
+		timer.Stop()
+		delete(d.timers, f)
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			if d.sessions[f]--; d.sessions[f] > 0 {
+				return
+			}
+			delete(d.sessions, f)
+			var timer *time.Timer
+			timer = time.AfterFunc(grace, func() {
+				d.mu.Lock()
+				if d.timers[f] != timer {
+					d.mu.Unlock()
+					return
+				}
+				delete(d.timers, f)
+				d.mu.Unlock()
+				mu.Lock()
+				defer mu.Unlock()
+				if e.draining {
+					return
+				}
+				cancelled := e.cancelOrders(f)
+				e.audit(src, audit.Record{Command: audit.CommandCancelOnDisconnect, Cancelled: audit.Orders(cancelled)}.Accept("", nil))
+			})
+			d.timers[f] = timer
+		})
+	}
+}
+
+var (
+	errKilled       = errors.New("orders blocked by kill switch")
+	errNoKillSwitch = errors.New("no such kill switch")
+)
+
+// CancelOrders cancels the resting orders selected by the account, symbol and side query
+// parameters and returns them. Keys without the admin permission only cancel their own orders
+func CancelOrders(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	src := httpSource(r, nil)
+	f, err := parseCancelFilter(r.URL.Query())
+	if err != nil {
+		exchange.Refuse(src, audit.CommandMassCancel, nil, err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if f.Account, err = requestAccount(r, f.Account); err != nil {
+		exchange.Refuse(src, audit.CommandMassCancel, nil, err.Error())
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	json.NewEncoder(w).Encode(ordersJson(exchange.CancelOrders(src, f)))
+}
+
+// KillSwitch sets a kill switch on POST, lifts it on DELETE and lists them on GET. The
+// switch is selected by the account, symbol and side query parameters
+func KillSwitch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	f, err := parseCancelFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodPost:
+		json.NewEncoder(w).Encode(ordersJson(exchange.Kill(httpSource(r, nil), f)))
+	case http.MethodDelete:
+		if !exchange.Revive(httpSource(r, nil), f) {
+			http.Error(w, errNoKillSwitch.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		json.NewEncoder(w).Encode(exchange.KillSwitches())
+	}
+}
+
+func ordersJson(orders []orderbook.Order) []createOrderJson {
+	result := make([]createOrderJson, 0, len(orders))
+	for _, order := range orders {
+		result = append(result, orderJson(order))
+	}
+	return result
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/EliasManj/orderbook/auth"
+	"github.com/EliasManj/orderbook/metrics"
+	"github.com/EliasManj/orderbook/ratelimit"
+	"github.com/gorilla/mux"
+)
+
+var httpThrottled = metrics.NewCounterVec("http_throttled_total", "HTTP requests refused by the rate limits, by route, class and client kind.", "route", "class", "by")
+
+// RateLimitMiddleware throttles the API routes with a token bucket per API key, or per IP
+// address for requests without a key, one for order entry and one for reads. It has to run
+// after AuthMiddleware to see the keys
+func RateLimitMiddleware(limiter *ratelimit.Limiter) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := routeTemplate(r)
+			need, ok := routePermissions[route]
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			class := ratelimit.Reads
+			if need == auth.Trade {
+				class = ratelimit.Orders
+			}
+			by, client, tier := "ip", clientIP(r), limiter.Config.IP
+			if key, ok := auth.FromContext(r.Context()); ok {
+				by, client, tier = "key", "key "+key.Key, limiter.Tier(key.Tier)
+			}
+			if allowed, wait := limiter.Allow(client, tier, class); !allowed {
+				httpThrottled.Inc(route, string(class), by)
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP returns the address a request came from, without the port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "ip " + r.RemoteAddr
+	}
+	return "ip " + host
+}
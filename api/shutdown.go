@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/EliasManj/orderbook/orderbook"
+	"github.com/gorilla/websocket"
+)
+
+var errDraining = errors.New("server is shutting down")
+
+// Drain stops the exchange from taking new orders and modifies, from every gateway, once the
+// command in progress is over. Cancels are still accepted
+func (e *Exchange) Drain() {
+	mu.Lock()
+	defer mu.Unlock()
+	e.draining = true
+}
+
+// Draining reports whether Drain was called
+func (e *Exchange) Draining() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return e.draining
+}
+
+// GetHealth reports whether the server takes orders, with 503 once it is shutting down or
+// while the audit log cannot be written
+func GetHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	status := map[string]string{"status": "ok"}
+	if exchange.Draining() {
+		status["status"] = "draining"
+	} else if err := exchange.AuditError(); err != nil {
+		status["status"] = "audit log unavailable"
+		status["error"] = err.Error()
+	}
+	if status["status"] != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
+// CloseFeeds ends every WebSocket feed with a going away close frame and refuses new ones,
+// waiting until the close frames are written or ctx is done
+func CloseFeeds(ctx context.Context) error {
+	feed.close(websocket.FormatCloseMessage(websocket.CloseGoingAway, errDraining.Error()))
+	done := make(chan struct{})
+	go func() {
+		feed.pumps.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// WriteSnapshot saves the resting orders and the fee ledger of the book to path, replacing the file at once so
+// that a crash while writing leaves the previous snapshot in place
+func WriteSnapshot(path string) error {
+	mu.Lock()
+	snapshot := ob.Snapshot()
+	mu.Unlock()
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// RestoreSnapshot puts the orders and fees saved by WriteSnapshot back into the book. It has to be
+// called after OpenJournal and before any order is added
+func RestoreSnapshot(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var snapshot orderbook.Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return ob.Restore(snapshot)
+}
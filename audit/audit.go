@@ -0,0 +1,119 @@
+// Package audit writes the audit trail of the exchange, separate from the journal: one JSON
+// line for every command with who sent it, the request as it was received, the order it
+// became, the outcome and the trades it produced.
+//
+// Lines are hash chained. The hash of a line covers the hash of the line before it and the
+// line itself, so a line changed, removed or moved breaks the chain from there on, which
+// Verify reports. The log is split in files rotated by size and by UTC day, the chain
+// running on from one file to the next.
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/EliasManj/orderbook/orderbook"
+)
+
+// Commands recorded in the audit log
+const (
+	CommandNewOrder           = "new_order"
+	CommandModifyOrder        = "modify_order"
+	CommandCancelOrder        = "cancel_order"
+	CommandMassCancel         = "mass_cancel"
+	CommandCancelOnDisconnect = "cancel_on_disconnect"
+	CommandKill               = "kill"
+	CommandRevive             = "revive"
+)
+
+// Outcomes of a command. The status of an accepted order command is one of the outcome
+// constants of package orderbook
+const (
+	Accepted = "accepted"
+	Rejected = "rejected"
+)
+
+// Source is who sent a command and how: the gateway, the identity of the client on it, such
+// as an API key or a FIX session, and the request as received
+type Source struct {
+	Gateway string `json:"gateway"`
+	Client  string `json:"client"`
+	Request string `json:"request"`
+}
+
+// Record is a line of the audit log. Seq, Time, Prev and Hash are set by Log.Write
+type Record struct {
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	Source
+	Command string `json:"command"`
+	// Order is the order of the command once normalized, as the book sees it
+	Order   *Order            `json:"order,omitempty"`
+	Outcome string            `json:"outcome"`
+	Reason  string            `json:"reason,omitempty"`
+	Status  string            `json:"status,omitempty"`
+	Trades  []orderbook.Trade `json:"trades,omitempty"`
+	// Cancelled holds the orders of a mass cancel
+	Cancelled []Order `json:"cancelled,omitempty"`
+	// Prev is the hash of the line before, empty for the first line of the log
+	Prev string `json:"prev"`
+	Hash string `json:"hash,omitempty"`
+}
+
+// Order is an order as recorded in the audit log
+type Order struct {
+	OrderId      orderbook.OrderId  `json:"order_id"`
+	OrderType    string             `json:"order_type"`
+	Side         string             `json:"side"`
+	Price        orderbook.Price    `json:"price"`
+	Qty          orderbook.Quantity `json:"qty"`
+	RemainingQty orderbook.Quantity `json:"remaining_qty"`
+	Account      string             `json:"account,omitempty"`
+}
+
+// NewOrder returns the audit form of an order
+func NewOrder(order orderbook.Order) *Order {
+	return &Order{
+		OrderId:      order.GetOrderId(),
+		OrderType:    order.OrderType.String(),
+		Side:         order.Side.String(),
+		Price:        order.Price,
+		Qty:          order.GetInitialQty(),
+		RemainingQty: order.GetRemainingQty(),
+		Account:      order.Account,
+	}
+}
+
+// Orders returns the audit form of orders
+func Orders(orders []orderbook.Order) []Order {
+	result := make([]Order, 0, len(orders))
+	for _, order := range orders {
+		result = append(result, *NewOrder(order))
+	}
+	return result
+}
+
+// Reject marks the record rejected for reason
+func (r Record) Reject(reason string) Record {
+	r.Outcome = Rejected
+	r.Reason = reason
+	return r
+}
+
+// Accept marks the record accepted with the status of its order and the trades it produced
+func (r Record) Accept(status string, trades []orderbook.Trade) Record {
+	r.Outcome = Accepted
+	r.Status = status
+	r.Trades = trades
+	return r
+}
+
+// chainHash is the hash of a line encoded without its hash, following the line hashed prev
+func chainHash(prev string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(prev))
+	h.Write([]byte{'\n'})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
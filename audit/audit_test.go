@@ -0,0 +1,148 @@
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/EliasManj/orderbook/orderbook"
+	"github.com/stretchr/testify/require"
+)
+
+func writeRecords(t *testing.T, l *Log, n int) {
+	for i := 0; i < n; i++ {
+		order := orderbook.NewOrderWithId(orderbook.OrderId(i+1), "GoodTilCancelled", "Buy", 100, 5)
+		order.Account = "alice"
+		rec := Record{
+			Source:  Source{Gateway: "http", Client: "key k1", Request: `POST /order/ {"side":"Buy"}`},
+			Command: CommandNewOrder,
+			Order:   NewOrder(*order),
+		}
+		require.NoError(t, l.Write(rec.Accept(orderbook.OutcomeResting, nil)))
+	}
+}
+
+func TestLogWriteAndVerify(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 10, 19, 23, 59, 0, 0, time.UTC)
+	l, err := Open(dir, 1024)
+	require.NoError(t, err)
+	l.Clock = func() time.Time { return now }
+	writeRecords(t, l, 6)
+	now = now.Add(2 * time.Minute)
+	writeRecords(t, l, 2)
+	require.NoError(t, l.Close())
+
+	// The files rotate by size within a day and again when the day changes
+	files, err := Files(dir)
+	require.NoError(t, err)
+	require.Greater(t, len(files), 2)
+	require.Contains(t, files[len(files)-1], "audit-2026-10-20-000000000007.jsonl")
+
+	// Reopening carries the chain on
+	l, err = Open(dir, 1024)
+	require.NoError(t, err)
+	l.Clock = func() time.Time { return now }
+	writeRecords(t, l, 1)
+	seq, hash := l.Seq()
+	require.Equal(t, uint64(9), seq)
+	require.NoError(t, l.Close())
+
+	summary, err := Verify(dir)
+	require.NoError(t, err)
+	require.Equal(t, uint64(9), summary.Records)
+	files, err = Files(dir)
+	require.NoError(t, err)
+	require.Equal(t, len(files), summary.Files)
+	require.Equal(t, hash, summary.LastHash)
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	for name, tamper := range map[string]func(data []byte) []byte{
+		"changed": func(data []byte) []byte {
+			return bytes.Replace(data, []byte(`"account":"alice"`), []byte(`"account":"mallory"`), 1)
+		},
+		"removed": func(data []byte) []byte {
+			lines := bytes.SplitAfter(data, []byte("\n"))
+			return bytes.Join(append(lines[:1], lines[2:]...), nil)
+		},
+		"swapped": func(data []byte) []byte {
+			lines := bytes.SplitAfter(data, []byte("\n"))
+			lines[0], lines[1] = lines[1], lines[0]
+			return bytes.Join(lines, nil)
+		},
+		"truncated": func(data []byte) []byte {
+			return data[:len(data)-10]
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			l, err := Open(dir, 0)
+			require.NoError(t, err)
+			writeRecords(t, l, 3)
+			require.NoError(t, l.Close())
+			files, err := Files(dir)
+			require.NoError(t, err)
+			require.Len(t, files, 1)
+			data, err := os.ReadFile(files[0])
+			require.NoError(t, err)
+			require.NoError(t, os.WriteFile(files[0], tamper(data), 0644))
+
+			_, err = Verify(dir)
+			require.ErrorContains(t, err, files[0])
+		})
+	}
+}
+
+// tornFile writes half of the next line it is given to its file, then fails
+type tornFile struct {
+	logFile
+}
+
+func (f tornFile) Write(b []byte) (int, error) {
+	n, _ := f.logFile.Write(b[:len(b)/2])
+	return n, errors.New("no space left on device")
+}
+
+func TestLogRecoversFromFailedWrite(t *testing.T) {
+	for name, before := range map[string]int{"first record of a file": 0, "later record": 2} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			l, err := Open(dir, 0)
+			require.NoError(t, err)
+			writeRecords(t, l, 1)
+			l.mu.Lock()
+			require.NoError(t, l.rotate(l.day, 2))
+			l.mu.Unlock()
+			writeRecords(t, l, before)
+
+			l.mu.Lock()
+			l.file = tornFile{l.file}
+			l.mu.Unlock()
+			require.Error(t, l.Write(Record{Command: CommandKill}.Accept("", nil)))
+			require.Error(t, l.Err())
+			seq, _ := l.Seq()
+			require.Equal(t, uint64(1+before), seq)
+
+			// The next record starts a new file and the torn one left nothing behind
+			writeRecords(t, l, 1)
+			require.NoError(t, l.Err())
+			require.NoError(t, l.Close())
+			summary, err := Verify(dir)
+			require.NoError(t, err)
+			require.Equal(t, uint64(2+before), summary.Records)
+			files, err := Files(dir)
+			require.NoError(t, err)
+			require.Len(t, files, 2+min(before, 1))
+
+			l, err = Open(dir, 0)
+			require.NoError(t, err)
+			writeRecords(t, l, 1)
+			require.NoError(t, l.Close())
+			_, err = Verify(dir)
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxSize is the size a file of the log grows to before the next one is started
+const DefaultMaxSize = 64 << 20
+
+const (
+	filePrefix = "audit-"
+	fileSuffix = ".jsonl"
+	dayFormat  = "2006-01-02"
+)
+
+// Log appends records to the files of an audit directory, named after the UTC day and the
+// sequence number of their first record so that they sort in order
+type Log struct {
+	// Clock stamps the records and decides when the day changes
+	Clock   func() time.Time
+	dir     string
+	maxSize int64
+
+	mu   sync.Mutex
+	file logFile
+	name string
+	day  string
+	size int64
+	seq  uint64
+	hash string
+	// err is the error of the last write, nil once a write succeeds again
+	err error
+}
+
+// logFile is the file a log appends to, an *os.File but for tests
+type logFile interface {
+	Write(b []byte) (int, error)
+	Truncate(size int64) error
+	Sync() error
+	Close() error
+}
+
+// Open opens the audit log in dir, creating the directory when missing, and carries on the
+// chain after the last record of its last file. Files grow up to maxSize bytes,
+// DefaultMaxSize when 0
+func Open(dir string, maxSize int64) (*Log, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	l := &Log{Clock: time.Now, dir: dir, maxSize: maxSize}
+	files, err := Files(dir)
+	if err != nil || len(files) == 0 {
+		return l, err
+	}
+	// The last file is empty when the server stopped right after starting it
+	for i := len(files) - 1; i >= 0 && l.seq == 0; i-- {
+		err := readFile(files[i], func(rec Record, line []byte) error {
+			l.seq, l.hash = rec.Seq, rec.Hash
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	last := files[len(files)-1]
+	file, err := os.OpenFile(last, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	l.file, l.name, l.size = file, last, info.Size()
+	l.day = strings.TrimPrefix(filepath.Base(last), filePrefix)[:len(dayFormat)]
+	return l, nil
+}
+
+// Files returns the files of the audit log in dir, oldest first
+func Files(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, filePrefix+"*"+fileSuffix))
+	sort.Strings(files)
+	return files, err
+}
+
+// Write numbers, stamps and chains rec, then appends it to the log as a single write. A
+// write that fails leaves no part of the record behind: the file is cut back to the record
+// before and the next write starts a new file, carrying on the chain
+func (l *Log) Write(rec Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.err = l.write(rec)
+	return l.err
+}
+
+func (l *Log) write(rec Record) error {
+	rec.Seq = l.seq + 1
+	rec.Time = l.Clock().UTC()
+	rec.Prev = l.hash
+	rec.Hash = ""
+	body, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	hash := chainHash(rec.Prev, body)
+	line := append(body[:len(body)-1], hashSuffix(hash)...)
+	line = append(line, '\n')
+
+	day := rec.Time.Format(dayFormat)
+	if l.file == nil || day != l.day || (l.size > 0 && l.size+int64(len(line)) > l.maxSize) {
+		if err := l.rotate(day, rec.Seq); err != nil {
+			return err
+		}
+	}
+	if _, err := l.file.Write(line); err != nil {
+		l.abandon()
+		return err
+	}
+	l.size += int64(len(line))
+	l.seq, l.hash = rec.Seq, hash
+	return nil
+}
+
+// abandon drops the current file after a failed write, removing the part of the record
+// that made it to disk, and the file itself when that leaves it empty so that the next file
+// can take its name. The file keeps the torn record when it cannot be cut back, which
+// Verify then reports
+func (l *Log) abandon() {
+	if err := l.file.Truncate(l.size); err == nil && l.size == 0 {
+		os.Remove(l.name)
+	}
+	l.file.Close()
+	l.file = nil
+}
+
+// Err returns the error of the last write, nil when it succeeded
+func (l *Log) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// rotate closes the current file and starts the one of day beginning with record seq
+func (l *Log) rotate(day string, seq uint64) error {
+	if l.file != nil {
+		if err := l.file.Close(); err != nil {
+			return err
+		}
+		l.file = nil
+	}
+	name := filepath.Join(l.dir, fmt.Sprintf("%s%s-%012d%s", filePrefix, day, seq, fileSuffix))
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	l.file, l.name, l.day, l.size = file, name, day, 0
+	return nil
+}
+
+// Seq returns the sequence number of the last record and its hash
+func (l *Log) Seq() (uint64, string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.seq, l.hash
+}
+
+// Sync commits the records written so far to disk
+func (l *Log) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Sync()
+}
+
+// Close syncs and closes the current file
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Sync()
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	l.file = nil
+	return err
+}
+
+// hashSuffix ends a line encoded without its hash with the hash field
+func hashSuffix(hash string) []byte {
+	return []byte(`,"hash":"` + hash + `"}`)
+}
+
+// readFile calls fn with every record of the file at path and the line it was read from,
+// without its newline
+func readFile(path string, fn func(rec Record, line []byte) error) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	for n := 1; len(data) > 0; n++ {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			return fmt.Errorf("%s:%d: truncated record", path, n)
+		}
+		line := data[:i]
+		data = data[i+1:]
+		var rec Record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		if err := fn(rec, line); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+	}
+	return nil
+}
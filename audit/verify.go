@@ -0,0 +1,52 @@
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Summary describes a verified audit log
+type Summary struct {
+	Files   int
+	Records uint64
+	// LastHash is the hash of the last record. Records removed from the end of the log leave
+	// a valid chain, comparing LastHash with a copy kept elsewhere detects it
+	LastHash string
+}
+
+// Verify checks the chain of the audit log in dir: records numbered from 1 without gaps,
+// each naming the hash of the one before and hashing to its own hash. The error names the
+// file and line where the chain breaks
+func Verify(dir string) (Summary, error) {
+	files, err := Files(dir)
+	if err != nil {
+		return Summary{}, err
+	}
+	var summary Summary
+	for _, path := range files {
+		err := readFile(path, func(rec Record, line []byte) error {
+			suffix := hashSuffix(rec.Hash)
+			if rec.Hash == "" || !bytes.HasSuffix(line, suffix) {
+				return errors.New("record does not end with its hash")
+			}
+			if rec.Seq != summary.Records+1 {
+				return fmt.Errorf("record %d follows record %d", rec.Seq, summary.Records)
+			}
+			if rec.Prev != summary.LastHash {
+				return fmt.Errorf("record %d does not follow the hash of record %d", rec.Seq, summary.Records)
+			}
+			body := append(line[:len(line)-len(suffix):len(line)-len(suffix)], '}')
+			if chainHash(rec.Prev, body) != rec.Hash {
+				return fmt.Errorf("record %d does not match its hash", rec.Seq)
+			}
+			summary.Records, summary.LastHash = rec.Seq, rec.Hash
+			return nil
+		})
+		if err != nil {
+			return summary, err
+		}
+		summary.Files++
+	}
+	return summary, nil
+}
@@ -0,0 +1,297 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Headers carrying the key, the unix millisecond timestamp and the signature of a request.
+// The optional nonce tells apart identical requests sent within the same millisecond
+const (
+	HeaderKey       = "X-API-Key"
+	HeaderTimestamp = "X-API-Timestamp"
+	HeaderNonce     = "X-API-Nonce"
+	HeaderSignature = "X-API-Signature"
+)
+
+// DefaultWindow is how far the timestamp of a request may be from the server clock
+const DefaultWindow = 30 * time.Second
+
+// Permission is what a key is allowed to do, each permission includes the ones before it
+type Permission string
+
+const (
+	Read  Permission = "read"
+	Trade Permission = "trade"
+	Admin Permission = "admin"
+)
+
+func (p Permission) rank() int {
+	switch p {
+	case Read:
+		return 1
+	case Trade:
+		return 2
+	case Admin:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// Allows reports whether a key with permission p may do what needs permission need
+func (p Permission) Allows(need Permission) bool {
+	return p.rank() > 0 && p.rank() >= need.rank()
+}
+
+var (
+	ErrUnsigned  = errors.New("missing API key, timestamp or signature")
+	ErrUnknown   = errors.New("unknown API key")
+	ErrSignature = errors.New("invalid signature")
+	ErrExpired   = errors.New("timestamp outside of the allowed window")
+	ErrReplayed  = errors.New("request already seen")
+)
+
+// Key is an API key with the account it trades for. Tier names the rate limits of the key
+type Key struct {
+	Key        string     `json:"key"`
+	Secret     string     `json:"secret"`
+	Account    string     `json:"account"`
+	Permission Permission `json:"permission"`
+	Tier       string     `json:"tier,omitempty"`
+}
+
+// NewKey creates a key with a random id and secret
+func NewKey(account string, permission Permission) (Key, error) {
+	id := make([]byte, 12)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return Key{}, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return Key{}, err
+	}
+	return Key{Key: hex.EncodeToString(id), Secret: hex.EncodeToString(secret), Account: account, Permission: permission}, nil
+}
+
+// seen is a signature accepted recently, kept until no request carrying it can be on time
+type seen struct {
+	signature string
+	expires   time.Time
+}
+
+// KeyStore verifies signed requests against a set of keys, remembering the signatures of
+// the window so that a captured request cannot be sent again
+type KeyStore struct {
+	Window time.Duration
+	Clock  func() time.Time
+	mu     sync.Mutex
+	keys   map[string]Key
+	seen   map[string]bool
+	// recent holds the seen signatures in the order they expire
+	recent []seen
+}
+
+// NewKeyStore creates a KeyStore holding keys
+func NewKeyStore(keys ...Key) *KeyStore {
+	ks := &KeyStore{
+		Window: DefaultWindow,
+		Clock:  time.Now,
+		keys:   make(map[string]Key),
+		seen:   make(map[string]bool),
+	}
+	for _, key := range keys {
+		ks.keys[key.Key] = key
+	}
+	return ks
+}
+
+// Load reads a KeyStore from a JSON file holding a list of keys
+func Load(path string) (*KeyStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []Key
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, key := range keys {
+		if key.Key == "" || key.Secret == "" {
+			return nil, fmt.Errorf("%s: key without an id or secret", path)
+		}
+		if key.Permission.rank() == 0 {
+			return nil, fmt.Errorf("%s: key %s has unknown permission %q", path, key.Key, key.Permission)
+		}
+	}
+	return NewKeyStore(keys...), nil
+}
+
+// Keys returns the keys of the store sorted by id
+func (ks *KeyStore) Keys() []Key {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	keys := make([]Key, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Key < keys[j].Key })
+	return keys
+}
+
+// Save writes keys to a JSON file readable only by its owner
+func Save(path string, keys []Key) error {
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
+
+// Sign returns the hex HMAC-SHA256 of a request under secret. The message is the timestamp,
+// nonce, method, path with its query and body, separated by newlines
+func Sign(secret string, timestamp string, nonce string, method string, path string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n", timestamp, nonce, method, path)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Signature is what a signed message carries besides its content
+type Signature struct {
+	Key       string
+	Timestamp string
+	Nonce     string
+	Signature string
+}
+
+// SignNow signs a message with a key, stamped with the current time and a random nonce
+func SignNow(key string, secret string, method string, path string, body []byte) (Signature, error) {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return Signature{}, err
+	}
+	sig := Signature{Key: key, Timestamp: strconv.FormatInt(time.Now().UnixMilli(), 10), Nonce: hex.EncodeToString(nonce)}
+	sig.Signature = Sign(secret, sig.Timestamp, sig.Nonce, method, path, body)
+	return sig, nil
+}
+
+// Verify checks the signature of a request with the given body, returning its key
+func (ks *KeyStore) Verify(r *http.Request, body []byte) (Key, error) {
+	sig := Signature{
+		Key:       r.Header.Get(HeaderKey),
+		Timestamp: r.Header.Get(HeaderTimestamp),
+		Nonce:     r.Header.Get(HeaderNonce),
+		Signature: r.Header.Get(HeaderSignature),
+	}
+	return ks.VerifySigned(sig, r.Method, r.URL.RequestURI(), body)
+}
+
+// VerifySigned checks a signature made by Sign for a message sent another way than an HTTP
+// request, such as a gRPC call, returning its key
+func (ks *KeyStore) VerifySigned(sig Signature, method string, path string, body []byte) (Key, error) {
+	id, timestamp, signature := sig.Key, sig.Timestamp, sig.Signature
+	if id == "" || timestamp == "" || signature == "" {
+		return Key{}, ErrUnsigned
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	now := ks.Clock()
+	ks.expire(now)
+	key, ok := ks.keys[id]
+	if !ok {
+		return Key{}, ErrUnknown
+	}
+	expected := Sign(key.Secret, timestamp, sig.Nonce, method, path, body)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return Key{}, ErrSignature
+	}
+	ms, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return Key{}, ErrSignature
+	}
+	if skew := now.Sub(time.UnixMilli(ms)); skew > ks.Window || skew < -ks.Window {
+		return Key{}, ErrExpired
+	}
+	if ks.seen[signature] {
+		return Key{}, ErrReplayed
+	}
+	// A request stamped up to a window ahead stays on time until two windows from now
+	ks.seen[signature] = true
+	ks.recent = append(ks.recent, seen{signature: signature, expires: now.Add(2 * ks.Window)})
+	return key, nil
+}
+
+// expire forgets the signatures no request can be on time with anymore. Callers must hold mu
+func (ks *KeyStore) expire(now time.Time) {
+	i := 0
+	for i < len(ks.recent) && !ks.recent[i].expires.After(now) {
+		delete(ks.seen, ks.recent[i].signature)
+		i++
+	}
+	ks.recent = ks.recent[i:]
+}
+
+type contextKey struct{}
+
+// WithKey returns a context carrying the key a request was signed with
+func WithKey(ctx context.Context, key Key) context.Context {
+	return context.WithValue(ctx, contextKey{}, key)
+}
+
+// FromContext returns the key a request was signed with, if it was
+func FromContext(ctx context.Context) (Key, bool) {
+	key, ok := ctx.Value(contextKey{}).(Key)
+	return key, ok
+}
+
+// Transport signs every request with a key before sending it through Base, or
+// http.DefaultTransport when Base is nil
+type Transport struct {
+	Key    string
+	Secret string
+	Base   http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	signed := req.Clone(req.Context())
+	if req.Body != nil {
+		signed.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	sig, err := SignNow(t.Key, t.Secret, req.Method, req.URL.RequestURI(), body)
+	if err != nil {
+		return nil, err
+	}
+	signed.Header.Set(HeaderKey, sig.Key)
+	signed.Header.Set(HeaderTimestamp, sig.Timestamp)
+	signed.Header.Set(HeaderNonce, sig.Nonce)
+	signed.Header.Set(HeaderSignature, sig.Signature)
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(signed)
+}
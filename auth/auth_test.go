@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var alice = Key{Key: "alice-key", Secret: "alice-secret", Account: "alice", Permission: Trade}
+
+// signedRequest builds a request signed by key at the given time
+func signedRequest(key Key, at time.Time, nonce string, method string, path string, body string) *http.Request {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	timestamp := strconv.FormatInt(at.UnixMilli(), 10)
+	r.Header.Set(HeaderKey, key.Key)
+	r.Header.Set(HeaderTimestamp, timestamp)
+	r.Header.Set(HeaderNonce, nonce)
+	r.Header.Set(HeaderSignature, Sign(key.Secret, timestamp, nonce, method, path, []byte(body)))
+	return r
+}
+
+func newTestStore(now time.Time) *KeyStore {
+	ks := NewKeyStore(alice)
+	ks.Clock = func() time.Time { return now }
+	return ks
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	ks := newTestStore(now)
+	body := `{"side":"Buy","qty":1}`
+
+	key, err := ks.Verify(signedRequest(alice, now, "1", "POST", "/order/", body), []byte(body))
+	require.NoError(t, err)
+	require.Equal(t, "alice", key.Account)
+
+	r := signedRequest(alice, now, "2", "POST", "/order/", body)
+	_, err = ks.Verify(r, []byte(`{"side":"Buy","qty":100}`))
+	require.ErrorIs(t, err, ErrSignature)
+	r = signedRequest(alice, now, "3", "POST", "/order/", body)
+	r.Method = "DELETE"
+	_, err = ks.Verify(r, []byte(body))
+	require.ErrorIs(t, err, ErrSignature)
+	_, err = ks.Verify(signedRequest(Key{Key: "alice-key", Secret: "guess"}, now, "4", "GET", "/bids/", ""), nil)
+	require.ErrorIs(t, err, ErrSignature)
+	_, err = ks.Verify(signedRequest(Key{Key: "mallory", Secret: "x"}, now, "5", "GET", "/bids/", ""), nil)
+	require.ErrorIs(t, err, ErrUnknown)
+	_, err = ks.Verify(httptest.NewRequest("GET", "/bids/", nil), nil)
+	require.ErrorIs(t, err, ErrUnsigned)
+}
+
+func TestVerify_ReplayWindow(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	ks := newTestStore(now)
+
+	_, err := ks.Verify(signedRequest(alice, now.Add(-31*time.Second), "1", "GET", "/bids/", ""), nil)
+	require.ErrorIs(t, err, ErrExpired)
+	_, err = ks.Verify(signedRequest(alice, now.Add(31*time.Second), "1", "GET", "/bids/", ""), nil)
+	require.ErrorIs(t, err, ErrExpired)
+
+	stamped := now.Add(20 * time.Second)
+	_, err = ks.Verify(signedRequest(alice, stamped, "1", "GET", "/bids/", ""), nil)
+	require.NoError(t, err)
+	_, err = ks.Verify(signedRequest(alice, stamped, "1", "GET", "/bids/", ""), nil)
+	require.ErrorIs(t, err, ErrReplayed)
+	_, err = ks.Verify(signedRequest(alice, stamped, "2", "GET", "/bids/", ""), nil)
+	require.NoError(t, err, "another nonce is another request")
+
+	// Still refused as long as the timestamp is within the window
+	ks.Clock = func() time.Time { return now.Add(50 * time.Second) }
+	_, err = ks.Verify(signedRequest(alice, stamped, "1", "GET", "/bids/", ""), nil)
+	require.ErrorIs(t, err, ErrReplayed)
+	ks.Clock = func() time.Time { return now.Add(61 * time.Second) }
+	_, err = ks.Verify(signedRequest(alice, stamped, "1", "GET", "/bids/", ""), nil)
+	require.ErrorIs(t, err, ErrExpired)
+	require.Empty(t, ks.seen)
+}
+
+func TestPermission_Allows(t *testing.T) {
+	require.True(t, Admin.Allows(Trade))
+	require.True(t, Trade.Allows(Read))
+	require.False(t, Read.Allows(Trade))
+	require.False(t, Trade.Allows(Admin))
+	require.False(t, Permission("root").Allows(Read))
+}
+
+func TestLoadAndSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "apikeys.json")
+	key, err := NewKey("bob", Read)
+	require.NoError(t, err)
+	require.NoError(t, Save(path, []Key{alice, key}))
+
+	ks, err := Load(path)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []Key{alice, key}, ks.Keys())
+
+	require.NoError(t, Save(path, []Key{{Key: "k", Secret: "s", Permission: "root"}}))
+	_, err = Load(path)
+	require.ErrorContains(t, err, "unknown permission")
+}
+
+func TestTransport(t *testing.T) {
+	ks := NewKeyStore(alice)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		key, err := ks.Verify(r, body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(key.Account + " " + string(body)))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &Transport{Key: alice.Key, Secret: alice.Secret}}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Post(server.URL+"/order/?x=1", "application/json", strings.NewReader(`{"qty":1}`))
+		require.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+		require.Equal(t, `alice {"qty":1}`, string(body))
+	}
+	resp, err := client.Get(server.URL + "/bids/")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
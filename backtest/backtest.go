@@ -0,0 +1,381 @@
+// Package backtest replays historical order events through the matching engine on a simulated
+// clock and lets a strategy trade against them, accounting for its fills and PnL
+package backtest
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/EliasManj/orderbook/orderbook"
+)
+
+// DefaultAccount is the account of the strategy orders when none is configured
+const DefaultAccount = "backtest"
+
+// DefaultLevels is the number of price levels per side given to Strategy.OnBook by default
+const DefaultLevels = 10
+
+// strategyIdBase is the first id given to strategy orders, far above the ids of recorded orders
+const strategyIdBase orderbook.OrderId = 1 << 48
+
+// Strategy reacts to the replayed market. Orders placed through the Session reach the book
+// after the configured latency. Changes caused by the strategy's own orders are only
+// reported through OnFill, so a strategy cannot keep reacting to itself at a single instant
+type Strategy interface {
+	// OnBook is called after every historical event with the depth of the book
+	OnBook(s *Session, depth orderbook.OrderBookLevelInfos)
+	// OnTrade is called for every trade between historical orders, and every trade
+	// of a historical order against an order of the strategy
+	OnTrade(s *Session, trade orderbook.Trade)
+	// OnFill is called for every execution of an order of the strategy
+	OnFill(s *Session, fill Fill)
+}
+
+// Config sets up a backtest, zero values use the defaults
+type Config struct {
+	Symbol string
+	// Account is the account of the strategy orders
+	Account string
+	// Latency delays every order, cancel and modify of the strategy
+	Latency time.Duration
+	// Levels is the number of price levels per side given to OnBook
+	Levels int
+	// Fees is the fee schedule of the strategy account, historical orders pay no fees
+	Fees orderbook.FeeSchedule
+}
+
+// Fill is an execution of a strategy order
+type Fill struct {
+	Time      time.Time
+	TradeId   orderbook.TradeId
+	OrderId   orderbook.OrderId
+	Side      orderbook.Side
+	Price     orderbook.Price
+	Qty       orderbook.Quantity
+	Liquidity orderbook.Liquidity
+	Fee       float64
+	// QueueAhead is the quantity resting ahead of a maker order when it joined the queue
+	QueueAhead orderbook.Quantity
+	// Resting is how long a maker order rested before this fill
+	Resting time.Duration
+}
+
+// ownOrder tracks a live strategy order
+type ownOrder struct {
+	side       orderbook.Side
+	filled     bool
+	restedAt   time.Time
+	queueAhead orderbook.Quantity
+	rested     bool
+}
+
+// action is a strategy command waiting for its latency to elapse
+type action struct {
+	at time.Time
+	fn func()
+}
+
+// Session is the view of the backtest given to the strategy
+type Session struct {
+	cfg      Config
+	book     *orderbook.OrderBook
+	strategy Strategy
+	now      time.Time
+	nextId   orderbook.OrderId
+	own      map[orderbook.OrderId]*ownOrder
+	pending  []action
+	acct     account
+	report   Report
+	// lastPrice is the price of the last trade, used to value the position
+	lastPrice orderbook.Price
+}
+
+// Run replays events through a new order book, calling the strategy as the market changes,
+// and returns the report of the strategy once every event and pending command was applied
+func Run(events []Event, strategy Strategy, cfg Config) (Report, error) {
+	s := newSession(strategy, cfg)
+	for i, event := range events {
+		s.advance(event.Time)
+		if err := s.replay(event); err != nil {
+			return s.report, fmt.Errorf("event %d: %w", i+1, err)
+		}
+	}
+	s.advance(time.Time{})
+	return s.finish(), nil
+}
+
+func newSession(strategy Strategy, cfg Config) *Session {
+	if cfg.Account == "" {
+		cfg.Account = DefaultAccount
+	}
+	if cfg.Levels <= 0 {
+		cfg.Levels = DefaultLevels
+	}
+	if len(cfg.Fees.Tiers) == 0 {
+		cfg.Fees = orderbook.ZeroFeeSchedule
+	}
+	s := &Session{
+		cfg:      cfg,
+		book:     orderbook.NewOrderBook(),
+		strategy: strategy,
+		nextId:   strategyIdBase,
+		own:      make(map[orderbook.OrderId]*ownOrder),
+	}
+	if cfg.Symbol != "" {
+		s.book.Symbol = cfg.Symbol
+	}
+	s.book.Clock = func() time.Time { return s.now }
+	s.book.Fees.SetSchedule(cfg.Account, cfg.Fees)
+	s.report.Symbol = s.book.Symbol
+	return s
+}
+
+// advance applies the strategy commands due by t, all of them when t is zero
+func (s *Session) advance(t time.Time) {
+	for len(s.pending) > 0 && (t.IsZero() || !s.pending[0].at.After(t)) {
+		next := s.pending[0]
+		s.pending = s.pending[1:]
+		if next.at.After(s.now) {
+			s.now = next.at
+		}
+		next.fn()
+		s.mark()
+	}
+	if t.After(s.now) {
+		s.now = t
+	}
+}
+
+// replay applies a historical event and tells the strategy about it
+func (s *Session) replay(event Event) error {
+	if event.OrderId >= strategyIdBase {
+		return fmt.Errorf("order id %d is reserved for strategy orders", event.OrderId)
+	}
+	s.report.Events++
+	var trades []orderbook.Trade
+	switch event.Action {
+	case ActionAdd:
+		order, err := event.order()
+		if err != nil {
+			return err
+		}
+		if _, exists := s.book.Orders[order.GetOrderId()]; exists {
+			s.report.Skipped++
+		} else {
+			trades = s.book.AddOrder(order)
+		}
+	case ActionCancel:
+		if _, exists := s.book.GetOrder(event.OrderId); exists {
+			s.book.CancelOrder(event.OrderId)
+		} else {
+			s.report.Skipped++
+		}
+	case ActionModify:
+		order, exists := s.book.GetOrder(event.OrderId)
+		if !exists || order.Amend(orderbook.Price(event.Price), orderbook.Quantity(event.Qty)) != nil {
+			s.report.Skipped++
+		} else {
+			trades = s.book.ModifyOrder(order)
+		}
+	default:
+		return fmt.Errorf("unknown action %q", event.Action)
+	}
+	s.fills(trades)
+	for _, trade := range trades {
+		s.strategy.OnTrade(s, trade)
+	}
+	s.strategy.OnBook(s, s.book.Depth(s.cfg.Levels))
+	s.mark()
+	return nil
+}
+
+// fills reports the executions of strategy orders among trades and settles them
+func (s *Session) fills(trades []orderbook.Trade) {
+	for _, trade := range trades {
+		for _, info := range []orderbook.TradeInfo{trade.BidTrade, trade.AskTrade} {
+			own, ok := s.own[info.OrderId]
+			if !ok {
+				continue
+			}
+			fill := Fill{
+				Time:      trade.Timestamp,
+				TradeId:   trade.Id,
+				OrderId:   info.OrderId,
+				Side:      own.side,
+				Price:     trade.ExecPrice(),
+				Qty:       info.Qty,
+				Liquidity: info.Liquidity,
+				Fee:       info.Fee,
+			}
+			if info.Liquidity == orderbook.Maker {
+				fill.QueueAhead = own.queueAhead
+				fill.Resting = trade.Timestamp.Sub(own.restedAt)
+			}
+			own.filled = true
+			s.acct.fill(fill)
+			s.report.addFill(fill)
+			s.strategy.OnFill(s, fill)
+		}
+		s.lastPrice = trade.ExecPrice()
+	}
+	for id, own := range s.own {
+		if _, resting := s.book.GetOrder(id); !resting {
+			delete(s.own, id)
+			continue
+		}
+		if !own.rested {
+			// The order joined the queue, note the quantity ahead of it
+			own.rested = true
+			own.restedAt = s.now
+			own.queueAhead, _ = s.book.QueueAhead(id)
+		}
+	}
+}
+
+// mark values the position at the last trade price and tracks the drawdown
+func (s *Session) mark() {
+	equity := s.acct.equity(s.markPrice())
+	s.report.PeakEquity = math.Max(s.report.PeakEquity, equity)
+	s.report.MaxDrawdown = math.Max(s.report.MaxDrawdown, s.report.PeakEquity-equity)
+}
+
+// markPrice is the price of the last trade, or the middle of the book before any trade
+func (s *Session) markPrice() orderbook.Price {
+	if s.lastPrice != 0 {
+		return s.lastPrice
+	}
+	if !s.book.Bids.IsEmpty() && !s.book.Asks.IsEmpty() {
+		bid, _ := s.book.Bids.FirstKey()
+		ask, _ := s.book.Asks.FirstKey()
+		return (bid + ask) / 2
+	}
+	return s.acct.avgCost
+}
+
+func (s *Session) finish() Report {
+	r := s.report
+	r.Position = s.acct.position
+	r.AvgCost = s.acct.avgCost
+	r.Mark = s.markPrice()
+	r.Realized = s.acct.realized
+	r.Unrealized = s.acct.unrealized(r.Mark)
+	r.Fees = s.acct.fees
+	r.NetPnL = r.Realized + r.Unrealized - r.Fees
+	r.OpenOrders = len(s.own)
+	return r
+}
+
+// schedule runs fn once the latency has elapsed
+func (s *Session) schedule(fn func()) {
+	s.pending = append(s.pending, action{at: s.now.Add(s.cfg.Latency), fn: fn})
+}
+
+// Now returns the time of the simulated clock
+func (s *Session) Now() time.Time {
+	return s.now
+}
+
+// Depth returns the current depth of the book, limited to levels per side when positive
+func (s *Session) Depth(levels int) orderbook.OrderBookLevelInfos {
+	return s.book.Depth(levels)
+}
+
+// Position returns the net quantity held by the strategy, negative when short
+func (s *Session) Position() int64 {
+	return s.acct.position
+}
+
+// Submit places an order of the strategy, returning the id it will rest under.
+// The order type takes the names accepted by orderbook.StringToOrderType, or gtc, fak, fok and market
+func (s *Session) Submit(otype string, side orderbook.Side, price orderbook.Price, qty orderbook.Quantity) (orderbook.OrderId, error) {
+	event := Event{Type: otype, Side: side.String(), Price: float64(price), Qty: int(qty), Account: s.cfg.Account}
+	event.OrderId = s.nextId
+	order, err := event.order()
+	if err != nil {
+		return 0, err
+	}
+	s.nextId++
+	s.report.Orders++
+	s.schedule(func() {
+		own := &ownOrder{side: side}
+		s.own[order.GetOrderId()] = own
+		s.apply(s.book.AddOrder(order))
+		if !own.filled && !own.rested {
+			s.report.Rejected++
+		}
+	})
+	return order.GetOrderId(), nil
+}
+
+// Cancel removes a resting order of the strategy, if it is still resting once the latency elapsed
+func (s *Session) Cancel(orderId orderbook.OrderId) {
+	s.schedule(func() {
+		if _, ok := s.own[orderId]; !ok {
+			return
+		}
+		s.book.CancelOrder(orderId)
+		delete(s.own, orderId)
+		s.report.Cancels++
+	})
+}
+
+// Modify changes the price and total quantity of a resting order of the strategy
+func (s *Session) Modify(orderId orderbook.OrderId, price orderbook.Price, qty orderbook.Quantity) {
+	s.schedule(func() {
+		own, ok := s.own[orderId]
+		if !ok {
+			return
+		}
+		order, exists := s.book.GetOrder(orderId)
+		if !exists {
+			return
+		}
+		// Only a smaller quantity at the same price keeps the place in the queue
+		keepsPriority := order.Price == price && qty < order.GetInitialQty()
+		if order.Amend(price, qty) != nil {
+			return
+		}
+		if !keepsPriority {
+			own.rested = false
+		}
+		s.report.Modifies++
+		s.apply(s.book.ModifyOrder(order))
+	})
+}
+
+// QueueAhead returns the quantity resting before an order of the strategy at its price
+func (s *Session) QueueAhead(orderId orderbook.OrderId) (orderbook.Quantity, bool) {
+	if _, ok := s.own[orderId]; !ok {
+		return 0, false
+	}
+	return s.book.QueueAhead(orderId)
+}
+
+// OpenOrders returns the resting orders of the strategy
+func (s *Session) OpenOrders() []orderbook.Order {
+	orders := []orderbook.Order{}
+	for id := range s.own {
+		if order, ok := s.book.GetOrder(id); ok {
+			orders = append(orders, order)
+		}
+	}
+	return orders
+}
+
+// apply settles the trades of a strategy command and tells the strategy about the
+// executions of historical orders it traded with
+func (s *Session) apply(trades []orderbook.Trade) {
+	external := []orderbook.Trade{}
+	for _, trade := range trades {
+		_, bid := s.own[trade.BidTrade.OrderId]
+		_, ask := s.own[trade.AskTrade.OrderId]
+		if !bid || !ask {
+			external = append(external, trade)
+		}
+	}
+	s.fills(trades)
+	for _, trade := range external {
+		s.strategy.OnTrade(s, trade)
+	}
+}
@@ -0,0 +1,163 @@
+package backtest
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EliasManj/orderbook/journal"
+	"github.com/EliasManj/orderbook/orderbook"
+	"github.com/stretchr/testify/require"
+)
+
+const eventsCSV = `time,action,order_id,side,type,price,qty,account
+2024-03-01T09:30:00Z,add,1,buy,gtc,100,10,alice
+2024-03-01T09:30:01Z,add,2,sell,gtc,102,10,bob
+2024-03-01T09:30:02Z,add,3,sell,fak,100,12,carol
+2024-03-01T09:30:03Z,add,4,buy,gtc,101,5,alice
+2024-03-01T09:30:04Z,cancel,99,,,,,
+`
+
+// joinAndExit joins the best bid once, then sells what it bought when the bid reaches 101
+type joinAndExit struct {
+	bid    orderbook.OrderId
+	ahead  orderbook.Quantity
+	sold   bool
+	trades int
+	fills  []Fill
+}
+
+func (j *joinAndExit) OnBook(s *Session, depth orderbook.OrderBookLevelInfos) {
+	if j.bid != 0 {
+		j.ahead, _ = s.QueueAhead(j.bid)
+	}
+	if j.bid == 0 && len(depth.Bids) > 0 && len(depth.Asks) > 0 {
+		j.bid, _ = s.Submit("gtc", orderbook.Buy, depth.Bids[0].Price, 5)
+	}
+	if s.Position() > 0 && !j.sold && len(depth.Bids) > 0 && depth.Bids[0].Price >= 101 {
+		s.Submit("fak", orderbook.Sell, 101, orderbook.Quantity(s.Position()))
+		j.sold = true
+	}
+}
+
+func (j *joinAndExit) OnTrade(s *Session, trade orderbook.Trade) {
+	j.trades++
+}
+
+func (j *joinAndExit) OnFill(s *Session, fill Fill) {
+	j.fills = append(j.fills, fill)
+}
+
+func TestRun(t *testing.T) {
+	events, err := ReadCSV(strings.NewReader(eventsCSV))
+	require.NoError(t, err)
+	require.Len(t, events, 5)
+
+	strategy := &joinAndExit{}
+	report, err := Run(events, strategy, Config{Symbol: "TEST"})
+	require.NoError(t, err)
+
+	require.Len(t, strategy.fills, 2)
+	entry := strategy.fills[0]
+	require.Equal(t, orderbook.Maker, entry.Liquidity)
+	require.Equal(t, orderbook.Quantity(2), entry.Qty)
+	require.Equal(t, orderbook.Quantity(10), entry.QueueAhead, "the order joined behind order 1")
+	require.Equal(t, time.Second, entry.Resting)
+	exit := strategy.fills[1]
+	require.Equal(t, orderbook.Taker, exit.Liquidity)
+	require.Equal(t, orderbook.Sell, exit.Side)
+	require.Equal(t, orderbook.Price(101), exit.Price)
+	require.Equal(t, orderbook.Quantity(0), strategy.ahead, "order 1 traded ahead of the strategy")
+	require.Equal(t, 3, strategy.trades)
+
+	require.Equal(t, 5, report.Events)
+	require.Equal(t, 1, report.Skipped)
+	require.Equal(t, 2, report.Orders)
+	require.Equal(t, 0, report.Rejected)
+	require.Equal(t, 1, report.MakerFills)
+	require.Equal(t, 1, report.TakerFills)
+	require.Equal(t, int64(2), report.Bought)
+	require.Equal(t, int64(2), report.Sold)
+	require.Equal(t, int64(0), report.Position)
+	require.InDelta(t, 2.0, report.Realized, 1e-9)
+	require.InDelta(t, 2.0, report.NetPnL, 1e-9)
+	require.Equal(t, 1, report.OpenOrders)
+	require.Equal(t, 10.0, report.AvgQueueAhead)
+
+	var out bytes.Buffer
+	require.NoError(t, report.Write(&out))
+	require.Contains(t, out.String(), "Net PnL")
+	require.Contains(t, out.String(), "2 (1 maker, 1 taker)")
+}
+
+func TestRunLatency(t *testing.T) {
+	events, err := ReadCSV(strings.NewReader(eventsCSV))
+	require.NoError(t, err)
+
+	// The bid arrives after the sell that would have filled it
+	strategy := &joinAndExit{}
+	report, err := Run(events, strategy, Config{Latency: 1500 * time.Millisecond})
+	require.NoError(t, err)
+	require.Empty(t, strategy.fills)
+	require.Equal(t, 0, report.Fills)
+	require.Equal(t, 1, report.OpenOrders)
+	require.Equal(t, orderbook.Quantity(0), strategy.ahead)
+}
+
+func TestRunFees(t *testing.T) {
+	events, err := ReadCSV(strings.NewReader(eventsCSV))
+	require.NoError(t, err)
+	report, err := Run(events, &joinAndExit{}, Config{Fees: orderbook.StandardFeeSchedule})
+	require.NoError(t, err)
+	// A rebate on 200 bought as maker, a fee on 202 sold as taker
+	require.InDelta(t, -0.02+0.101, report.Fees, 1e-9)
+	require.InDelta(t, 2-report.Fees, report.NetPnL, 1e-9)
+}
+
+func TestAccount(t *testing.T) {
+	var a account
+	a.fill(Fill{Side: orderbook.Buy, Price: 100, Qty: 10})
+	a.fill(Fill{Side: orderbook.Buy, Price: 106, Qty: 5})
+	require.Equal(t, orderbook.Price(102), a.avgCost)
+	a.fill(Fill{Side: orderbook.Sell, Price: 110, Qty: 20})
+	require.Equal(t, int64(-5), a.position)
+	require.Equal(t, orderbook.Price(110), a.avgCost)
+	require.InDelta(t, 120.0, a.realized, 1e-9)
+	require.InDelta(t, 25.0, a.unrealized(105), 1e-9)
+	a.fill(Fill{Side: orderbook.Buy, Price: 105, Qty: 5, Fee: 1})
+	require.Equal(t, int64(0), a.position)
+	require.InDelta(t, 144.0, a.equity(90), 1e-9)
+}
+
+func TestReadEvents(t *testing.T) {
+	_, err := ReadCSV(strings.NewReader("time,action\n"))
+	require.ErrorContains(t, err, "order_id")
+	_, err = ReadCSV(strings.NewReader("time,action,order_id\n2024-03-01T09:30:00Z,replace,1\n"))
+	require.ErrorContains(t, err, "line 2")
+	_, err = ReadCSV(strings.NewReader("time,action,order_id,side,qty\n2024-03-01T09:30:01Z,add,1,buy,1\n2024-03-01T09:30:00Z,add,2,buy,1\n"))
+	require.ErrorContains(t, err, "earlier")
+
+	path := filepath.Join(t.TempDir(), "events.journal")
+	j, err := journal.Open(path)
+	require.NoError(t, err)
+	_, err = j.Append(ActionAdd, "TEST", Event{OrderId: 1, Side: "sell", Type: "gtc", Price: 10, Qty: 3})
+	require.NoError(t, err)
+	_, err = j.Append("trade", "TEST", orderbook.Trade{})
+	require.NoError(t, err)
+	_, err = j.Append(ActionModify, "TEST", Event{OrderId: 1, Price: 11, Qty: 4})
+	require.NoError(t, err)
+	require.NoError(t, j.Close())
+
+	events, err := Load(path)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	require.Equal(t, ActionAdd, events[0].Action)
+	require.Equal(t, ActionModify, events[1].Action)
+	require.False(t, events[1].Time.IsZero())
+
+	report, err := Run(events, &joinAndExit{}, Config{})
+	require.NoError(t, err)
+	require.Equal(t, 0, report.Skipped)
+}
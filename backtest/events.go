@@ -0,0 +1,210 @@
+package backtest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EliasManj/orderbook/journal"
+	"github.com/EliasManj/orderbook/orderbook"
+)
+
+// Actions of a historical event, also the journal entry types holding events
+const (
+	ActionAdd    = "add"
+	ActionCancel = "cancel"
+	ActionModify = "modify"
+)
+
+// Event is a historical order command. Modify events carry the new price and total quantity
+type Event struct {
+	Time    time.Time         `json:"time"`
+	Action  string            `json:"action"`
+	OrderId orderbook.OrderId `json:"order_id"`
+	Side    string            `json:"side,omitempty"`
+	Type    string            `json:"type,omitempty"`
+	Price   float64           `json:"price,omitempty"`
+	Qty     int               `json:"qty,omitempty"`
+	Account string            `json:"account,omitempty"`
+}
+
+// csvHeader lists the columns of an event file, in order
+var csvHeader = []string{"time", "action", "order_id", "side", "type", "price", "qty", "account"}
+
+// orderTypes accepts the short order type names used by the command line tools
+var orderTypes = map[string]string{
+	"gtc":    "GoodTilCancelled",
+	"fak":    "FillAndKill",
+	"ioc":    "FillAndKill",
+	"fok":    "FillOrKill",
+	"market": "Market",
+}
+
+// order builds the order of an add event
+func (e Event) order() (orderbook.Order, error) {
+	typ := e.Type
+	if long, ok := orderTypes[strings.ToLower(typ)]; ok {
+		typ = long
+	}
+	if typ == "" {
+		typ = "GoodTilCancelled"
+	}
+	if _, err := orderbook.StringToOrderType(typ); err != nil {
+		return orderbook.Order{}, err
+	}
+	if _, err := orderbook.StringToOrderSide(e.Side); err != nil {
+		return orderbook.Order{}, fmt.Errorf("invalid side: %q", e.Side)
+	}
+	if e.Qty <= 0 {
+		return orderbook.Order{}, errors.New("quantity must be positive")
+	}
+	order := orderbook.NewOrderWithId(e.OrderId, typ, e.Side, e.Price, e.Qty)
+	order.Account = e.Account
+	return *order, nil
+}
+
+// Load reads the events of a CSV file, when its name ends in .csv, or of a journal file
+func Load(path string) ([]Event, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return ReadCSV(file)
+	}
+	return ReadJournal(file)
+}
+
+// ReadCSV reads events from CSV with a header row naming the columns
+// time, action, order_id, side, type, price, qty and account. Times are RFC 3339
+func ReadCSV(r io.Reader) ([]Event, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range csvHeader[:3] {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing column %q", name)
+		}
+	}
+	events := []Event{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		get := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		event, err := parseRecord(get)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		events = append(events, event)
+	}
+	return events, checkOrder(events)
+}
+
+func parseRecord(get func(name string) string) (Event, error) {
+	var event Event
+	var err error
+	if event.Time, err = time.Parse(time.RFC3339Nano, get("time")); err != nil {
+		return event, err
+	}
+	event.Action = strings.ToLower(get("action"))
+	id, err := strconv.Atoi(get("order_id"))
+	if err != nil {
+		return event, fmt.Errorf("invalid order id %q", get("order_id"))
+	}
+	event.OrderId = orderbook.OrderId(id)
+	event.Side = get("side")
+	event.Type = get("type")
+	event.Account = get("account")
+	if v := get("price"); v != "" {
+		if event.Price, err = strconv.ParseFloat(v, 64); err != nil {
+			return event, fmt.Errorf("invalid price %q", v)
+		}
+	}
+	if v := get("qty"); v != "" {
+		if event.Qty, err = strconv.Atoi(v); err != nil {
+			return event, fmt.Errorf("invalid quantity %q", v)
+		}
+	}
+	return event, validate(event)
+}
+
+// ReadJournal reads the events of a journal. Entries of type add, cancel and modify hold an
+// Event without its time, which is taken from the entry. Other entries, like trades, are skipped
+func ReadJournal(r io.Reader) ([]Event, error) {
+	events := []Event{}
+	err := journal.Read(r, func(e journal.Entry) error {
+		switch e.Type {
+		case ActionAdd, ActionCancel, ActionModify:
+		default:
+			return nil
+		}
+		var event Event
+		if err := json.Unmarshal(e.Data, &event); err != nil {
+			return fmt.Errorf("journal entry %d: %w", e.Seq, err)
+		}
+		event.Time = e.Time
+		event.Action = e.Type
+		if err := validate(event); err != nil {
+			return fmt.Errorf("journal entry %d: %w", e.Seq, err)
+		}
+		events = append(events, event)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, checkOrder(events)
+}
+
+func validate(event Event) error {
+	switch event.Action {
+	case ActionAdd:
+		_, err := event.order()
+		return err
+	case ActionCancel:
+		return nil
+	case ActionModify:
+		if event.Qty <= 0 {
+			return errors.New("quantity must be positive")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown action %q", event.Action)
+	}
+}
+
+// checkOrder makes sure the events can be replayed on a clock that only moves forward
+func checkOrder(events []Event) error {
+	for i := 1; i < len(events); i++ {
+		if events[i].Time.Before(events[i-1].Time) {
+			return fmt.Errorf("event %d at %s is earlier than the one before it", i+1, events[i].Time.Format(time.RFC3339Nano))
+		}
+	}
+	return nil
+}
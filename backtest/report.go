@@ -0,0 +1,152 @@
+package backtest
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/EliasManj/orderbook/orderbook"
+)
+
+// Report summarises the activity and results of a strategy over a backtest
+type Report struct {
+	Symbol string
+	// Events is the number of historical events replayed, Skipped the ones that referred
+	// to unknown orders or reused the id of a resting order
+	Events  int
+	Skipped int
+
+	Orders   int
+	Rejected int
+	Cancels  int
+	Modifies int
+
+	Fills      int
+	MakerFills int
+	TakerFills int
+	Bought     int64
+	Sold       int64
+	Notional   float64
+	// AvgQueueAhead is the average quantity ahead of maker orders when they joined the queue
+	AvgQueueAhead float64
+	// AvgResting is the average time maker orders rested before a fill
+	AvgResting time.Duration
+
+	Position   int64
+	AvgCost    orderbook.Price
+	Mark       orderbook.Price
+	Realized   float64
+	Unrealized float64
+	Fees       float64
+	NetPnL     float64
+	PeakEquity float64
+	// MaxDrawdown is the largest fall of the net PnL from its peak
+	MaxDrawdown float64
+	OpenOrders  int
+
+	queueAhead int64
+	resting    time.Duration
+}
+
+func (r *Report) addFill(fill Fill) {
+	r.Fills++
+	if fill.Side == orderbook.Buy {
+		r.Bought += int64(fill.Qty)
+	} else {
+		r.Sold += int64(fill.Qty)
+	}
+	r.Notional += float64(fill.Price) * float64(fill.Qty)
+	if fill.Liquidity == orderbook.Taker {
+		r.TakerFills++
+		return
+	}
+	r.MakerFills++
+	r.queueAhead += int64(fill.QueueAhead)
+	r.resting += fill.Resting
+	r.AvgQueueAhead = float64(r.queueAhead) / float64(r.MakerFills)
+	r.AvgResting = r.resting / time.Duration(r.MakerFills)
+}
+
+// Write prints the report as a table
+func (r Report) Write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	rows := []struct {
+		name  string
+		value any
+	}{
+		{"Symbol", r.Symbol},
+		{"Events", fmt.Sprintf("%d (%d skipped)", r.Events, r.Skipped)},
+		{"Orders", fmt.Sprintf("%d (%d rejected, %d cancelled, %d modified, %d open)", r.Orders, r.Rejected, r.Cancels, r.Modifies, r.OpenOrders)},
+		{"Fills", fmt.Sprintf("%d (%d maker, %d taker)", r.Fills, r.MakerFills, r.TakerFills)},
+		{"Bought", r.Bought},
+		{"Sold", r.Sold},
+		{"Notional", fmt.Sprintf("%.2f", r.Notional)},
+		{"Avg queue ahead", fmt.Sprintf("%.1f", r.AvgQueueAhead)},
+		{"Avg time to fill", r.AvgResting},
+		{"Position", fmt.Sprintf("%d @ %.2f", r.Position, float64(r.AvgCost))},
+		{"Mark", fmt.Sprintf("%.2f", float64(r.Mark))},
+		{"Realized PnL", fmt.Sprintf("%.2f", r.Realized)},
+		{"Unrealized PnL", fmt.Sprintf("%.2f", r.Unrealized)},
+		{"Fees", fmt.Sprintf("%.2f", r.Fees)},
+		{"Net PnL", fmt.Sprintf("%.2f", r.NetPnL)},
+		{"Max drawdown", fmt.Sprintf("%.2f", r.MaxDrawdown)},
+	}
+	for _, row := range rows {
+		fmt.Fprintf(tw, "%s\t%v\n", row.name, row.value)
+	}
+	return tw.Flush()
+}
+
+// account tracks the position of the strategy at its average cost
+type account struct {
+	position int64
+	avgCost  orderbook.Price
+	realized float64
+	fees     float64
+}
+
+// fill applies an execution, realizing the PnL of the part that reduces the position
+func (a *account) fill(fill Fill) {
+	qty := int64(fill.Qty)
+	if fill.Side == orderbook.Sell {
+		qty = -qty
+	}
+	a.fees += fill.Fee
+	if a.position == 0 || (a.position > 0) == (qty > 0) {
+		held, added := abs(a.position), abs(qty)
+		a.avgCost = orderbook.Price((float64(a.avgCost)*float64(held) + float64(fill.Price)*float64(added)) / float64(held+added))
+		a.position += qty
+		return
+	}
+	var direction float64 = 1
+	if a.position < 0 {
+		direction = -1
+	}
+	closed := min(abs(a.position), abs(qty))
+	a.realized += float64(closed) * float64(fill.Price-a.avgCost) * direction
+	a.position += qty
+	switch {
+	case a.position == 0:
+		a.avgCost = 0
+	case (a.position > 0) != (direction > 0):
+		// The fill flipped the position, the rest opened at the fill price
+		a.avgCost = fill.Price
+	}
+}
+
+func (a *account) unrealized(mark orderbook.Price) float64 {
+	return float64(a.position) * float64(mark-a.avgCost)
+}
+
+// equity is the net PnL if the position was closed at mark
+func (a *account) equity(mark orderbook.Price) float64 {
+	return a.realized + a.unrealized(mark) - a.fees
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,212 @@
+package candles
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/EliasManj/orderbook/orderbook"
+)
+
+// DefaultIntervals are the bar intervals maintained by NewAggregator when none are given
+var DefaultIntervals = []time.Duration{time.Second, time.Minute, 5 * time.Minute, time.Hour}
+
+// DefaultCapacity is the number of bars kept per interval
+const DefaultCapacity = 10000
+
+// subscriberBuffer is the number of updates a subscriber can fall behind before updates are dropped
+const subscriberBuffer = 64
+
+type Candle struct {
+	Start    time.Time
+	Interval time.Duration
+	Open     orderbook.Price
+	High     orderbook.Price
+	Low      orderbook.Price
+	Close    orderbook.Price
+	Volume   orderbook.Quantity
+	Trades   int
+}
+
+// Aggregator builds OHLCV bars at several intervals from a stream of trades.
+// Intervals without trades produce flat bars at the previous close with no volume
+type Aggregator struct {
+	mu          sync.RWMutex
+	capacity    int
+	series      map[time.Duration][]Candle
+	subscribers map[time.Duration]map[chan Candle]struct{}
+	Clock       func() time.Time
+}
+
+// NewAggregator creates an Aggregator maintaining bars at the given intervals
+func NewAggregator(intervals ...time.Duration) *Aggregator {
+	if len(intervals) == 0 {
+		intervals = DefaultIntervals
+	}
+	a := &Aggregator{
+		capacity:    DefaultCapacity,
+		series:      make(map[time.Duration][]Candle),
+		subscribers: make(map[time.Duration]map[chan Candle]struct{}),
+		Clock:       time.Now,
+	}
+	for _, interval := range intervals {
+		a.series[interval] = []Candle{}
+		a.subscribers[interval] = make(map[chan Candle]struct{})
+	}
+	return a
+}
+
+// ParseInterval parses intervals such as 1s, 1m, 5m or 1h
+func ParseInterval(s string) (time.Duration, error) {
+	interval, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if interval <= 0 {
+		return 0, fmt.Errorf("invalid interval: %s", s)
+	}
+	return interval, nil
+}
+
+// Intervals returns the maintained intervals in ascending order
+func (a *Aggregator) Intervals() []time.Duration {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	intervals := make([]time.Duration, 0, len(a.series))
+	for interval := range a.series {
+		intervals = append(intervals, interval)
+	}
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i] < intervals[j] })
+	return intervals
+}
+
+// Backfill rebuilds the bars from trades in time order, typically loaded from the trade history
+func (a *Aggregator) Backfill(trades []orderbook.Trade) {
+	for _, trade := range trades {
+		a.AddTrade(trade)
+	}
+}
+
+// AddTrade updates the bar containing the trade in every interval and notifies subscribers
+func (a *Aggregator) AddTrade(trade orderbook.Trade) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for interval, candles := range a.series {
+		start := trade.Timestamp.Truncate(interval)
+		n := len(candles)
+		if n > 0 && start.Before(candles[n-1].Start) {
+			// Late trades for a bar that has already been superseded are ignored
+			continue
+		}
+		if n == 0 || start.After(candles[n-1].Start) {
+			candles = fillGap(candles, interval, start, a.capacity)
+			candles = append(candles, Candle{
+				Start:    start,
+				Interval: interval,
+				Open:     trade.ExecPrice(),
+				High:     trade.ExecPrice(),
+				Low:      trade.ExecPrice(),
+				Close:    trade.ExecPrice(),
+			})
+			if len(candles) > a.capacity {
+				candles = candles[len(candles)-a.capacity:]
+			}
+			n = len(candles)
+		}
+		candle := &candles[n-1]
+		price := trade.ExecPrice()
+		candle.High = max(candle.High, price)
+		candle.Low = min(candle.Low, price)
+		candle.Close = price
+		candle.Volume += trade.Qty()
+		candle.Trades++
+		a.series[interval] = candles
+		a.publish(interval, *candle)
+	}
+}
+
+// Candles returns the bars of an interval starting in [from, to), zero values leave the range open.
+// Bars are extended with flat bars up to to, or up to the current time when to is in the future
+func (a *Aggregator) Candles(interval time.Duration, from time.Time, to time.Time) ([]Candle, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	candles, ok := a.series[interval]
+	if !ok {
+		return nil, fmt.Errorf("unsupported interval: %s", interval)
+	}
+	end := a.Clock().Truncate(interval).Add(interval)
+	if !to.IsZero() && to.Before(end) {
+		end = to
+	}
+	if len(candles) > 0 {
+		candles = fillGap(append([]Candle{}, candles...), interval, end, a.capacity)
+	}
+	result := []Candle{}
+	for _, candle := range candles {
+		if !from.IsZero() && candle.Start.Before(from) {
+			continue
+		}
+		if !candle.Start.Before(end) {
+			break
+		}
+		result = append(result, candle)
+	}
+	return result, nil
+}
+
+// Subscribe returns a channel receiving every update to the bars of an interval
+// and a function to stop the subscription. Updates are dropped when the channel is full
+func (a *Aggregator) Subscribe(interval time.Duration) (<-chan Candle, func(), error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	subscribers, ok := a.subscribers[interval]
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported interval: %s", interval)
+	}
+	ch := make(chan Candle, subscriberBuffer)
+	subscribers[ch] = struct{}{}
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			delete(subscribers, ch)
+			close(ch)
+		})
+	}
+	return ch, cancel, nil
+}
+
+func (a *Aggregator) publish(interval time.Duration, candle Candle) {
+	for ch := range a.subscribers[interval] {
+		select {
+		case ch <- candle:
+		default:
+		}
+	}
+}
+
+// fillGap appends flat bars at the last close for every interval missing before end,
+// generating at most limit of the most recent ones
+func fillGap(candles []Candle, interval time.Duration, end time.Time, limit int) []Candle {
+	if len(candles) == 0 {
+		return candles
+	}
+	last := candles[len(candles)-1]
+	first := last.Start.Add(interval)
+	if missing := int(end.Sub(first) / interval); missing > limit {
+		first = first.Add(time.Duration(missing-limit) * interval)
+	}
+	for next := first; next.Before(end); next = next.Add(interval) {
+		candles = append(candles, Candle{
+			Start:    next,
+			Interval: interval,
+			Open:     last.Close,
+			High:     last.Close,
+			Low:      last.Close,
+			Close:    last.Close,
+		})
+	}
+	return candles
+}
@@ -0,0 +1,92 @@
+package candles
+
+import (
+	"testing"
+	"time"
+
+	"github.com/EliasManj/orderbook/orderbook"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func createTrade(offset time.Duration, price orderbook.Price, qty orderbook.Quantity) orderbook.Trade {
+	return orderbook.Trade{
+		Timestamp: start.Add(offset),
+		BidTrade:  orderbook.TradeInfo{Price: price, Qty: qty, Liquidity: orderbook.Maker},
+		AskTrade:  orderbook.TradeInfo{Price: price, Qty: qty, Liquidity: orderbook.Taker},
+	}
+}
+
+func createAggregator(now time.Time) *Aggregator {
+	a := NewAggregator(time.Minute, 5*time.Minute)
+	a.Clock = func() time.Time { return now }
+	return a
+}
+
+func TestAggregatorOHLCV(t *testing.T) {
+	a := createAggregator(start.Add(2 * time.Minute))
+	a.AddTrade(createTrade(1*time.Second, 100, 5))
+	a.AddTrade(createTrade(10*time.Second, 110, 1))
+	a.AddTrade(createTrade(20*time.Second, 95, 2))
+	a.AddTrade(createTrade(30*time.Second, 105, 3))
+	a.AddTrade(createTrade(70*time.Second, 107, 4))
+
+	bars, err := a.Candles(time.Minute, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, bars, 3)
+	require.Equal(t, Candle{Start: start, Interval: time.Minute, Open: 100, High: 110, Low: 95, Close: 105, Volume: 11, Trades: 4}, bars[0])
+	require.Equal(t, Candle{Start: start.Add(time.Minute), Interval: time.Minute, Open: 107, High: 107, Low: 107, Close: 107, Volume: 4, Trades: 1}, bars[1])
+	// The current interval has no trades yet and is reported flat
+	require.Equal(t, orderbook.Quantity(0), bars[2].Volume)
+
+	bars, err = a.Candles(5*time.Minute, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, bars, 1)
+	require.Equal(t, orderbook.Price(95), bars[0].Low)
+	require.Equal(t, orderbook.Price(107), bars[0].Close)
+	require.Equal(t, orderbook.Quantity(15), bars[0].Volume)
+
+	_, err = a.Candles(time.Hour, time.Time{}, time.Time{})
+	require.Error(t, err)
+}
+
+func TestAggregatorEmptyIntervals(t *testing.T) {
+	a := createAggregator(start.Add(10 * time.Minute))
+	a.AddTrade(createTrade(0, 100, 1))
+	a.AddTrade(createTrade(4*time.Minute, 120, 1))
+
+	bars, err := a.Candles(time.Minute, start, start.Add(6*time.Minute))
+	require.NoError(t, err)
+	require.Len(t, bars, 6)
+	for i := 1; i <= 3; i++ {
+		require.Equal(t, start.Add(time.Duration(i)*time.Minute), bars[i].Start)
+		require.Equal(t, orderbook.Price(100), bars[i].Open)
+		require.Equal(t, orderbook.Price(100), bars[i].Close)
+		require.Equal(t, 0, bars[i].Trades)
+	}
+	require.Equal(t, orderbook.Price(120), bars[4].Close)
+	require.Equal(t, orderbook.Price(120), bars[5].Open)
+
+	bars, err = a.Candles(time.Minute, start.Add(2*time.Minute), start.Add(4*time.Minute))
+	require.NoError(t, err)
+	require.Len(t, bars, 2)
+}
+
+func TestAggregatorSubscribe(t *testing.T) {
+	a := createAggregator(start)
+	ch, cancel, err := a.Subscribe(time.Minute)
+	require.NoError(t, err)
+	a.Backfill([]orderbook.Trade{createTrade(0, 100, 1), createTrade(time.Second, 101, 2)})
+
+	first := <-ch
+	require.Equal(t, orderbook.Price(100), first.Close)
+	second := <-ch
+	require.Equal(t, orderbook.Price(101), second.Close)
+	require.Equal(t, orderbook.Quantity(3), second.Volume)
+
+	cancel()
+	_, open := <-ch
+	require.False(t, open)
+	cancel()
+}
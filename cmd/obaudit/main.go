@@ -0,0 +1,46 @@
+// Command obaudit checks the audit log written by the server.
+//
+//	obaudit [-dir audit] verify
+//
+// verify walks the hash chain of every file in order and prints the number of records and
+// the hash of the last one, which can be kept elsewhere to detect records removed from the
+// end. It exits with status 1 and the file and line where the chain breaks otherwise.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/EliasManj/orderbook/audit"
+)
+
+func main() {
+	dir := flag.String("dir", "audit", "audit log directory")
+	flag.Parse()
+	if err := run(*dir, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "obaudit:", err)
+		os.Exit(1)
+	}
+}
+
+func run(dir string, args []string) error {
+	if len(args) == 0 {
+		return errors.New("expected a command: verify")
+	}
+	switch args[0] {
+	case "verify":
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", dir)
+		}
+		summary, err := audit.Verify(dir)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("ok      %d records in %d files\nlast    %s\n", summary.Records, summary.Files, summary.LastHash)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
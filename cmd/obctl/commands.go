@@ -0,0 +1,378 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EliasManj/orderbook/auth"
+	"github.com/EliasManj/orderbook/grpcapi"
+	"github.com/EliasManj/orderbook/grpcapi/pb"
+	"github.com/EliasManj/orderbook/history"
+	"github.com/EliasManj/orderbook/orderbook"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// requestTimeout bounds every unary call and HTTP request
+const requestTimeout = 10 * time.Second
+
+// cli holds the connections of a command, opened on first use
+type cli struct {
+	cfg    config
+	stdout io.Writer
+	conn   *grpc.ClientConn
+}
+
+func (c *cli) client() (pb.OrderBookClient, error) {
+	if c.conn == nil {
+		opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+		if c.cfg.Key != "" {
+			opts = append(opts, grpcapi.Signer{Key: c.cfg.Key, Secret: c.cfg.Secret}.DialOptions()...)
+		}
+		conn, err := grpc.NewClient(c.cfg.GRPC, opts...)
+		if err != nil {
+			return nil, err
+		}
+		c.conn = conn
+	}
+	return pb.NewOrderBookClient(c.conn), nil
+}
+
+func (c *cli) close() {
+	if c.conn != nil {
+		c.conn.Close()
+	}
+}
+
+// call runs a unary call with the request timeout, turning gRPC errors into plain messages
+func call[T any](c *cli, fn func(ctx context.Context, client pb.OrderBookClient) (T, error)) (T, error) {
+	var zero T
+	client, err := c.client()
+	if err != nil {
+		return zero, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	result, err := fn(ctx, client)
+	if err != nil {
+		return zero, errors.New(status.Convert(err).Message())
+	}
+	return result, nil
+}
+
+var placeArgs struct {
+	side    string
+	typ     string
+	price   float64
+	qty     int
+	account string
+}
+
+func placeFlags(fs *flag.FlagSet) {
+	fs.StringVar(&placeArgs.side, "side", "", "buy or sell")
+	fs.StringVar(&placeArgs.typ, "type", "gtc", "gtc, fak, fok or market")
+	fs.Float64Var(&placeArgs.price, "price", 0, "limit price, not used by market orders")
+	fs.IntVar(&placeArgs.qty, "qty", 0, "quantity")
+	fs.StringVar(&placeArgs.account, "account", "", "account the order is placed for")
+}
+
+var orderTypes = map[string]pb.OrderType{
+	"gtc":    pb.OrderType_ORDER_TYPE_GOOD_TIL_CANCELLED,
+	"fak":    pb.OrderType_ORDER_TYPE_FILL_AND_KILL,
+	"ioc":    pb.OrderType_ORDER_TYPE_FILL_AND_KILL,
+	"fok":    pb.OrderType_ORDER_TYPE_FILL_OR_KILL,
+	"market": pb.OrderType_ORDER_TYPE_MARKET,
+}
+
+func runPlace(c *cli, fs *flag.FlagSet, args []string) error {
+	req := &pb.SubmitOrderRequest{Price: placeArgs.price, Quantity: int32(placeArgs.qty), Account: placeArgs.account}
+	switch strings.ToLower(placeArgs.side) {
+	case "buy", "b":
+		req.Side = pb.Side_SIDE_BUY
+	case "sell", "s":
+		req.Side = pb.Side_SIDE_SELL
+	default:
+		fs.Usage()
+		return errUsage
+	}
+	typ, ok := orderTypes[strings.ToLower(placeArgs.typ)]
+	if !ok {
+		return fmt.Errorf("unknown order type %q, expected gtc, fak, fok or market", placeArgs.typ)
+	}
+	req.Type = typ
+	resp, err := call(c, func(ctx context.Context, client pb.OrderBookClient) (*pb.SubmitOrderResponse, error) {
+		return client.SubmitOrder(ctx, req)
+	})
+	if err != nil {
+		return err
+	}
+	if c.cfg.Output == "json" {
+		return writeJSON(c.stdout, resp)
+	}
+	writeOrders(c.stdout, resp.Order)
+	if len(resp.Trades) > 0 {
+		fmt.Fprintln(c.stdout)
+		writeTrades(c.stdout, resp.Trades...)
+	}
+	return nil
+}
+
+// orderId parses the single order id argument of a command
+func orderId(fs *flag.FlagSet, args []string) (uint64, error) {
+	if len(args) != 1 {
+		fs.Usage()
+		return 0, errUsage
+	}
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid order id %q", args[0])
+	}
+	return id, nil
+}
+
+func runCancel(c *cli, fs *flag.FlagSet, args []string) error {
+	id, err := orderId(fs, args)
+	if err != nil {
+		return err
+	}
+	resp, err := call(c, func(ctx context.Context, client pb.OrderBookClient) (*pb.CancelOrderResponse, error) {
+		return client.CancelOrder(ctx, &pb.CancelOrderRequest{OrderId: id})
+	})
+	if err != nil {
+		return err
+	}
+	if c.cfg.Output == "json" {
+		return writeJSON(c.stdout, resp)
+	}
+	writeOrders(c.stdout, resp.Order)
+	return nil
+}
+
+var modifyArgs struct {
+	price float64
+	qty   int
+}
+
+func modifyFlags(fs *flag.FlagSet) {
+	fs.Float64Var(&modifyArgs.price, "price", 0, "new price")
+	fs.IntVar(&modifyArgs.qty, "qty", 0, "new total quantity, including what was already filled")
+}
+
+func runModify(c *cli, fs *flag.FlagSet, args []string) error {
+	id, err := orderId(fs, args)
+	if err != nil {
+		return err
+	}
+	req := &pb.ModifyOrderRequest{OrderId: id, Price: modifyArgs.price, Quantity: int32(modifyArgs.qty)}
+	resp, err := call(c, func(ctx context.Context, client pb.OrderBookClient) (*pb.ModifyOrderResponse, error) {
+		return client.ModifyOrder(ctx, req)
+	})
+	if err != nil {
+		return err
+	}
+	if c.cfg.Output == "json" {
+		return writeJSON(c.stdout, resp)
+	}
+	writeOrders(c.stdout, resp.Order)
+	if len(resp.Trades) > 0 {
+		fmt.Fprintln(c.stdout)
+		writeTrades(c.stdout, resp.Trades...)
+	}
+	return nil
+}
+
+func runStatus(c *cli, fs *flag.FlagSet, args []string) error {
+	id, err := orderId(fs, args)
+	if err != nil {
+		return err
+	}
+	order, err := call(c, func(ctx context.Context, client pb.OrderBookClient) (*pb.Order, error) {
+		return client.GetOrder(ctx, &pb.GetOrderRequest{OrderId: id})
+	})
+	if err != nil {
+		return err
+	}
+	if c.cfg.Output == "json" {
+		return writeJSON(c.stdout, order)
+	}
+	writeOrders(c.stdout, order)
+	return nil
+}
+
+var depthArgs struct {
+	levels int
+}
+
+func depthFlags(fs *flag.FlagSet) {
+	fs.IntVar(&depthArgs.levels, "levels", 10, "price levels per side, 0 for all")
+}
+
+func runDepth(c *cli, fs *flag.FlagSet, args []string) error {
+	depth, err := call(c, func(ctx context.Context, client pb.OrderBookClient) (*pb.Depth, error) {
+		return client.GetDepth(ctx, &pb.GetDepthRequest{Levels: int32(depthArgs.levels)})
+	})
+	if err != nil {
+		return err
+	}
+	if c.cfg.Output == "json" {
+		return writeJSON(c.stdout, depth)
+	}
+	writeLadder(c.stdout, depth)
+	return nil
+}
+
+var tradesArgs struct {
+	limit   int
+	account string
+	order   uint64
+}
+
+func tradesFlags(fs *flag.FlagSet) {
+	fs.IntVar(&tradesArgs.limit, "limit", 20, "number of trades")
+	fs.StringVar(&tradesArgs.account, "account", "", "only trades of this account")
+	fs.Uint64Var(&tradesArgs.order, "order", 0, "only trades of this order id")
+}
+
+func runTrades(c *cli, fs *flag.FlagSet, args []string) error {
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(tradesArgs.limit))
+	if tradesArgs.account != "" {
+		query.Set("account", tradesArgs.account)
+	}
+	if tradesArgs.order != 0 {
+		query.Set("order_id", strconv.FormatUint(tradesArgs.order, 10))
+	}
+	client := &http.Client{Timeout: requestTimeout}
+	if c.cfg.Key != "" {
+		client.Transport = &auth.Transport{Key: c.cfg.Key, Secret: c.cfg.Secret}
+	}
+	resp, err := client.Get(strings.TrimRight(c.cfg.HTTP, "/") + "/trades?" + query.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var page history.Page
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return err
+	}
+	trades := make([]*pb.Trade, 0, len(page.Trades))
+	for _, trade := range page.Trades {
+		trades = append(trades, toTrade(trade))
+	}
+	if c.cfg.Output == "json" {
+		return writeJSONList(c.stdout, trades)
+	}
+	writeTrades(c.stdout, trades...)
+	return nil
+}
+
+// toTrade converts a trade of the HTTP history to the message streamed over gRPC
+func toTrade(trade orderbook.Trade) *pb.Trade {
+	side := func(info orderbook.TradeInfo) *pb.TradeSide {
+		liquidity := pb.Liquidity_LIQUIDITY_TAKER
+		if info.Liquidity == orderbook.Maker {
+			liquidity = pb.Liquidity_LIQUIDITY_MAKER
+		}
+		return &pb.TradeSide{OrderId: uint64(info.OrderId), Price: float64(info.Price), Account: info.Account, Liquidity: liquidity, Fee: info.Fee}
+	}
+	return &pb.Trade{
+		TradeId:  int64(trade.Id),
+		Time:     timestamppb.New(trade.Timestamp),
+		Price:    float64(trade.ExecPrice()),
+		Quantity: int32(trade.Qty()),
+		Bid:      side(trade.BidTrade),
+		Ask:      side(trade.AskTrade),
+	}
+}
+
+var watchArgs struct {
+	depth  bool
+	levels int
+}
+
+func watchFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&watchArgs.depth, "depth", false, "stream the depth instead of trades")
+	fs.IntVar(&watchArgs.levels, "levels", 10, "price levels per side for -depth, 0 for all")
+}
+
+func runWatch(c *cli, fs *flag.FlagSet, args []string) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if watchArgs.depth {
+		stream, err := client.SubscribeDepth(ctx, &pb.SubscribeDepthRequest{Levels: int32(watchArgs.levels)})
+		if err != nil {
+			return err
+		}
+		return watch(ctx, stream.Recv, func(depth *pb.Depth) error {
+			if c.cfg.Output == "json" {
+				return writeJSONLine(c.stdout, depth)
+			}
+			if isTerminal(c.stdout) {
+				fmt.Fprint(c.stdout, "\033[H\033[2J")
+			}
+			fmt.Fprintf(c.stdout, "%s  %s\n", depth.Symbol, time.Now().Format(time.TimeOnly))
+			writeLadder(c.stdout, depth)
+			return nil
+		})
+	}
+	stream, err := client.SubscribeTrades(ctx, &pb.SubscribeTradesRequest{})
+	if err != nil {
+		return err
+	}
+	if c.cfg.Output == "table" {
+		writeTradeHeader(c.stdout)
+	}
+	return watch(ctx, stream.Recv, func(trade *pb.Trade) error {
+		if c.cfg.Output == "json" {
+			return writeJSONLine(c.stdout, trade)
+		}
+		writeTradeRow(c.stdout, trade)
+		return nil
+	})
+}
+
+// watch prints every message of a stream until it ends or ctx is cancelled
+func watch[T any](ctx context.Context, recv func() (T, error), print func(T) error) error {
+	for {
+		msg, err := recv()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return errors.New(status.Convert(err).Message())
+		}
+		if err := print(msg); err != nil {
+			return err
+		}
+	}
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,206 @@
+// Command obctl works with a running order book from the terminal.
+//
+//	obctl [flags] <command> [flags] [args]
+//
+// Orders and market data go through the gRPC service, the trade history through the HTTP API.
+// Server addresses come from flags, then the OBCTL_GRPC and OBCTL_HTTP environment variables,
+// then the JSON config file at $HOME/.config/obctl/config.json, for example
+//
+//	{"grpc": "localhost:9090", "http": "http://localhost:8080", "output": "table"}
+//
+// Against a server with API keys, requests are signed with the key and secret of the
+// -key and -secret flags, the ORDERBOOK_API_KEY and ORDERBOOK_API_SECRET variables or the
+// "key" and "secret" entries of the config file
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// config holds the settings shared by every command
+type config struct {
+	GRPC   string `json:"grpc"`
+	HTTP   string `json:"http"`
+	Output string `json:"output"`
+	Key    string `json:"key"`
+	Secret string `json:"secret"`
+}
+
+var defaultConfig = config{GRPC: "localhost:9090", HTTP: "http://localhost:8080", Output: "table"}
+
+// errUsage reports bad arguments, the usage has already been printed
+var errUsage = errors.New("usage")
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(c *cli, fs *flag.FlagSet, args []string) error
+	flags   func(fs *flag.FlagSet)
+}
+
+var commands []command
+
+func init() {
+	// Assigned here because the commands print the usage, which lists the commands
+	commands = []command{
+		{name: "place", args: "-side buy|sell -qty N [-price P]", summary: "place an order", run: runPlace, flags: placeFlags},
+		{name: "cancel", args: "<order-id>", summary: "cancel a resting order", run: runCancel},
+		{name: "modify", args: "<order-id> -price P -qty N", summary: "change the price and total quantity of a resting order", run: runModify, flags: modifyFlags},
+		{name: "status", args: "<order-id>", summary: "show a resting order", run: runStatus},
+		{name: "depth", args: "[-levels N]", summary: "show the book as a price ladder", run: runDepth, flags: depthFlags},
+		{name: "trades", args: "[-limit N] [-account A] [-order ID]", summary: "list recent trades, newest first", run: runTrades, flags: tradesFlags},
+		{name: "watch", args: "[-depth] [-levels N]", summary: "stream trades, or the depth with -depth, until interrupted", run: runWatch, flags: watchFlags},
+	}
+}
+
+func main() {
+	err := run(os.Args[1:], os.Stdout, os.Stderr)
+	if errors.Is(err, errUsage) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "obctl:", err)
+		os.Exit(1)
+	}
+}
+
+// run parses the global flags and runs a command
+func run(args []string, stdout io.Writer, stderr io.Writer) error {
+	cfg := defaultConfig
+	configPath := ""
+	if home, err := os.UserHomeDir(); err == nil {
+		configPath = filepath.Join(home, ".config", "obctl", "config.json")
+	}
+	// The config file is read before the flags so that flags override it
+	for i, arg := range args {
+		if (arg == "-config" || arg == "--config") && i+1 < len(args) {
+			configPath = args[i+1]
+		} else if v, ok := strings.CutPrefix(strings.TrimLeft(arg, "-"), "config="); ok {
+			configPath = v
+		}
+	}
+	if err := loadConfig(configPath, &cfg); err != nil {
+		return err
+	}
+	if v := os.Getenv("OBCTL_GRPC"); v != "" {
+		cfg.GRPC = v
+	}
+	if v := os.Getenv("OBCTL_HTTP"); v != "" {
+		cfg.HTTP = v
+	}
+	if v := os.Getenv("ORDERBOOK_API_KEY"); v != "" {
+		cfg.Key = v
+	}
+	if v := os.Getenv("ORDERBOOK_API_SECRET"); v != "" {
+		cfg.Secret = v
+	}
+
+	fs := flag.NewFlagSet("obctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { usage(stderr) }
+	fs.String("config", configPath, "config file")
+	commonFlags(fs, &cfg)
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() == 0 {
+		usage(stderr)
+		return errUsage
+	}
+	for _, cmd := range commands {
+		if cmd.name != fs.Arg(0) {
+			continue
+		}
+		sub := flag.NewFlagSet("obctl "+cmd.name, flag.ContinueOnError)
+		sub.SetOutput(stderr)
+		sub.Usage = func() {
+			fmt.Fprintf(stderr, "usage: obctl %s %s\n", cmd.name, cmd.args)
+			sub.PrintDefaults()
+		}
+		commonFlags(sub, &cfg)
+		if cmd.flags != nil {
+			cmd.flags(sub)
+		}
+		if err := sub.Parse(interleave(fs.Args()[1:])); err != nil {
+			return errUsage
+		}
+		if cfg.Output != "table" && cfg.Output != "json" {
+			return fmt.Errorf("unknown output %q, expected table or json", cfg.Output)
+		}
+		c := &cli{cfg: cfg, stdout: stdout}
+		defer c.close()
+		return cmd.run(c, sub, sub.Args())
+	}
+	fmt.Fprintf(stderr, "obctl: unknown command %q\n", fs.Arg(0))
+	usage(stderr)
+	return errUsage
+}
+
+func commonFlags(fs *flag.FlagSet, cfg *config) {
+	fs.StringVar(&cfg.GRPC, "grpc", cfg.GRPC, "gRPC address of the order book")
+	fs.StringVar(&cfg.HTTP, "http", cfg.HTTP, "base URL of the HTTP API")
+	fs.StringVar(&cfg.Output, "o", cfg.Output, "output format, table or json")
+	fs.StringVar(&cfg.Key, "key", cfg.Key, "API key to sign requests with")
+	fs.StringVar(&cfg.Secret, "secret", cfg.Secret, "secret of the API key")
+}
+
+// loadConfig reads the config file at path over cfg, a missing file is not an error
+func loadConfig(path string, cfg *config) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	return nil
+}
+
+// interleave moves positional arguments after the flags so that both
+// "modify 42 -price 10 -qty 5" and "modify -price 10 -qty 5 42" work
+func interleave(args []string) []string {
+	flags, positional := []string{}, []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			positional = append(positional, args[i+1:]...)
+			return append(append(flags, "--"), positional...)
+		case strings.HasPrefix(arg, "-"):
+			flags = append(flags, arg)
+			name := strings.TrimLeft(arg, "-")
+			if !strings.Contains(name, "=") && !boolFlags[name] && i+1 < len(args) {
+				flags = append(flags, args[i+1])
+				i++
+			}
+		default:
+			positional = append(positional, arg)
+		}
+	}
+	return append(append(flags, "--"), positional...)
+}
+
+// boolFlags are the flags that take no value
+var boolFlags = map[string]bool{"depth": true}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: obctl [-grpc addr] [-http url] [-o table|json] [-config file] <command> [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-7s %s\n", cmd.name, cmd.summary)
+	}
+}
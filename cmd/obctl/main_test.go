@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/EliasManj/orderbook/api"
+	"github.com/EliasManj/orderbook/grpcapi"
+	"github.com/stretchr/testify/require"
+)
+
+func startServers(t *testing.T) (string, string) {
+	server := grpcapi.NewServer(api.DefaultExchange())
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.Serve(l)
+	t.Cleanup(server.Close)
+	httpServer := httptest.NewServer(api.NewRouter())
+	t.Cleanup(httpServer.Close)
+	return l.Addr().String(), httpServer.URL
+}
+
+// obctl runs a command against the test servers, returning its output
+func obctl(t *testing.T, grpcAddr string, httpURL string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	args = append([]string{"-config", "", "-grpc", grpcAddr, "-http", httpURL}, args...)
+	err := run(args, &stdout, &stderr)
+	return stdout.String() + stderr.String(), err
+}
+
+func TestCommands(t *testing.T) {
+	grpcAddr, httpURL := startServers(t)
+
+	out, err := obctl(t, grpcAddr, httpURL, "place", "-side", "sell", "-price", "5000", "-qty", "10", "-account", "cli", "-o", "json")
+	require.NoError(t, err, out)
+	var placed struct {
+		Order struct {
+			OrderId string `json:"order_id"`
+			Status  string `json:"status"`
+		} `json:"order"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(out), &placed), out)
+	require.Equal(t, "ORDER_STATUS_NEW", placed.Order.Status)
+	id := placed.Order.OrderId
+
+	out, err = obctl(t, grpcAddr, httpURL, "place", "-side", "buy", "-type", "fak", "-price", "5000", "-qty", "3")
+	require.NoError(t, err, out)
+	require.Contains(t, out, "filled")
+	require.Contains(t, out, "AGGRESSOR")
+
+	// Positional arguments may come before or after the flags
+	out, err = obctl(t, grpcAddr, httpURL, "modify", id, "-price", "5001", "-qty", "12")
+	require.NoError(t, err, out)
+	require.Contains(t, out, "5001.00")
+	out, err = obctl(t, grpcAddr, httpURL, "status", "-o", "json", id)
+	require.NoError(t, err, out)
+	require.Contains(t, out, `"remaining_quantity": 9`)
+
+	out, err = obctl(t, grpcAddr, httpURL, "depth", "-levels", "1")
+	require.NoError(t, err, out)
+	require.Contains(t, out, "PRICE")
+	require.Contains(t, out, "5001.00  9")
+
+	out, err = obctl(t, grpcAddr, httpURL, "trades", "-order", id, "-o", "json")
+	require.NoError(t, err, out)
+	var trades []struct {
+		Quantity int `json:"quantity"`
+		Ask      struct {
+			OrderId string `json:"order_id"`
+		} `json:"ask"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(out), &trades), out)
+	require.Len(t, trades, 1)
+	require.Equal(t, 3, trades[0].Quantity)
+	require.Equal(t, id, trades[0].Ask.OrderId)
+
+	out, err = obctl(t, grpcAddr, httpURL, "cancel", id)
+	require.NoError(t, err, out)
+	require.Contains(t, out, "cancelled")
+	out, err = obctl(t, grpcAddr, httpURL, "cancel", id)
+	require.ErrorContains(t, err, "order "+id+" is not resting")
+
+	_, err = obctl(t, grpcAddr, httpURL, "status")
+	require.ErrorIs(t, err, errUsage)
+	_, err = obctl(t, grpcAddr, httpURL, "unknown")
+	require.ErrorIs(t, err, errUsage)
+	_, err = obctl(t, grpcAddr, httpURL, "depth", "-o", "yaml")
+	require.ErrorContains(t, err, "unknown output")
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"grpc": "file:1", "http": "http://file", "output": "json"}`), 0644))
+	cfg := defaultConfig
+	require.NoError(t, loadConfig(path, &cfg))
+	require.Equal(t, config{GRPC: "file:1", HTTP: "http://file", Output: "json"}, cfg)
+	require.NoError(t, loadConfig(filepath.Join(t.TempDir(), "missing.json"), &cfg))
+
+	// The environment overrides the file and flags override both
+	t.Setenv("OBCTL_GRPC", "127.0.0.1:1")
+	var stdout, stderr bytes.Buffer
+	err := run([]string{"-config", path, "-o", "table", "status", "-grpc", "127.0.0.1:2", strconv.Itoa(1)}, &stdout, &stderr)
+	require.ErrorContains(t, err, "127.0.0.1:2")
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/EliasManj/orderbook/grpcapi/pb"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+var jsonOptions = protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}
+
+// marshal encodes a message on one line. protojson varies its whitespace on purpose,
+// compacting gives output that is stable between runs
+func marshal(msg proto.Message) ([]byte, error) {
+	data, err := jsonOptions.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeJSON prints an indented message
+func writeJSON(w io.Writer, msg proto.Message) error {
+	data, err := marshal(msg)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	json.Indent(&buf, data, "", "  ")
+	_, err = fmt.Fprintln(w, buf.String())
+	return err
+}
+
+// writeJSONList prints messages as a JSON array, one message per line
+func writeJSONList[T proto.Message](w io.Writer, msgs []T) error {
+	lines := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		data, err := marshal(msg)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, "  "+string(data))
+	}
+	if len(lines) == 0 {
+		_, err := fmt.Fprintln(w, "[]")
+		return err
+	}
+	_, err := fmt.Fprintf(w, "[\n%s\n]\n", strings.Join(lines, ",\n"))
+	return err
+}
+
+// writeJSONLine prints a message on a single line, for streams
+func writeJSONLine(w io.Writer, msg proto.Message) error {
+	data, err := marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// enumName shortens ORDER_STATUS_PARTIALLY_FILLED to partially_filled
+func enumName(name string, prefix string) string {
+	return strings.ToLower(strings.TrimPrefix(name, prefix))
+}
+
+func formatPrice(p float64) string {
+	return strconv.FormatFloat(p, 'f', 2, 64)
+}
+
+func writeOrders(w io.Writer, orders ...*pb.Order) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "ORDER\tSIDE\tTYPE\tPRICE\tQTY\tFILLED\tLEFT\tSTATUS\tACCOUNT\t")
+	for _, o := range orders {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%d\t%d\t%d\t%s\t%s\t\n",
+			o.OrderId,
+			enumName(o.Side.String(), "SIDE_"),
+			enumName(o.Type.String(), "ORDER_TYPE_"),
+			formatPrice(o.Price),
+			o.Quantity,
+			o.FilledQuantity,
+			o.RemainingQuantity,
+			enumName(o.Status.String(), "ORDER_STATUS_"),
+			o.Account)
+	}
+	tw.Flush()
+}
+
+// tradeFormat lays out trade rows with fixed widths so streamed rows line up
+const tradeFormat = "%8s  %-12s  %10s  %6s  %12s  %12s  %s\n"
+
+func writeTradeHeader(w io.Writer) {
+	fmt.Fprintf(w, tradeFormat, "TRADE", "TIME", "PRICE", "QTY", "BUY ORDER", "SELL ORDER", "AGGRESSOR")
+}
+
+func writeTradeRow(w io.Writer, t *pb.Trade) {
+	aggressor := "sell"
+	if t.Bid.GetLiquidity() == pb.Liquidity_LIQUIDITY_TAKER {
+		aggressor = "buy"
+	}
+	fmt.Fprintf(w, tradeFormat,
+		strconv.FormatInt(t.TradeId, 10),
+		t.Time.AsTime().Local().Format(time.TimeOnly+".000"),
+		formatPrice(t.Price),
+		strconv.Itoa(int(t.Quantity)),
+		strconv.FormatUint(t.Bid.GetOrderId(), 10),
+		strconv.FormatUint(t.Ask.GetOrderId(), 10),
+		aggressor)
+}
+
+func writeTrades(w io.Writer, trades ...*pb.Trade) {
+	writeTradeHeader(w)
+	for _, t := range trades {
+		writeTradeRow(w, t)
+	}
+}
+
+// writeLadder prints the book as a price ladder, asks above bids with the best prices
+// meeting in the middle and a bar sized by quantity next to each level
+func writeLadder(w io.Writer, depth *pb.Depth) {
+	const barWidth = 20
+	var largest int32 = 1
+	for _, level := range append(append([]*pb.Level{}, depth.Bids...), depth.Asks...) {
+		largest = max(largest, level.Quantity)
+	}
+	bar := func(qty int32) string {
+		return strings.Repeat("#", int((int64(qty)*barWidth+int64(largest)-1)/int64(largest)))
+	}
+	fmt.Fprintf(w, "%*s %8s  %10s  %-8s %s\n", barWidth, "", "BID", "PRICE", "ASK", "")
+	for i := len(depth.Asks) - 1; i >= 0; i-- {
+		level := depth.Asks[i]
+		fmt.Fprintf(w, "%*s %8s  %10s  %-8d %s\n", barWidth, "", "", formatPrice(level.Price), level.Quantity, bar(level.Quantity))
+	}
+	if len(depth.Asks) > 0 && len(depth.Bids) > 0 {
+		fmt.Fprintf(w, "%*s %8s  %10s\n", barWidth, "", "", "spread "+formatPrice(depth.Asks[0].Price-depth.Bids[0].Price))
+	}
+	for _, level := range depth.Bids {
+		fmt.Fprintf(w, "%*s %8d  %10s\n", barWidth, bar(level.Quantity), level.Quantity, formatPrice(level.Price))
+	}
+}
@@ -0,0 +1,98 @@
+// Command obkeys manages the API keys of the HTTP API in the local key store file.
+//
+//	obkeys [-file apikeys.json] add -account alice [-permission trade] [-tier default]
+//	obkeys [-file apikeys.json] list
+//	obkeys [-file apikeys.json] revoke <key>
+//
+// add prints the new key and its secret, the secret is not shown again by list.
+// The server reads the file when it starts.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/EliasManj/orderbook/auth"
+)
+
+func main() {
+	file := flag.String("file", "apikeys.json", "key store file")
+	flag.Parse()
+	if err := run(*file, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "obkeys:", err)
+		os.Exit(1)
+	}
+}
+
+func run(file string, args []string) error {
+	if len(args) == 0 {
+		return errors.New("expected a command: add, list or revoke")
+	}
+	keys, err := load(file)
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "add":
+		fs := flag.NewFlagSet("add", flag.ExitOnError)
+		account := fs.String("account", "", "account the key trades for")
+		permission := fs.String("permission", string(auth.Trade), "read, trade or admin")
+		tier := fs.String("tier", "", "rate limit tier, the default tier when empty")
+		fs.Parse(args[1:])
+		if *account == "" {
+			return errors.New("add needs -account")
+		}
+		perm := auth.Permission(*permission)
+		if !perm.Allows(auth.Read) {
+			return fmt.Errorf("unknown permission %q", *permission)
+		}
+		key, err := auth.NewKey(*account, perm)
+		if err != nil {
+			return err
+		}
+		key.Tier = *tier
+		if err := auth.Save(file, append(keys, key)); err != nil {
+			return err
+		}
+		fmt.Printf("key    %s\nsecret %s\n", key.Key, key.Secret)
+		return nil
+	case "list":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KEY\tACCOUNT\tPERMISSION\tTIER")
+		for _, key := range keys {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", key.Key, key.Account, key.Permission, key.Tier)
+		}
+		return w.Flush()
+	case "revoke":
+		if len(args) != 2 {
+			return errors.New("revoke takes a key")
+		}
+		kept := []auth.Key{}
+		for _, key := range keys {
+			if key.Key != args[1] {
+				kept = append(kept, key)
+			}
+		}
+		if len(kept) == len(keys) {
+			return fmt.Errorf("unknown key %s", args[1])
+		}
+		return auth.Save(file, kept)
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// load reads the keys of the store file, none when it does not exist yet
+func load(file string) ([]auth.Key, error) {
+	ks, err := auth.Load(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ks.Keys(), nil
+}
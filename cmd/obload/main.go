@@ -0,0 +1,104 @@
+// Command obload measures the throughput and latency of the order book under a mixed
+// workload of order entry, cancels and modifies, in process or through the HTTP API.
+//
+//	obload [-target engine|http] [-n 100000] [-d 30s] [-c 1] [-rate 0] [-mix limit=60,...] [-o result.json]
+//	obload -compare base.json next.json
+//
+// Results are saved as JSON with -o so that runs can be compared with -compare.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/EliasManj/orderbook/loadgen"
+	"github.com/EliasManj/orderbook/sim"
+)
+
+func main() {
+	cfg := loadgen.DefaultConfig()
+	target := flag.String("target", "engine", "where to send the workload, engine or http")
+	baseURL := flag.String("http", "http://localhost:8080", "base URL of the HTTP API")
+	apiKey := flag.String("key", os.Getenv("ORDERBOOK_API_KEY"), "API key to sign HTTP requests with, defaults to $ORDERBOOK_API_KEY")
+	apiSecret := flag.String("secret", os.Getenv("ORDERBOOK_API_SECRET"), "secret of the API key, defaults to $ORDERBOOK_API_SECRET")
+	mix := flag.String("mix", cfg.Mix.String(), "relative weights of the operations")
+	output := flag.String("o", "", "file to save the result to as JSON")
+	compare := flag.Bool("compare", false, "compare the two result files given as arguments")
+	flag.Int64Var(&cfg.Operations, "n", cfg.Operations, "number of operations, 0 to run for -d")
+	flag.DurationVar(&cfg.Duration, "d", cfg.Duration, "how long to run, 0 to run for -n operations")
+	flag.IntVar(&cfg.Concurrency, "c", cfg.Concurrency, "concurrent workers, http only")
+	flag.Float64Var(&cfg.Rate, "rate", cfg.Rate, "operations per second, 0 for as fast as possible")
+	flag.Int64Var(&cfg.Seed, "seed", cfg.Seed, "seed of the random number generator")
+	flag.Float64Var(&cfg.Price, "price", cfg.Price, "middle price of the workload")
+	flag.Parse()
+
+	if *compare {
+		if flag.NArg() != 2 {
+			fmt.Fprintln(os.Stderr, "usage: obload -compare base.json next.json")
+			os.Exit(2)
+		}
+		if err := compareFiles(flag.Arg(0), flag.Arg(1)); err != nil {
+			fmt.Fprintln(os.Stderr, "obload:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var err error
+	if cfg.Mix, err = loadgen.ParseMix(*mix); err != nil {
+		fmt.Fprintln(os.Stderr, "obload:", err)
+		os.Exit(2)
+	}
+	var t loadgen.Target
+	name := *target
+	switch *target {
+	case "engine":
+		// The book is not safe for concurrent use, the engine is measured from one worker
+		if cfg.Concurrency > 1 {
+			fmt.Fprintln(os.Stderr, "obload: -c only applies to the http target")
+			os.Exit(2)
+		}
+		t = sim.NewEngine()
+	case "http":
+		h := sim.NewHTTP(*baseURL)
+		if *apiKey != "" {
+			h.SignWith(*apiKey, *apiSecret)
+		}
+		t = h
+		name = *baseURL
+	default:
+		fmt.Fprintf(os.Stderr, "obload: unknown target %q, expected engine or http\n", *target)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	result, err := loadgen.Run(ctx, t, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "obload:", err)
+		os.Exit(2)
+	}
+	result.Target = name
+	result.Write(os.Stdout)
+	if *output != "" {
+		if err := result.Save(*output); err != nil {
+			fmt.Fprintln(os.Stderr, "obload:", err)
+			os.Exit(1)
+		}
+	}
+}
+
+func compareFiles(basePath string, nextPath string) error {
+	base, err := loadgen.Load(basePath)
+	if err != nil {
+		return err
+	}
+	next, err := loadgen.Load(nextPath)
+	if err != nil {
+		return err
+	}
+	return loadgen.Compare(os.Stdout, base, next)
+}
@@ -0,0 +1,103 @@
+// Command obsim runs the agent based market simulator against the HTTP API of a running
+// order book, or against an in-process engine to try out agent settings.
+//
+//	obsim [-target http|engine] [-http url] [-rate 200] [-n actions] [-seed 1]
+//
+// It runs until it took n actions, or until interrupted when n is 0, then prints what
+// the agents traded.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/EliasManj/orderbook/sim"
+)
+
+func main() {
+	cfg := sim.DefaultConfig()
+	target := flag.String("target", "http", "where to send orders, http or engine")
+	baseURL := flag.String("http", "http://localhost:8080", "base URL of the HTTP API")
+	apiKey := flag.String("key", os.Getenv("ORDERBOOK_API_KEY"), "API key to sign HTTP requests with, defaults to $ORDERBOOK_API_KEY")
+	apiSecret := flag.String("secret", os.Getenv("ORDERBOOK_API_SECRET"), "secret of the API key, defaults to $ORDERBOOK_API_SECRET")
+	actions := flag.Int("n", 0, "number of agent actions, 0 to run until interrupted")
+	flag.Int64Var(&cfg.Seed, "seed", cfg.Seed, "seed of the random number generator")
+	flag.Float64Var(&cfg.Rate, "rate", cfg.Rate, "agent actions per second, 0 for as fast as possible")
+	flag.Float64Var(&cfg.TickSize, "tick", cfg.TickSize, "price increment")
+	flag.Float64Var(&cfg.Fundamental.Start, "price", cfg.Fundamental.Start, "starting fundamental price")
+	flag.Float64Var(&cfg.Fundamental.Volatility, "volatility", cfg.Fundamental.Volatility, "standard deviation of the fundamental over one second")
+	flag.IntVar(&cfg.Noise.Count, "noise", cfg.Noise.Count, "number of noise traders")
+	flag.IntVar(&cfg.Makers.Count, "makers", cfg.Makers.Count, "number of market makers")
+	flag.IntVar(&cfg.Makers.Spread, "spread", cfg.Makers.Spread, "market maker spread in ticks")
+	flag.IntVar(&cfg.Momentum.Count, "momentum", cfg.Momentum.Count, "number of momentum traders")
+	flag.Parse()
+
+	var t sim.Target
+	switch *target {
+	case "http":
+		h := sim.NewHTTP(*baseURL)
+		if *apiKey != "" {
+			h.SignWith(*apiKey, *apiSecret)
+		}
+		t = h
+	case "engine":
+		t = sim.NewEngine()
+	default:
+		fmt.Fprintf(os.Stderr, "obsim: unknown target %q, expected http or engine\n", *target)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	s := sim.New(cfg, t)
+	stats, err := s.Run(ctx, *actions)
+	report(os.Stdout, s, stats)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "obsim:", err)
+		os.Exit(1)
+	}
+}
+
+// report prints the counts of the run and the position and PnL of each population
+func report(w io.Writer, s *sim.Simulator, stats sim.Stats) {
+	fmt.Fprintf(w, "%d actions over %s simulated: %d orders, %d cancels, %d trades, volume %d\n",
+		stats.Actions, stats.SimTime, stats.Orders, stats.Cancels, stats.Trades, stats.Volume)
+	fmt.Fprintf(w, "fundamental %.2f, last trade %.2f\n\n", s.Fundamental(), float64(s.LastPrice()))
+
+	type population struct {
+		agents   int
+		position int64
+		pnl      float64
+	}
+	populations := make(map[string]*population)
+	for _, agent := range s.Agents() {
+		kind, _, _ := strings.Cut(agent.Name(), "-")
+		p, ok := populations[kind]
+		if !ok {
+			p = &population{}
+			populations[kind] = p
+		}
+		p.agents++
+		p.position += agent.Position()
+		p.pnl += agent.PnL(s.LastPrice())
+	}
+	kinds := make([]string, 0, len(populations))
+	for kind := range populations {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "AGENTS\tCOUNT\tPOSITION\tPNL\t")
+	for _, kind := range kinds {
+		p := populations[kind]
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.2f\t\n", kind, p.agents, p.position, p.pnl)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,163 @@
+// Command obtui is a terminal viewer for a running order book. It shows a live price ladder
+// with depth bars, a tape of recent trades and a ticker line, all streamed from the WebSocket
+// market data feed, and an order entry panel sending orders through the HTTP API.
+//
+//	obtui [-http http://localhost:8080]
+//
+// It only needs a terminal, so it works over SSH.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/term"
+)
+
+// redrawInterval is how often the screen is refreshed at most, and how often a resize is noticed
+const redrawInterval = 100 * time.Millisecond
+
+func main() {
+	baseURL := flag.String("http", "http://localhost:8080", "base URL of the HTTP API")
+	flag.Parse()
+	if err := run(*baseURL); err != nil {
+		fmt.Fprintln(os.Stderr, "obtui:", err)
+		os.Exit(1)
+	}
+}
+
+// feedURL turns the base URL of the HTTP API into the URL of its WebSocket feed
+func feedURL(baseURL string) (string, error) {
+	u, err := url.Parse(strings.TrimRight(baseURL, "/") + "/ws")
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("unsupported scheme %q in %s", u.Scheme, baseURL)
+	}
+	return u.String(), nil
+}
+
+// subscribe reads the feed into messages until the connection fails, sending the error to errs
+func subscribe(conn *websocket.Conn, messages chan<- feedMessage, errs chan<- error) {
+	for {
+		var msg feedMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			errs <- err
+			return
+		}
+		messages <- msg
+	}
+}
+
+func run(baseURL string) error {
+	wsURL, err := feedURL(baseURL)
+	if err != nil {
+		return err
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		return fmt.Errorf("connecting to %s: %w", wsURL, err)
+	}
+	defer conn.Close()
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return fmt.Errorf("stdin is not a terminal")
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+	// Alternate screen with a hidden cursor, both undone on exit
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\x1b[?1049l")
+
+	messages := make(chan feedMessage, 256)
+	feedErrs := make(chan error, 1)
+	go subscribe(conn, messages, feedErrs)
+	keys := make(chan []key)
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- parseKeys(buf[:n])
+		}
+	}()
+
+	m := newModel()
+	client := &http.Client{Timeout: 10 * time.Second}
+	ticker := time.NewTicker(redrawInterval)
+	defer ticker.Stop()
+	dirty := true
+	lastWidth, lastHeight := 0, 0
+	for {
+		select {
+		case msg := <-messages:
+			if err := m.apply(msg); err != nil {
+				m.status = "bad feed message: " + err.Error()
+			}
+			dirty = true
+		case err := <-feedErrs:
+			return fmt.Errorf("market data feed closed: %w", err)
+		case pressed, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			for _, k := range pressed {
+				if k.name == "esc" || k.name == "ctrl-c" {
+					return nil
+				}
+				if m.handleKey(k) {
+					m.status = "sending..."
+					draw(m, lastWidth, lastHeight)
+					m.submit(client, baseURL)
+				}
+			}
+			dirty = true
+		case <-ticker.C:
+			width, height, err := term.GetSize(fd)
+			if err != nil {
+				return err
+			}
+			if dirty || width != lastWidth || height != lastHeight {
+				lastWidth, lastHeight = width, height
+				draw(m, width, height)
+				dirty = false
+			}
+		}
+	}
+}
+
+// draw writes the whole screen in one write to avoid flicker
+func draw(m *model, width int, height int) {
+	if width == 0 || height == 0 {
+		return
+	}
+	var sb strings.Builder
+	sb.WriteString("\x1b[H")
+	for i, line := range m.render(width, height) {
+		if i > 0 {
+			sb.WriteString("\r\n")
+		}
+		sb.WriteString(line)
+	}
+	sb.WriteString("\x1b[J")
+	os.Stdout.WriteString(sb.String())
+}
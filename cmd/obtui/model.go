@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EliasManj/orderbook/orderbook"
+)
+
+// tapeSize is the number of recent trades kept for the tape
+const tapeSize = 200
+
+// feedMessage is a message of the WebSocket market data feed
+type feedMessage struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// field is an input of the order entry panel
+type field int
+
+const (
+	fieldSide field = iota
+	fieldType
+	fieldPrice
+	fieldQty
+	fieldAccount
+	fieldCount
+)
+
+var fieldNames = [fieldCount]string{"Side", "Type", "Price", "Qty", "Account"}
+
+var sides = []string{"buy", "sell"}
+
+// orderTypes maps the choices of the panel to the order types of the HTTP API
+var orderTypes = []struct{ name, apiName string }{
+	{"gtc", "GoodTilCancelled"},
+	{"fak", "FillAndKill"},
+	{"fok", "FillOrKill"},
+	{"market", "Market"},
+}
+
+// model is the state shown by the viewer, updated from the feed and the keyboard
+type model struct {
+	ticker orderbook.Ticker
+	bids   []orderbook.LevelInfo
+	asks   []orderbook.LevelInfo
+	// tape holds the most recent trades, newest first
+	tape []orderbook.Trade
+
+	focus   field
+	side    int
+	typ     int
+	inputs  [fieldCount]string
+	status  string
+	updated time.Time
+}
+
+func newModel() *model {
+	return &model{focus: fieldPrice}
+}
+
+// apply updates the model with a message of the feed
+func (m *model) apply(msg feedMessage) error {
+	switch msg.Type {
+	case "ticker":
+		if err := json.Unmarshal(msg.Data, &m.ticker); err != nil {
+			return err
+		}
+	case "depth":
+		var depth orderbook.OrderBookLevelInfos
+		if err := json.Unmarshal(msg.Data, &depth); err != nil {
+			return err
+		}
+		m.bids = aggregate(depth.Bids, func(a, b orderbook.Price) bool { return a > b })
+		m.asks = aggregate(depth.Asks, func(a, b orderbook.Price) bool { return a < b })
+	case "trade":
+		var trade orderbook.Trade
+		if err := json.Unmarshal(msg.Data, &trade); err != nil {
+			return err
+		}
+		m.tape = append([]orderbook.Trade{trade}, m.tape...)
+		if len(m.tape) > tapeSize {
+			m.tape = m.tape[:tapeSize]
+		}
+	default:
+		return nil
+	}
+	m.updated = time.Now()
+	return nil
+}
+
+// aggregate sums the per order quantities of the feed into price levels, best first
+func aggregate(orders []orderbook.LevelInfo, better func(a, b orderbook.Price) bool) []orderbook.LevelInfo {
+	byPrice := make(map[orderbook.Price]orderbook.Quantity)
+	for _, order := range orders {
+		byPrice[order.Price] += order.Quantity
+	}
+	levels := make([]orderbook.LevelInfo, 0, len(byPrice))
+	for price, qty := range byPrice {
+		levels = append(levels, orderbook.LevelInfo{Price: price, Quantity: qty})
+	}
+	sort.Slice(levels, func(i, j int) bool { return better(levels[i].Price, levels[j].Price) })
+	return levels
+}
+
+// key is a key press decoded from the terminal
+type key struct {
+	name string
+	r    rune
+}
+
+// handleKey updates the order entry panel, returning true when the order should be sent
+func (m *model) handleKey(k key) bool {
+	switch k.name {
+	case "tab", "down":
+		m.focus = (m.focus + 1) % fieldCount
+	case "backtab", "up":
+		m.focus = (m.focus + fieldCount - 1) % fieldCount
+	case "enter":
+		return true
+	case "left", "right", "space":
+		step := 1
+		if k.name == "left" {
+			step = -1
+		}
+		switch m.focus {
+		case fieldSide:
+			m.side = (m.side + step + len(sides)) % len(sides)
+		case fieldType:
+			m.typ = (m.typ + step + len(orderTypes)) % len(orderTypes)
+		}
+	case "backspace":
+		if input := m.inputs[m.focus]; input != "" {
+			m.inputs[m.focus] = input[:len(input)-1]
+		}
+	case "rune":
+		switch m.focus {
+		case fieldSide:
+			if k.r == 'b' || k.r == 's' {
+				m.side = strings.IndexRune("bs", k.r)
+			}
+		case fieldPrice:
+			if (k.r >= '0' && k.r <= '9') || (k.r == '.' && !strings.Contains(m.inputs[m.focus], ".")) {
+				m.inputs[m.focus] += string(k.r)
+			}
+		case fieldQty:
+			if k.r >= '0' && k.r <= '9' {
+				m.inputs[m.focus] += string(k.r)
+			}
+		case fieldAccount:
+			if k.r > ' ' && k.r < 0x7f {
+				m.inputs[m.focus] += string(k.r)
+			}
+		}
+	}
+	return false
+}
+
+// orderRequest is the body of POST /order/
+type orderRequest struct {
+	OrderType string  `json:"order_type"`
+	Side      string  `json:"side"`
+	Price     float64 `json:"price"`
+	Qty       int     `json:"qty"`
+	Account   string  `json:"account"`
+}
+
+type orderResponse struct {
+	Trades []orderbook.Trade `json:"trades"`
+	Order  struct {
+		OrderId int `json:"order_id"`
+	} `json:"order"`
+}
+
+// request builds the order described by the panel
+func (m *model) request() (orderRequest, error) {
+	req := orderRequest{
+		OrderType: orderTypes[m.typ].apiName,
+		Side:      sides[m.side],
+		Account:   m.inputs[fieldAccount],
+	}
+	qty, err := strconv.Atoi(m.inputs[fieldQty])
+	if err != nil || qty <= 0 {
+		return req, fmt.Errorf("quantity must be a positive number")
+	}
+	req.Qty = qty
+	if req.OrderType != "Market" {
+		price, err := strconv.ParseFloat(m.inputs[fieldPrice], 64)
+		if err != nil || price <= 0 {
+			return req, fmt.Errorf("price must be a positive number")
+		}
+		req.Price = price
+	}
+	return req, nil
+}
+
+// submit sends the order of the panel to the HTTP API and reports the result in the status line
+func (m *model) submit(client *http.Client, baseURL string) {
+	req, err := m.request()
+	if err != nil {
+		m.status = err.Error()
+		return
+	}
+	body, _ := json.Marshal(req)
+	resp, err := client.Post(strings.TrimRight(baseURL, "/")+"/order/", "application/json", bytes.NewReader(body))
+	if err != nil {
+		m.status = "sending order: " + err.Error()
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		m.status = "order rejected: " + resp.Status
+		return
+	}
+	var result orderResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		m.status = "reading response: " + err.Error()
+		return
+	}
+	var filled orderbook.Quantity
+	for _, trade := range result.Trades {
+		if int(trade.BidTrade.OrderId) == result.Order.OrderId || int(trade.AskTrade.OrderId) == result.Order.OrderId {
+			filled += trade.Qty()
+		}
+	}
+	at := "at market"
+	if req.OrderType != "Market" {
+		at = "@ " + formatPrice(orderbook.Price(req.Price))
+	}
+	m.status = fmt.Sprintf("sent %s %s %d %s as order %d, filled %d", req.Side, orderTypes[m.typ].name, req.Qty, at, result.Order.OrderId, filled)
+}
+
+func formatPrice(p orderbook.Price) string {
+	return strconv.FormatFloat(float64(p), 'f', 2, 64)
+}
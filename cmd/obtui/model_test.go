@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/EliasManj/orderbook/api"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+var ansi = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// plain strips the styles of rendered rows
+func plain(lines []string) []string {
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		out[i] = ansi.ReplaceAllString(line, "")
+	}
+	return out
+}
+
+func TestParseKeys(t *testing.T) {
+	keys := parseKeys([]byte("1.5\t\x1b[A\x1b[Z\x1b[1;5C\x7f\r\x1b"))
+	names := []string{}
+	for _, k := range keys {
+		if k.name == "rune" {
+			names = append(names, string(k.r))
+		} else {
+			names = append(names, k.name)
+		}
+	}
+	// The unknown ctrl-right sequence is skipped
+	require.Equal(t, []string{"1", ".", "5", "tab", "up", "backtab", "backspace", "enter", "esc"}, names)
+}
+
+func TestHandleKey(t *testing.T) {
+	m := newModel()
+	for _, k := range parseKeys([]byte("12.5.0x\x7f")) {
+		require.False(t, m.handleKey(k))
+	}
+	require.Equal(t, "12.5", m.inputs[fieldPrice])
+
+	m.handleKey(key{name: "up"})
+	m.handleKey(key{name: "right"})
+	require.Equal(t, "fak", orderTypes[m.typ].name)
+	m.handleKey(key{name: "up"})
+	m.handleKey(key{name: "rune", r: 's'})
+	require.Equal(t, "sell", sides[m.side])
+	require.True(t, m.handleKey(key{name: "enter"}))
+
+	_, err := m.request()
+	require.ErrorContains(t, err, "quantity")
+	m.inputs[fieldQty] = "3"
+	req, err := m.request()
+	require.NoError(t, err)
+	require.Equal(t, orderRequest{OrderType: "FillAndKill", Side: "sell", Price: 12.5, Qty: 3}, req)
+}
+
+func TestRender(t *testing.T) {
+	m := newModel()
+	for _, line := range plain(m.render(100, 20)) {
+		require.LessOrEqual(t, utf8.RuneCountInString(line), 100)
+	}
+	require.Len(t, m.render(100, 20), 20)
+	require.Contains(t, plain(m.render(40, 5))[1], "too small")
+
+	require.NoError(t, m.apply(feedMessage{Type: "depth", Data: []byte(`{
+		"Bids": [{"Price": 99, "Quantity": 5}, {"Price": 100, "Quantity": 2}, {"Price": 100, "Quantity": 3}],
+		"Asks": [{"Price": 101, "Quantity": 10}]}`)}))
+	require.NoError(t, m.apply(feedMessage{Type: "ticker", Data: []byte(`{"Symbol": "TEST", "LastPrice": 100.5}`)}))
+	require.Equal(t, 5, int(m.bids[0].Quantity))
+
+	lines := plain(m.render(100, 20))
+	require.Len(t, lines, 20)
+	require.Contains(t, lines[0], "TEST  Last 100.50")
+	text := strings.Join(lines, "\n")
+	ask := strings.Index(text, "101.00")
+	best := strings.Index(text, "100.00")
+	require.True(t, ask >= 0 && best > ask, "asks are drawn above the bids")
+	require.Contains(t, lines[len(lines)-2], "Price: _")
+	for _, line := range lines {
+		require.Equal(t, 100, utf8.RuneCountInString(line), line)
+	}
+}
+
+func TestFeedAndSubmit(t *testing.T) {
+	server := httptest.NewServer(api.NewRouter())
+	defer server.Close()
+	wsURL, err := feedURL(server.URL)
+	require.NoError(t, err)
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	m := newModel()
+	client := &http.Client{Timeout: 5 * time.Second}
+	m.side, m.inputs[fieldPrice], m.inputs[fieldQty], m.inputs[fieldAccount] = 1, "7777", "4", "tui"
+	m.submit(client, server.URL)
+	require.Contains(t, m.status, "sent sell gtc 4 @ 7777.00")
+	m.side, m.typ, m.inputs[fieldQty] = 0, 3, "1"
+	m.submit(client, server.URL)
+	require.Contains(t, m.status, "sent buy market 1 at market")
+	require.Contains(t, m.status, "filled 1")
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for len(m.tape) == 0 {
+		var msg feedMessage
+		require.NoError(t, conn.ReadJSON(&msg))
+		require.NoError(t, m.apply(msg))
+	}
+	require.Equal(t, 7777, int(m.tape[0].ExecPrice()))
+	require.Contains(t, strings.Join(plain(m.render(100, 20)), "\n"), "buy")
+}
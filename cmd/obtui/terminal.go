@@ -0,0 +1,67 @@
+package main
+
+import "unicode/utf8"
+
+// escapes maps the escape sequences sent by common terminals to key names
+var escapes = map[string]string{
+	"\x1b[A": "up",
+	"\x1b[B": "down",
+	"\x1b[C": "right",
+	"\x1b[D": "left",
+	"\x1bOA": "up",
+	"\x1bOB": "down",
+	"\x1bOC": "right",
+	"\x1bOD": "left",
+	"\x1b[Z": "backtab",
+}
+
+// parseKeys decodes the bytes of one read from a terminal in raw mode
+func parseKeys(data []byte) []key {
+	keys := []key{}
+	for len(data) > 0 {
+		if data[0] == 0x1b {
+			matched := false
+			for seq, name := range escapes {
+				if len(data) >= len(seq) && string(data[:len(seq)]) == seq {
+					keys = append(keys, key{name: name})
+					data = data[len(seq):]
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				// A lone escape, or a sequence we do not know which is skipped whole
+				if len(data) > 1 && (data[1] == '[' || data[1] == 'O') {
+					i := 2
+					for i < len(data) && (data[i] < 0x40 || data[i] > 0x7e) {
+						i++
+					}
+					data = data[min(i+1, len(data)):]
+					continue
+				}
+				keys = append(keys, key{name: "esc"})
+				data = data[1:]
+			}
+			continue
+		}
+		r, size := utf8.DecodeRune(data)
+		data = data[size:]
+		switch r {
+		case '\t':
+			keys = append(keys, key{name: "tab"})
+		case '\r', '\n':
+			keys = append(keys, key{name: "enter"})
+		case 0x7f, 0x08:
+			keys = append(keys, key{name: "backspace"})
+		case 0x03:
+			keys = append(keys, key{name: "ctrl-c"})
+		case ' ':
+			keys = append(keys, key{name: "space"})
+		default:
+			if r >= ' ' {
+				keys = append(keys, key{name: "rune", r: r})
+			}
+		}
+	}
+	return keys
+}
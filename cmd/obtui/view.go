@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/EliasManj/orderbook/orderbook"
+)
+
+const (
+	// tapeWidth is the width of the trades tape on the right of the ladder
+	tapeWidth = 36
+	// panelHeight is the number of rows of the order entry panel
+	panelHeight = 3
+	minWidth    = 80
+	minHeight   = 12
+)
+
+// ANSI styles
+const (
+	styleReverse = "7"
+	styleBold    = "1"
+	styleDim     = "2"
+	styleGreen   = "32"
+	styleRed     = "31"
+)
+
+func styled(code string, s string) string {
+	return "\x1b[" + code + "m" + s + "\x1b[0m"
+}
+
+// fit pads or truncates plain text to exactly width columns
+func fit(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	if n := utf8.RuneCountInString(s); n < width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	return string([]rune(s)[:width])
+}
+
+// render draws the model on a width by height screen, one string per row
+func (m *model) render(width int, height int) []string {
+	lines := []string{styled(styleReverse, fit(m.tickerLine(), width))}
+	if width < minWidth || height < minHeight {
+		return append(lines, fit(fmt.Sprintf("terminal too small, %dx%d needed", minWidth, minHeight), width))
+	}
+	bodyHeight := height - 2 - panelHeight
+	ladder := m.ladder(width-tapeWidth-1, bodyHeight)
+	tape := m.tapeRows(bodyHeight)
+	for i := range ladder {
+		lines = append(lines, ladder[i]+" "+tape[i])
+	}
+	return append(lines, m.panel(width)...)
+}
+
+func (m *model) tickerLine() string {
+	t := m.ticker
+	if t.Symbol == "" {
+		return " waiting for market data..."
+	}
+	return fmt.Sprintf(" %s  Last %s x %d  Bid %s x %d  Ask %s x %d  Spread %s  VWAP %s  High %s  Low %s  Vol %d",
+		t.Symbol, formatPrice(t.LastPrice), t.LastQty,
+		formatPrice(t.BestBid), t.BestBidQty, formatPrice(t.BestAsk), t.BestAskQty,
+		formatPrice(t.Spread), formatPrice(t.VWAP), formatPrice(t.High), formatPrice(t.Low), t.Volume)
+}
+
+// ladder returns a title row and height rows with the asks above the bids, the best prices
+// meeting in the middle and a bar sized by quantity beside each level
+func (m *model) ladder(width int, height int) []string {
+	const fixed = 8 + 2 + 10 + 2 + 8 + 2
+	barWidth := max((width-fixed)/2, 0)
+	row := func(bidBar, bidQty, price, askQty, askBar string) string {
+		return fit(fmt.Sprintf("%*s %8s  %10s  %-8s %-*s", barWidth, bidBar, bidQty, price, askQty, barWidth, askBar), width)
+	}
+	title := styled(styleBold, row("", "BID", "PRICE", "ASK", ""))
+
+	askRows := height / 2
+	bidRows := height - askRows
+	asks := m.asks[:min(len(m.asks), askRows)]
+	bids := m.bids[:min(len(m.bids), bidRows)]
+	var largest orderbook.Quantity = 1
+	for _, level := range append(append([]orderbook.LevelInfo{}, asks...), bids...) {
+		largest = max(largest, level.Quantity)
+	}
+	bar := func(qty orderbook.Quantity) string {
+		return strings.Repeat("█", int((int64(qty)*int64(barWidth)+int64(largest)-1)/int64(largest)))
+	}
+
+	rows := []string{title}
+	for i := askRows - 1; i >= 0; i-- {
+		if i >= len(asks) {
+			rows = append(rows, fit("", width))
+			continue
+		}
+		level := asks[i]
+		rows = append(rows, styled(styleRed, row("", "", formatPrice(level.Price), fmt.Sprint(level.Quantity), bar(level.Quantity))))
+	}
+	for i := 0; i < bidRows; i++ {
+		if i >= len(bids) {
+			rows = append(rows, fit("", width))
+			continue
+		}
+		level := bids[i]
+		rows = append(rows, styled(styleGreen, row(bar(level.Quantity), fmt.Sprint(level.Quantity), formatPrice(level.Price), "", "")))
+	}
+	return rows
+}
+
+// tapeRows returns a title row and height rows of the most recent trades
+func (m *model) tapeRows(height int) []string {
+	const format = "%-12s  %10s  %6s  %-4s"
+	rows := []string{styled(styleBold, fit(fmt.Sprintf(format, "TIME", "PRICE", "QTY", "SIDE"), tapeWidth))}
+	for i := 0; i < height; i++ {
+		if i >= len(m.tape) {
+			rows = append(rows, fit("", tapeWidth))
+			continue
+		}
+		trade := m.tape[i]
+		side, style := "sell", styleRed
+		if trade.BidTrade.Liquidity == orderbook.Taker {
+			side, style = "buy", styleGreen
+		}
+		line := fmt.Sprintf(format, trade.Timestamp.Local().Format(time.TimeOnly+".000"), formatPrice(trade.ExecPrice()), fmt.Sprint(trade.Qty()), side)
+		rows = append(rows, styled(style, fit(line, tapeWidth)))
+	}
+	return rows
+}
+
+// panel returns the rows of the order entry panel
+func (m *model) panel(width int) []string {
+	title := "── Order entry "
+	separator := styled(styleDim, fit(title+strings.Repeat("─", max(width-utf8.RuneCountInString(title), 0)), width))
+
+	var sb strings.Builder
+	visible := 0
+	for f := field(0); f < fieldCount; f++ {
+		value := m.inputs[f]
+		switch f {
+		case fieldSide:
+			value = sides[m.side]
+		case fieldType:
+			value = orderTypes[m.typ].name
+		}
+		if f == m.focus {
+			value += "_"
+		}
+		label := " " + fieldNames[f] + ": "
+		value = fit(value, max(utf8.RuneCountInString(value), 6))
+		sb.WriteString(label)
+		if f == m.focus {
+			sb.WriteString(styled(styleReverse, value))
+		} else {
+			sb.WriteString(value)
+		}
+		visible += utf8.RuneCountInString(label + value)
+	}
+	help := "   enter send  tab next  ←/→ change  esc quit"
+	fields := sb.String()
+	if visible+utf8.RuneCountInString(help) <= width {
+		fields += styled(styleDim, help)
+		visible += utf8.RuneCountInString(help)
+	}
+	if visible < width {
+		fields += strings.Repeat(" ", width-visible)
+	}
+	return []string{separator, fields, fit(" "+m.status, width)}
+}
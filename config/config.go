@@ -0,0 +1,355 @@
+// Package config holds the settings of the exchange server. They are read from a YAML file,
+// then overridden by ORDERBOOK_* environment variables and then by command line flags.
+//
+// Every setting holding a single value has a key made of its YAML path, such as
+// listen.http. The matching environment variable is ORDERBOOK_LISTEN_HTTP and the
+// matching flag -listen.http. Lists and maps, such as the instruments and the rate limit
+// tiers, can only be set in the file.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EliasManj/orderbook/audit"
+	"github.com/EliasManj/orderbook/orderbook"
+	"github.com/EliasManj/orderbook/ratelimit"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix starts the names of the environment variables overriding settings
+const EnvPrefix = "ORDERBOOK_"
+
+type Config struct {
+	Listen      Listen       `yaml:"listen"`
+	StaticDir   string       `yaml:"static_dir"`
+	Instruments []Instrument `yaml:"instruments"`
+	Journal     string       `yaml:"journal"`
+	// Snapshot is the file the resting orders are saved to on shutdown and restored from on
+	// start, none when empty
+	Snapshot   string           `yaml:"snapshot"`
+	ITCH       ITCH             `yaml:"itch"`
+	FIX        FIX              `yaml:"fix"`
+	Auth       Auth             `yaml:"auth"`
+	RateLimits ratelimit.Config `yaml:"rate_limits"`
+	Shutdown   Shutdown         `yaml:"shutdown"`
+	Audit      Audit            `yaml:"audit"`
+	Debug      Debug            `yaml:"debug"`
+	Log        Log              `yaml:"log"`
+}
+
+// Listen holds the addresses the gateways accept connections on
+type Listen struct {
+	HTTP string `yaml:"http"`
+	FIX  string `yaml:"fix"`
+	GRPC string `yaml:"grpc"`
+}
+
+// Instrument is a symbol traded on the exchange with the increments of its prices and
+// quantities, any when 0
+type Instrument struct {
+	Symbol   string  `yaml:"symbol"`
+	TickSize float64 `yaml:"tick_size"`
+	LotSize  int     `yaml:"lot_size"`
+}
+
+// ITCH sets where the binary order feed is written and sent
+type ITCH struct {
+	File string `yaml:"file"`
+	UDP  string `yaml:"udp"`
+}
+
+type FIX struct {
+	CompID string `yaml:"comp_id"`
+	// Store is the directory holding the state of the sessions
+	Store                   string        `yaml:"store"`
+	CancelOnDisconnectGrace time.Duration `yaml:"cancel_on_disconnect_grace"`
+	// Accounts binds SenderCompIDs to the accounts they trade for. Once set, or when the API
+	// key file exists, only the comp IDs it lists may log on
+	Accounts map[string]string `yaml:"accounts,omitempty"`
+}
+
+// Auth names the API key file, which also authenticates the gRPC calls. The HTTP and gRPC
+// APIs are open to everyone when the file does not exist
+type Auth struct {
+	KeyFile string `yaml:"key_file"`
+}
+
+// Shutdown sets how the server stops on SIGINT or SIGTERM. DrainDelay is how long it keeps
+// running without taking orders, so that load balancers see the health check fail, and
+// Timeout how long it waits for the sessions to close after that
+type Shutdown struct {
+	DrainDelay time.Duration `yaml:"drain_delay"`
+	Timeout    time.Duration `yaml:"timeout"`
+}
+
+// Audit sets the directory of the audit log, none when empty, and the size its files grow
+// to before the next one is started. The files also change with the UTC day
+type Audit struct {
+	Dir     string `yaml:"dir"`
+	MaxSize int64  `yaml:"max_size"`
+}
+
+// Debug turns on the runtime profiles at /debug/pprof/ on the HTTP listener, which need the
+// admin permission when the API keys are on
+type Debug struct {
+	Pprof bool `yaml:"pprof"`
+}
+
+type Log struct {
+	Level string `yaml:"level"`
+}
+
+// Default returns the settings the server used before it was configurable
+func Default() Config {
+	return Config{
+		Listen:      Listen{HTTP: ":8080", FIX: ":9878", GRPC: ":9090"},
+		StaticDir:   "./static/",
+		Instruments: []Instrument{{Symbol: orderbook.DefaultSymbol}},
+		Journal:     "orderbook.journal",
+		Snapshot:    "orderbook.snapshot",
+		ITCH:        ITCH{File: "orderbook.itch", UDP: "127.0.0.1:5005"},
+		FIX:         FIX{CompID: "ORDERBOOK", Store: "fix-store", CancelOnDisconnectGrace: 5 * time.Second},
+		Auth:        Auth{KeyFile: "apikeys.json"},
+		RateLimits:  ratelimit.DefaultConfig(),
+		Shutdown:    Shutdown{DrainDelay: time.Second, Timeout: 10 * time.Second},
+		Audit:       Audit{Dir: "audit", MaxSize: audit.DefaultMaxSize},
+		Log:         Log{Level: "info"},
+	}
+}
+
+// Load returns the default settings overridden by the YAML file at path, when not empty,
+// and then by the ORDERBOOK_* variables of environ naming a setting. Rate limit tiers
+// named in the file replace the default ones of the same name, the other ones are kept
+func Load(path string, environ []string) (Config, error) {
+	cfg := Default()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, err
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return cfg, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	for _, kv := range environ {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(name, EnvPrefix) {
+			continue
+		}
+		key := strings.ToLower(strings.ReplaceAll(strings.TrimPrefix(name, EnvPrefix), "_", "."))
+		field, ok := fieldByEnv(&cfg, key)
+		if !ok {
+			// Such as the API key variables of the command line tools
+			continue
+		}
+		if err := setField(field.value, value); err != nil {
+			return cfg, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return cfg, nil
+}
+
+// field is a setting holding a single value
+type field struct {
+	key   string
+	value reflect.Value
+}
+
+// fields returns the settings of cfg holding a single value, keyed by their YAML path
+func fields(cfg *Config) []field {
+	var result []field
+	var walk func(prefix string, v reflect.Value)
+	walk = func(prefix string, v reflect.Value) {
+		for i := 0; i < v.NumField(); i++ {
+			name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("yaml"), ",")
+			key := prefix + name
+			f := v.Field(i)
+			switch f.Kind() {
+			case reflect.Struct:
+				walk(key+".", f)
+			case reflect.String, reflect.Int, reflect.Int64, reflect.Float64, reflect.Bool:
+				result = append(result, field{key: key, value: f})
+			}
+		}
+	}
+	walk("", reflect.ValueOf(cfg).Elem())
+	return result
+}
+
+// fieldByEnv finds a setting from the key of an environment variable, where the
+// underscores inside YAML names have become dots too
+func fieldByEnv(cfg *Config, key string) (field, bool) {
+	for _, f := range fields(cfg) {
+		if strings.ReplaceAll(f.key, "_", ".") == key {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+func setField(v reflect.Value, s string) error {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	}
+	return nil
+}
+
+// Flags registers a flag for every setting holding a single value on fs. The returned
+// function applies the flags set on the command line to a Config
+func Flags(fs *flag.FlagSet) func(cfg *Config) error {
+	defaults := Default()
+	values := make(map[string]*string)
+	for _, f := range fields(&defaults) {
+		values[f.key] = fs.String(f.key, fmt.Sprint(f.value.Interface()), "overrides "+f.key)
+	}
+	return func(cfg *Config) error {
+		byKey := make(map[string]reflect.Value)
+		for _, f := range fields(cfg) {
+			byKey[f.key] = f.value
+		}
+		var err error
+		fs.Visit(func(fl *flag.Flag) {
+			if v, ok := byKey[fl.Name]; ok && err == nil {
+				if setErr := setField(v, *values[fl.Name]); setErr != nil {
+					err = fmt.Errorf("-%s: %w", fl.Name, setErr)
+				}
+			}
+		})
+		return err
+	}
+}
+
+// Validate checks the settings, reporting every problem it finds
+func (c Config) Validate() error {
+	var errs []error
+	fail := func(key string, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+	for key, addr := range map[string]string{"listen.http": c.Listen.HTTP, "listen.fix": c.Listen.FIX, "listen.grpc": c.Listen.GRPC, "itch.udp": c.ITCH.UDP} {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			fail(key, "invalid address %q", addr)
+		}
+	}
+	if info, err := os.Stat(c.StaticDir); err != nil || !info.IsDir() {
+		fail("static_dir", "%q is not a directory", c.StaticDir)
+	}
+	switch len(c.Instruments) {
+	case 0:
+		fail("instruments", "at least one instrument is needed")
+	case 1:
+	default:
+		fail("instruments", "the server trades a single instrument, %d are defined", len(c.Instruments))
+	}
+	for i, instrument := range c.Instruments {
+		key := fmt.Sprintf("instruments[%d]", i)
+		if instrument.Symbol == "" {
+			fail(key+".symbol", "missing symbol")
+		}
+		if instrument.TickSize < 0 {
+			fail(key+".tick_size", "must not be negative")
+		}
+		if instrument.LotSize < 0 {
+			fail(key+".lot_size", "must not be negative")
+		}
+	}
+	for key, path := range map[string]string{"journal": c.Journal, "itch.file": c.ITCH.File, "fix.store": c.FIX.Store} {
+		if path == "" {
+			fail(key, "missing path")
+		}
+	}
+	if c.FIX.CompID == "" {
+		fail("fix.comp_id", "missing CompID")
+	}
+	if c.FIX.CancelOnDisconnectGrace < 0 {
+		fail("fix.cancel_on_disconnect_grace", "must not be negative")
+	}
+	for compID, account := range c.FIX.Accounts {
+		if account == "" {
+			fail("fix.accounts."+compID, "missing account")
+		}
+	}
+	if c.Audit.MaxSize <= 0 {
+		fail("audit.max_size", "must be positive")
+	}
+	if c.Shutdown.DrainDelay < 0 {
+		fail("shutdown.drain_delay", "must not be negative")
+	}
+	if c.Shutdown.Timeout <= 0 {
+		fail("shutdown.timeout", "must be positive")
+	}
+	tiers := map[string]ratelimit.Tier{"rate_limits.ip": c.RateLimits.IP}
+	for name, tier := range c.RateLimits.Tiers {
+		tiers["rate_limits.tiers."+name] = tier
+	}
+	for key, tier := range tiers {
+		for class, rate := range map[string]ratelimit.Rate{"orders": tier.Orders, "reads": tier.Reads} {
+			if rate.PerSecond < 0 || rate.Burst < 0 {
+				fail(key+"."+class, "rates must not be negative")
+			}
+		}
+	}
+	if _, err := c.LogLevel(); err != nil {
+		fail("log.level", "%v", err)
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errors.Join(errs...)
+}
+
+// LogLevel returns the slog level named by the settings
+func (c Config) LogLevel() (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(c.Log.Level))
+	return level, err
+}
+
+// YAML returns the settings in the format of the configuration file
+func (c Config) YAML() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), enc.Close()
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "orderbook.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	path := writeFile(t, `
+listen:
+  http: ":8081"
+instruments:
+  - symbol: BTCUSD
+    tick_size: 0.5
+    lot_size: 10
+fix:
+  cancel_on_disconnect_grace: 2s
+  accounts:
+    CLIENT1: alice
+rate_limits:
+  tiers:
+    premium:
+      orders: {per_second: 1000, burst: 2000}
+log:
+  level: debug
+`)
+	cfg, err := Load(path, []string{"ORDERBOOK_LISTEN_GRPC=:9191", "ORDERBOOK_AUDIT_MAX_SIZE=1048576", "ORDERBOOK_FIX_CANCEL_ON_DISCONNECT_GRACE=3s", "ORDERBOOK_API_KEY=ignored", "HOME=/root"})
+	require.NoError(t, err)
+	require.Equal(t, ":8081", cfg.Listen.HTTP)
+	require.Equal(t, ":9191", cfg.Listen.GRPC)
+	require.Equal(t, ":9878", cfg.Listen.FIX, "settings missing from the file keep their default")
+	require.Equal(t, []Instrument{{Symbol: "BTCUSD", TickSize: 0.5, LotSize: 10}}, cfg.Instruments)
+	require.Equal(t, 3*time.Second, cfg.FIX.CancelOnDisconnectGrace)
+	require.Equal(t, map[string]string{"CLIENT1": "alice"}, cfg.FIX.Accounts)
+	require.Equal(t, 1000.0, cfg.RateLimits.Tiers["premium"].Orders.PerSecond)
+	require.Contains(t, cfg.RateLimits.Tiers, "unlimited")
+	require.Equal(t, "debug", cfg.Log.Level)
+	require.Equal(t, int64(1<<20), cfg.Audit.MaxSize)
+
+	_, err = Load(writeFile(t, "listen:\n  htttp: \":8081\"\n"), nil)
+	require.ErrorContains(t, err, "field htttp not found")
+	_, err = Load(path, []string{"ORDERBOOK_INSTRUMENTS=x", "ORDERBOOK_FIX_CANCEL_ON_DISCONNECT_GRACE=soon"})
+	require.ErrorContains(t, err, "ORDERBOOK_FIX_CANCEL_ON_DISCONNECT_GRACE")
+	cfg, err = Load(writeFile(t, ""), nil)
+	require.NoError(t, err)
+	require.Equal(t, Default(), cfg)
+}
+
+func TestFlags(t *testing.T) {
+	fs := flag.NewFlagSet("orderbook", flag.ContinueOnError)
+	apply := Flags(fs)
+	require.NoError(t, fs.Parse([]string{"-listen.http", ":9000", "-log.level=warn", "-rate_limits.ip.orders.per_second", "5", "-snapshot=", "-debug.pprof=true"}))
+	cfg, err := Load("", []string{"ORDERBOOK_LISTEN_HTTP=:8888", "ORDERBOOK_LISTEN_FIX=:7777"})
+	require.NoError(t, err)
+	require.NoError(t, apply(&cfg))
+	require.Equal(t, ":9000", cfg.Listen.HTTP, "flags override the environment")
+	require.Equal(t, ":7777", cfg.Listen.FIX)
+	require.Equal(t, "warn", cfg.Log.Level)
+	require.Equal(t, 5.0, cfg.RateLimits.IP.Orders.PerSecond)
+	require.Empty(t, cfg.Snapshot)
+	require.True(t, cfg.Debug.Pprof)
+
+	require.NoError(t, fs.Parse([]string{"-fix.cancel_on_disconnect_grace", "later"}))
+	require.ErrorContains(t, apply(&cfg), "-fix.cancel_on_disconnect_grace")
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Default()
+	cfg.StaticDir = t.TempDir()
+	require.NoError(t, cfg.Validate())
+
+	cfg.Listen.HTTP = "8080"
+	cfg.Instruments = []Instrument{{Symbol: "A", TickSize: -1}, {LotSize: 1}}
+	cfg.FIX.Store = ""
+	cfg.RateLimits.IP.Reads.Burst = -1
+	cfg.Shutdown.Timeout = 0
+	cfg.Audit.MaxSize = -1
+	cfg.Log.Level = "loud"
+	err := cfg.Validate()
+	require.Error(t, err)
+	for _, msg := range []string{
+		`listen.http: invalid address "8080"`,
+		"instruments: the server trades a single instrument, 2 are defined",
+		"instruments[0].tick_size: must not be negative",
+		"instruments[1].symbol: missing symbol",
+		"fix.store: missing path",
+		"rate_limits.ip.reads: rates must not be negative",
+		"shutdown.timeout: must be positive",
+		"audit.max_size: must be positive",
+		"log.level: ",
+	} {
+		require.ErrorContains(t, err, msg)
+	}
+}
+
+func TestYAML(t *testing.T) {
+	cfg := Default()
+	data, err := cfg.YAML()
+	require.NoError(t, err)
+	require.Contains(t, string(data), "cancel_on_disconnect_grace: 5s")
+	loaded, err := Load(writeFile(t, string(data)), nil)
+	require.NoError(t, err)
+	require.Equal(t, cfg, loaded)
+}
@@ -0,0 +1,311 @@
+package fix
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EliasManj/orderbook/audit"
+	"github.com/EliasManj/orderbook/orderbook"
+)
+
+// Engine is the order book the gateway routes orders to
+type Engine interface {
+	Symbol() string
+	AddOrder(src audit.Source, order orderbook.Order) []orderbook.Trade
+	CancelOrder(src audit.Source, orderId orderbook.OrderId) (orderbook.Order, bool)
+	ModifyOrder(src audit.Source, orderId orderbook.OrderId, price orderbook.Price, qty orderbook.Quantity) ([]orderbook.Trade, error)
+	GetOrder(orderId orderbook.OrderId) (orderbook.Order, bool)
+	// Refuse records a command the gateway turned down in the audit log
+	Refuse(src audit.Source, command string, order *orderbook.Order, reason string)
+	// OnBookChange registers a listener for every change to the resting orders, whichever
+	// gateway caused it. The listener runs while the book is locked
+	OnBookChange(l orderbook.BookListener)
+}
+
+// Acceptor is a FIX 4.4 order entry gateway accepting sessions from any counterparty
+// that logs on with TargetCompID set to CompID
+type Acceptor struct {
+	CompID   string
+	Engine   Engine
+	NewStore func(sessionID string) (Store, error)
+	// Accounts binds sessions to the accounts they trade for, keyed by SenderCompID. When
+	// set only the comp IDs it holds may log on, and their orders are booked to their account
+	Accounts map[string]string
+	// CancelOnDisconnectGrace is how long a session that logged on with
+	// TagCancelOnDisconnect may stay away before its orders are cancelled
+	CancelOnDisconnectGrace time.Duration
+
+	mu       sync.Mutex
+	listener net.Listener
+	sessions map[string]*session
+	orders   map[orderbook.OrderId]*orderState
+	clOrdIDs map[string]orderbook.OrderId
+	execSeq  int
+	execBase string
+	closed   bool
+}
+
+// validCompID matches the SenderCompIDs accepted at logon. The comp ID names the files of
+// the session, so it may not hold path separators or ".."
+var validCompID = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// NewAcceptor creates an Acceptor routing orders to engine, with session state kept by newStore
+func NewAcceptor(compID string, engine Engine, newStore func(sessionID string) (Store, error)) *Acceptor {
+	a := &Acceptor{
+		CompID:   compID,
+		Engine:   engine,
+		NewStore: newStore,
+		sessions: make(map[string]*session),
+		orders:   make(map[orderbook.OrderId]*orderState),
+		clOrdIDs: make(map[string]orderbook.OrderId),
+		execBase: time.Now().UTC().Format("20060102150405"),
+	}
+	engine.OnBookChange(bookListener{a})
+	return a
+}
+
+// FileStores returns a store factory persisting every session under dir
+func FileStores(dir string) func(sessionID string) (Store, error) {
+	return func(sessionID string) (Store, error) {
+		return NewFileStore(dir, sessionID)
+	}
+}
+
+// Listen accepts connections on addr until Close is called
+func (a *Acceptor) Listen(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return a.Serve(l)
+}
+
+// Serve accepts connections on l until Close is called
+func (a *Acceptor) Serve(l net.Listener) error {
+	a.mu.Lock()
+	a.listener = l
+	a.mu.Unlock()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go a.handleConn(conn)
+	}
+}
+
+// Close stops accepting connections and logs out every session. The orders of sessions
+// that asked to cancel on disconnect stay in the book
+func (a *Acceptor) Close() error {
+	a.mu.Lock()
+	a.closed = true
+	l := a.listener
+	sessions := make([]*session, 0, len(a.sessions))
+	for _, s := range a.sessions {
+		sessions = append(sessions, s)
+	}
+	a.mu.Unlock()
+	for _, s := range sessions {
+		s.mu.Lock()
+		connected := s.conn != nil
+		s.mu.Unlock()
+		if connected {
+			s.logout("gateway shutting down")
+		}
+	}
+	if l == nil {
+		return nil
+	}
+	return l.Close()
+}
+
+// handleConn waits for a Logon, then runs the session until the connection closes
+func (a *Acceptor) handleConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	data, err := ReadMessage(r)
+	if err != nil {
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	logon, err := Parse(data)
+	if err != nil || logon.MsgType() != MsgTypeLogon {
+		log.Printf("fix: first message from %s is not a valid Logon", conn.RemoteAddr())
+		return
+	}
+	s, err := a.logon(conn, logon)
+	if err != nil {
+		log.Printf("fix: logon from %s rejected: %v", conn.RemoteAddr(), err)
+		return
+	}
+	defer a.disconnect(s)
+	s.serve(conn, r)
+}
+
+// logon validates a Logon, binds the connection to its session and answers it
+func (a *Acceptor) logon(conn net.Conn, logon *Message) (*session, error) {
+	target, _ := logon.Get(TagTargetCompID)
+	if target != a.CompID {
+		return nil, fmt.Errorf("unknown TargetCompID %q", target)
+	}
+	id, ok := logon.Get(TagSenderCompID)
+	if !ok || id == "" {
+		return nil, errors.New("missing SenderCompID")
+	}
+	if !validCompID.MatchString(id) || strings.Contains(id, "..") {
+		return nil, fmt.Errorf("invalid SenderCompID %q", id)
+	}
+	if _, ok := a.Accounts[id]; a.Accounts != nil && !ok {
+		return nil, fmt.Errorf("SenderCompID %s has no account", id)
+	}
+	heartBtInt := DefaultHeartBtInt
+	if v, err := logon.GetInt(TagHeartBtInt); err == nil && v > 0 {
+		heartBtInt = v
+	}
+
+	a.mu.Lock()
+	s, exists := a.sessions[id]
+	if !exists {
+		store, err := a.NewStore(a.CompID + "-" + id)
+		if err != nil {
+			a.mu.Unlock()
+			return nil, err
+		}
+		s = &session{id: id, acceptor: a, store: store}
+		a.sessions[id] = s
+	}
+	a.mu.Unlock()
+
+	s.mu.Lock()
+	if s.conn != nil {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("session %s is already logged on", id)
+	}
+	if logon.GetBool(TagResetSeqNumFlag) {
+		if err := s.store.Reset(); err != nil {
+			s.mu.Unlock()
+			return nil, err
+		}
+	}
+	if s.disconnectTimer != nil {
+		s.disconnectTimer.Stop()
+		s.disconnectTimer = nil
+	}
+	s.cancelOnDisconnect = logon.GetBool(TagCancelOnDisconnect)
+	s.conn = conn
+	s.heartBtInt = time.Duration(heartBtInt) * time.Second
+	s.lastRecv = time.Now()
+	s.testReqID = ""
+	s.resendUntil = 0
+	s.mu.Unlock()
+
+	seq, err := logon.GetInt(TagMsgSeqNum)
+	if err != nil {
+		return nil, a.abortLogon(s, "missing MsgSeqNum")
+	}
+	if expected := s.store.NextTargetSeq(); seq < expected {
+		return nil, a.abortLogon(s, fmt.Sprintf("MsgSeqNum too low, expecting %d but received %d", expected, seq))
+	}
+	reply := NewMessage(MsgTypeLogon)
+	reply.Set(TagEncryptMethod, "0")
+	reply.SetInt(TagHeartBtInt, heartBtInt)
+	if logon.GetBool(TagResetSeqNumFlag) {
+		reply.Set(TagResetSeqNumFlag, "Y")
+	}
+	if err := s.send(reply); err != nil {
+		return nil, err
+	}
+	// The Logon goes through the normal sequence check so a gap triggers a ResendRequest
+	if _, err := s.checkSeqNum(logon); err != nil {
+		return nil, a.abortLogon(s, err.Error())
+	}
+	return s, nil
+}
+
+func (a *Acceptor) abortLogon(s *session, reason string) error {
+	s.logout(reason)
+	a.disconnect(s)
+	return errors.New(reason)
+}
+
+func (a *Acceptor) disconnect(s *session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return
+	}
+	s.conn.Close()
+	s.conn = nil
+	if s.cancelOnDisconnect {
+		var timer *time.Timer
+		timer = time.AfterFunc(a.CancelOnDisconnectGrace, func() {
+			s.mu.Lock()
+			expired := s.disconnectTimer == timer
+			if expired {
+				s.disconnectTimer = nil
+			}
+			s.mu.Unlock()
+			if expired {
+				a.cancelSessionOrders(s)
+			}
+		})
+		s.disconnectTimer = timer
+	}
+}
+
+// cancelSessionOrders cancels the live orders of a session, queueing a Canceled report
+// for each to be resent when it logs on again. Once the acceptor is closed the orders are
+// left resting, to be saved in the snapshot taken at shutdown
+func (a *Acceptor) cancelSessionOrders(s *session) {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return
+	}
+	states := []*orderState{}
+	for _, state := range a.orders {
+		if state.session == s.id && !state.done {
+			states = append(states, state)
+		}
+	}
+	a.mu.Unlock()
+	sort.Slice(states, func(i, j int) bool { return states[i].orderId < states[j].orderId })
+	src := audit.Source{Gateway: "fix", Client: s.id, Request: "cancel on disconnect"}
+	for _, state := range states {
+		a.mu.Lock()
+		state.inflight = true
+		a.mu.Unlock()
+		if _, ok := a.Engine.CancelOrder(src, state.orderId); !ok {
+			_, resting := a.Engine.GetOrder(state.orderId)
+			a.finishCommand(state, resting, "", "")
+			continue
+		}
+		a.mu.Lock()
+		state.inflight = false
+		state.done = true
+		report := a.execReport(state, ExecTypeCanceled)
+		report.Set(TagText, "cancelled on disconnect")
+		a.forget(state)
+		a.mu.Unlock()
+		s.send(report)
+	}
+}
+
+// session returns the session of a counterparty, nil if it never logged on
+func (a *Acceptor) session(id string) *session {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.sessions[id]
+}
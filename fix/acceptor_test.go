@@ -0,0 +1,411 @@
+package fix
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/EliasManj/orderbook/api"
+	"github.com/EliasManj/orderbook/audit"
+	"github.com/EliasManj/orderbook/orderbook"
+	"github.com/stretchr/testify/require"
+)
+
+// testClient is a minimal FIX initiator driving the acceptor over TCP
+type testClient struct {
+	t      *testing.T
+	conn   net.Conn
+	r      *bufio.Reader
+	compID string
+	seq    int
+}
+
+func startAcceptor(t *testing.T, dir string) (*Acceptor, string) {
+	acceptor := NewAcceptor("ORDERBOOK", api.DefaultExchange(), FileStores(dir))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go acceptor.Serve(l)
+	t.Cleanup(func() { acceptor.Close() })
+	return acceptor, l.Addr().String()
+}
+
+func dial(t *testing.T, addr string, compID string, seq int) *testClient {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return &testClient{t: t, conn: conn, r: bufio.NewReader(conn), compID: compID, seq: seq}
+}
+
+func (c *testClient) send(msg *Message) {
+	msg.Set(TagSenderCompID, c.compID)
+	msg.Set(TagTargetCompID, "ORDERBOOK")
+	msg.SetInt(TagMsgSeqNum, c.seq)
+	msg.SetTime(TagSendingTime, time.Now())
+	c.seq++
+	_, err := c.conn.Write(msg.Bytes())
+	require.NoError(c.t, err)
+}
+
+// read returns the next message of the given type, skipping heartbeats sent while idle
+func (c *testClient) read(msgType string) *Message {
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		data, err := ReadMessage(c.r)
+		require.NoError(c.t, err)
+		msg, err := Parse(data)
+		require.NoError(c.t, err)
+		if msg.MsgType() == MsgTypeHeartbeat && msgType != MsgTypeHeartbeat {
+			continue
+		}
+		require.Equal(c.t, msgType, msg.MsgType(), msg.String())
+		return msg
+	}
+}
+
+func (c *testClient) logon(reset bool, heartBtInt int) *Message {
+	logon := NewMessage(MsgTypeLogon).Set(TagEncryptMethod, "0").SetInt(TagHeartBtInt, heartBtInt)
+	if reset {
+		logon.Set(TagResetSeqNumFlag, "Y")
+	}
+	c.send(logon)
+	return c.read(MsgTypeLogon)
+}
+
+func newOrderSingle(clOrdID string, side string, tif string, price float64, qty int) *Message {
+	msg := NewMessage(MsgTypeNewOrderSingle)
+	msg.Set(TagClOrdID, clOrdID)
+	msg.Set(TagSymbol, "DEFAULT")
+	msg.Set(TagSide, side)
+	msg.Set(TagOrdType, "2")
+	msg.Set(TagTimeInForce, tif)
+	msg.SetFloat(TagPrice, price)
+	msg.SetInt(TagOrderQty, qty)
+	return msg
+}
+
+func requireFields(t *testing.T, msg *Message, expected map[int]string) {
+	for tag, value := range expected {
+		actual, ok := msg.Get(tag)
+		require.True(t, ok, "missing tag %d in %s", tag, msg)
+		require.Equal(t, value, actual, "tag %d in %s", tag, msg)
+	}
+}
+
+func TestAcceptorOrderLifecycle(t *testing.T) {
+	_, addr := startAcceptor(t, t.TempDir())
+	seller := dial(t, addr, "SELLER", 1)
+	seller.logon(true, 1)
+	buyer := dial(t, addr, "BUYER", 1)
+	buyer.logon(true, 1)
+
+	seller.send(newOrderSingle("s1", "2", "1", 7000, 10))
+	report := seller.read(MsgTypeExecutionReport)
+	requireFields(t, report, map[int]string{TagClOrdID: "s1", TagExecType: ExecTypeNew, TagOrdStatus: OrdStatusNew, TagLeavesQty: "10", TagCumQty: "0"})
+	orderID, _ := report.Get(TagOrderID)
+
+	// The buyer takes part of the resting sell, both sides get a fill
+	buyer.send(newOrderSingle("b1", "1", "1", 7000, 4))
+	requireFields(t, buyer.read(MsgTypeExecutionReport), map[int]string{TagClOrdID: "b1", TagExecType: ExecTypeNew})
+	requireFields(t, buyer.read(MsgTypeExecutionReport), map[int]string{TagExecType: ExecTypeTrade, TagOrdStatus: OrdStatusFilled, TagLastQty: "4", TagLastPx: "7000", TagLeavesQty: "0"})
+	requireFields(t, seller.read(MsgTypeExecutionReport), map[int]string{TagClOrdID: "s1", TagExecType: ExecTypeTrade, TagOrdStatus: OrdStatusPartiallyFilled, TagCumQty: "4", TagLeavesQty: "6", TagAvgPx: "7000"})
+
+	seller.send(NewMessage(MsgTypeOrderCancelReplaceRequest).Set(TagOrigClOrdID, "s1").Set(TagClOrdID, "s2").Set(TagSide, "2").SetFloat(TagPrice, 7001).SetInt(TagOrderQty, 8))
+	requireFields(t, seller.read(MsgTypeExecutionReport), map[int]string{TagClOrdID: "s2", TagOrigClOrdID: "s1", TagOrderID: orderID, TagExecType: ExecTypeReplaced, TagOrdStatus: OrdStatusPartiallyFilled, TagPrice: "7001", TagLeavesQty: "4"})
+
+	// A fill or kill larger than the book is rejected outright
+	buyer.send(newOrderSingle("b2", "1", "4", 7001, 5))
+	requireFields(t, buyer.read(MsgTypeExecutionReport), map[int]string{TagClOrdID: "b2", TagExecType: ExecTypeRejected, TagOrdStatus: OrdStatusRejected})
+	// A fill and kill takes what it can and cancels the rest
+	buyer.send(newOrderSingle("b3", "1", "3", 7001, 3))
+	requireFields(t, buyer.read(MsgTypeExecutionReport), map[int]string{TagClOrdID: "b3", TagExecType: ExecTypeNew})
+	requireFields(t, buyer.read(MsgTypeExecutionReport), map[int]string{TagExecType: ExecTypeTrade, TagLastQty: "3"})
+	requireFields(t, seller.read(MsgTypeExecutionReport), map[int]string{TagClOrdID: "s2", TagExecType: ExecTypeTrade, TagCumQty: "7", TagLeavesQty: "1"})
+
+	seller.send(NewMessage(MsgTypeOrderCancelRequest).Set(TagOrigClOrdID, "s2").Set(TagClOrdID, "s3").Set(TagSide, "2"))
+	requireFields(t, seller.read(MsgTypeExecutionReport), map[int]string{TagClOrdID: "s3", TagOrigClOrdID: "s2", TagExecType: ExecTypeCanceled, TagOrdStatus: OrdStatusCanceled, TagLeavesQty: "0", TagCumQty: "7"})
+	seller.send(NewMessage(MsgTypeOrderCancelRequest).Set(TagOrigClOrdID, "s3").Set(TagClOrdID, "s4").Set(TagSide, "2"))
+	requireFields(t, seller.read(MsgTypeOrderCancelReject), map[int]string{TagClOrdID: "s4", TagCxlRejResponseTo: "1"})
+
+	buyer.send(newOrderSingle("b4", "9", "1", 7000, 1))
+	requireFields(t, buyer.read(MsgTypeExecutionReport), map[int]string{TagOrderID: "NONE", TagExecType: ExecTypeRejected, TagText: "unsupported Side 9"})
+
+	buyer.send(NewMessage(MsgTypeLogout))
+	buyer.read(MsgTypeLogout)
+}
+
+func TestAcceptorReplaceRejected(t *testing.T) {
+	_, addr := startAcceptor(t, t.TempDir())
+	api.ConfigureBook("DEFAULT", 0.5, 0)
+	t.Cleanup(func() { api.ConfigureBook("DEFAULT", 0, 0) })
+	client := dial(t, addr, "REPLACER", 1)
+	client.logon(true, 30)
+	client.send(newOrderSingle("r1", "2", "1", 86500, 5))
+	requireFields(t, client.read(MsgTypeExecutionReport), map[int]string{TagClOrdID: "r1", TagExecType: ExecTypeNew})
+
+	// A replace off the tick is refused and the original order stays live
+	client.send(NewMessage(MsgTypeOrderCancelReplaceRequest).Set(TagOrigClOrdID, "r1").Set(TagClOrdID, "r2").Set(TagSide, "2").SetFloat(TagPrice, 86500.3).SetInt(TagOrderQty, 5))
+	requireFields(t, client.read(MsgTypeOrderCancelReject), map[int]string{TagClOrdID: "r2", TagOrigClOrdID: "r1", TagCxlRejResponseTo: "2", TagCxlRejReason: "99", TagOrdStatus: OrdStatusNew, TagText: orderbook.RejectTickSize})
+	client.send(NewMessage(MsgTypeOrderCancelRequest).Set(TagOrigClOrdID, "r1").Set(TagClOrdID, "r3").Set(TagSide, "2"))
+	requireFields(t, client.read(MsgTypeExecutionReport), map[int]string{TagClOrdID: "r3", TagOrigClOrdID: "r1", TagExecType: ExecTypeCanceled, TagPrice: "86500", TagLeavesQty: "0", TagCumQty: "0"})
+}
+
+func TestAcceptorSessionAdmin(t *testing.T) {
+	dir := t.TempDir()
+	_, addr := startAcceptor(t, dir)
+	client := dial(t, addr, "ADMIN", 1)
+	// A long heartbeat interval keeps idle heartbeats from taking sequence numbers
+	client.logon(true, 30)
+
+	client.send(NewMessage(MsgTypeTestRequest).Set(TagTestReqID, "ping"))
+	requireFields(t, client.read(MsgTypeHeartbeat), map[int]string{TagTestReqID: "ping"})
+
+	// An invalid order produces an application message that can be resent
+	client.send(newOrderSingle("x1", "9", "1", 1, 1))
+	client.read(MsgTypeExecutionReport)
+	client.send(NewMessage(MsgTypeResendRequest).SetInt(TagBeginSeqNo, 1).SetInt(TagEndSeqNo, 0))
+	gap := client.read(MsgTypeSequenceReset)
+	requireFields(t, gap, map[int]string{TagMsgSeqNum: "1", TagGapFillFlag: "Y", TagPossDupFlag: "Y", TagNewSeqNo: "3"})
+	resent := client.read(MsgTypeExecutionReport)
+	requireFields(t, resent, map[int]string{TagMsgSeqNum: "3", TagPossDupFlag: "Y", TagClOrdID: "x1"})
+	_, ok := resent.Get(TagOrigSendingTime)
+	require.True(t, ok)
+
+	// Skipping a sequence number makes the acceptor ask for the gap, which is filled
+	missing := client.seq
+	client.seq++
+	client.send(NewMessage(MsgTypeHeartbeat))
+	requireFields(t, client.read(MsgTypeResendRequest), map[int]string{TagBeginSeqNo: strconv.Itoa(missing), TagEndSeqNo: "0"})
+	client.seq = missing
+	client.send(NewMessage(MsgTypeSequenceReset).Set(TagGapFillFlag, "Y").Set(TagPossDupFlag, "Y").SetInt(TagNewSeqNo, missing+2))
+	client.seq = missing + 2
+	client.send(NewMessage(MsgTypeTestRequest).Set(TagTestReqID, "after-gap"))
+	requireFields(t, client.read(MsgTypeHeartbeat), map[int]string{TagTestReqID: "after-gap"})
+
+	client.send(NewMessage(MsgTypeLogout))
+	client.read(MsgTypeLogout)
+	nextSeq := client.seq
+
+	// Sequence numbers survive a restart of the gateway
+	_, addr = startAcceptor(t, dir)
+	client = dial(t, addr, "ADMIN", 1)
+	client.send(NewMessage(MsgTypeLogon).SetInt(TagHeartBtInt, 1))
+	requireFields(t, client.read(MsgTypeLogout), map[int]string{TagText: "MsgSeqNum too low, expecting " + strconv.Itoa(nextSeq) + " but received 1"})
+
+	client = dial(t, addr, "ADMIN", nextSeq)
+	logon := client.logon(false, 30)
+	seq, err := logon.GetInt(TagMsgSeqNum)
+	require.NoError(t, err)
+	require.Greater(t, seq, 5)
+}
+
+func TestAcceptorRejectsInvalidCompID(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "a", "b")
+	_, addr := startAcceptor(t, dir)
+	dial(t, addr, "GOOD", 1).logon(true, 30)
+	for _, compID := range []string{"../../x", "a/b", "..", "x y"} {
+		client := dial(t, addr, compID, 1)
+		client.send(NewMessage(MsgTypeLogon).Set(TagEncryptMethod, "0").SetInt(TagHeartBtInt, 30))
+		client.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, err := ReadMessage(client.r)
+		require.Error(t, err, compID)
+	}
+	entries, err := os.ReadDir(root)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "a", entries[0].Name())
+	entries, err = os.ReadDir(filepath.Join(root, "a"))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	files, err := filepath.Glob(filepath.Join(dir, "*.seqnums"))
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(dir, "ORDERBOOK-GOOD.seqnums")}, files)
+}
+
+func TestAcceptorAccounts(t *testing.T) {
+	acceptor, addr := startAcceptor(t, t.TempDir())
+	acceptor.Accounts = map[string]string{"ALICE": "alice"}
+
+	// Only the sessions bound to an account may log on
+	stranger := dial(t, addr, "STRANGER", 1)
+	stranger.send(NewMessage(MsgTypeLogon).Set(TagEncryptMethod, "0").SetInt(TagHeartBtInt, 30))
+	stranger.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err := ReadMessage(stranger.r)
+	require.Error(t, err)
+
+	alice := dial(t, addr, "ALICE", 1)
+	alice.logon(true, 30)
+	alice.send(newOrderSingle("a1", "2", "1", 90000, 1).Set(TagAccount, "bob"))
+	requireFields(t, alice.read(MsgTypeExecutionReport), map[int]string{TagExecType: ExecTypeRejected, TagText: "account bob is not the account of the session"})
+	alice.send(newOrderSingle("a2", "2", "1", 90000, 1))
+	report := alice.read(MsgTypeExecutionReport)
+	requireFields(t, report, map[int]string{TagExecType: ExecTypeNew})
+	id, err := report.GetInt(TagOrderID)
+	require.NoError(t, err)
+	order, ok := acceptor.Engine.GetOrder(orderbook.OrderId(id))
+	require.True(t, ok)
+	require.Equal(t, "alice", order.Account)
+	alice.send(NewMessage(MsgTypeOrderCancelRequest).Set(TagOrigClOrdID, "a2").Set(TagClOrdID, "a3").Set(TagSide, "2"))
+	requireFields(t, alice.read(MsgTypeExecutionReport), map[int]string{TagExecType: ExecTypeCanceled})
+}
+
+// closeRecorder is a connection that only records being closed
+type closeRecorder struct {
+	net.Conn
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestHeartbeatStopsWithItsConnection(t *testing.T) {
+	for name, current := range map[string]*closeRecorder{"disconnected": nil, "logged on again": {}} {
+		t.Run(name, func(t *testing.T) {
+			// The TestRequest went unanswered long ago, a tick would disconnect
+			s := &session{id: "GONE", heartBtInt: 40 * time.Millisecond, testReqID: "TEST-1", lastSent: time.Now().Add(time.Hour), lastRecv: time.Now().Add(-time.Hour)}
+			if current != nil {
+				s.conn = current
+			}
+			old := &closeRecorder{}
+			finished := make(chan struct{})
+			go func() {
+				s.heartbeat(old, make(chan struct{}))
+				close(finished)
+			}()
+			select {
+			case <-finished:
+			case <-time.After(5 * time.Second):
+				t.Fatal("heartbeat kept running without its connection")
+			}
+			require.False(t, old.closed)
+			if current != nil {
+				require.False(t, current.closed, "the new connection was closed")
+			}
+		})
+	}
+}
+
+func TestAcceptorCancelledElsewhere(t *testing.T) {
+	acceptor, addr := startAcceptor(t, t.TempDir())
+	exchange := api.DefaultExchange()
+	src := audit.Source{Gateway: "test"}
+	client := dial(t, addr, "KILLED", 1)
+	client.logon(true, 30)
+	ids := map[string]orderbook.OrderId{}
+	for i, clOrdID := range []string{"k1", "k2", "k3"} {
+		client.send(newOrderSingle(clOrdID, "2", "1", float64(85000+i), 1).Set(TagAccount, "fixkill"))
+		report := client.read(MsgTypeExecutionReport)
+		id, err := report.GetInt(TagOrderID)
+		require.NoError(t, err)
+		ids[clOrdID] = orderbook.OrderId(id)
+	}
+
+	// A cancel from another gateway and the kill switch are reported to the session
+	_, ok := exchange.CancelOrder(src, ids["k1"])
+	require.True(t, ok)
+	requireFields(t, client.read(MsgTypeExecutionReport), map[int]string{TagClOrdID: "k1", TagExecType: ExecTypeCanceled, TagOrdStatus: OrdStatusCanceled, TagLeavesQty: "0", TagText: "cancelled outside the session"})
+	t.Cleanup(func() { exchange.Revive(src, api.CancelFilter{Account: "fixkill"}) })
+	require.Len(t, exchange.Kill(src, api.CancelFilter{Account: "fixkill"}), 2)
+	for _, clOrdID := range []string{"k2", "k3"} {
+		requireFields(t, client.read(MsgTypeExecutionReport), map[int]string{TagClOrdID: clOrdID, TagExecType: ExecTypeCanceled, TagOrdStatus: OrdStatusCanceled, TagText: "cancelled outside the session"})
+	}
+
+	// The gateway forgets the orders
+	acceptor.mu.Lock()
+	require.Empty(t, acceptor.orders)
+	require.Empty(t, acceptor.clOrdIDs)
+	acceptor.mu.Unlock()
+	client.send(NewMessage(MsgTypeOrderCancelRequest).Set(TagOrigClOrdID, "k2").Set(TagClOrdID, "k4").Set(TagSide, "2"))
+	requireFields(t, client.read(MsgTypeOrderCancelReject), map[int]string{TagClOrdID: "k4", TagCxlRejReason: "1"})
+}
+
+func TestAcceptorCancelOnDisconnect(t *testing.T) {
+	acceptor, addr := startAcceptor(t, t.TempDir())
+	acceptor.CancelOnDisconnectGrace = 50 * time.Millisecond
+	resting := func(report *Message) bool {
+		id, err := report.GetInt(TagOrderID)
+		require.NoError(t, err)
+		_, ok := acceptor.Engine.GetOrder(orderbook.OrderId(id))
+		return ok
+	}
+	logon := func(client *testClient, cancelOnDisconnect bool) {
+		logon := NewMessage(MsgTypeLogon).Set(TagEncryptMethod, "0").SetInt(TagHeartBtInt, 30).Set(TagResetSeqNumFlag, "Y")
+		if cancelOnDisconnect {
+			logon.Set(TagCancelOnDisconnect, "Y")
+		}
+		client.send(logon)
+		client.read(MsgTypeLogon)
+	}
+
+	gone := dial(t, addr, "GONE", 1)
+	logon(gone, true)
+	gone.send(newOrderSingle("g1", "2", "1", 80000, 1))
+	goneOrder := gone.read(MsgTypeExecutionReport)
+	back := dial(t, addr, "BACK", 1)
+	logon(back, true)
+	back.send(newOrderSingle("b1", "2", "1", 80001, 1))
+	backOrder := back.read(MsgTypeExecutionReport)
+	stays := dial(t, addr, "STAYS", 1)
+	logon(stays, false)
+	stays.send(newOrderSingle("s1", "2", "1", 80002, 1))
+	staysOrder := stays.read(MsgTypeExecutionReport)
+
+	for _, client := range []*testClient{gone, back, stays} {
+		client.conn.Close()
+		s := acceptor.session(client.compID)
+		require.Eventually(t, func() bool {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return s.conn == nil
+		}, time.Second, time.Millisecond)
+	}
+	back = dial(t, addr, "BACK", 1)
+	logon(back, true)
+	require.Eventually(t, func() bool { return !resting(goneOrder) }, time.Second, 5*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	require.True(t, resting(backOrder))
+	require.True(t, resting(staysOrder))
+
+	// The cancel is reported to the session, here once it asks for what it missed
+	gone = dial(t, addr, "GONE", 3)
+	gone.send(NewMessage(MsgTypeLogon).Set(TagEncryptMethod, "0").SetInt(TagHeartBtInt, 30))
+	gone.read(MsgTypeLogon)
+	gone.send(NewMessage(MsgTypeResendRequest).SetInt(TagBeginSeqNo, 3).SetInt(TagEndSeqNo, 0))
+	requireFields(t, gone.read(MsgTypeExecutionReport), map[int]string{TagClOrdID: "g1", TagExecType: ExecTypeCanceled, TagOrdStatus: OrdStatusCanceled, TagText: "cancelled on disconnect"})
+
+	for _, report := range []*Message{backOrder, staysOrder} {
+		id, _ := report.GetInt(TagOrderID)
+		acceptor.Engine.CancelOrder(audit.Source{Gateway: "test"}, orderbook.OrderId(id))
+	}
+}
+
+func TestAcceptorCloseKeepsOrders(t *testing.T) {
+	acceptor, addr := startAcceptor(t, t.TempDir())
+	client := dial(t, addr, "SHUTDOWN", 1)
+	client.send(NewMessage(MsgTypeLogon).Set(TagEncryptMethod, "0").SetInt(TagHeartBtInt, 30).Set(TagResetSeqNumFlag, "Y").Set(TagCancelOnDisconnect, "Y"))
+	client.read(MsgTypeLogon)
+	client.send(newOrderSingle("c1", "2", "1", 80003, 1))
+	id, err := client.read(MsgTypeExecutionReport).GetInt(TagOrderID)
+	require.NoError(t, err)
+
+	// The session logged out at shutdown keeps its orders for the snapshot
+	require.NoError(t, acceptor.Close())
+	client.read(MsgTypeLogout)
+	client.conn.Close()
+	s := acceptor.session("SHUTDOWN")
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.conn == nil
+	}, time.Second, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	_, ok := acceptor.Engine.GetOrder(orderbook.OrderId(id))
+	require.True(t, ok)
+	acceptor.Engine.CancelOrder(audit.Source{Gateway: "test"}, orderbook.OrderId(id))
+}
@@ -0,0 +1,301 @@
+package fix
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+const (
+	BeginString = "FIX.4.4"
+	soh         = '\x01'
+	// TimeFormat is the layout of UTCTimestamp fields
+	TimeFormat = "20060102-15:04:05.000"
+)
+
+// Tags used by the gateway
+const (
+	TagAccount             = 1
+	TagAvgPx               = 6
+	TagBeginSeqNo          = 7
+	TagBeginString         = 8
+	TagBodyLength          = 9
+	TagCheckSum            = 10
+	TagClOrdID             = 11
+	TagCumQty              = 14
+	TagEndSeqNo            = 16
+	TagExecID              = 17
+	TagLastPx              = 31
+	TagLastQty             = 32
+	TagMsgSeqNum           = 34
+	TagMsgType             = 35
+	TagNewSeqNo            = 36
+	TagOrderID             = 37
+	TagOrderQty            = 38
+	TagOrdStatus           = 39
+	TagOrdType             = 40
+	TagOrigClOrdID         = 41
+	TagPossDupFlag         = 43
+	TagPrice               = 44
+	TagRefSeqNum           = 45
+	TagSenderCompID        = 49
+	TagSendingTime         = 52
+	TagSide                = 54
+	TagSymbol              = 55
+	TagTargetCompID        = 56
+	TagText                = 58
+	TagTimeInForce         = 59
+	TagEncryptMethod       = 98
+	TagCxlRejReason        = 102
+	TagOrdRejReason        = 103
+	TagHeartBtInt          = 108
+	TagTestReqID           = 112
+	TagOrigSendingTime     = 122
+	TagGapFillFlag         = 123
+	TagResetSeqNumFlag     = 141
+	TagExecType            = 150
+	TagLeavesQty           = 151
+	TagSessionRejectReason = 373
+	TagCxlRejResponseTo    = 434
+	// TagCancelOnDisconnect is a user defined Logon field, Y asks for the orders of the
+	// session to be cancelled when it disconnects
+	TagCancelOnDisconnect = 8013
+)
+
+// Message types used by the gateway
+const (
+	MsgTypeHeartbeat                 = "0"
+	MsgTypeTestRequest               = "1"
+	MsgTypeResendRequest             = "2"
+	MsgTypeReject                    = "3"
+	MsgTypeSequenceReset             = "4"
+	MsgTypeLogout                    = "5"
+	MsgTypeExecutionReport           = "8"
+	MsgTypeOrderCancelReject         = "9"
+	MsgTypeLogon                     = "A"
+	MsgTypeNewOrderSingle            = "D"
+	MsgTypeOrderCancelRequest        = "F"
+	MsgTypeOrderCancelReplaceRequest = "G"
+)
+
+// headerTags are written before the body in this order
+var headerTags = []int{TagMsgType, TagSenderCompID, TagTargetCompID, TagMsgSeqNum, TagPossDupFlag, TagSendingTime, TagOrigSendingTime}
+
+type Field struct {
+	Tag   int
+	Value string
+}
+
+// Message is a FIX message without the BeginString, BodyLength and CheckSum fields,
+// which are computed when it is encoded
+type Message struct {
+	Fields []Field
+}
+
+func NewMessage(msgType string) *Message {
+	return &Message{Fields: []Field{{TagMsgType, msgType}}}
+}
+
+func (m *Message) MsgType() string {
+	v, _ := m.Get(TagMsgType)
+	return v
+}
+
+// Get returns the value of the first field with the tag
+func (m *Message) Get(tag int) (string, bool) {
+	for _, f := range m.Fields {
+		if f.Tag == tag {
+			return f.Value, true
+		}
+	}
+	return "", false
+}
+
+func (m *Message) GetInt(tag int) (int, error) {
+	v, ok := m.Get(tag)
+	if !ok {
+		return 0, fmt.Errorf("missing tag %d", tag)
+	}
+	return strconv.Atoi(v)
+}
+
+func (m *Message) GetFloat(tag int) (float64, error) {
+	v, ok := m.Get(tag)
+	if !ok {
+		return 0, fmt.Errorf("missing tag %d", tag)
+	}
+	return strconv.ParseFloat(v, 64)
+}
+
+// GetBool returns true when the tag is set to Y
+func (m *Message) GetBool(tag int) bool {
+	v, _ := m.Get(tag)
+	return v == "Y"
+}
+
+// Set replaces the value of the tag or appends it when absent
+func (m *Message) Set(tag int, value string) *Message {
+	for i, f := range m.Fields {
+		if f.Tag == tag {
+			m.Fields[i].Value = value
+			return m
+		}
+	}
+	m.Fields = append(m.Fields, Field{tag, value})
+	return m
+}
+
+func (m *Message) SetInt(tag int, value int) *Message {
+	return m.Set(tag, strconv.Itoa(value))
+}
+
+func (m *Message) SetFloat(tag int, value float64) *Message {
+	return m.Set(tag, strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+func (m *Message) SetTime(tag int, value time.Time) *Message {
+	return m.Set(tag, value.UTC().Format(TimeFormat))
+}
+
+// Bytes encodes the message with header fields first and the body length and checksum filled in
+func (m *Message) Bytes() []byte {
+	var body bytes.Buffer
+	for _, tag := range headerTags {
+		if v, ok := m.Get(tag); ok {
+			writeField(&body, tag, v)
+		}
+	}
+	for _, f := range m.Fields {
+		if isHeaderTag(f.Tag) || f.Tag == TagBeginString || f.Tag == TagBodyLength || f.Tag == TagCheckSum {
+			continue
+		}
+		writeField(&body, f.Tag, f.Value)
+	}
+	var out bytes.Buffer
+	writeField(&out, TagBeginString, BeginString)
+	writeField(&out, TagBodyLength, strconv.Itoa(body.Len()))
+	out.Write(body.Bytes())
+	writeField(&out, TagCheckSum, fmt.Sprintf("%03d", checksum(out.Bytes())))
+	return out.Bytes()
+}
+
+// String renders the message with | as the field separator, for logs
+func (m *Message) String() string {
+	return string(bytes.ReplaceAll(m.Bytes(), []byte{soh}, []byte{'|'}))
+}
+
+// Parse decodes a complete message, validating its body length and checksum
+func Parse(data []byte) (*Message, error) {
+	if len(data) == 0 || data[len(data)-1] != soh {
+		return nil, errors.New("message does not end with SOH")
+	}
+	fields := bytes.Split(data[:len(data)-1], []byte{soh})
+	if len(fields) < 4 {
+		return nil, errors.New("message too short")
+	}
+	m := &Message{}
+	var bodyStart, bodyLength int
+	offset := 0
+	for i, raw := range fields {
+		eq := bytes.IndexByte(raw, '=')
+		if eq <= 0 {
+			return nil, fmt.Errorf("malformed field %q", raw)
+		}
+		tag, err := strconv.Atoi(string(raw[:eq]))
+		if err != nil {
+			return nil, fmt.Errorf("malformed tag %q", raw[:eq])
+		}
+		value := string(raw[eq+1:])
+		switch {
+		case i == 0 && tag != TagBeginString, i == 1 && tag != TagBodyLength, i == 2 && tag != TagMsgType:
+			return nil, fmt.Errorf("unexpected tag %d at position %d", tag, i)
+		case i == 0 && value != BeginString:
+			return nil, fmt.Errorf("unsupported BeginString %s", value)
+		case i == 1:
+			if bodyLength, err = strconv.Atoi(value); err != nil {
+				return nil, fmt.Errorf("malformed BodyLength %q", value)
+			}
+			bodyStart = offset + len(raw) + 1
+		case i == len(fields)-1:
+			if tag != TagCheckSum {
+				return nil, errors.New("message does not end with CheckSum")
+			}
+			if offset-bodyStart != bodyLength {
+				return nil, fmt.Errorf("BodyLength is %d, expected %d", bodyLength, offset-bodyStart)
+			}
+			sum, err := strconv.Atoi(value)
+			if err != nil || sum != checksum(data[:offset]) {
+				return nil, fmt.Errorf("CheckSum is %s, expected %03d", value, checksum(data[:offset]))
+			}
+		default:
+			if i > 1 {
+				m.Fields = append(m.Fields, Field{tag, value})
+			}
+		}
+		offset += len(raw) + 1
+	}
+	return m, nil
+}
+
+// ReadMessage reads the bytes of the next message, using the BodyLength to find its end
+func ReadMessage(r *bufio.Reader) ([]byte, error) {
+	begin, err := r.ReadBytes(soh)
+	if err != nil {
+		return nil, err
+	}
+	length, err := r.ReadBytes(soh)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(length, []byte("9=")) {
+		return nil, fmt.Errorf("expected BodyLength, got %q", length)
+	}
+	n, err := strconv.Atoi(string(length[2 : len(length)-1]))
+	if err != nil || n < 0 || n > 1<<20 {
+		return nil, fmt.Errorf("malformed BodyLength %q", length)
+	}
+	// The body is followed by the 7 byte CheckSum field
+	rest := make([]byte, n+7)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, err
+	}
+	data := append(begin, length...)
+	return append(data, rest...), nil
+}
+
+func writeField(buf *bytes.Buffer, tag int, value string) {
+	buf.WriteString(strconv.Itoa(tag))
+	buf.WriteByte('=')
+	buf.WriteString(value)
+	buf.WriteByte(soh)
+}
+
+func checksum(data []byte) int {
+	sum := 0
+	for _, b := range data {
+		sum += int(b)
+	}
+	return sum % 256
+}
+
+func isHeaderTag(tag int) bool {
+	for _, t := range headerTags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func isAdmin(msgType string) bool {
+	switch msgType {
+	case MsgTypeHeartbeat, MsgTypeTestRequest, MsgTypeResendRequest, MsgTypeReject, MsgTypeSequenceReset, MsgTypeLogout, MsgTypeLogon:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,67 @@
+package fix
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageEncodeAndParse(t *testing.T) {
+	msg := NewMessage(MsgTypeNewOrderSingle)
+	msg.Set(TagClOrdID, "abc")
+	msg.SetInt(TagMsgSeqNum, 7)
+	msg.Set(TagSenderCompID, "CLIENT")
+	msg.Set(TagTargetCompID, "ORDERBOOK")
+	msg.SetFloat(TagPrice, 101.5)
+
+	data := msg.Bytes()
+	// Header fields are moved ahead of the body whatever order they were set in
+	require.True(t, strings.HasPrefix(string(data), "8=FIX.4.4\x019=49\x0135=D\x0149=CLIENT\x0156=ORDERBOOK\x0134=7\x01"), msg.String())
+	require.True(t, strings.HasSuffix(string(data), "11=abc\x0144=101.5\x0110=230\x01"), msg.String())
+
+	parsed, err := Parse(data)
+	require.NoError(t, err)
+	require.Equal(t, MsgTypeNewOrderSingle, parsed.MsgType())
+	seq, err := parsed.GetInt(TagMsgSeqNum)
+	require.NoError(t, err)
+	require.Equal(t, 7, seq)
+	price, err := parsed.GetFloat(TagPrice)
+	require.NoError(t, err)
+	require.Equal(t, 101.5, price)
+	require.Equal(t, data, parsed.Bytes())
+}
+
+func TestParseRejectsCorruptMessages(t *testing.T) {
+	data := NewMessage(MsgTypeHeartbeat).SetInt(TagMsgSeqNum, 1).Bytes()
+
+	corrupt := bytes.Replace(data, []byte("34=1"), []byte("34=2"), 1)
+	_, err := Parse(corrupt)
+	require.ErrorContains(t, err, "CheckSum")
+
+	_, err = Parse(bytes.Replace(data, []byte("9=10"), []byte("9=11"), 1))
+	require.ErrorContains(t, err, "BodyLength")
+
+	_, err = Parse(bytes.Replace(data, []byte("FIX.4.4"), []byte("FIX.4.2"), 1))
+	require.ErrorContains(t, err, "BeginString")
+
+	_, err = Parse(data[:len(data)-1])
+	require.Error(t, err)
+}
+
+func TestReadMessageSplitsStream(t *testing.T) {
+	first := NewMessage(MsgTypeHeartbeat).SetInt(TagMsgSeqNum, 1).Bytes()
+	second := NewMessage(MsgTypeTestRequest).SetInt(TagMsgSeqNum, 2).Set(TagTestReqID, "x").Bytes()
+	r := bufio.NewReader(bytes.NewReader(append(append([]byte{}, first...), second...)))
+
+	data, err := ReadMessage(r)
+	require.NoError(t, err)
+	require.Equal(t, first, data)
+	data, err = ReadMessage(r)
+	require.NoError(t, err)
+	require.Equal(t, second, data)
+	_, err = ReadMessage(r)
+	require.Error(t, err)
+}
@@ -0,0 +1,475 @@
+package fix
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/EliasManj/orderbook/audit"
+	"github.com/EliasManj/orderbook/orderbook"
+)
+
+// ExecType and OrdStatus values used in execution reports
+const (
+	ExecTypeNew      = "0"
+	ExecTypeCanceled = "4"
+	ExecTypeReplaced = "5"
+	ExecTypeRejected = "8"
+	ExecTypeTrade    = "F"
+
+	OrdStatusNew             = "0"
+	OrdStatusPartiallyFilled = "1"
+	OrdStatusFilled          = "2"
+	OrdStatusCanceled        = "4"
+	OrdStatusRejected        = "8"
+)
+
+type fill struct {
+	price orderbook.Price
+	qty   orderbook.Quantity
+}
+
+// orderState tracks an order entered through the gateway until it is filled or cancelled
+type orderState struct {
+	session  string
+	orderId  orderbook.OrderId
+	clOrdID  string
+	symbol   string
+	side     orderbook.Side
+	price    orderbook.Price
+	qty      orderbook.Quantity
+	cumQty   orderbook.Quantity
+	notional float64
+	done     bool
+	// inflight is set while a command for the order is running, fills seen meanwhile are
+	// held in pending so they are reported after the acknowledgement of the command
+	inflight bool
+	pending  []fill
+}
+
+func (o *orderState) status() string {
+	switch {
+	case o.done && o.cumQty < o.qty:
+		return OrdStatusCanceled
+	case o.cumQty >= o.qty:
+		return OrdStatusFilled
+	case o.cumQty > 0:
+		return OrdStatusPartiallyFilled
+	default:
+		return OrdStatusNew
+	}
+}
+
+func (o *orderState) leavesQty() orderbook.Quantity {
+	if o.done {
+		return 0
+	}
+	return o.qty - o.cumQty
+}
+
+// clOrdKey scopes a ClOrdID to the session that sent it
+func clOrdKey(sessionID string, clOrdID string) string {
+	return sessionID + "\x00" + clOrdID
+}
+
+// source identifies a message of a session for the audit log
+func source(s *session, msg *Message) audit.Source {
+	return audit.Source{Gateway: "fix", Client: s.id, Request: msg.String()}
+}
+
+// newOrderSingle maps a NewOrderSingle onto AddOrder
+func (a *Acceptor) newOrderSingle(s *session, msg *Message) {
+	clOrdID, ok := msg.Get(TagClOrdID)
+	if !ok {
+		a.Engine.Refuse(source(s, msg), audit.CommandNewOrder, nil, "missing ClOrdID")
+		s.reject(msg, "missing ClOrdID")
+		return
+	}
+	order, err := a.parseOrder(s, msg)
+	if err == nil {
+		a.mu.Lock()
+		if _, exists := a.clOrdIDs[clOrdKey(s.id, clOrdID)]; exists {
+			err = fmt.Errorf("duplicate ClOrdID %s", clOrdID)
+		}
+		a.mu.Unlock()
+	}
+	if err != nil {
+		a.Engine.Refuse(source(s, msg), audit.CommandNewOrder, order, err.Error())
+		s.send(a.rejectReport(msg, err.Error()))
+		return
+	}
+	state := &orderState{
+		session:  s.id,
+		orderId:  order.GetOrderId(),
+		clOrdID:  clOrdID,
+		symbol:   a.Engine.Symbol(),
+		side:     order.Side,
+		price:    order.Price,
+		qty:      order.GetInitialQty(),
+		inflight: true,
+	}
+	a.mu.Lock()
+	a.orders[state.orderId] = state
+	a.clOrdIDs[clOrdKey(s.id, clOrdID)] = state.orderId
+	a.mu.Unlock()
+
+	a.Engine.AddOrder(source(s, msg), *order)
+	_, resting := a.Engine.GetOrder(state.orderId)
+	a.finishCommand(state, resting, ExecTypeNew, "")
+}
+
+// cancelOrder maps an OrderCancelRequest onto CancelOrder
+func (a *Acceptor) cancelOrder(s *session, msg *Message) {
+	origClOrdID, _ := msg.Get(TagOrigClOrdID)
+	clOrdID, _ := msg.Get(TagClOrdID)
+	state := a.lookup(s.id, origClOrdID)
+	if state == nil {
+		a.Engine.Refuse(source(s, msg), audit.CommandCancelOrder, nil, "unknown order")
+		s.send(a.cancelReject(nil, origClOrdID, clOrdID, "1", "1", "unknown order"))
+		return
+	}
+	a.mu.Lock()
+	state.inflight = true
+	a.mu.Unlock()
+	if _, ok := a.Engine.CancelOrder(source(s, msg), state.orderId); !ok {
+		_, resting := a.Engine.GetOrder(state.orderId)
+		a.finishCommand(state, resting, "", "")
+		s.send(a.cancelReject(state, origClOrdID, clOrdID, "1", "0", "too late to cancel"))
+		return
+	}
+	a.mu.Lock()
+	state.inflight = false
+	state.done = true
+	a.rename(state, clOrdID)
+	report := a.execReport(state, ExecTypeCanceled)
+	report.Set(TagOrigClOrdID, origClOrdID)
+	a.forget(state)
+	a.mu.Unlock()
+	s.send(report)
+}
+
+// replaceOrder maps an OrderCancelReplaceRequest onto ModifyOrder
+func (a *Acceptor) replaceOrder(s *session, msg *Message) {
+	origClOrdID, _ := msg.Get(TagOrigClOrdID)
+	clOrdID, _ := msg.Get(TagClOrdID)
+	state := a.lookup(s.id, origClOrdID)
+	if state == nil {
+		a.Engine.Refuse(source(s, msg), audit.CommandModifyOrder, nil, "unknown order")
+		s.send(a.cancelReject(nil, origClOrdID, clOrdID, "2", "1", "unknown order"))
+		return
+	}
+	a.mu.Lock()
+	price, qty := state.price, state.qty
+	a.mu.Unlock()
+	if v, err := msg.GetFloat(TagPrice); err == nil {
+		price = orderbook.Price(v)
+	}
+	if v, err := msg.GetFloat(TagOrderQty); err == nil {
+		qty = orderbook.Quantity(v)
+	}
+
+	a.mu.Lock()
+	state.inflight = true
+	a.mu.Unlock()
+	if _, err := a.Engine.ModifyOrder(source(s, msg), state.orderId, price, qty); err != nil {
+		// The order stays live as it was. A replace the book rejects is refused with the
+		// reason Other, one that came too late with Too late to cancel
+		reason := "0"
+		var rejection orderbook.Rejection
+		if errors.As(err, &rejection) {
+			reason = "99"
+		}
+		_, resting := a.Engine.GetOrder(state.orderId)
+		a.finishCommand(state, resting, "", "")
+		s.send(a.cancelReject(state, origClOrdID, clOrdID, "2", reason, err.Error()))
+		return
+	}
+	a.mu.Lock()
+	state.price, state.qty = price, qty
+	a.rename(state, clOrdID)
+	a.mu.Unlock()
+	_, resting := a.Engine.GetOrder(state.orderId)
+	a.finishCommand(state, resting, ExecTypeReplaced, origClOrdID)
+}
+
+// finishCommand reports the outcome of a command on an order: the acknowledgement, the
+// fills it produced and a cancel when the order no longer rests with quantity left.
+// An empty execType skips the acknowledgement
+func (a *Acceptor) finishCommand(state *orderState, resting bool, execType string, origClOrdID string) {
+	a.mu.Lock()
+	pending := state.pending
+	state.pending = nil
+	state.inflight = false
+	reports := []*Message{}
+	if execType == ExecTypeNew && len(pending) == 0 && !resting {
+		// Nothing matched and nothing rests, the book refused the order
+		state.done = true
+		report := a.execReport(state, ExecTypeRejected)
+		report.Set(TagOrdStatus, OrdStatusRejected)
+		report.Set(TagText, "order could not be executed")
+		reports = append(reports, report)
+		a.forget(state)
+	} else {
+		if execType != "" {
+			report := a.execReport(state, execType)
+			if origClOrdID != "" {
+				report.Set(TagOrigClOrdID, origClOrdID)
+			}
+			reports = append(reports, report)
+		}
+		for _, f := range pending {
+			reports = append(reports, a.applyFill(state, f))
+		}
+		if !resting && !state.done && state.cumQty < state.qty {
+			state.done = true
+			report := a.execReport(state, ExecTypeCanceled)
+			report.Set(TagText, "unfilled quantity cancelled")
+			reports = append(reports, report)
+			a.forget(state)
+		}
+	}
+	a.mu.Unlock()
+	if s := a.session(state.session); s != nil {
+		for _, report := range reports {
+			s.send(report)
+		}
+	}
+}
+
+// bookListener follows the gateway orders in the book whichever gateway changes them: their
+// fills and their removal by another gateway, such as a mass cancel or the kill switch.
+// It runs while the book is locked so it never calls back into the engine
+type bookListener struct {
+	a *Acceptor
+}
+
+func (l bookListener) OrderAdded(order orderbook.Order) {}
+
+func (l bookListener) OrderExecuted(order orderbook.Order, qty orderbook.Quantity, price orderbook.Price, tradeId orderbook.TradeId) {
+	l.a.onFill(order.GetOrderId(), fill{price: price, qty: qty})
+}
+
+func (l bookListener) OrderTraded(order orderbook.Order, qty orderbook.Quantity, price orderbook.Price, tradeId orderbook.TradeId) {
+	l.a.onFill(order.GetOrderId(), fill{price: price, qty: qty})
+}
+
+func (l bookListener) OrderCancelled(order orderbook.Order, qty orderbook.Quantity) {}
+
+func (l bookListener) OrderDeleted(order orderbook.Order) {
+	l.a.onDeleted(order.GetOrderId())
+}
+
+func (l bookListener) OrderReplaced(old orderbook.Order, order orderbook.Order) {}
+
+// onFill reports the fill of a gateway order, or holds it for the command in flight
+func (a *Acceptor) onFill(orderId orderbook.OrderId, f fill) {
+	a.mu.Lock()
+	state, ok := a.orders[orderId]
+	if !ok {
+		a.mu.Unlock()
+		return
+	}
+	if state.inflight {
+		state.pending = append(state.pending, f)
+		a.mu.Unlock()
+		return
+	}
+	report := a.applyFill(state, f)
+	a.mu.Unlock()
+	if s := a.session(state.session); s != nil {
+		s.send(report)
+	}
+}
+
+// onDeleted reports a gateway order removed from the book by another gateway. Removals
+// caused by a command of the session are reported by the command
+func (a *Acceptor) onDeleted(orderId orderbook.OrderId) {
+	a.mu.Lock()
+	state, ok := a.orders[orderId]
+	if !ok || state.inflight || state.done {
+		a.mu.Unlock()
+		return
+	}
+	state.done = true
+	report := a.execReport(state, ExecTypeCanceled)
+	report.Set(TagText, "cancelled outside the session")
+	a.forget(state)
+	a.mu.Unlock()
+	if s := a.session(state.session); s != nil {
+		s.send(report)
+	}
+}
+
+// applyFill updates the order with a fill and returns its report. Callers must hold mu
+func (a *Acceptor) applyFill(state *orderState, f fill) *Message {
+	state.cumQty += f.qty
+	state.notional += float64(f.price) * float64(f.qty)
+	report := a.execReport(state, ExecTypeTrade)
+	report.SetFloat(TagLastPx, float64(f.price))
+	report.SetInt(TagLastQty, int(f.qty))
+	if state.cumQty >= state.qty {
+		a.forget(state)
+	}
+	return report
+}
+
+// execReport builds an ExecutionReport with the current state of the order. Callers must hold mu
+func (a *Acceptor) execReport(state *orderState, execType string) *Message {
+	a.execSeq++
+	msg := NewMessage(MsgTypeExecutionReport)
+	msg.Set(TagOrderID, strconv.Itoa(int(state.orderId)))
+	msg.Set(TagClOrdID, state.clOrdID)
+	msg.Set(TagExecID, fmt.Sprintf("%s-%d", a.execBase, a.execSeq))
+	msg.Set(TagExecType, execType)
+	msg.Set(TagOrdStatus, state.status())
+	msg.Set(TagSymbol, state.symbol)
+	msg.Set(TagSide, sideToFix(state.side))
+	msg.SetInt(TagOrderQty, int(state.qty))
+	msg.SetFloat(TagPrice, float64(state.price))
+	msg.SetInt(TagLeavesQty, int(state.leavesQty()))
+	msg.SetInt(TagCumQty, int(state.cumQty))
+	avgPx := 0.0
+	if state.cumQty > 0 {
+		avgPx = state.notional / float64(state.cumQty)
+	}
+	msg.SetFloat(TagAvgPx, avgPx)
+	return msg
+}
+
+// rejectReport builds the ExecutionReport refusing an invalid NewOrderSingle
+func (a *Acceptor) rejectReport(order *Message, reason string) *Message {
+	a.mu.Lock()
+	a.execSeq++
+	execID := fmt.Sprintf("%s-%d", a.execBase, a.execSeq)
+	a.mu.Unlock()
+	msg := NewMessage(MsgTypeExecutionReport)
+	msg.Set(TagOrderID, "NONE")
+	for _, tag := range []int{TagClOrdID, TagSymbol, TagSide, TagOrderQty} {
+		if v, ok := order.Get(tag); ok {
+			msg.Set(tag, v)
+		}
+	}
+	msg.Set(TagExecID, execID)
+	msg.Set(TagExecType, ExecTypeRejected)
+	msg.Set(TagOrdStatus, OrdStatusRejected)
+	msg.Set(TagOrdRejReason, "99")
+	msg.Set(TagText, reason)
+	msg.SetInt(TagLeavesQty, 0)
+	msg.SetInt(TagCumQty, 0)
+	msg.SetInt(TagAvgPx, 0)
+	return msg
+}
+
+// cancelReject builds an OrderCancelReject, responseTo is 1 for cancels and 2 for replaces
+func (a *Acceptor) cancelReject(state *orderState, origClOrdID string, clOrdID string, responseTo string, reason string, text string) *Message {
+	msg := NewMessage(MsgTypeOrderCancelReject)
+	msg.Set(TagOrderID, "NONE")
+	msg.Set(TagOrdStatus, OrdStatusRejected)
+	if state != nil {
+		a.mu.Lock()
+		msg.Set(TagOrderID, strconv.Itoa(int(state.orderId)))
+		msg.Set(TagOrdStatus, state.status())
+		a.mu.Unlock()
+	}
+	msg.Set(TagClOrdID, clOrdID)
+	msg.Set(TagOrigClOrdID, origClOrdID)
+	msg.Set(TagCxlRejResponseTo, responseTo)
+	msg.Set(TagCxlRejReason, reason)
+	msg.Set(TagText, text)
+	return msg
+}
+
+// parseOrder validates a NewOrderSingle of a session and builds the matching order
+func (a *Acceptor) parseOrder(s *session, msg *Message) (*orderbook.Order, error) {
+	if symbol, ok := msg.Get(TagSymbol); ok && symbol != a.Engine.Symbol() {
+		return nil, fmt.Errorf("unknown symbol %s", symbol)
+	}
+	side, err := sideFromFix(msg)
+	if err != nil {
+		return nil, err
+	}
+	qty, err := msg.GetFloat(TagOrderQty)
+	if err != nil || qty <= 0 || qty != float64(int(qty)) {
+		return nil, errors.New("invalid OrderQty")
+	}
+	ordType, _ := msg.Get(TagOrdType)
+	tif, _ := msg.Get(TagTimeInForce)
+	var orderType string
+	var price float64
+	switch ordType {
+	case "1":
+		orderType = orderbook.Market.String()
+	case "2":
+		if price, err = msg.GetFloat(TagPrice); err != nil || price <= 0 {
+			return nil, errors.New("limit orders need a positive Price")
+		}
+		switch tif {
+		case "", "0", "1":
+			orderType = orderbook.GoodTilCancelled.String()
+		case "3":
+			orderType = orderbook.FillAndKill.String()
+		case "4":
+			orderType = orderbook.FillOrKill.String()
+		default:
+			return nil, fmt.Errorf("unsupported TimeInForce %s", tif)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported OrdType %s", ordType)
+	}
+	order := orderbook.NewOrder(orderType, side.String(), price, int(qty))
+	if order == nil {
+		return nil, errors.New("invalid order")
+	}
+	order.Account, _ = msg.Get(TagAccount)
+	if a.Accounts != nil {
+		account := a.Accounts[s.id]
+		if order.Account != "" && order.Account != account {
+			return order, fmt.Errorf("account %s is not the account of the session", order.Account)
+		}
+		order.Account = account
+	}
+	return order, nil
+}
+
+func sideFromFix(msg *Message) (orderbook.Side, error) {
+	side, _ := msg.Get(TagSide)
+	switch side {
+	case "1":
+		return orderbook.Buy, nil
+	case "2":
+		return orderbook.Sell, nil
+	default:
+		return 0, fmt.Errorf("unsupported Side %s", side)
+	}
+}
+
+func sideToFix(side orderbook.Side) string {
+	if side == orderbook.Buy {
+		return "1"
+	}
+	return "2"
+}
+
+// lookup finds a live order by the ClOrdID a session last gave it
+func (a *Acceptor) lookup(sessionID string, clOrdID string) *orderState {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	id, ok := a.clOrdIDs[clOrdKey(sessionID, clOrdID)]
+	if !ok {
+		return nil
+	}
+	return a.orders[id]
+}
+
+// rename moves the order to the ClOrdID of the command that changed it. Callers must hold mu
+func (a *Acceptor) rename(state *orderState, clOrdID string) {
+	delete(a.clOrdIDs, clOrdKey(state.session, state.clOrdID))
+	state.clOrdID = clOrdID
+	a.clOrdIDs[clOrdKey(state.session, clOrdID)] = state.orderId
+}
+
+// forget stops tracking a finished order. Callers must hold mu
+func (a *Acceptor) forget(state *orderState) {
+	delete(a.orders, state.orderId)
+	delete(a.clOrdIDs, clOrdKey(state.session, state.clOrdID))
+}
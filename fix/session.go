@@ -0,0 +1,314 @@
+package fix
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultHeartBtInt is the heartbeat interval in seconds used when the Logon does not set one
+const DefaultHeartBtInt = 30
+
+// session is the state of one counterparty, kept between connections so that
+// execution reports produced while it is logged out can be resent
+type session struct {
+	id       string
+	acceptor *Acceptor
+	store    Store
+
+	mu         sync.Mutex
+	conn       net.Conn
+	heartBtInt time.Duration
+	lastSent   time.Time
+	lastRecv   time.Time
+	testReqID  string
+	// resendUntil is the highest sequence number seen while waiting for a requested resend
+	resendUntil int
+	// cancelOnDisconnect is set by the Logon, disconnectTimer runs while the session is away
+	cancelOnDisconnect bool
+	disconnectTimer    *time.Timer
+}
+
+// send stamps the header and next sequence number on msg, stores it and writes it
+// to the connection when the counterparty is logged on
+func (s *session) send(msg *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sendLocked(msg)
+}
+
+func (s *session) sendLocked(msg *Message) error {
+	seq := s.store.NextSenderSeq()
+	s.stamp(msg, seq)
+	data := msg.Bytes()
+	if err := s.store.SaveMessage(seq, data); err != nil {
+		return err
+	}
+	if err := s.store.SetNextSenderSeq(seq + 1); err != nil {
+		return err
+	}
+	return s.write(data)
+}
+
+func (s *session) stamp(msg *Message, seq int) {
+	msg.Set(TagSenderCompID, s.acceptor.CompID)
+	msg.Set(TagTargetCompID, s.id)
+	msg.SetInt(TagMsgSeqNum, seq)
+	msg.SetTime(TagSendingTime, time.Now())
+}
+
+// write sends raw bytes if connected. Callers must hold mu
+func (s *session) write(data []byte) error {
+	if s.conn == nil {
+		return nil
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := s.conn.Write(data); err != nil {
+		s.conn.Close()
+		return err
+	}
+	s.lastSent = time.Now()
+	return nil
+}
+
+// logout sends a Logout with an optional reason and closes the connection
+func (s *session) logout(text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msg := NewMessage(MsgTypeLogout)
+	if text != "" {
+		msg.Set(TagText, text)
+	}
+	s.sendLocked(msg)
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+// resend answers a ResendRequest, replaying stored application messages with PossDupFlag
+// and replacing admin messages and gaps with SequenceReset-GapFill
+func (s *session) resend(begin int, end int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next := s.store.NextSenderSeq()
+	if end == 0 || end >= next {
+		end = next - 1
+	}
+	gapStart := 0
+	flushGap := func(upTo int) error {
+		if gapStart == 0 {
+			return nil
+		}
+		gap := NewMessage(MsgTypeSequenceReset)
+		s.stamp(gap, gapStart)
+		gap.Set(TagPossDupFlag, "Y")
+		gap.Set(TagGapFillFlag, "Y")
+		gap.SetInt(TagNewSeqNo, upTo)
+		gapStart = 0
+		return s.write(gap.Bytes())
+	}
+	for seq := begin; seq <= end; seq++ {
+		data, ok := s.store.Message(seq)
+		var msg *Message
+		if ok {
+			msg, _ = Parse(data)
+		}
+		if msg == nil || isAdmin(msg.MsgType()) {
+			if gapStart == 0 {
+				gapStart = seq
+			}
+			continue
+		}
+		if err := flushGap(seq); err != nil {
+			return err
+		}
+		if sent, ok := msg.Get(TagSendingTime); ok {
+			msg.Set(TagOrigSendingTime, sent)
+		}
+		msg.Set(TagPossDupFlag, "Y")
+		msg.SetTime(TagSendingTime, time.Now())
+		if err := s.write(msg.Bytes()); err != nil {
+			return err
+		}
+	}
+	return flushGap(end + 1)
+}
+
+// checkSeqNum validates the sequence number of an incoming message, returning whether it
+// should be processed. Messages ahead of the expected number trigger a ResendRequest
+func (s *session) checkSeqNum(msg *Message) (bool, error) {
+	seq, err := msg.GetInt(TagMsgSeqNum)
+	if err != nil {
+		return false, errors.New("missing MsgSeqNum")
+	}
+	expected := s.store.NextTargetSeq()
+	switch {
+	case seq == expected:
+		if err := s.store.SetNextTargetSeq(seq + 1); err != nil {
+			return false, err
+		}
+		s.mu.Lock()
+		if seq >= s.resendUntil {
+			s.resendUntil = 0
+		}
+		s.mu.Unlock()
+		return true, nil
+	case seq > expected:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.resendUntil == 0 {
+			req := NewMessage(MsgTypeResendRequest)
+			req.SetInt(TagBeginSeqNo, expected)
+			req.SetInt(TagEndSeqNo, 0)
+			if err := s.sendLocked(req); err != nil {
+				return false, err
+			}
+		}
+		s.resendUntil = max(s.resendUntil, seq)
+		return false, nil
+	case msg.GetBool(TagPossDupFlag):
+		return false, nil
+	default:
+		return false, fmt.Errorf("MsgSeqNum too low, expecting %d but received %d", expected, seq)
+	}
+}
+
+// serve runs the session on a logged on connection until it is closed
+func (s *session) serve(conn net.Conn, r *bufio.Reader) {
+	done := make(chan struct{})
+	defer close(done)
+	go s.heartbeat(conn, done)
+	for {
+		data, err := ReadMessage(r)
+		if err != nil {
+			return
+		}
+		msg, err := Parse(data)
+		if err != nil {
+			log.Printf("fix %s: %v", s.id, err)
+			continue
+		}
+		s.mu.Lock()
+		s.lastRecv = time.Now()
+		s.testReqID = ""
+		s.mu.Unlock()
+
+		if msg.MsgType() == MsgTypeSequenceReset && !msg.GetBool(TagGapFillFlag) {
+			// A reset without GapFill moves the expected sequence regardless of MsgSeqNum
+			if next, err := msg.GetInt(TagNewSeqNo); err == nil {
+				s.store.SetNextTargetSeq(next)
+			}
+			continue
+		}
+		process, err := s.checkSeqNum(msg)
+		if err != nil {
+			s.logout(err.Error())
+			return
+		}
+		if !process {
+			continue
+		}
+		if !s.handle(msg) {
+			return
+		}
+	}
+}
+
+// handle processes an in sequence message, returning false once the session has logged out
+func (s *session) handle(msg *Message) bool {
+	switch msg.MsgType() {
+	case MsgTypeHeartbeat, MsgTypeReject:
+	case MsgTypeTestRequest:
+		hb := NewMessage(MsgTypeHeartbeat)
+		if id, ok := msg.Get(TagTestReqID); ok {
+			hb.Set(TagTestReqID, id)
+		}
+		s.send(hb)
+	case MsgTypeResendRequest:
+		begin, err := msg.GetInt(TagBeginSeqNo)
+		if err != nil {
+			s.reject(msg, "missing BeginSeqNo")
+			return true
+		}
+		end, _ := msg.GetInt(TagEndSeqNo)
+		if err := s.resend(begin, end); err != nil {
+			log.Printf("fix %s: resend: %v", s.id, err)
+		}
+	case MsgTypeSequenceReset:
+		if next, err := msg.GetInt(TagNewSeqNo); err == nil {
+			s.store.SetNextTargetSeq(next)
+		}
+	case MsgTypeLogout:
+		s.logout("")
+		return false
+	case MsgTypeLogon:
+		s.reject(msg, "already logged on")
+	case MsgTypeNewOrderSingle:
+		s.acceptor.newOrderSingle(s, msg)
+	case MsgTypeOrderCancelRequest:
+		s.acceptor.cancelOrder(s, msg)
+	case MsgTypeOrderCancelReplaceRequest:
+		s.acceptor.replaceOrder(s, msg)
+	default:
+		s.reject(msg, "unsupported MsgType "+msg.MsgType())
+	}
+	return true
+}
+
+// reject sends a session level Reject for msg
+func (s *session) reject(msg *Message, text string) {
+	rej := NewMessage(MsgTypeReject)
+	if seq, ok := msg.Get(TagMsgSeqNum); ok {
+		rej.Set(TagRefSeqNum, seq)
+	}
+	rej.Set(TagText, text)
+	s.send(rej)
+}
+
+// heartbeat sends Heartbeats when the session is idle, a TestRequest when the counterparty
+// is silent and closes conn if the TestRequest goes unanswered. It stops once done is closed
+// or the session is no longer on conn, whichever it sees first
+func (s *session) heartbeat(conn net.Conn, done <-chan struct{}) {
+	// The session may log on again with another interval once done is closed
+	s.mu.Lock()
+	interval := s.heartBtInt / 4
+	s.mu.Unlock()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			// A tick can win over a closed done: stop once the connection is over, or the
+			// session went away or is on a connection of its own
+			select {
+			case <-done:
+				conn = nil
+			default:
+			}
+			if conn == nil || s.conn != conn {
+				s.mu.Unlock()
+				return
+			}
+			if now.Sub(s.lastSent) >= s.heartBtInt {
+				s.sendLocked(NewMessage(MsgTypeHeartbeat))
+			}
+			silence := now.Sub(s.lastRecv)
+			if s.testReqID == "" && silence >= s.heartBtInt*6/5 {
+				s.testReqID = "TEST-" + strconv.FormatInt(now.UnixNano(), 10)
+				s.sendLocked(NewMessage(MsgTypeTestRequest).Set(TagTestReqID, s.testReqID))
+			} else if s.testReqID != "" && silence >= s.heartBtInt*2 {
+				log.Printf("fix %s: no response to TestRequest, disconnecting", s.id)
+				conn.Close()
+			}
+			s.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package fix
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Store persists the sequence numbers and sent messages of a session so it can resume after a restart
+type Store interface {
+	NextSenderSeq() int
+	NextTargetSeq() int
+	SetNextSenderSeq(seq int) error
+	SetNextTargetSeq(seq int) error
+	// SaveMessage records a sent message so it can be resent on request
+	SaveMessage(seq int, data []byte) error
+	// Message returns a previously sent message
+	Message(seq int) ([]byte, bool)
+	// Reset starts both sequences over at 1 and forgets sent messages
+	Reset() error
+}
+
+// MemoryStore keeps the session state in memory only
+type MemoryStore struct {
+	mu         sync.Mutex
+	nextSender int
+	nextTarget int
+	messages   map[int][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{nextSender: 1, nextTarget: 1, messages: make(map[int][]byte)}
+}
+
+func (s *MemoryStore) NextSenderSeq() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.nextSender
+}
+
+func (s *MemoryStore) NextTargetSeq() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.nextTarget
+}
+
+func (s *MemoryStore) SetNextSenderSeq(seq int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextSender = seq
+	return nil
+}
+
+func (s *MemoryStore) SetNextTargetSeq(seq int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextTarget = seq
+	return nil
+}
+
+func (s *MemoryStore) SaveMessage(seq int, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages[seq] = data
+	return nil
+}
+
+func (s *MemoryStore) Message(seq int) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.messages[seq]
+	return data, ok
+}
+
+func (s *MemoryStore) Reset() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextSender, s.nextTarget = 1, 1
+	s.messages = make(map[int][]byte)
+	return nil
+}
+
+// FileStore keeps the session state in memory and mirrors it to two files in a directory,
+// <session>.seqnums with the next sender and target sequence numbers and
+// <session>.body with every sent message
+type FileStore struct {
+	*MemoryStore
+	seqPath  string
+	bodyPath string
+	body     *os.File
+}
+
+// NewFileStore opens the files of a session in dir, loading any state left by a previous run
+func NewFileStore(dir string, sessionID string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &FileStore{
+		MemoryStore: NewMemoryStore(),
+		seqPath:     filepath.Join(dir, sessionID+".seqnums"),
+		bodyPath:    filepath.Join(dir, sessionID+".body"),
+	}
+	if data, err := os.ReadFile(s.seqPath); err == nil {
+		if _, err := fmt.Sscanf(string(data), "%d %d", &s.nextSender, &s.nextTarget); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", s.seqPath, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := s.loadMessages(); err != nil {
+		return nil, err
+	}
+	body, err := os.OpenFile(s.bodyPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s.body = body
+	return s, nil
+}
+
+// loadMessages reads the body file, each record is a "seq length" line followed by the message
+func (s *FileStore) loadMessages() error {
+	file, err := os.Open(s.bodyPath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+	r := bufio.NewReader(file)
+	for {
+		var seq, length int
+		if _, err := fmt.Fscanf(r, "%d %d\n", &seq, &length); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("reading %s: %w", s.bodyPath, err)
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return fmt.Errorf("reading %s: %w", s.bodyPath, err)
+		}
+		s.messages[seq] = data
+	}
+}
+
+func (s *FileStore) SetNextSenderSeq(seq int) error {
+	s.MemoryStore.SetNextSenderSeq(seq)
+	return s.saveSeqNums()
+}
+
+func (s *FileStore) SetNextTargetSeq(seq int) error {
+	s.MemoryStore.SetNextTargetSeq(seq)
+	return s.saveSeqNums()
+}
+
+func (s *FileStore) SaveMessage(seq int, data []byte) error {
+	s.MemoryStore.SaveMessage(seq, data)
+	if _, err := fmt.Fprintf(s.body, "%d %d\n", seq, len(data)); err != nil {
+		return err
+	}
+	_, err := s.body.Write(data)
+	return err
+}
+
+func (s *FileStore) Reset() error {
+	s.MemoryStore.Reset()
+	if err := s.body.Truncate(0); err != nil {
+		return err
+	}
+	return s.saveSeqNums()
+}
+
+func (s *FileStore) Close() error {
+	return s.body.Close()
+}
+
+// saveSeqNums rewrites the sequence file through a rename so a crash never leaves it half written
+func (s *FileStore) saveSeqNums() error {
+	tmp := s.seqPath + ".tmp"
+	data := fmt.Sprintf("%d %d\n", s.NextSenderSeq(), s.NextTargetSeq())
+	if err := os.WriteFile(tmp, []byte(data), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.seqPath)
+}
@@ -0,0 +1,176 @@
+package grpcapi
+
+import (
+	"context"
+	"strings"
+
+	"github.com/EliasManj/orderbook/auth"
+	"github.com/EliasManj/orderbook/grpcapi/pb"
+	"github.com/EliasManj/orderbook/orderbook"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// methodPermissions is the permission each method needs when authentication is on
+var methodPermissions = map[string]auth.Permission{
+	pb.OrderBook_SubmitOrder_FullMethodName:     auth.Trade,
+	pb.OrderBook_CancelOrder_FullMethodName:     auth.Trade,
+	pb.OrderBook_ModifyOrder_FullMethodName:     auth.Trade,
+	pb.OrderBook_GetOrder_FullMethodName:        auth.Read,
+	pb.OrderBook_GetDepth_FullMethodName:        auth.Read,
+	pb.OrderBook_SubscribeDepth_FullMethodName:  auth.Read,
+	pb.OrderBook_SubscribeTrades_FullMethodName: auth.Read,
+}
+
+// Calls are signed like HTTP requests, as a POST of the full method name. The body is the
+// request in the deterministic protobuf encoding for unary calls and empty for streams.
+// The key, timestamp, nonce and signature travel in the metadata under the names of the
+// HTTP headers
+const signedMethod = "POST"
+
+var (
+	mdKey       = strings.ToLower(auth.HeaderKey)
+	mdTimestamp = strings.ToLower(auth.HeaderTimestamp)
+	mdNonce     = strings.ToLower(auth.HeaderNonce)
+	mdSignature = strings.ToLower(auth.HeaderSignature)
+)
+
+var errOtherAccount = status.Error(codes.PermissionDenied, "API key cannot act for another account")
+
+// signedBody is the body a call is signed with
+func signedBody(req any) ([]byte, error) {
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return nil, nil
+	}
+	return proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+}
+
+// authenticate checks the signature of a call and the permission of its key, returning
+// the context carrying the key. Calls go through as they are when Keys is nil
+func (s *Server) authenticate(ctx context.Context, method string, body []byte) (context.Context, error) {
+	if s.Keys == nil {
+		return ctx, nil
+	}
+	need, ok := methodPermissions[method]
+	if !ok {
+		return nil, status.Errorf(codes.PermissionDenied, "unknown method %s", method)
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	get := func(name string) string {
+		if values := md.Get(name); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	sig := auth.Signature{Key: get(mdKey), Timestamp: get(mdTimestamp), Nonce: get(mdNonce), Signature: get(mdSignature)}
+	key, err := s.Keys.VerifySigned(sig, signedMethod, method, body)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if !key.Permission.Allows(need) {
+		return nil, status.Errorf(codes.PermissionDenied, "API key does not have the %s permission", need)
+	}
+	return auth.WithKey(ctx, key), nil
+}
+
+func (s *Server) authUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	body, err := signedBody(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	ctx, err = s.authenticate(ctx, info.FullMethod, body)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) authStream(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authenticate(stream.Context(), info.FullMethod, nil)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &keyedStream{ServerStream: stream, ctx: ctx})
+}
+
+// keyedStream is a stream whose context carries the key it was opened with
+type keyedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *keyedStream) Context() context.Context {
+	return s.ctx
+}
+
+// requestAccount returns the account a call acts for. Without authentication or with an
+// admin key it is the account asked for, otherwise the account of the key
+func requestAccount(ctx context.Context, account string) (string, error) {
+	key, ok := auth.FromContext(ctx)
+	if !ok || key.Permission == auth.Admin {
+		return account, nil
+	}
+	if account != "" && account != key.Account {
+		return "", errOtherAccount
+	}
+	return key.Account, nil
+}
+
+// ownsOrder reports whether the key of a call may cancel or modify an order of account
+func ownsOrder(ctx context.Context, account string) bool {
+	key, ok := auth.FromContext(ctx)
+	return !ok || key.Permission == auth.Admin || key.Account == account
+}
+
+// visibleTrade returns a trade of the trade stream as the caller may see it: with the
+// accounts and fees of every order for admin keys, of the orders of its account for other
+// keys and of none without a key
+func visibleTrade(ctx context.Context, trade orderbook.Trade) orderbook.Trade {
+	key, ok := auth.FromContext(ctx)
+	if ok && key.Permission == auth.Admin {
+		return trade
+	}
+	return trade.VisibleTo(key.Account)
+}
+
+// Signer signs the calls of a client with an API key, for servers with authentication on
+type Signer struct {
+	Key    string
+	Secret string
+}
+
+// DialOptions returns the options signing every call of a client connection
+func (sg Signer) DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			body, err := signedBody(req)
+			if err != nil {
+				return err
+			}
+			if ctx, err = sg.sign(ctx, method, body); err != nil {
+				return err
+			}
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}),
+		grpc.WithChainStreamInterceptor(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			ctx, err := sg.sign(ctx, method, nil)
+			if err != nil {
+				return nil, err
+			}
+			return streamer(ctx, desc, cc, method, opts...)
+		}),
+	}
+}
+
+// sign adds the signature of a call to the outgoing metadata of ctx
+func (sg Signer) sign(ctx context.Context, method string, body []byte) (context.Context, error) {
+	sig, err := auth.SignNow(sg.Key, sg.Secret, signedMethod, method, body)
+	if err != nil {
+		return nil, err
+	}
+	return metadata.AppendToOutgoingContext(ctx, mdKey, sig.Key, mdTimestamp, sig.Timestamp, mdNonce, sig.Nonce, mdSignature, sig.Signature), nil
+}
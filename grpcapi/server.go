@@ -0,0 +1,461 @@
+// Package grpcapi serves the order book over gRPC, with the contract defined in orderbook.proto
+package grpcapi
+
+//go:generate protoc --go_out=pb --go_opt=paths=source_relative --go-grpc_out=pb --go-grpc_opt=paths=source_relative orderbook.proto
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/EliasManj/orderbook/audit"
+	"github.com/EliasManj/orderbook/auth"
+	"github.com/EliasManj/orderbook/grpcapi/pb"
+	"github.com/EliasManj/orderbook/orderbook"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// subscriptionBuffer is the number of trades a subscriber may fall behind before it is dropped
+const subscriptionBuffer = 1024
+
+// Engine is the order book the service routes requests to
+type Engine interface {
+	Symbol() string
+	AddOrder(src audit.Source, order orderbook.Order) []orderbook.Trade
+	CancelOrder(src audit.Source, orderId orderbook.OrderId) (orderbook.Order, bool)
+	ModifyOrder(src audit.Source, orderId orderbook.OrderId, price orderbook.Price, qty orderbook.Quantity) ([]orderbook.Trade, error)
+	GetOrder(orderId orderbook.OrderId) (orderbook.Order, bool)
+	Depth(levels int) orderbook.OrderBookLevelInfos
+	// Refuse records a call the service turned down in the audit log
+	Refuse(src audit.Source, command string, order *orderbook.Order, reason string)
+	// OnTrades and OnDepth register callbacks run after every command, whichever gateway sent it
+	OnTrades(fn func([]orderbook.Trade))
+	OnDepth(fn func(orderbook.OrderBookLevelInfos))
+}
+
+// Server implements the OrderBook gRPC service on top of an Engine
+type Server struct {
+	pb.UnimplementedOrderBookServer
+	Engine Engine
+	// Keys turns authentication on when set: every call must be signed by a key with the
+	// permission of its method, see Signer, and orders are booked to the account of the key
+	Keys *auth.KeyStore
+
+	grpc   *grpc.Server
+	symbol string
+	// stopping is closed by Shutdown to end the streams
+	stopping     chan struct{}
+	stoppingOnce sync.Once
+
+	mu        sync.Mutex
+	tradeSubs map[*tradeSub]struct{}
+	depthSubs map[*depthSub]struct{}
+}
+
+// tradeSub is a SubscribeTrades stream, dropped when its buffer fills up
+type tradeSub struct {
+	trades  chan orderbook.Trade
+	dropped chan struct{}
+}
+
+// depthSub is a SubscribeDepth stream that only ever holds the latest depth
+type depthSub struct {
+	depth chan orderbook.OrderBookLevelInfos
+}
+
+// NewServer creates a Server routing requests to engine
+func NewServer(engine Engine) *Server {
+	s := &Server{
+		Engine:    engine,
+		symbol:    engine.Symbol(),
+		tradeSubs: make(map[*tradeSub]struct{}),
+		depthSubs: make(map[*depthSub]struct{}),
+		stopping:  make(chan struct{}),
+	}
+	s.grpc = grpc.NewServer(grpc.UnaryInterceptor(s.authUnary), grpc.StreamInterceptor(s.authStream))
+	pb.RegisterOrderBookServer(s.grpc, s)
+	engine.OnTrades(s.onTrades)
+	engine.OnDepth(s.onDepth)
+	return s
+}
+
+// Listen serves gRPC on addr until Close is called
+func (s *Server) Listen(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve serves gRPC on l until Close is called
+func (s *Server) Serve(l net.Listener) error {
+	err := s.grpc.Serve(l)
+	if errors.Is(err, grpc.ErrServerStopped) {
+		return nil
+	}
+	return err
+}
+
+// Close stops the server, ending every open stream
+func (s *Server) Close() {
+	s.grpc.Stop()
+}
+
+// Shutdown ends the streams with Unavailable, refuses new calls and waits for the calls in
+// progress to finish, stopping the server outright once ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.stoppingOnce.Do(func() { close(s.stopping) })
+	done := make(chan struct{})
+	go func() {
+		s.grpc.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.grpc.Stop()
+		return ctx.Err()
+	}
+}
+
+var errStopping = status.Error(codes.Unavailable, "server shutting down")
+
+// source identifies the caller of a request for the audit log by its key, or its address
+// without authentication, with the request in its JSON form
+func source(ctx context.Context, req proto.Message) audit.Source {
+	src := audit.Source{Gateway: "grpc"}
+	if key, ok := auth.FromContext(ctx); ok {
+		src.Client = "key " + key.Key
+	} else if p, ok := peer.FromContext(ctx); ok {
+		src.Client = "peer " + p.Addr.String()
+	}
+	if data, err := protojson.Marshal(req); err == nil {
+		src.Request = string(data)
+	}
+	return src
+}
+
+// invalid records a refused call and returns its error
+func (s *Server) invalid(src audit.Source, command string, err error) error {
+	s.Engine.Refuse(src, command, nil, status.Convert(err).Message())
+	return err
+}
+
+func (s *Server) SubmitOrder(ctx context.Context, req *pb.SubmitOrderRequest) (*pb.SubmitOrderResponse, error) {
+	src := source(ctx, req)
+	orderType, ok := orderTypes[req.Type]
+	if !ok {
+		return nil, s.invalid(src, audit.CommandNewOrder, status.Errorf(codes.InvalidArgument, "unsupported order type %v", req.Type))
+	}
+	side, ok := sides[req.Side]
+	if !ok {
+		return nil, s.invalid(src, audit.CommandNewOrder, status.Errorf(codes.InvalidArgument, "unsupported side %v", req.Side))
+	}
+	if req.Quantity <= 0 {
+		return nil, s.invalid(src, audit.CommandNewOrder, status.Error(codes.InvalidArgument, "quantity must be positive"))
+	}
+	if req.Type != pb.OrderType_ORDER_TYPE_MARKET && req.Price <= 0 {
+		return nil, s.invalid(src, audit.CommandNewOrder, status.Error(codes.InvalidArgument, "price must be positive"))
+	}
+	account, err := requestAccount(ctx, req.Account)
+	if err != nil {
+		return nil, s.invalid(src, audit.CommandNewOrder, err)
+	}
+	order := orderbook.NewOrder(orderType, side, req.Price, int(req.Quantity))
+	order.Account = account
+	executed := s.Engine.AddOrder(src, *order)
+
+	filled := tradedQty(executed, order.GetOrderId())
+	result := s.toOrder(*order)
+	result.FilledQuantity = int32(filled)
+	if resting, ok := s.Engine.GetOrder(order.GetOrderId()); ok {
+		result = s.toOrder(resting)
+	} else {
+		result.RemainingQuantity = 0
+		switch {
+		case filled == order.GetInitialQty():
+			result.Status = pb.OrderStatus_ORDER_STATUS_FILLED
+		case filled > 0:
+			result.Status = pb.OrderStatus_ORDER_STATUS_CANCELLED
+		default:
+			result.Status = pb.OrderStatus_ORDER_STATUS_REJECTED
+		}
+	}
+	return &pb.SubmitOrderResponse{Order: result, Trades: s.toTrades(executed)}, nil
+}
+
+func (s *Server) CancelOrder(ctx context.Context, req *pb.CancelOrderRequest) (*pb.CancelOrderResponse, error) {
+	src := source(ctx, req)
+	orderId := orderbook.OrderId(req.OrderId)
+	if order, ok := s.Engine.GetOrder(orderId); ok && !ownsOrder(ctx, order.Account) {
+		s.Engine.Refuse(src, audit.CommandCancelOrder, &order, status.Convert(errOtherAccount).Message())
+		return nil, errOtherAccount
+	}
+	order, ok := s.Engine.CancelOrder(src, orderId)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "order %d is not resting", req.OrderId)
+	}
+	result := s.toOrder(order)
+	result.RemainingQuantity = 0
+	result.Status = pb.OrderStatus_ORDER_STATUS_CANCELLED
+	return &pb.CancelOrderResponse{Order: result}, nil
+}
+
+func (s *Server) ModifyOrder(ctx context.Context, req *pb.ModifyOrderRequest) (*pb.ModifyOrderResponse, error) {
+	src := source(ctx, req)
+	if req.Quantity <= 0 || req.Price <= 0 {
+		return nil, s.invalid(src, audit.CommandModifyOrder, status.Error(codes.InvalidArgument, "price and quantity must be positive"))
+	}
+	orderId := orderbook.OrderId(req.OrderId)
+	before, ok := s.Engine.GetOrder(orderId)
+	if !ok {
+		s.Engine.Refuse(src, audit.CommandModifyOrder, nil, "unknown order")
+		return nil, status.Errorf(codes.NotFound, "order %d is not resting", req.OrderId)
+	}
+	if !ownsOrder(ctx, before.Account) {
+		s.Engine.Refuse(src, audit.CommandModifyOrder, &before, status.Convert(errOtherAccount).Message())
+		return nil, errOtherAccount
+	}
+	executed, err := s.Engine.ModifyOrder(src, orderId, orderbook.Price(req.Price), orderbook.Quantity(req.Quantity))
+	var rejection orderbook.Rejection
+	if errors.As(err, &rejection) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	var result *pb.Order
+	if after, ok := s.Engine.GetOrder(orderId); ok {
+		result = s.toOrder(after)
+	} else {
+		// The new version no longer rests: filled on arrival or, without trades, cancelled
+		// by another command since
+		result = s.toOrder(before)
+		result.Price = req.Price
+		result.Quantity = req.Quantity
+		result.FilledQuantity = int32(before.GetFilledQty() + tradedQty(executed, orderId))
+		result.RemainingQuantity = 0
+		result.Status = pb.OrderStatus_ORDER_STATUS_CANCELLED
+		if result.FilledQuantity == result.Quantity {
+			result.Status = pb.OrderStatus_ORDER_STATUS_FILLED
+		}
+	}
+	return &pb.ModifyOrderResponse{Order: result, Trades: s.toTrades(executed)}, nil
+}
+
+// tradedQty returns the quantity order traded in trades
+func tradedQty(trades []orderbook.Trade, orderId orderbook.OrderId) orderbook.Quantity {
+	var qty orderbook.Quantity
+	for _, trade := range trades {
+		if trade.BidTrade.OrderId == orderId || trade.AskTrade.OrderId == orderId {
+			qty += trade.Qty()
+		}
+	}
+	return qty
+}
+
+func (s *Server) GetOrder(ctx context.Context, req *pb.GetOrderRequest) (*pb.Order, error) {
+	order, ok := s.Engine.GetOrder(orderbook.OrderId(req.OrderId))
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "order %d is not resting", req.OrderId)
+	}
+	// Any key may read the book, only the owner and admin keys see whose order it is
+	if !ownsOrder(ctx, order.Account) {
+		order.Account = ""
+	}
+	return s.toOrder(order), nil
+}
+
+func (s *Server) GetDepth(ctx context.Context, req *pb.GetDepthRequest) (*pb.Depth, error) {
+	return s.toDepth(s.Engine.Depth(int(req.Levels)), int(req.Levels)), nil
+}
+
+func (s *Server) SubscribeDepth(req *pb.SubscribeDepthRequest, stream pb.OrderBook_SubscribeDepthServer) error {
+	sub := &depthSub{depth: make(chan orderbook.OrderBookLevelInfos, 1)}
+	s.mu.Lock()
+	s.depthSubs[sub] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.depthSubs, sub)
+		s.mu.Unlock()
+	}()
+	// Taken after registering so no change can fall between the snapshot and the updates
+	if err := stream.Send(s.toDepth(s.Engine.Depth(0), int(req.Levels))); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-s.stopping:
+			return errStopping
+		case depth := <-sub.depth:
+			if err := stream.Send(s.toDepth(depth, int(req.Levels))); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *Server) SubscribeTrades(req *pb.SubscribeTradesRequest, stream pb.OrderBook_SubscribeTradesServer) error {
+	sub := &tradeSub{trades: make(chan orderbook.Trade, subscriptionBuffer), dropped: make(chan struct{})}
+	s.mu.Lock()
+	s.tradeSubs[sub] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.tradeSubs, sub)
+		s.mu.Unlock()
+	}()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-s.stopping:
+			return errStopping
+		case <-sub.dropped:
+			return status.Error(codes.ResourceExhausted, "subscriber too slow, trades were dropped")
+		case trade := <-sub.trades:
+			if err := stream.Send(s.toTrade(visibleTrade(stream.Context(), trade))); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// onTrades fans trades out to the subscribers without ever blocking the engine
+func (s *Server) onTrades(trades []orderbook.Trade) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.tradeSubs {
+	trades:
+		for _, trade := range trades {
+			select {
+			case sub.trades <- trade:
+			default:
+				close(sub.dropped)
+				delete(s.tradeSubs, sub)
+				break trades
+			}
+		}
+	}
+}
+
+// onDepth hands the latest depth to every subscriber, replacing any depth not sent yet
+func (s *Server) onDepth(depth orderbook.OrderBookLevelInfos) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.depthSubs {
+		select {
+		case <-sub.depth:
+		default:
+		}
+		sub.depth <- depth
+	}
+}
+
+var orderTypes = map[pb.OrderType]string{
+	pb.OrderType_ORDER_TYPE_GOOD_TIL_CANCELLED: "goodtilcancelled",
+	pb.OrderType_ORDER_TYPE_FILL_AND_KILL:      "fillandkill",
+	pb.OrderType_ORDER_TYPE_FILL_OR_KILL:       "fillorkill",
+	pb.OrderType_ORDER_TYPE_MARKET:             "market",
+}
+
+var sides = map[pb.Side]string{
+	pb.Side_SIDE_BUY:  "buy",
+	pb.Side_SIDE_SELL: "sell",
+}
+
+func (s *Server) toOrder(order orderbook.Order) *pb.Order {
+	result := &pb.Order{
+		OrderId:           uint64(order.GetOrderId()),
+		Symbol:            s.symbol,
+		Side:              pb.Side_SIDE_SELL,
+		Price:             float64(order.Price),
+		Quantity:          int32(order.GetInitialQty()),
+		FilledQuantity:    int32(order.GetFilledQty()),
+		RemainingQuantity: int32(order.GetRemainingQty()),
+		Account:           order.Account,
+		Status:            pb.OrderStatus_ORDER_STATUS_NEW,
+	}
+	if order.Side == orderbook.Buy {
+		result.Side = pb.Side_SIDE_BUY
+	}
+	switch order.OrderType {
+	case orderbook.GoodTilCancelled:
+		result.Type = pb.OrderType_ORDER_TYPE_GOOD_TIL_CANCELLED
+	case orderbook.FillAndKill:
+		result.Type = pb.OrderType_ORDER_TYPE_FILL_AND_KILL
+	case orderbook.FillOrKill:
+		result.Type = pb.OrderType_ORDER_TYPE_FILL_OR_KILL
+	case orderbook.Market:
+		result.Type = pb.OrderType_ORDER_TYPE_MARKET
+	}
+	if order.GetFilledQty() > 0 {
+		result.Status = pb.OrderStatus_ORDER_STATUS_PARTIALLY_FILLED
+	}
+	return result
+}
+
+func (s *Server) toTrades(trades []orderbook.Trade) []*pb.Trade {
+	result := make([]*pb.Trade, 0, len(trades))
+	for _, trade := range trades {
+		result = append(result, s.toTrade(trade))
+	}
+	return result
+}
+
+func (s *Server) toTrade(trade orderbook.Trade) *pb.Trade {
+	return &pb.Trade{
+		TradeId:  int64(trade.Id),
+		Symbol:   s.symbol,
+		Time:     timestamppb.New(trade.Timestamp),
+		Price:    float64(trade.ExecPrice()),
+		Quantity: int32(trade.Qty()),
+		Bid:      toTradeSide(trade.BidTrade),
+		Ask:      toTradeSide(trade.AskTrade),
+	}
+}
+
+func toTradeSide(info orderbook.TradeInfo) *pb.TradeSide {
+	liquidity := pb.Liquidity_LIQUIDITY_TAKER
+	if info.Liquidity == orderbook.Maker {
+		liquidity = pb.Liquidity_LIQUIDITY_MAKER
+	}
+	return &pb.TradeSide{
+		OrderId:   uint64(info.OrderId),
+		Price:     float64(info.Price),
+		Account:   info.Account,
+		Liquidity: liquidity,
+		Fee:       info.Fee,
+	}
+}
+
+func (s *Server) toDepth(depth orderbook.OrderBookLevelInfos, levels int) *pb.Depth {
+	return &pb.Depth{
+		Symbol: s.symbol,
+		Bids:   toLevels(depth.Bids, levels),
+		Asks:   toLevels(depth.Asks, levels),
+	}
+}
+
+func toLevels(infos []orderbook.LevelInfo, levels int) []*pb.Level {
+	if levels > 0 && len(infos) > levels {
+		infos = infos[:levels]
+	}
+	result := make([]*pb.Level, 0, len(infos))
+	for _, info := range infos {
+		result = append(result, &pb.Level{Price: float64(info.Price), Quantity: int32(info.Quantity)})
+	}
+	return result
+}
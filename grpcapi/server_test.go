@@ -0,0 +1,251 @@
+package grpcapi
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/EliasManj/orderbook/api"
+	"github.com/EliasManj/orderbook/auth"
+	"github.com/EliasManj/orderbook/grpcapi/pb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func startServer(t *testing.T) (*Server, pb.OrderBookClient) {
+	server, dial := serve(t)
+	return server, dial()
+}
+
+// serve starts a server and returns it with a function opening clients to it
+func serve(t *testing.T) (*Server, func(opts ...grpc.DialOption) pb.OrderBookClient) {
+	server := NewServer(api.DefaultExchange())
+	l := bufconn.Listen(1 << 20)
+	go server.Serve(l)
+	t.Cleanup(server.Close)
+	return server, func(opts ...grpc.DialOption) pb.OrderBookClient {
+		opts = append(opts,
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return l.DialContext(ctx) }),
+			grpc.WithTransportCredentials(insecure.NewCredentials()))
+		conn, err := grpc.NewClient("passthrough:///bufnet", opts...)
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		return pb.NewOrderBookClient(conn)
+	}
+}
+
+func requireCode(t *testing.T, err error, code codes.Code) {
+	require.Error(t, err)
+	require.Equal(t, code, status.Code(err), err.Error())
+}
+
+func TestServer(t *testing.T) {
+	_, client := startServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	depthStream, err := client.SubscribeDepth(ctx, &pb.SubscribeDepthRequest{Levels: 1})
+	require.NoError(t, err)
+	snapshot, err := depthStream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, "DEFAULT", snapshot.Symbol)
+	tradeStream, err := client.SubscribeTrades(ctx, &pb.SubscribeTradesRequest{})
+	require.NoError(t, err)
+
+	sell, err := client.SubmitOrder(ctx, &pb.SubmitOrderRequest{Type: pb.OrderType_ORDER_TYPE_GOOD_TIL_CANCELLED, Side: pb.Side_SIDE_SELL, Price: 9000, Quantity: 10, Account: "grpc-seller"})
+	require.NoError(t, err)
+	require.Equal(t, pb.OrderStatus_ORDER_STATUS_NEW, sell.Order.Status)
+	require.Empty(t, sell.Trades)
+	depth, err := depthStream.Recv()
+	require.NoError(t, err)
+	require.Len(t, depth.Asks, 1)
+	require.Equal(t, float64(9000), depth.Asks[0].Price)
+	require.Equal(t, int32(10), depth.Asks[0].Quantity)
+
+	_, err = client.SubmitOrder(ctx, &pb.SubmitOrderRequest{Type: pb.OrderType_ORDER_TYPE_FILL_AND_KILL, Side: pb.Side_SIDE_BUY, Price: 9001, Quantity: 4, Account: "grpc-buyer"})
+	require.NoError(t, err)
+	trade, err := tradeStream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, float64(9000), trade.Price)
+	require.Equal(t, int32(4), trade.Quantity)
+	require.Equal(t, sell.Order.OrderId, trade.Ask.OrderId)
+	require.Equal(t, pb.Liquidity_LIQUIDITY_MAKER, trade.Ask.Liquidity)
+
+	order, err := client.GetOrder(ctx, &pb.GetOrderRequest{OrderId: sell.Order.OrderId})
+	require.NoError(t, err)
+	require.Equal(t, pb.OrderStatus_ORDER_STATUS_PARTIALLY_FILLED, order.Status)
+	require.Equal(t, int32(6), order.RemainingQuantity)
+	require.Equal(t, "grpc-seller", order.Account)
+
+	modified, err := client.ModifyOrder(ctx, &pb.ModifyOrderRequest{OrderId: sell.Order.OrderId, Price: 9002, Quantity: 12})
+	require.NoError(t, err)
+	require.Equal(t, float64(9002), modified.Order.Price)
+	require.Equal(t, int32(8), modified.Order.RemainingQuantity)
+	_, err = client.ModifyOrder(ctx, &pb.ModifyOrderRequest{OrderId: sell.Order.OrderId, Price: 9002, Quantity: 4})
+	requireCode(t, err, codes.FailedPrecondition)
+
+	top, err := client.GetDepth(ctx, &pb.GetDepthRequest{Levels: 1})
+	require.NoError(t, err)
+	require.Len(t, top.Asks, 1)
+	require.LessOrEqual(t, len(top.Bids), 1)
+
+	cancelled, err := client.CancelOrder(ctx, &pb.CancelOrderRequest{OrderId: sell.Order.OrderId})
+	require.NoError(t, err)
+	require.Equal(t, pb.OrderStatus_ORDER_STATUS_CANCELLED, cancelled.Order.Status)
+	require.Equal(t, int32(4), cancelled.Order.FilledQuantity)
+	_, err = client.CancelOrder(ctx, &pb.CancelOrderRequest{OrderId: sell.Order.OrderId})
+	requireCode(t, err, codes.NotFound)
+	_, err = client.GetOrder(ctx, &pb.GetOrderRequest{OrderId: sell.Order.OrderId})
+	requireCode(t, err, codes.NotFound)
+
+	// A fill or kill that cannot fill is rejected by the engine
+	rejected, err := client.SubmitOrder(ctx, &pb.SubmitOrderRequest{Type: pb.OrderType_ORDER_TYPE_FILL_OR_KILL, Side: pb.Side_SIDE_BUY, Price: 1, Quantity: 1})
+	require.NoError(t, err)
+	require.Equal(t, pb.OrderStatus_ORDER_STATUS_REJECTED, rejected.Order.Status)
+
+	_, err = client.SubmitOrder(ctx, &pb.SubmitOrderRequest{Type: pb.OrderType_ORDER_TYPE_GOOD_TIL_CANCELLED, Price: 1, Quantity: 1})
+	requireCode(t, err, codes.InvalidArgument)
+	_, err = client.SubmitOrder(ctx, &pb.SubmitOrderRequest{Type: pb.OrderType_ORDER_TYPE_GOOD_TIL_CANCELLED, Side: pb.Side_SIDE_BUY, Price: 1})
+	requireCode(t, err, codes.InvalidArgument)
+}
+
+func TestServerModifyStatus(t *testing.T) {
+	_, client := startServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	api.ConfigureBook("DEFAULT", 0.5, 0)
+	t.Cleanup(func() { api.ConfigureBook("DEFAULT", 0, 0) })
+
+	sell, err := client.SubmitOrder(ctx, &pb.SubmitOrderRequest{Type: pb.OrderType_ORDER_TYPE_GOOD_TIL_CANCELLED, Side: pb.Side_SIDE_SELL, Price: 9100, Quantity: 10, Account: "grpc-modify"})
+	require.NoError(t, err)
+	orderId := sell.Order.OrderId
+
+	// A rejected modify leaves the order as it was
+	_, err = client.ModifyOrder(ctx, &pb.ModifyOrderRequest{OrderId: orderId, Price: 9100.3, Quantity: 10})
+	requireCode(t, err, codes.InvalidArgument)
+	order, err := client.GetOrder(ctx, &pb.GetOrderRequest{OrderId: orderId})
+	require.NoError(t, err)
+	require.Equal(t, float64(9100), order.Price)
+	require.Equal(t, int32(10), order.RemainingQuantity)
+
+	_, err = client.SubmitOrder(ctx, &pb.SubmitOrderRequest{Type: pb.OrderType_ORDER_TYPE_FILL_AND_KILL, Side: pb.Side_SIDE_BUY, Price: 9100, Quantity: 4, Account: "grpc-modify-buyer"})
+	require.NoError(t, err)
+	bid, err := client.SubmitOrder(ctx, &pb.SubmitOrderRequest{Type: pb.OrderType_ORDER_TYPE_GOOD_TIL_CANCELLED, Side: pb.Side_SIDE_BUY, Price: 9050, Quantity: 2, Account: "grpc-modify-buyer"})
+	require.NoError(t, err)
+	require.Equal(t, pb.OrderStatus_ORDER_STATUS_NEW, bid.Order.Status)
+
+	// The new version trades its last 2 on arrival, after 4 filled before
+	modified, err := client.ModifyOrder(ctx, &pb.ModifyOrderRequest{OrderId: orderId, Price: 9050, Quantity: 6})
+	require.NoError(t, err)
+	require.Len(t, modified.Trades, 1)
+	require.Equal(t, pb.OrderStatus_ORDER_STATUS_FILLED, modified.Order.Status)
+	require.Equal(t, int32(6), modified.Order.FilledQuantity)
+	require.Equal(t, int32(0), modified.Order.RemainingQuantity)
+}
+
+func TestServerShutdown(t *testing.T) {
+	server, client := startServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	tradeStream, err := client.SubscribeTrades(ctx, &pb.SubscribeTradesRequest{})
+	require.NoError(t, err)
+	depthStream, err := client.SubscribeDepth(ctx, &pb.SubscribeDepthRequest{})
+	require.NoError(t, err)
+	_, err = depthStream.Recv()
+	require.NoError(t, err)
+
+	// The streams end instead of holding the graceful stop until the deadline
+	require.NoError(t, server.Shutdown(ctx))
+	_, err = tradeStream.Recv()
+	requireCode(t, err, codes.Unavailable)
+	_, err = depthStream.Recv()
+	requireCode(t, err, codes.Unavailable)
+	_, err = client.GetDepth(ctx, &pb.GetDepthRequest{})
+	requireCode(t, err, codes.Unavailable)
+}
+
+func TestServerAuth(t *testing.T) {
+	viewer := auth.Key{Key: "viewer", Secret: "s1", Account: "viewer", Permission: auth.Read}
+	alice := auth.Key{Key: "alice", Secret: "s2", Account: "alice", Permission: auth.Trade}
+	bob := auth.Key{Key: "bob", Secret: "s3", Account: "bob", Permission: auth.Trade}
+	admin := auth.Key{Key: "admin", Secret: "s4", Account: "ops", Permission: auth.Admin}
+	server, dial := serve(t)
+	server.Keys = auth.NewKeyStore(viewer, alice, bob, admin)
+	client := func(key auth.Key) pb.OrderBookClient {
+		return dial(Signer{Key: key.Key, Secret: key.Secret}.DialOptions()...)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	sell := &pb.SubmitOrderRequest{Type: pb.OrderType_ORDER_TYPE_GOOD_TIL_CANCELLED, Side: pb.Side_SIDE_SELL, Price: 95000, Quantity: 2}
+
+	_, err := dial().SubmitOrder(ctx, sell)
+	requireCode(t, err, codes.Unauthenticated)
+	_, err = client(auth.Key{Key: "alice", Secret: "wrong"}).GetDepth(ctx, &pb.GetDepthRequest{})
+	requireCode(t, err, codes.Unauthenticated)
+	stream, err := dial().SubscribeTrades(ctx, &pb.SubscribeTradesRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	requireCode(t, err, codes.Unauthenticated)
+
+	_, err = client(viewer).SubmitOrder(ctx, sell)
+	requireCode(t, err, codes.PermissionDenied)
+	_, err = client(viewer).GetDepth(ctx, &pb.GetDepthRequest{})
+	require.NoError(t, err)
+	trades, err := client(viewer).SubscribeTrades(ctx, &pb.SubscribeTradesRequest{})
+	require.NoError(t, err)
+	depthStream, err := client(viewer).SubscribeDepth(ctx, &pb.SubscribeDepthRequest{})
+	require.NoError(t, err)
+	_, err = depthStream.Recv()
+	require.NoError(t, err)
+
+	// Orders are booked to the account of the key, which cannot act for another one
+	sell.Account = "bob"
+	_, err = client(alice).SubmitOrder(ctx, sell)
+	requireCode(t, err, codes.PermissionDenied)
+	sell.Account = ""
+	placed, err := client(alice).SubmitOrder(ctx, sell)
+	require.NoError(t, err)
+	require.Equal(t, "alice", placed.Order.Account)
+	orderId := placed.Order.OrderId
+	for _, key := range []auth.Key{alice, admin} {
+		got, err := client(key).GetOrder(ctx, &pb.GetOrderRequest{OrderId: orderId})
+		require.NoError(t, err)
+		require.Equal(t, "alice", got.Account)
+	}
+	// Other keys see the order without its account
+	for _, key := range []auth.Key{viewer, bob} {
+		got, err := client(key).GetOrder(ctx, &pb.GetOrderRequest{OrderId: orderId})
+		require.NoError(t, err)
+		require.Equal(t, orderId, got.OrderId)
+		require.Empty(t, got.Account)
+	}
+	_, err = client(bob).CancelOrder(ctx, &pb.CancelOrderRequest{OrderId: orderId})
+	requireCode(t, err, codes.PermissionDenied)
+	_, err = client(bob).ModifyOrder(ctx, &pb.ModifyOrderRequest{OrderId: orderId, Price: 95001, Quantity: 2})
+	requireCode(t, err, codes.PermissionDenied)
+
+	sell.Account = "bob"
+	placed, err = client(admin).SubmitOrder(ctx, sell)
+	require.NoError(t, err)
+	require.Equal(t, "bob", placed.Order.Account)
+	_, err = client(admin).CancelOrder(ctx, &pb.CancelOrderRequest{OrderId: placed.Order.OrderId})
+	require.NoError(t, err)
+	_, err = client(alice).CancelOrder(ctx, &pb.CancelOrderRequest{OrderId: orderId})
+	require.NoError(t, err)
+
+	// The trade stream only shows the accounts of the caller
+	sell.Account = ""
+	_, err = client(alice).SubmitOrder(ctx, sell)
+	require.NoError(t, err)
+	_, err = client(bob).SubmitOrder(ctx, &pb.SubmitOrderRequest{Type: pb.OrderType_ORDER_TYPE_FILL_AND_KILL, Side: pb.Side_SIDE_BUY, Price: 95000, Quantity: 2})
+	require.NoError(t, err)
+	trade, err := trades.Recv()
+	require.NoError(t, err)
+	require.Empty(t, trade.Bid.Account)
+	require.Empty(t, trade.Ask.Account)
+}
@@ -0,0 +1,170 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/EliasManj/orderbook/journal"
+	"github.com/EliasManj/orderbook/orderbook"
+)
+
+// TradeEntry is the journal entry type used for trades
+const TradeEntry = "trade"
+
+// DefaultCapacity is the number of trades kept per symbol when none is given
+const DefaultCapacity = 100000
+
+// DefaultLimit is the page size used when a query does not set one
+const DefaultLimit = 100
+
+// Query filters the trade history, zero values disable a filter.
+// Results are returned newest first, Cursor continues a previous page
+type Query struct {
+	Symbol  string
+	From    time.Time
+	To      time.Time
+	OrderId orderbook.OrderId
+	Account string
+	Cursor  orderbook.TradeId
+	Limit   int
+}
+
+type Page struct {
+	Trades     []orderbook.Trade
+	NextCursor orderbook.TradeId
+}
+
+// Store keeps a bounded, in-memory history of trades per symbol and
+// appends every trade to the journal when one is attached
+type Store struct {
+	mu       sync.RWMutex
+	capacity int
+	symbols  map[string][]orderbook.Trade
+	journal  *journal.Journal
+}
+
+// NewStore creates a Store keeping at most capacity trades per symbol
+func NewStore(capacity int, j *journal.Journal) *Store {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	return &Store{
+		capacity: capacity,
+		symbols:  make(map[string][]orderbook.Trade),
+		journal:  j,
+	}
+}
+
+// Restore loads the trades recorded in the journal file at path
+func (s *Store) Restore(path string) error {
+	err := journal.Replay(path, func(e journal.Entry) error {
+		if e.Type != TradeEntry {
+			return nil
+		}
+		var trade orderbook.Trade
+		if err := json.Unmarshal(e.Data, &trade); err != nil {
+			return err
+		}
+		s.mu.Lock()
+		s.append(e.Symbol, trade)
+		s.mu.Unlock()
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Add records trades for a symbol, writing them to the journal first and flushing it
+func (s *Store) Add(symbol string, trades []orderbook.Trade) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, trade := range trades {
+		if s.journal != nil {
+			if _, err := s.journal.Append(TradeEntry, symbol, trade); err != nil {
+				return err
+			}
+		}
+		s.append(symbol, trade)
+	}
+	if s.journal != nil && len(trades) > 0 {
+		return s.journal.Flush()
+	}
+	return nil
+}
+
+// LastId returns the id of the most recent trade of a symbol
+func (s *Store) LastId(symbol string) orderbook.TradeId {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	trades := s.symbols[symbol]
+	if len(trades) == 0 {
+		return 0
+	}
+	return trades[len(trades)-1].Id
+}
+
+// All returns every stored trade of a symbol, oldest first
+func (s *Store) All(symbol string) []orderbook.Trade {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	trades := make([]orderbook.Trade, len(s.symbols[symbol]))
+	copy(trades, s.symbols[symbol])
+	return trades
+}
+
+// Query returns one page of trades matching q, newest first
+func (s *Store) Query(q Query) Page {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	trades := s.symbols[q.Symbol]
+	page := Page{Trades: []orderbook.Trade{}}
+	for i := len(trades) - 1; i >= 0; i-- {
+		trade := trades[i]
+		if q.Cursor != 0 && trade.Id >= q.Cursor {
+			continue
+		}
+		if !q.From.IsZero() && trade.Timestamp.Before(q.From) {
+			// Trades are stored in time order so nothing older can match
+			break
+		}
+		if !q.To.IsZero() && !trade.Timestamp.Before(q.To) {
+			continue
+		}
+		if !matches(trade, q) {
+			continue
+		}
+		if len(page.Trades) == limit {
+			page.NextCursor = page.Trades[limit-1].Id
+			break
+		}
+		page.Trades = append(page.Trades, trade)
+	}
+	return page
+}
+
+func matches(trade orderbook.Trade, q Query) bool {
+	if q.OrderId != 0 && trade.BidTrade.OrderId != q.OrderId && trade.AskTrade.OrderId != q.OrderId {
+		return false
+	}
+	if q.Account != "" && trade.BidTrade.Account != q.Account && trade.AskTrade.Account != q.Account {
+		return false
+	}
+	return true
+}
+
+func (s *Store) append(symbol string, trade orderbook.Trade) {
+	trades := append(s.symbols[symbol], trade)
+	if len(trades) > s.capacity {
+		trades = trades[len(trades)-s.capacity:]
+	}
+	s.symbols[symbol] = trades
+}
@@ -0,0 +1,103 @@
+package history
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/EliasManj/orderbook/journal"
+	"github.com/EliasManj/orderbook/orderbook"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func createTrade(id int, bid orderbook.OrderId, ask orderbook.OrderId, account string) orderbook.Trade {
+	return orderbook.Trade{
+		Id:        orderbook.TradeId(id),
+		Timestamp: start.Add(time.Duration(id) * time.Second),
+		BidTrade:  orderbook.TradeInfo{OrderId: bid, Price: 100, Qty: 1, Account: account},
+		AskTrade:  orderbook.TradeInfo{OrderId: ask, Price: 100, Qty: 1, Account: "other"},
+	}
+}
+
+func TestStoreQueryFilters(t *testing.T) {
+	store := NewStore(0, nil)
+	for i := 1; i <= 10; i++ {
+		account := "alice"
+		if i%2 == 0 {
+			account = "bob"
+		}
+		require.NoError(t, store.Add("ABC", []orderbook.Trade{createTrade(i, orderbook.OrderId(i), 1000, account)}))
+	}
+
+	page := store.Query(Query{Symbol: "ABC"})
+	require.Len(t, page.Trades, 10)
+	require.Equal(t, orderbook.TradeId(10), page.Trades[0].Id)
+	require.Equal(t, orderbook.TradeId(0), page.NextCursor)
+
+	page = store.Query(Query{Symbol: "ABC", Account: "bob"})
+	require.Len(t, page.Trades, 5)
+	page = store.Query(Query{Symbol: "ABC", OrderId: 3})
+	require.Len(t, page.Trades, 1)
+	require.Equal(t, orderbook.TradeId(3), page.Trades[0].Id)
+	page = store.Query(Query{Symbol: "ABC", OrderId: 1000})
+	require.Len(t, page.Trades, 10)
+
+	page = store.Query(Query{Symbol: "ABC", From: start.Add(3 * time.Second), To: start.Add(6 * time.Second)})
+	require.Len(t, page.Trades, 3)
+	require.Equal(t, orderbook.TradeId(5), page.Trades[0].Id)
+	require.Equal(t, orderbook.TradeId(3), page.Trades[2].Id)
+
+	require.Len(t, store.Query(Query{Symbol: "XYZ"}).Trades, 0)
+}
+
+func TestStoreCursorPagination(t *testing.T) {
+	store := NewStore(0, nil)
+	for i := 1; i <= 7; i++ {
+		require.NoError(t, store.Add("ABC", []orderbook.Trade{createTrade(i, 1, 2, "alice")}))
+	}
+	ids := []orderbook.TradeId{}
+	query := Query{Symbol: "ABC", Limit: 3}
+	for {
+		page := store.Query(query)
+		for _, trade := range page.Trades {
+			ids = append(ids, trade.Id)
+		}
+		if page.NextCursor == 0 {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+	require.Equal(t, []orderbook.TradeId{7, 6, 5, 4, 3, 2, 1}, ids)
+}
+
+func TestStoreIsBounded(t *testing.T) {
+	store := NewStore(3, nil)
+	for i := 1; i <= 5; i++ {
+		require.NoError(t, store.Add("ABC", []orderbook.Trade{createTrade(i, 1, 2, "alice")}))
+	}
+	all := store.All("ABC")
+	require.Len(t, all, 3)
+	require.Equal(t, orderbook.TradeId(3), all[0].Id)
+	require.Equal(t, orderbook.TradeId(5), store.LastId("ABC"))
+}
+
+func TestStoreRestoreFromJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trades.journal")
+	j, err := journal.Open(path)
+	require.NoError(t, err)
+	store := NewStore(0, j)
+	require.NoError(t, store.Add("ABC", []orderbook.Trade{createTrade(1, 1, 2, "alice"), createTrade(2, 3, 4, "bob")}))
+	require.NoError(t, store.Add("XYZ", []orderbook.Trade{createTrade(3, 5, 6, "carol")}))
+	require.NoError(t, j.Close())
+
+	restored := NewStore(0, nil)
+	require.NoError(t, restored.Restore(path))
+	require.Equal(t, store.All("ABC"), restored.All("ABC"))
+	require.Equal(t, orderbook.TradeId(3), restored.LastId("XYZ"))
+	require.Equal(t, "bob", restored.All("ABC")[1].BidTrade.Account)
+
+	// A missing journal is an empty history
+	require.NoError(t, NewStore(0, nil).Restore(filepath.Join(t.TempDir(), "missing")))
+}
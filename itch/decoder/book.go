@@ -0,0 +1,154 @@
+package decoder
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/EliasManj/orderbook/itch"
+)
+
+// Order is an order resting in a rebuilt book
+type Order struct {
+	Ref    uint64
+	Side   byte
+	Price  itch.Price
+	Shares uint32
+}
+
+// Level is the displayed quantity at one price
+type Level struct {
+	Price  itch.Price
+	Shares uint64
+	Orders int
+}
+
+// Book is an order book rebuilt from the feed alone
+type Book struct {
+	seq    uint64
+	orders map[uint64]*Order
+	// Volume is the number of shares executed against resting orders
+	Volume uint64
+}
+
+func NewBook() *Book {
+	return &Book{orders: make(map[uint64]*Order)}
+}
+
+// Seq returns the sequence number of the last applied message
+func (b *Book) Seq() uint64 {
+	return b.seq
+}
+
+// Apply updates the book with the next message of the feed. Messages must be applied
+// in sequence, a gap or a reference to an unknown order is an error
+func (b *Book) Apply(msg itch.Message) error {
+	seq := msg.Head().Seq
+	if seq != b.seq+1 {
+		return fmt.Errorf("itch: expected message %d, got %d", b.seq+1, seq)
+	}
+	b.seq = seq
+	switch m := msg.(type) {
+	case *itch.AddOrder:
+		if _, exists := b.orders[m.OrderRef]; exists {
+			return fmt.Errorf("itch: message %d adds order %d twice", seq, m.OrderRef)
+		}
+		b.orders[m.OrderRef] = &Order{Ref: m.OrderRef, Side: m.Side, Price: m.Price, Shares: m.Shares}
+	case *itch.OrderExecuted:
+		order, err := b.reduce(seq, m.OrderRef, m.Shares)
+		if err != nil {
+			return err
+		}
+		b.Volume += uint64(m.Shares)
+		if order.Shares == 0 {
+			delete(b.orders, m.OrderRef)
+		}
+	case *itch.OrderCancel:
+		if _, err := b.reduce(seq, m.OrderRef, m.CancelledShares); err != nil {
+			return err
+		}
+	case *itch.OrderDelete:
+		if _, err := b.order(seq, m.OrderRef); err != nil {
+			return err
+		}
+		delete(b.orders, m.OrderRef)
+	case *itch.OrderReplace:
+		order, err := b.order(seq, m.OriginalOrderRef)
+		if err != nil {
+			return err
+		}
+		delete(b.orders, m.OriginalOrderRef)
+		b.orders[m.NewOrderRef] = &Order{Ref: m.NewOrderRef, Side: order.Side, Price: m.Price, Shares: m.Shares}
+	case *itch.Trade:
+		// The order never rested so only the volume changes
+	}
+	return nil
+}
+
+func (b *Book) order(seq uint64, ref uint64) (*Order, error) {
+	order, ok := b.orders[ref]
+	if !ok {
+		return nil, fmt.Errorf("itch: message %d refers to unknown order %d", seq, ref)
+	}
+	return order, nil
+}
+
+func (b *Book) reduce(seq uint64, ref uint64, shares uint32) (*Order, error) {
+	order, err := b.order(seq, ref)
+	if err != nil {
+		return nil, err
+	}
+	if shares > order.Shares {
+		return nil, fmt.Errorf("itch: message %d removes %d shares from order %d which has %d", seq, shares, ref, order.Shares)
+	}
+	order.Shares -= shares
+	return order, nil
+}
+
+// Order returns a resting order by reference
+func (b *Book) Order(ref uint64) (Order, bool) {
+	order, ok := b.orders[ref]
+	if !ok {
+		return Order{}, false
+	}
+	return *order, true
+}
+
+// Size returns the number of resting orders
+func (b *Book) Size() int {
+	return len(b.orders)
+}
+
+// Bids returns the buy levels, best price first
+func (b *Book) Bids() []Level {
+	levels := b.levels(itch.SideBuy)
+	sort.Slice(levels, func(i, j int) bool { return levels[i].Price > levels[j].Price })
+	return levels
+}
+
+// Asks returns the sell levels, best price first
+func (b *Book) Asks() []Level {
+	levels := b.levels(itch.SideSell)
+	sort.Slice(levels, func(i, j int) bool { return levels[i].Price < levels[j].Price })
+	return levels
+}
+
+func (b *Book) levels(side byte) []Level {
+	byPrice := make(map[itch.Price]*Level)
+	levels := []Level{}
+	for _, order := range b.orders {
+		if order.Side != side {
+			continue
+		}
+		level, ok := byPrice[order.Price]
+		if !ok {
+			level = &Level{Price: order.Price}
+			byPrice[order.Price] = level
+		}
+		level.Shares += uint64(order.Shares)
+		level.Orders++
+	}
+	for _, level := range byPrice {
+		levels = append(levels, *level)
+	}
+	return levels
+}
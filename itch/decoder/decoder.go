@@ -0,0 +1,124 @@
+// Package decoder reads the binary feed written by package itch and rebuilds the order book
+// it describes
+package decoder
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/EliasManj/orderbook/itch"
+)
+
+// Decode decodes a single unframed message
+func Decode(data []byte) (itch.Message, error) {
+	if len(data) == 0 {
+		return nil, errors.New("itch: empty message")
+	}
+	size := itch.Size(data[0])
+	if size == 0 {
+		return nil, fmt.Errorf("itch: unknown message type %q", data[0])
+	}
+	if len(data) != size {
+		return nil, fmt.Errorf("itch: message %q is %d bytes, expected %d", data[0], len(data), size)
+	}
+	d := fields{data: data[1:]}
+	h := itch.Header{Seq: d.uint64(), Timestamp: d.uint64()}
+	switch data[0] {
+	case itch.TypeAddOrder:
+		return &itch.AddOrder{Header: h, OrderRef: d.uint64(), Side: d.byte(), Shares: d.uint32(), Stock: d.stock(), Price: itch.Price(d.uint64())}, nil
+	case itch.TypeOrderExecuted:
+		return &itch.OrderExecuted{Header: h, OrderRef: d.uint64(), Shares: d.uint32(), MatchNumber: d.uint64()}, nil
+	case itch.TypeOrderCancel:
+		return &itch.OrderCancel{Header: h, OrderRef: d.uint64(), CancelledShares: d.uint32()}, nil
+	case itch.TypeOrderDelete:
+		return &itch.OrderDelete{Header: h, OrderRef: d.uint64()}, nil
+	case itch.TypeOrderReplace:
+		return &itch.OrderReplace{Header: h, OriginalOrderRef: d.uint64(), NewOrderRef: d.uint64(), Shares: d.uint32(), Price: itch.Price(d.uint64())}, nil
+	default:
+		return &itch.Trade{Header: h, OrderRef: d.uint64(), Side: d.byte(), Shares: d.uint32(), Stock: d.stock(), Price: itch.Price(d.uint64()), MatchNumber: d.uint64()}, nil
+	}
+}
+
+// DecodeDatagram decodes the framed messages of a datagram
+func DecodeDatagram(data []byte) ([]itch.Message, error) {
+	messages := []itch.Message{}
+	for len(data) > 0 {
+		if len(data) < 2 {
+			return messages, io.ErrUnexpectedEOF
+		}
+		size := int(binary.BigEndian.Uint16(data))
+		if len(data) < 2+size {
+			return messages, io.ErrUnexpectedEOF
+		}
+		msg, err := Decode(data[2 : 2+size])
+		if err != nil {
+			return messages, err
+		}
+		messages = append(messages, msg)
+		data = data[2+size:]
+	}
+	return messages, nil
+}
+
+// Reader reads framed messages from a stream such as a feed file
+type Reader struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next message, io.EOF at the end of the stream
+func (r *Reader) Next() (itch.Message, error) {
+	var length [2]byte
+	if _, err := io.ReadFull(r.r, length[:]); err != nil {
+		return nil, err
+	}
+	size := int(binary.BigEndian.Uint16(length[:]))
+	if cap(r.buf) < size {
+		r.buf = make([]byte, size)
+	}
+	r.buf = r.buf[:size]
+	if _, err := io.ReadFull(r.r, r.buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return Decode(r.buf)
+}
+
+// fields reads the fields of a message whose length was already checked
+type fields struct {
+	data []byte
+}
+
+func (f *fields) byte() byte {
+	b := f.data[0]
+	f.data = f.data[1:]
+	return b
+}
+
+func (f *fields) uint32() uint32 {
+	v := binary.BigEndian.Uint32(f.data)
+	f.data = f.data[4:]
+	return v
+}
+
+func (f *fields) uint64() uint64 {
+	v := binary.BigEndian.Uint64(f.data)
+	f.data = f.data[8:]
+	return v
+}
+
+func (f *fields) stock() string {
+	s := strings.TrimRight(string(f.data[:itch.StockSize]), " ")
+	f.data = f.data[itch.StockSize:]
+	return s
+}
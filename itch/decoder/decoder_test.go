@@ -0,0 +1,226 @@
+package decoder
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/EliasManj/orderbook/itch"
+	"github.com/EliasManj/orderbook/orderbook"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeRoundTrip(t *testing.T) {
+	h := itch.Header{Seq: 7, Timestamp: 1700000000000000000}
+	messages := []itch.Message{
+		&itch.AddOrder{Header: h, OrderRef: 1, Side: itch.SideBuy, Shares: 100, Stock: "DEFAULT", Price: itch.PriceFromFloat(99.25)},
+		&itch.OrderExecuted{Header: h, OrderRef: 1, Shares: 40, MatchNumber: 12},
+		&itch.OrderCancel{Header: h, OrderRef: 1, CancelledShares: 10},
+		&itch.OrderDelete{Header: h, OrderRef: 1},
+		&itch.OrderReplace{Header: h, OriginalOrderRef: 1, NewOrderRef: 2, Shares: 5, Price: itch.PriceFromFloat(100)},
+		&itch.Trade{Header: h, OrderRef: 3, Side: itch.SideSell, Shares: 9, Stock: "LONGSYMBOL", Price: itch.PriceFromFloat(98.5), MatchNumber: 13},
+	}
+	var datagram []byte
+	for _, msg := range messages {
+		data := itch.Append(nil, msg)
+		require.Len(t, data, itch.Size(msg.Type()))
+		decoded, err := Decode(data)
+		require.NoError(t, err)
+		if trade, ok := msg.(*itch.Trade); ok {
+			// Stocks are cut to the width of the field
+			trade.Stock = "LONGSYMB"
+		}
+		require.Equal(t, msg, decoded)
+		datagram = itch.AppendFrame(datagram, msg)
+	}
+	decoded, err := DecodeDatagram(datagram)
+	require.NoError(t, err)
+	require.Equal(t, messages, decoded)
+	require.Equal(t, 99.25, decoded[0].(*itch.AddOrder).Price.Float())
+
+	_, err = Decode([]byte{'Z'})
+	require.Error(t, err)
+	_, err = Decode(itch.Append(nil, messages[0])[:20])
+	require.Error(t, err)
+	_, err = DecodeDatagram(datagram[:len(datagram)-1])
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+// engineLevels aggregates the resting orders of one side of an engine book, best price first
+func engineLevels(levels *orderbook.OrderedMap) []Level {
+	result := []Level{}
+	for _, price := range levels.Keys() {
+		level := Level{Price: itch.PriceFromFloat(float64(price))}
+		for _, order := range levels.Values()[price] {
+			level.Shares += uint64(order.GetRemainingQty())
+			level.Orders++
+		}
+		result = append(result, level)
+	}
+	return result
+}
+
+func requireSameBook(t *testing.T, ob *orderbook.OrderBook, book *Book, step int) {
+	require.Equal(t, engineLevels(ob.Bids), book.Bids(), "bids after step %d", step)
+	require.Equal(t, engineLevels(ob.Asks), book.Asks(), "asks after step %d", step)
+	require.Equal(t, ob.Size(), book.Size(), "orders after step %d", step)
+	for id := range ob.Orders {
+		order, _ := ob.GetOrder(id)
+		rebuilt, ok := book.Order(uint64(id))
+		require.True(t, ok, "order %d after step %d", id, step)
+		require.Equal(t, uint32(order.GetRemainingQty()), rebuilt.Shares, "order %d after step %d", id, step)
+	}
+}
+
+// randomCommand sends a random command to the engine
+func randomCommand(rng *rand.Rand, ob *orderbook.OrderBook, resting []orderbook.OrderId) {
+	price := float64(95 + rng.Intn(11))
+	qty := 1 + rng.Intn(20)
+	side := []string{"buy", "sell"}[rng.Intn(2)]
+	switch n := rng.Intn(100); {
+	case n < 50:
+		ob.AddOrder(*orderbook.NewOrder("goodtilcancelled", side, price, qty))
+	case n < 60:
+		ob.AddOrder(*orderbook.NewOrder("fillandkill", side, price, qty))
+	case n < 65:
+		ob.AddOrder(*orderbook.NewOrder("fillorkill", side, price, qty))
+	case n < 70:
+		ob.AddOrder(*orderbook.NewOrder("market", side, price, qty))
+	case n < 85 && len(resting) > 0:
+		ob.CancelOrder(resting[rng.Intn(len(resting))])
+	case len(resting) > 0:
+		order, _ := ob.GetOrder(resting[rng.Intn(len(resting))])
+		if rng.Intn(2) == 0 {
+			// Reduce in place
+			price = float64(order.Price)
+			qty = int(order.GetFilledQty()) + max(1, int(order.GetRemainingQty())/2)
+		} else {
+			qty = int(order.GetFilledQty()) + qty
+		}
+		if order.Amend(orderbook.Price(price), orderbook.Quantity(qty)) == nil {
+			ob.ModifyOrder(order)
+		}
+	}
+}
+
+func TestRebuildBookFromFeed(t *testing.T) {
+	var feed bytes.Buffer
+	path := filepath.Join(t.TempDir(), "feed.itch")
+	file, err := itch.CreateFile(path)
+	require.NoError(t, err)
+	ob := orderbook.NewOrderBook()
+	publisher := itch.NewPublisher(ob.Symbol, &feed, file)
+	ob.AddListener(publisher)
+
+	rng := rand.New(rand.NewSource(32))
+	reader := NewReader(&feed)
+	book := NewBook()
+	for step := 0; step < 3000; step++ {
+		resting := make([]orderbook.OrderId, 0, len(ob.Orders))
+		for id := range ob.Orders {
+			resting = append(resting, id)
+		}
+		randomCommand(rng, ob, resting)
+		for {
+			msg, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			require.NoError(t, book.Apply(msg))
+		}
+		requireSameBook(t, ob, book, step)
+	}
+	require.Equal(t, publisher.Seq(), book.Seq())
+	require.Equal(t, uint64(ob.Ticker().Volume), book.Volume)
+
+	// The file holds the same feed
+	require.NoError(t, file.Close())
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	replayed := NewBook()
+	reader = NewReader(f)
+	for {
+		msg, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.NoError(t, replayed.Apply(msg))
+	}
+	require.Equal(t, book.Seq(), replayed.Seq())
+	require.Equal(t, book.Bids(), replayed.Bids())
+	require.Equal(t, book.Asks(), replayed.Asks())
+}
+
+func TestFeedAfterRestore(t *testing.T) {
+	ob := orderbook.NewOrderBook()
+	ob.AddOrder(*orderbook.NewOrder("goodtilcancelled", "sell", 101, 10))
+	ob.AddOrder(*orderbook.NewOrder("goodtilcancelled", "sell", 101, 5))
+	ob.AddOrder(*orderbook.NewOrder("goodtilcancelled", "buy", 99, 3))
+	restored := orderbook.NewOrderBook()
+	require.NoError(t, restored.Restore(ob.Snapshot()))
+
+	// A feed started after the restore still knows the orders an execution refers to
+	var feed bytes.Buffer
+	restored.AddListener(itch.NewPublisher(restored.Symbol, &feed))
+	restored.AddOrder(*orderbook.NewOrder("goodtilcancelled", "buy", 101, 12))
+
+	book := NewBook()
+	reader := NewReader(&feed)
+	for {
+		msg, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.NoError(t, book.Apply(msg))
+	}
+	requireSameBook(t, restored, book, 0)
+	require.Equal(t, []Level{{Price: itch.PriceFromFloat(101), Shares: 3, Orders: 1}}, book.Asks())
+	require.Equal(t, uint64(12), book.Volume)
+}
+
+func TestBookRejectsGaps(t *testing.T) {
+	book := NewBook()
+	err := book.Apply(&itch.OrderDelete{Header: itch.Header{Seq: 2}, OrderRef: 1})
+	require.ErrorContains(t, err, "expected message 1, got 2")
+	err = book.Apply(&itch.OrderDelete{Header: itch.Header{Seq: 1}, OrderRef: 1})
+	require.ErrorContains(t, err, "unknown order 1")
+}
+
+func TestUDPFeed(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	udp, err := itch.DialUDP(conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer udp.Close()
+
+	ob := orderbook.NewOrderBook()
+	ob.AddListener(itch.NewPublisher(ob.Symbol, udp))
+	ob.AddOrder(*orderbook.NewOrder("goodtilcancelled", "sell", 101, 10))
+	ob.AddOrder(*orderbook.NewOrder("goodtilcancelled", "buy", 101, 4))
+
+	book := NewBook()
+	buf := make([]byte, 1500)
+	for book.Seq() < 3 {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+		messages, err := DecodeDatagram(buf[:n])
+		require.NoError(t, err)
+		for _, msg := range messages {
+			require.NoError(t, book.Apply(msg))
+		}
+	}
+	require.Equal(t, []Level{{Price: itch.PriceFromFloat(101), Shares: 6, Orders: 1}}, book.Asks())
+	require.Empty(t, book.Bids())
+	require.Equal(t, uint64(4), book.Volume)
+}
@@ -0,0 +1,195 @@
+// Package itch implements a compact binary market data feed modeled on NASDAQ ITCH.
+//
+// Every message starts with a one byte type, an eight byte sequence number and an eight byte
+// timestamp in nanoseconds since the Unix epoch, followed by the fields of its type. Integers
+// are big endian, prices carry four implied decimals and stocks are padded with spaces to
+// eight bytes. On files and datagrams each message is framed by a two byte length.
+package itch
+
+import (
+	"encoding/binary"
+	"math"
+	"strings"
+)
+
+// Message types
+const (
+	TypeAddOrder      byte = 'A'
+	TypeOrderExecuted byte = 'E'
+	TypeOrderCancel   byte = 'X'
+	TypeOrderDelete   byte = 'D'
+	TypeOrderReplace  byte = 'U'
+	TypeTrade         byte = 'P'
+)
+
+// Sides of AddOrder and Trade messages
+const (
+	SideBuy  byte = 'B'
+	SideSell byte = 'S'
+)
+
+// HeaderSize is the length of the fields common to every message
+const HeaderSize = 17
+
+// StockSize is the length of the stock field
+const StockSize = 8
+
+// Price is a price with four implied decimals
+type Price uint64
+
+// PriceFromFloat converts a price to its wire form, rounding to four decimals
+func PriceFromFloat(f float64) Price {
+	return Price(math.Round(f * 10000))
+}
+
+// Float returns the price as a float
+func (p Price) Float() float64 {
+	return float64(p) / 10000
+}
+
+// Header holds the fields common to every message
+type Header struct {
+	Seq       uint64
+	Timestamp uint64
+}
+
+// Head returns the header of a message
+func (h *Header) Head() *Header {
+	return h
+}
+
+// Message is one of the messages of the feed
+type Message interface {
+	Type() byte
+	Head() *Header
+}
+
+// AddOrder reports a new order resting in the book
+type AddOrder struct {
+	Header
+	OrderRef uint64
+	Side     byte
+	Shares   uint32
+	Stock    string
+	Price    Price
+}
+
+// OrderExecuted reports a fill of a resting order at its own price
+type OrderExecuted struct {
+	Header
+	OrderRef    uint64
+	Shares      uint32
+	MatchNumber uint64
+}
+
+// OrderCancel reports a partial cancel, the order keeps resting with fewer shares
+type OrderCancel struct {
+	Header
+	OrderRef        uint64
+	CancelledShares uint32
+}
+
+// OrderDelete reports an order leaving the book
+type OrderDelete struct {
+	Header
+	OrderRef uint64
+}
+
+// OrderReplace reports an order taking the place of another one, with a new time priority
+type OrderReplace struct {
+	Header
+	OriginalOrderRef uint64
+	NewOrderRef      uint64
+	Shares           uint32
+	Price            Price
+}
+
+// Trade reports a fill of an order that never rested in the book
+type Trade struct {
+	Header
+	OrderRef    uint64
+	Side        byte
+	Shares      uint32
+	Stock       string
+	Price       Price
+	MatchNumber uint64
+}
+
+func (*AddOrder) Type() byte      { return TypeAddOrder }
+func (*OrderExecuted) Type() byte { return TypeOrderExecuted }
+func (*OrderCancel) Type() byte   { return TypeOrderCancel }
+func (*OrderDelete) Type() byte   { return TypeOrderDelete }
+func (*OrderReplace) Type() byte  { return TypeOrderReplace }
+func (*Trade) Type() byte         { return TypeTrade }
+
+// Size returns the length of the messages of a type, 0 if the type is unknown
+func Size(msgType byte) int {
+	switch msgType {
+	case TypeAddOrder:
+		return HeaderSize + 29
+	case TypeOrderExecuted:
+		return HeaderSize + 20
+	case TypeOrderCancel:
+		return HeaderSize + 12
+	case TypeOrderDelete:
+		return HeaderSize + 8
+	case TypeOrderReplace:
+		return HeaderSize + 28
+	case TypeTrade:
+		return HeaderSize + 37
+	default:
+		return 0
+	}
+}
+
+// Append appends the encoding of msg to buf
+func Append(buf []byte, msg Message) []byte {
+	h := msg.Head()
+	buf = append(buf, msg.Type())
+	buf = binary.BigEndian.AppendUint64(buf, h.Seq)
+	buf = binary.BigEndian.AppendUint64(buf, h.Timestamp)
+	switch m := msg.(type) {
+	case *AddOrder:
+		buf = binary.BigEndian.AppendUint64(buf, m.OrderRef)
+		buf = append(buf, m.Side)
+		buf = binary.BigEndian.AppendUint32(buf, m.Shares)
+		buf = appendStock(buf, m.Stock)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(m.Price))
+	case *OrderExecuted:
+		buf = binary.BigEndian.AppendUint64(buf, m.OrderRef)
+		buf = binary.BigEndian.AppendUint32(buf, m.Shares)
+		buf = binary.BigEndian.AppendUint64(buf, m.MatchNumber)
+	case *OrderCancel:
+		buf = binary.BigEndian.AppendUint64(buf, m.OrderRef)
+		buf = binary.BigEndian.AppendUint32(buf, m.CancelledShares)
+	case *OrderDelete:
+		buf = binary.BigEndian.AppendUint64(buf, m.OrderRef)
+	case *OrderReplace:
+		buf = binary.BigEndian.AppendUint64(buf, m.OriginalOrderRef)
+		buf = binary.BigEndian.AppendUint64(buf, m.NewOrderRef)
+		buf = binary.BigEndian.AppendUint32(buf, m.Shares)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(m.Price))
+	case *Trade:
+		buf = binary.BigEndian.AppendUint64(buf, m.OrderRef)
+		buf = append(buf, m.Side)
+		buf = binary.BigEndian.AppendUint32(buf, m.Shares)
+		buf = appendStock(buf, m.Stock)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(m.Price))
+		buf = binary.BigEndian.AppendUint64(buf, m.MatchNumber)
+	}
+	return buf
+}
+
+// AppendFrame appends msg to buf preceded by its two byte length
+func AppendFrame(buf []byte, msg Message) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, uint16(Size(msg.Type())))
+	return Append(buf, msg)
+}
+
+func appendStock(buf []byte, stock string) []byte {
+	if len(stock) > StockSize {
+		stock = stock[:StockSize]
+	}
+	buf = append(buf, stock...)
+	return append(buf, strings.Repeat(" ", StockSize-len(stock))...)
+}
@@ -0,0 +1,165 @@
+package itch
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/EliasManj/orderbook/orderbook"
+)
+
+// Publisher turns the changes of an order book into sequenced feed messages and writes each
+// framed message to every writer. It implements orderbook.BookListener
+type Publisher struct {
+	Symbol string
+	Clock  func() time.Time
+
+	mu      sync.Mutex
+	seq     uint64
+	writers []io.Writer
+	buf     []byte
+}
+
+// NewPublisher creates a Publisher for the book of symbol, numbering messages from 1
+func NewPublisher(symbol string, writers ...io.Writer) *Publisher {
+	return &Publisher{Symbol: symbol, Clock: time.Now, writers: writers}
+}
+
+// Seq returns the sequence number of the last published message
+func (p *Publisher) Seq() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.seq
+}
+
+func (p *Publisher) publish(msg Message) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.seq++
+	h := msg.Head()
+	h.Seq = p.seq
+	h.Timestamp = uint64(p.Clock().UnixNano())
+	p.buf = AppendFrame(p.buf[:0], msg)
+	for _, w := range p.writers {
+		if _, err := w.Write(p.buf); err != nil {
+			log.Printf("itch: publishing message %d: %v", p.seq, err)
+		}
+	}
+}
+
+func (p *Publisher) OrderAdded(order orderbook.Order) {
+	p.publish(&AddOrder{
+		OrderRef: uint64(order.GetOrderId()),
+		Side:     side(order.Side),
+		Shares:   uint32(order.GetRemainingQty()),
+		Stock:    p.Symbol,
+		Price:    PriceFromFloat(float64(order.Price)),
+	})
+}
+
+func (p *Publisher) OrderExecuted(order orderbook.Order, qty orderbook.Quantity, price orderbook.Price, tradeId orderbook.TradeId) {
+	p.publish(&OrderExecuted{
+		OrderRef:    uint64(order.GetOrderId()),
+		Shares:      uint32(qty),
+		MatchNumber: uint64(tradeId),
+	})
+}
+
+func (p *Publisher) OrderTraded(order orderbook.Order, qty orderbook.Quantity, price orderbook.Price, tradeId orderbook.TradeId) {
+	p.publish(&Trade{
+		OrderRef:    uint64(order.GetOrderId()),
+		Side:        side(order.Side),
+		Shares:      uint32(qty),
+		Stock:       p.Symbol,
+		Price:       PriceFromFloat(float64(price)),
+		MatchNumber: uint64(tradeId),
+	})
+}
+
+func (p *Publisher) OrderCancelled(order orderbook.Order, qty orderbook.Quantity) {
+	p.publish(&OrderCancel{OrderRef: uint64(order.GetOrderId()), CancelledShares: uint32(qty)})
+}
+
+func (p *Publisher) OrderDeleted(order orderbook.Order) {
+	p.publish(&OrderDelete{OrderRef: uint64(order.GetOrderId())})
+}
+
+func (p *Publisher) OrderReplaced(old orderbook.Order, order orderbook.Order) {
+	p.publish(&OrderReplace{
+		OriginalOrderRef: uint64(old.GetOrderId()),
+		NewOrderRef:      uint64(order.GetOrderId()),
+		Shares:           uint32(order.GetRemainingQty()),
+		Price:            PriceFromFloat(float64(order.Price)),
+	})
+}
+
+func side(s orderbook.Side) byte {
+	if s == orderbook.Buy {
+		return SideBuy
+	}
+	return SideSell
+}
+
+// FileWriter writes the feed to a file, buffered until Flush or Close
+type FileWriter struct {
+	file *os.File
+	w    *bufio.Writer
+}
+
+// CreateFile creates or truncates the feed file at path
+func CreateFile(path string) (*FileWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &FileWriter{file: file, w: bufio.NewWriter(file)}, nil
+}
+
+func (f *FileWriter) Write(p []byte) (int, error) {
+	return f.w.Write(p)
+}
+
+// Flush writes buffered messages to the file
+func (f *FileWriter) Flush() error {
+	return f.w.Flush()
+}
+
+func (f *FileWriter) Close() error {
+	if err := f.w.Flush(); err != nil {
+		f.file.Close()
+		return err
+	}
+	return f.file.Close()
+}
+
+// UDPWriter sends every write as one datagram to a unicast or multicast address.
+// Nobody listening is not an error, like on a real multicast feed
+type UDPWriter struct {
+	conn net.PacketConn
+	addr *net.UDPAddr
+}
+
+// DialUDP creates a UDPWriter sending to addr, for example "127.0.0.1:5005"
+func DialUDP(addr string) (*UDPWriter, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		return nil, err
+	}
+	return &UDPWriter{conn: conn, addr: udpAddr}, nil
+}
+
+func (u *UDPWriter) Write(p []byte) (int, error) {
+	return u.conn.WriteTo(p, u.addr)
+}
+
+func (u *UDPWriter) Close() error {
+	return u.conn.Close()
+}
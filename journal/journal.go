@@ -0,0 +1,177 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Entry is a single record in the journal, Data holds the JSON encoded payload
+type Entry struct {
+	Seq    uint64          `json:"seq"`
+	Time   time.Time       `json:"time"`
+	Type   string          `json:"type"`
+	Symbol string          `json:"symbol"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// Journal is an append-only file of JSON encoded entries, one per line
+type Journal struct {
+	mu     sync.Mutex
+	path   string
+	file   *os.File
+	writer *bufio.Writer
+	seq    uint64
+	// synced is the last entry synced to disk
+	synced uint64
+}
+
+// Open opens or creates the journal at path and positions it after the last entry. A last
+// entry cut short by a crash is removed, so that the next one starts on a line of its own
+func Open(path string) (*Journal, error) {
+	var last uint64
+	size, err := replay(path, func(e Entry) error {
+		last = e.Seq
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &Journal{
+		path:   path,
+		file:   file,
+		writer: bufio.NewWriter(file),
+		seq:    last,
+		synced: last,
+	}, nil
+}
+
+// Append encodes v and writes it as the next entry, returning its sequence number
+func (j *Journal) Append(entryType string, symbol string, v any) (uint64, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0, err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entry := Entry{
+		Seq:    j.seq + 1,
+		Time:   time.Now().UTC(),
+		Type:   entryType,
+		Symbol: symbol,
+		Data:   data,
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := j.writer.Write(append(line, '\n')); err != nil {
+		return 0, err
+	}
+	j.seq = entry.Seq
+	return entry.Seq, nil
+}
+
+// Seq returns the sequence number of the last entry written
+func (j *Journal) Seq() uint64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.seq
+}
+
+// Path returns the file the journal writes to
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// Flush writes buffered entries to the file and syncs it to disk
+func (j *Journal) Flush() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.writer.Flush(); err != nil {
+		return err
+	}
+	if err := j.file.Sync(); err != nil {
+		return err
+	}
+	j.synced = j.seq
+	return nil
+}
+
+// Lag returns the number of entries written since the last successful Flush, which a crash
+// could lose
+func (j *Journal) Lag() uint64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.seq - j.synced
+}
+
+// Close flushes and closes the journal file
+func (j *Journal) Close() error {
+	if err := j.Flush(); err != nil {
+		return err
+	}
+	return j.file.Close()
+}
+
+// Replay calls fn for every entry in the journal at path in sequence order
+func Replay(path string, fn func(Entry) error) error {
+	_, err := replay(path, fn)
+	return err
+}
+
+// replay is Replay returning the size of the entries read
+func replay(path string, fn func(Entry) error) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return read(file, fn)
+}
+
+// Read decodes entries from r and calls fn for each of them. A last line without its
+// newline is an entry whose write was cut short, it is skipped
+func Read(r io.Reader, fn func(Entry) error) error {
+	_, err := read(r, fn)
+	return err
+}
+
+// read is Read returning the number of bytes of the whole lines it read
+func read(r io.Reader, fn func(Entry) error) (int64, error) {
+	reader := bufio.NewReaderSize(r, 64*1024)
+	var size int64
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return size, nil
+		}
+		if err != nil {
+			return size, err
+		}
+		size += int64(len(data))
+		if len(data) == 1 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return size, fmt.Errorf("journal line %d: %w", line, err)
+		}
+		if err := fn(entry); err != nil {
+			return size, err
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournalAppendAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.journal")
+	j, err := Open(path)
+	require.NoError(t, err)
+	seq, err := j.Append("trade", "ABC", map[string]int{"qty": 10})
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), seq)
+	seq, err = j.Append("trade", "ABC", map[string]int{"qty": 20})
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), seq)
+	require.Equal(t, uint64(2), j.Lag())
+	require.NoError(t, j.Flush())
+	require.Zero(t, j.Lag())
+	require.NoError(t, j.Close())
+
+	// Reopening continues the sequence after the last entry
+	j, err = Open(path)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), j.Seq())
+	_, err = j.Append("trade", "XYZ", map[string]int{"qty": 30})
+	require.NoError(t, err)
+	require.NoError(t, j.Close())
+
+	entries := []Entry{}
+	require.NoError(t, Replay(path, func(e Entry) error {
+		entries = append(entries, e)
+		return nil
+	}))
+	require.Len(t, entries, 3)
+	for i, e := range entries {
+		require.Equal(t, uint64(i+1), e.Seq)
+		require.Equal(t, "trade", e.Type)
+	}
+	require.Equal(t, "XYZ", entries[2].Symbol)
+	require.JSONEq(t, `{"qty":30}`, string(entries[2].Data))
+}
+
+func TestJournalTornEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.journal")
+	j, err := Open(path)
+	require.NoError(t, err)
+	_, err = j.Append("trade", "ABC", map[string]int{"qty": 10})
+	require.NoError(t, err)
+	require.NoError(t, j.Close())
+	// A crash in the middle of the second entry
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"seq":2,"time":"2024-01-0`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	// Reopening drops the torn entry and writes the next one in its place
+	j, err = Open(path)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), j.Seq())
+	seq, err := j.Append("trade", "XYZ", map[string]int{"qty": 20})
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), seq)
+	require.NoError(t, j.Close())
+
+	symbols := []string{}
+	require.NoError(t, Replay(path, func(e Entry) error {
+		symbols = append(symbols, e.Symbol)
+		return nil
+	}))
+	require.Equal(t, []string{"ABC", "XYZ"}, symbols)
+}
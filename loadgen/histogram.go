@@ -0,0 +1,113 @@
+package loadgen
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+// subBucketBits sets the precision of the histogram. Values below 2^subBucketBits are
+// counted exactly, larger ones in buckets no wider than 1/2^(subBucketBits-1) of their value
+const (
+	subBucketBits  = 10
+	subBucketCount = 1 << subBucketBits
+	subBucketHalf  = subBucketCount / 2
+)
+
+// Histogram records latencies in nanoseconds in log-linear buckets like HdrHistogram, keeping
+// about three significant digits over the whole range of int64 at a fixed size
+type Histogram struct {
+	counts []int64
+	total  int64
+	sum    float64
+	min    int64
+	max    int64
+}
+
+// NewHistogram creates an empty histogram
+func NewHistogram() *Histogram {
+	shifts := 64 - subBucketBits
+	return &Histogram{counts: make([]int64, subBucketCount+shifts*subBucketHalf), min: math.MaxInt64}
+}
+
+// bucket returns the index counting v
+func bucket(v int64) int {
+	shift := max(bits.Len64(uint64(v))-subBucketBits, 0)
+	return shift*subBucketHalf + int(v>>shift)
+}
+
+// highest returns the largest value counted in the bucket at index
+func highest(index int) int64 {
+	if index < subBucketCount {
+		return int64(index)
+	}
+	shift := (index-subBucketCount)/subBucketHalf + 1
+	sub := int64(index - shift*subBucketHalf)
+	return (sub+1)<<shift - 1
+}
+
+// Record counts a latency, negative values count as 0
+func (h *Histogram) Record(d time.Duration) {
+	v := max(int64(d), 0)
+	h.counts[bucket(v)]++
+	h.total++
+	h.sum += float64(v)
+	h.min = min(h.min, v)
+	h.max = max(h.max, v)
+}
+
+// Merge adds the counts of other
+func (h *Histogram) Merge(other *Histogram) {
+	for i, c := range other.counts {
+		h.counts[i] += c
+	}
+	h.total += other.total
+	h.sum += other.sum
+	h.min = min(h.min, other.min)
+	h.max = max(h.max, other.max)
+}
+
+// Count returns the number of values recorded
+func (h *Histogram) Count() int64 {
+	return h.total
+}
+
+// Min returns the smallest value recorded
+func (h *Histogram) Min() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return time.Duration(h.min)
+}
+
+// Max returns the largest value recorded
+func (h *Histogram) Max() time.Duration {
+	return time.Duration(h.max)
+}
+
+// Mean returns the average of the values recorded
+func (h *Histogram) Mean() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return time.Duration(h.sum / float64(h.total))
+}
+
+// Percentile returns the value below which p percent of the values fall, within the
+// precision of its bucket
+func (h *Histogram) Percentile(p float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	// The epsilon keeps 99.9% of 100000 from rounding up to rank 99901
+	rank := int64(math.Ceil(p/100*float64(h.total) - 1e-9))
+	rank = min(max(rank, 1), h.total)
+	var seen int64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			return time.Duration(min(highest(i), h.max))
+		}
+	}
+	return time.Duration(h.max)
+}
@@ -0,0 +1,46 @@
+package loadgen
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuckets(t *testing.T) {
+	for _, v := range []int64{0, 1, 1023, 1024, 1025, 2047, 2048, 123456789, 1 << 40, 1<<62 + 12345} {
+		i := bucket(v)
+		require.GreaterOrEqual(t, highest(i), v)
+		if i > 0 {
+			require.Less(t, highest(i-1), v, "value %d", v)
+		}
+	}
+}
+
+func TestPercentiles(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	h := NewHistogram()
+	values := []int64{}
+	for i := 0; i < 100000; i++ {
+		// Log-normal around 20us with a long tail, like request latencies
+		v := int64(20000 * rng.ExpFloat64() * rng.ExpFloat64())
+		values = append(values, v)
+		h.Record(time.Duration(v))
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	for _, p := range []float64{50, 90, 99, 99.9, 100} {
+		exact := values[int(p/100*float64(len(values)))-1]
+		require.InEpsilon(t, float64(exact), float64(h.Percentile(p)), 0.002, "p%v", p)
+	}
+	require.Equal(t, time.Duration(values[0]), h.Min())
+	require.Equal(t, time.Duration(values[len(values)-1]), h.Max())
+
+	other := NewHistogram()
+	other.Record(time.Hour)
+	h.Merge(other)
+	require.Equal(t, int64(100001), h.Count())
+	require.Equal(t, time.Hour, h.Percentile(100))
+	require.Equal(t, time.Duration(0), NewHistogram().Percentile(99))
+}
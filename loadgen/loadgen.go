@@ -0,0 +1,376 @@
+// Package loadgen drives a mixed workload of order commands against the engine or the HTTP
+// API and measures throughput and latency percentiles
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/EliasManj/orderbook/orderbook"
+	"github.com/EliasManj/orderbook/sim"
+)
+
+// Operations of a workload
+const (
+	OpLimit  = "limit"
+	OpMarket = "market"
+	OpFAK    = "fak"
+	OpFOK    = "fok"
+	OpCancel = "cancel"
+	OpModify = "modify"
+)
+
+// operations lists the operations in the order of the fields of Mix
+var operations = []string{OpLimit, OpMarket, OpFAK, OpFOK, OpCancel, OpModify}
+
+// Mix holds the relative weights of the operations of a workload
+type Mix struct {
+	Limit  float64 `json:"limit"`
+	Market float64 `json:"market"`
+	FAK    float64 `json:"fak"`
+	FOK    float64 `json:"fok"`
+	Cancel float64 `json:"cancel"`
+	Modify float64 `json:"modify"`
+}
+
+// DefaultMix is mostly resting limit orders with a share of cancels, like a quoting market
+var DefaultMix = Mix{Limit: 60, Market: 5, FAK: 5, FOK: 5, Cancel: 20, Modify: 5}
+
+func (m Mix) weights() []float64 {
+	return []float64{m.Limit, m.Market, m.FAK, m.FOK, m.Cancel, m.Modify}
+}
+
+// String formats the mix as accepted by ParseMix
+func (m Mix) String() string {
+	parts := []string{}
+	for i, w := range m.weights() {
+		parts = append(parts, operations[i]+"="+strconv.FormatFloat(w, 'f', -1, 64))
+	}
+	return strings.Join(parts, ",")
+}
+
+// ParseMix reads weights such as "limit=60,cancel=30,modify=10", operations left out weigh 0
+func ParseMix(s string) (Mix, error) {
+	var m Mix
+	fields := map[string]*float64{
+		OpLimit: &m.Limit, OpMarket: &m.Market, OpFAK: &m.FAK, OpFOK: &m.FOK, OpCancel: &m.Cancel, OpModify: &m.Modify,
+	}
+	for _, part := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		field, known := fields[strings.ToLower(name)]
+		if !ok || !known {
+			return m, fmt.Errorf("invalid mix %q, expected op=weight with op one of %s", part, strings.Join(operations, ", "))
+		}
+		w, err := strconv.ParseFloat(value, 64)
+		if err != nil || w < 0 {
+			return m, fmt.Errorf("invalid weight %q for %s", value, name)
+		}
+		*field = w
+	}
+	if m.Limit+m.Market+m.FAK+m.FOK+m.Cancel+m.Modify == 0 {
+		return m, fmt.Errorf("the mix has no operations")
+	}
+	return m, nil
+}
+
+// Target receives the commands of a workload, sim.Engine and sim.HTTP implement it
+type Target interface {
+	Submit(order sim.Order) (orderbook.OrderId, []orderbook.Trade, error)
+	Cancel(orderId orderbook.OrderId) error
+	Modify(orderId orderbook.OrderId, price orderbook.Price, qty orderbook.Quantity) ([]orderbook.Trade, error)
+}
+
+// Config sets up a run. It stops after Operations commands or after Duration, whichever
+// comes first, at least one of them must be set
+type Config struct {
+	Mix        Mix           `json:"mix"`
+	Operations int64         `json:"operations"`
+	Duration   time.Duration `json:"duration_ns"`
+	// Concurrency is the number of workers sending commands, the target must be safe for
+	// concurrent use when it is more than 1
+	Concurrency int `json:"concurrency"`
+	// Rate is the number of commands per second over all workers, 0 sends them back to back.
+	// When set, latencies count from when a command was due rather than when it was sent,
+	// so that a stalled target is not hidden by the commands it kept from being sent
+	Rate float64 `json:"rate"`
+	Seed int64   `json:"seed"`
+	// Price is the middle of the prices of the workload
+	Price float64 `json:"price"`
+}
+
+// DefaultConfig sends 100000 commands of the default mix from one worker
+func DefaultConfig() Config {
+	return Config{Mix: DefaultMix, Operations: 100000, Concurrency: 1, Seed: 1, Price: 100}
+}
+
+// Latency summarises the latencies of a set of commands
+type Latency struct {
+	Count int64         `json:"count"`
+	Min   time.Duration `json:"min_ns"`
+	Mean  time.Duration `json:"mean_ns"`
+	P50   time.Duration `json:"p50_ns"`
+	P90   time.Duration `json:"p90_ns"`
+	P99   time.Duration `json:"p99_ns"`
+	P999  time.Duration `json:"p999_ns"`
+	Max   time.Duration `json:"max_ns"`
+}
+
+func summarize(h *Histogram) Latency {
+	return Latency{
+		Count: h.Count(),
+		Min:   h.Min(),
+		Mean:  h.Mean(),
+		P50:   h.Percentile(50),
+		P90:   h.Percentile(90),
+		P99:   h.Percentile(99),
+		P999:  h.Percentile(99.9),
+		Max:   h.Max(),
+	}
+}
+
+// Result is the outcome of a run, written as JSON to compare runs
+type Result struct {
+	Target     string             `json:"target"`
+	Start      time.Time          `json:"start"`
+	Elapsed    time.Duration      `json:"elapsed_ns"`
+	Operations int64              `json:"operations"`
+	Trades     int64              `json:"trades"`
+	Errors     int64              `json:"errors"`
+	FirstError string             `json:"first_error,omitempty"`
+	Throughput float64            `json:"ops_per_sec"`
+	Latency    Latency            `json:"latency"`
+	ByOp       map[string]Latency `json:"by_operation"`
+	Config     Config             `json:"config"`
+}
+
+// resting is an order a worker left in the book, for cancels and modifies
+type resting struct {
+	id    orderbook.OrderId
+	cents int
+	qty   orderbook.Quantity
+}
+
+// maxResting bounds the orders a worker remembers, the oldest are forgotten first
+const maxResting = 10000
+
+// worker sends its share of the workload and records the latencies it saw
+type worker struct {
+	target    Target
+	cfg       Config
+	rng       *rand.Rand
+	cumulated []float64
+	resting   []resting
+	all       *Histogram
+	byOp      map[string]*Histogram
+	trades    int64
+	errors    int64
+	err       error
+}
+
+// Run sends the workload described by cfg to target and measures it
+func Run(ctx context.Context, target Target, cfg Config) (Result, error) {
+	if cfg.Operations <= 0 && cfg.Duration <= 0 {
+		return Result{}, fmt.Errorf("set the number of operations or the duration of the run")
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	if cfg.Price <= 0 {
+		cfg.Price = 100
+	}
+	cumulated := []float64{}
+	var total float64
+	for _, w := range cfg.Mix.weights() {
+		total += w
+		cumulated = append(cumulated, total)
+	}
+	if total == 0 {
+		return Result{}, fmt.Errorf("the mix has no operations")
+	}
+	if cfg.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Duration)
+		defer cancel()
+	}
+
+	var sent atomic.Int64
+	workers := make([]*worker, cfg.Concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := range workers {
+		w := &worker{
+			target:    target,
+			cfg:       cfg,
+			rng:       rand.New(rand.NewSource(cfg.Seed + int64(i))),
+			cumulated: cumulated,
+			all:       NewHistogram(),
+			byOp:      make(map[string]*Histogram),
+		}
+		workers[i] = w
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.run(ctx, start, &sent)
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	result := Result{Start: start, Elapsed: elapsed, ByOp: make(map[string]Latency), Config: cfg}
+	all := NewHistogram()
+	byOp := make(map[string]*Histogram)
+	for _, w := range workers {
+		all.Merge(w.all)
+		for op, h := range w.byOp {
+			if byOp[op] == nil {
+				byOp[op] = NewHistogram()
+			}
+			byOp[op].Merge(h)
+		}
+		result.Trades += w.trades
+		result.Errors += w.errors
+		if w.err != nil && result.FirstError == "" {
+			result.FirstError = w.err.Error()
+		}
+	}
+	result.Operations = all.Count()
+	result.Throughput = float64(result.Operations) / elapsed.Seconds()
+	result.Latency = summarize(all)
+	for op, h := range byOp {
+		result.ByOp[op] = summarize(h)
+	}
+	return result, nil
+}
+
+func (w *worker) run(ctx context.Context, start time.Time, sent *atomic.Int64) {
+	interval := time.Duration(0)
+	if w.cfg.Rate > 0 {
+		interval = time.Duration(float64(time.Second) * float64(w.cfg.Concurrency) / w.cfg.Rate)
+	}
+	due := start
+	for i := 0; ; i++ {
+		if ctx.Err() != nil {
+			return
+		}
+		if w.cfg.Operations > 0 && sent.Add(1) > w.cfg.Operations {
+			return
+		}
+		began := time.Now()
+		if interval > 0 {
+			due = start.Add(time.Duration(i) * interval)
+			if wait := time.Until(due); wait > 0 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(wait):
+				}
+			}
+			began = due
+		}
+		op, err := w.step()
+		latency := time.Since(began)
+		if err != nil {
+			w.errors++
+			if w.err == nil {
+				w.err = err
+			}
+		}
+		w.all.Record(latency)
+		h := w.byOp[op]
+		if h == nil {
+			h = NewHistogram()
+			w.byOp[op] = h
+		}
+		h.Record(latency)
+	}
+}
+
+// pick draws an operation according to the weights of the mix
+func (w *worker) pick() string {
+	r := w.rng.Float64() * w.cumulated[len(w.cumulated)-1]
+	i := sort.SearchFloat64s(w.cumulated, r)
+	for w.cumulated[i] == r && i+1 < len(w.cumulated) {
+		// r fell on the end of a range, which belongs to the next operation with a weight
+		i++
+	}
+	return operations[i]
+}
+
+// cents returns a price in cents ticks away from the middle, on the passive side for positive ticks
+func (w *worker) cents(side orderbook.Side, ticks int) int {
+	middle := int(math.Round(w.cfg.Price * 100))
+	if side == orderbook.Sell {
+		return max(middle+ticks, 1)
+	}
+	return max(middle-ticks, 1)
+}
+
+// price converts cents to a price, dividing so that the price is the closest float to it
+func price(cents int) orderbook.Price {
+	return orderbook.Price(float64(cents) / 100)
+}
+
+// step sends one command of the workload, cancels and modifies fall back to a limit order
+// while the worker has nothing resting
+func (w *worker) step() (string, error) {
+	op := w.pick()
+	if (op == OpCancel || op == OpModify) && len(w.resting) == 0 {
+		op = OpLimit
+	}
+	side := orderbook.Buy
+	if w.rng.Intn(2) == 1 {
+		side = orderbook.Sell
+	}
+	qty := orderbook.Quantity(1 + w.rng.Intn(50))
+	switch op {
+	case OpLimit:
+		// Mostly passive with a few orders crossing the middle
+		cents := w.cents(side, w.rng.Intn(25)-5)
+		order := sim.Order{Type: "GoodTilCancelled", Side: side, Price: price(cents), Qty: qty}
+		id, trades, err := w.target.Submit(order)
+		if err != nil {
+			return op, err
+		}
+		w.trades += int64(len(trades))
+		var filled orderbook.Quantity
+		for _, trade := range trades {
+			if trade.BidTrade.OrderId == id || trade.AskTrade.OrderId == id {
+				filled += trade.Qty()
+			}
+		}
+		if filled < qty {
+			if len(w.resting) == maxResting {
+				w.resting = w.resting[1:]
+			}
+			w.resting = append(w.resting, resting{id: id, cents: cents, qty: qty})
+		}
+		return op, nil
+	case OpMarket, OpFAK, OpFOK:
+		types := map[string]string{OpMarket: "Market", OpFAK: "FillAndKill", OpFOK: "FillOrKill"}
+		order := sim.Order{Type: types[op], Side: side, Price: price(w.cents(side, -w.rng.Intn(10))), Qty: qty}
+		_, trades, err := w.target.Submit(order)
+		w.trades += int64(len(trades))
+		return op, err
+	case OpCancel:
+		i := w.rng.Intn(len(w.resting))
+		order := w.resting[i]
+		w.resting[i] = w.resting[len(w.resting)-1]
+		w.resting = w.resting[:len(w.resting)-1]
+		return op, w.target.Cancel(order.id)
+	default:
+		// Move the order a few ticks keeping its total quantity, which is more than it filled
+		order := &w.resting[w.rng.Intn(len(w.resting))]
+		order.cents = max(order.cents+w.rng.Intn(7)-3, 1)
+		trades, err := w.target.Modify(order.id, price(order.cents), order.qty)
+		w.trades += int64(len(trades))
+		return op, err
+	}
+}
@@ -0,0 +1,104 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/EliasManj/orderbook/api"
+	"github.com/EliasManj/orderbook/sim"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMix(t *testing.T) {
+	mix, err := ParseMix("limit=70, cancel=20,modify=10")
+	require.NoError(t, err)
+	require.Equal(t, Mix{Limit: 70, Cancel: 20, Modify: 10}, mix)
+	parsed, err := ParseMix(DefaultMix.String())
+	require.NoError(t, err)
+	require.Equal(t, DefaultMix, parsed)
+
+	_, err = ParseMix("limit=1,iceberg=2")
+	require.ErrorContains(t, err, "iceberg")
+	_, err = ParseMix("limit=-1")
+	require.Error(t, err)
+	_, err = ParseMix("limit=0")
+	require.ErrorContains(t, err, "no operations")
+}
+
+func TestRunEngine(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Operations = 20000
+	engine := sim.NewEngine()
+	result, err := Run(context.Background(), engine, cfg)
+	require.NoError(t, err)
+	require.Equal(t, int64(20000), result.Operations)
+	require.Zero(t, result.Errors, result.FirstError)
+	require.Greater(t, result.Trades, int64(0))
+	require.Greater(t, result.Throughput, 0.0)
+
+	var counted int64
+	for _, op := range operations {
+		counted += result.ByOp[op].Count
+	}
+	require.Equal(t, result.Operations, counted)
+	// Cancels fall back to limit orders only while nothing rests, so the mix is kept closely
+	require.InDelta(t, 0.2, float64(result.ByOp[OpCancel].Count)/20000, 0.02)
+	require.InDelta(t, 0.05, float64(result.ByOp[OpFOK].Count)/20000, 0.01)
+	l := result.Latency
+	require.True(t, l.Min <= l.P50 && l.P50 <= l.P99 && l.P99 <= l.P999 && l.P999 <= l.Max)
+
+	var out bytes.Buffer
+	require.NoError(t, result.Write(&out))
+	require.Contains(t, out.String(), "P99.9 us")
+	require.Contains(t, out.String(), "modify")
+}
+
+func TestRunHTTP(t *testing.T) {
+	server := httptest.NewServer(api.NewRouter())
+	defer server.Close()
+
+	cfg := DefaultConfig()
+	cfg.Operations = 0
+	cfg.Duration = 300 * time.Millisecond
+	cfg.Concurrency = 4
+	cfg.Price = 700
+	result, err := Run(context.Background(), sim.NewHTTP(server.URL), cfg)
+	require.NoError(t, err)
+	require.Greater(t, result.Operations, int64(0))
+	require.Zero(t, result.Errors, result.FirstError)
+	require.Less(t, result.Elapsed, time.Second)
+}
+
+func TestRate(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Operations = 50
+	cfg.Rate = 500
+	result, err := Run(context.Background(), sim.NewEngine(), cfg)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, result.Elapsed, 98*time.Millisecond)
+	require.InDelta(t, 500, result.Throughput, 100)
+}
+
+func TestSaveAndCompare(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Operations = 2000
+	base, err := Run(context.Background(), sim.NewEngine(), cfg)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "base.json")
+	require.NoError(t, base.Save(path))
+	loaded, err := Load(path)
+	require.NoError(t, err)
+	require.Equal(t, base.Latency, loaded.Latency)
+	require.Equal(t, base.Config, loaded.Config)
+
+	next := loaded
+	next.Throughput = loaded.Throughput * 2
+	var out bytes.Buffer
+	require.NoError(t, Compare(&out, loaded, next))
+	require.Contains(t, out.String(), "+100.0%")
+	require.Contains(t, out.String(), "cancel p99.9 us")
+}
@@ -0,0 +1,95 @@
+package loadgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// formatLatency prints a latency in microseconds, the scale of the engine
+func formatLatency(d time.Duration) string {
+	return fmt.Sprintf("%.1f", float64(d)/float64(time.Microsecond))
+}
+
+func latencyRow(name string, l Latency) string {
+	return fmt.Sprintf("%s\t%d\t%s\t%s\t%s\t%s\t%s\t",
+		name, l.Count, formatLatency(l.Mean), formatLatency(l.P50), formatLatency(l.P99), formatLatency(l.P999), formatLatency(l.Max))
+}
+
+// Write prints the throughput of a run and its latencies per operation, in microseconds
+func (r Result) Write(w io.Writer) error {
+	fmt.Fprintf(w, "%s: %d operations in %s, %.0f ops/sec, %d trades, %d errors\n",
+		r.Target, r.Operations, r.Elapsed.Round(time.Millisecond), r.Throughput, r.Trades, r.Errors)
+	if r.FirstError != "" {
+		fmt.Fprintf(w, "first error: %s\n", r.FirstError)
+	}
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "OPERATION\tCOUNT\tMEAN us\tP50 us\tP99 us\tP99.9 us\tMAX us\t")
+	for _, op := range operations {
+		if l, ok := r.ByOp[op]; ok {
+			fmt.Fprintln(tw, latencyRow(op, l))
+		}
+	}
+	fmt.Fprintln(tw, latencyRow("all", r.Latency))
+	return tw.Flush()
+}
+
+// Save writes the result as indented JSON to path
+func (r Result) Save(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Load reads a result saved by Save
+func Load(path string) (Result, error) {
+	var r Result
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return r, err
+	}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return r, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return r, nil
+}
+
+// Compare prints the throughput and latencies of two runs side by side with the change
+// from base to next, negative changes of latency are improvements
+func Compare(w io.Writer, base Result, next Result) error {
+	change := func(a, b float64) string {
+		if a == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%+.1f%%", (b-a)/a*100)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "METRIC\tBASE\tNEXT\tCHANGE\t")
+	fmt.Fprintf(tw, "ops/sec\t%.0f\t%.0f\t%s\t\n", base.Throughput, next.Throughput, change(base.Throughput, next.Throughput))
+	rows := func(name string, a, b Latency) {
+		for _, metric := range []struct {
+			name string
+			a, b time.Duration
+		}{
+			{"p50", a.P50, b.P50}, {"p99", a.P99, b.P99}, {"p99.9", a.P999, b.P999}, {"max", a.Max, b.Max},
+		} {
+			fmt.Fprintf(tw, "%s %s us\t%s\t%s\t%s\t\n", name, metric.name,
+				formatLatency(metric.a), formatLatency(metric.b), change(float64(metric.a), float64(metric.b)))
+		}
+	}
+	rows("all", base.Latency, next.Latency)
+	for _, op := range operations {
+		a, inBase := base.ByOp[op]
+		b, inNext := next.ByOp[op]
+		if inBase && inNext {
+			rows(op, a, b)
+		}
+	}
+	return tw.Flush()
+}
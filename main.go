@@ -1,22 +1,214 @@
+// Command orderbook runs the exchange: the HTTP API and dashboard, the FIX and gRPC order
+// entry gateways and the ITCH order feed, all sharing one book.
+//
+//	orderbook [-config orderbook.yaml] [-print-config] [-listen.http :8080] ...
+//
+// Settings come from the optional YAML file, then ORDERBOOK_* environment variables, then
+// flags, see package config. -print-config prints the effective settings and exits.
+//
+// On SIGINT or SIGTERM the server stops taking orders and reports draining on /health,
+// closes the WebSocket, FIX and gRPC sessions, writes the resting orders to the snapshot
+// file and flushes the journal and the audit log. It exits with 0 when all of it went
+// well. It exits with 1 when the server failed to start or a step of the shutdown failed.
+// It exits with 2 for an invalid configuration.
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/EliasManj/orderbook/api"
-	"github.com/gorilla/mux"
+	"github.com/EliasManj/orderbook/audit"
+	"github.com/EliasManj/orderbook/auth"
+	"github.com/EliasManj/orderbook/config"
+	"github.com/EliasManj/orderbook/fix"
+	"github.com/EliasManj/orderbook/grpcapi"
+	"github.com/EliasManj/orderbook/itch"
+	"github.com/EliasManj/orderbook/journal"
+	"github.com/EliasManj/orderbook/orderbook"
+	"github.com/EliasManj/orderbook/ratelimit"
 )
 
 func main() {
-	r := mux.NewRouter()
-	r.HandleFunc("/bids/", api.GetBids)
-	r.HandleFunc("/asks/", api.GetAsks)
-	r.HandleFunc("/order/", api.CreateOrder).Methods("POST")
+	os.Exit(run())
+}
+
+// run serves until a signal or a failing listener and returns the exit status
+func run() int {
+	configPath := flag.String("config", "", "YAML configuration file")
+	printConfig := flag.Bool("print-config", false, "print the effective configuration and exit")
+	applyFlags := config.Flags(flag.CommandLine)
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath, os.Environ())
+	if err == nil {
+		err = applyFlags(&cfg)
+	}
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "orderbook: invalid configuration:\n%v\n", err)
+		return 2
+	}
+	if *printConfig {
+		data, err := cfg.YAML()
+		if err != nil {
+			return fail(err)
+		}
+		os.Stdout.Write(data)
+		return 0
+	}
+	level, _ := cfg.LogLevel()
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	instrument := cfg.Instruments[0]
+	api.ConfigureBook(instrument.Symbol, orderbook.Price(instrument.TickSize), orderbook.Quantity(instrument.LotSize))
+	j, err := api.OpenJournal(cfg.Journal)
+	if err != nil {
+		return fail(err)
+	}
+	defer j.Close()
+	if cfg.Snapshot != "" {
+		err := api.RestoreSnapshot(cfg.Snapshot)
+		switch {
+		case err == nil:
+			slog.Info("restored snapshot", "snapshot", cfg.Snapshot)
+		case !errors.Is(err, os.ErrNotExist):
+			return fail(err)
+		}
+	}
+
+	var auditLog *audit.Log
+	if cfg.Audit.Dir != "" {
+		if auditLog, err = audit.Open(cfg.Audit.Dir, cfg.Audit.MaxSize); err != nil {
+			return fail(err)
+		}
+		defer auditLog.Close()
+	}
+
+	feedFile, err := itch.CreateFile(cfg.ITCH.File)
+	if err != nil {
+		return fail(err)
+	}
+	defer feedFile.Close()
+	feedUDP, err := itch.DialUDP(cfg.ITCH.UDP)
+	if err != nil {
+		return fail(err)
+	}
+	defer feedUDP.Close()
+	exchange := api.DefaultExchange()
+	if auditLog != nil {
+		exchange.SetAuditLog(auditLog)
+	}
+	exchange.OnBookChange(itch.NewPublisher(exchange.Symbol(), feedFile, feedUDP))
+
+	// The keys bind every gateway to the accounts they trade for: the HTTP API and the gRPC
+	// service check the signature of each request and FIX sessions trade for their account
+	keys, err := auth.Load(cfg.Auth.KeyFile)
+	if errors.Is(err, os.ErrNotExist) {
+		slog.Warn("no API key file, the HTTP and gRPC APIs are open to everyone", "key_file", cfg.Auth.KeyFile)
+	} else if err != nil {
+		return fail(err)
+	}
+
+	// errs gets the first listener to fail, the others are not read once shutting down
+	errs := make(chan error, 3)
+	acceptor := fix.NewAcceptor(cfg.FIX.CompID, exchange, fix.FileStores(cfg.FIX.Store))
+	acceptor.CancelOnDisconnectGrace = cfg.FIX.CancelOnDisconnectGrace
+	if keys != nil || len(cfg.FIX.Accounts) > 0 {
+		acceptor.Accounts = make(map[string]string)
+		for compID, account := range cfg.FIX.Accounts {
+			acceptor.Accounts[compID] = account
+		}
+	}
+	go func() {
+		errs <- fmt.Errorf("fix: %w", acceptor.Listen(cfg.Listen.FIX))
+	}()
+
+	rpc := grpcapi.NewServer(exchange)
+	rpc.Keys = keys
+	go func() {
+		errs <- fmt.Errorf("grpc: %w", rpc.Listen(cfg.Listen.GRPC))
+	}()
+
+	r := api.NewRouter()
+	if keys != nil {
+		r.Use(api.AuthMiddleware(keys))
+	}
+	r.Use(api.RateLimitMiddleware(ratelimit.New(cfg.RateLimits)))
+	if cfg.Debug.Pprof {
+		api.RegisterPprof(r)
+	}
 
 	// Serve static HTML file
-	r.PathPrefix("/").Handler(http.FileServer(http.Dir("./static/")))
+	r.PathPrefix("/").Handler(http.FileServer(http.Dir(cfg.StaticDir)))
+
+	server := &http.Server{Addr: cfg.Listen.HTTP, Handler: r}
+	go func() {
+		errs <- fmt.Errorf("http: %w", server.ListenAndServe())
+	}()
+	slog.Info("listening", "http", cfg.Listen.HTTP, "fix", cfg.Listen.FIX, "grpc", cfg.Listen.GRPC, "symbol", instrument.Symbol)
+
+	status := 0
+	select {
+	case <-ctx.Done():
+		slog.Info("shutting down", "drain_delay", cfg.Shutdown.DrainDelay, "timeout", cfg.Shutdown.Timeout)
+	case err := <-errs:
+		slog.Error(err.Error())
+		status = 1
+	}
+	// A second signal kills the server
+	stop()
+	if !shutdown(cfg, exchange, server, acceptor, rpc, j, auditLog) {
+		status = 1
+	}
+	slog.Info("stopped", "status", status)
+	return status
+}
+
+// shutdown stops taking orders, closes every session once the drain delay is over, then
+// saves the book. It reports whether every step succeeded within the shutdown timeout
+func shutdown(cfg config.Config, exchange *api.Exchange, server *http.Server, acceptor *fix.Acceptor, rpc *grpcapi.Server, j *journal.Journal, auditLog *audit.Log) bool {
+	exchange.Drain()
+	time.Sleep(cfg.Shutdown.DrainDelay)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Shutdown.Timeout)
+	defer cancel()
+
+	ok := true
+	check := func(step string, err error) {
+		if err != nil {
+			slog.Error("shutdown failed", "step", step, "err", err)
+			ok = false
+		}
+	}
+	check("websocket", api.CloseFeeds(ctx))
+	check("fix", acceptor.Close())
+	check("grpc", rpc.Shutdown(ctx))
+	check("http", server.Shutdown(ctx))
+	// Commands still running hold the book until they are over, so the snapshot follows them
+	if cfg.Snapshot != "" {
+		check("snapshot", api.WriteSnapshot(cfg.Snapshot))
+	}
+	check("journal", j.Flush())
+	if auditLog != nil {
+		check("audit", auditLog.Sync())
+	}
+	return ok
+}
 
-	http.Handle("/", r)
-	log.Fatal(http.ListenAndServe(":8080", r))
+// fail logs err whatever the log level and returns the exit status for it
+func fail(err error) int {
+	slog.Error(err.Error())
+	return 1
 }
@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryTextFormat(t *testing.T) {
+	r := NewRegistry()
+	orders := r.NewCounterVec("orders_total", "Orders seen.", "side")
+	depth := r.NewGaugeVec("depth", "Book depth.")
+	latency := r.NewHistogramVec("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+
+	orders.Inc("Buy")
+	orders.Add(2, "Sell")
+	orders.Inc("Buy")
+	depth.Set(10)
+	depth.Add(-3)
+	latency.Observe(0.05, "/order/")
+	latency.Observe(0.5, "/order/")
+	latency.Observe(5, "/order/")
+
+	var buf bytes.Buffer
+	require.NoError(t, r.WriteText(&buf))
+	require.Equal(t, `# HELP depth Book depth.
+# TYPE depth gauge
+depth 7
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/order/",le="0.1"} 1
+latency_seconds_bucket{route="/order/",le="1"} 2
+latency_seconds_bucket{route="/order/",le="+Inf"} 3
+latency_seconds_sum{route="/order/"} 5.55
+latency_seconds_count{route="/order/"} 3
+# HELP orders_total Orders seen.
+# TYPE orders_total counter
+orders_total{side="Buy"} 2
+orders_total{side="Sell"} 2
+`, buf.String())
+}
+
+func TestRegistryEscapesAndPanics(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("escaped_total", "Line one\nline two.", "label")
+	c.Inc("quote\"back\\slash\nnewline")
+	var buf bytes.Buffer
+	require.NoError(t, r.WriteText(&buf))
+	require.Contains(t, buf.String(), `# HELP escaped_total Line one\nline two.`)
+	require.Contains(t, buf.String(), `escaped_total{label="quote\"back\\slash\nnewline"} 1`)
+
+	require.Panics(t, func() { r.NewGaugeVec("escaped_total", "Duplicate.") })
+	require.Panics(t, func() { c.Inc() })
+	require.Panics(t, func() { c.Add(-1, "x") })
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("served_total", "Served.").Inc()
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, 200, rec.Code)
+	require.Contains(t, rec.Header().Get("Content-Type"), "text/plain; version=0.0.4")
+	require.Contains(t, rec.Body.String(), "served_total 1\n")
+}
@@ -0,0 +1,187 @@
+package orderbook
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/EliasManj/orderbook/metrics"
+)
+
+// DefaultEventBuffer is the number of events a subscriber can fall behind by default
+const DefaultEventBuffer = 1024
+
+var (
+	eventsPublished = metrics.NewCounterVec("orderbook_events_total", "Events published on the event bus.", "type")
+	eventsDropped   = metrics.NewCounterVec("orderbook_events_dropped_total", "Events dropped for slow subscribers.", "subscriber")
+)
+
+// Subscriber receives the events of a book, one at a time and in sequence order
+type Subscriber interface {
+	HandleEvent(e Event)
+}
+
+// SubscriberFunc adapts a function to a Subscriber
+type SubscriberFunc func(e Event)
+
+func (f SubscriberFunc) HandleEvent(e Event) {
+	f(e)
+}
+
+// SlowConsumerPolicy is what happens to the events a subscriber has no room for
+type SlowConsumerPolicy int
+
+const (
+	// DropNewest discards the events that do not fit, the subscriber sees a gap in Seq
+	DropNewest SlowConsumerPolicy = iota
+	// DropOldest discards the oldest queued event to make room, the subscriber sees a gap in Seq
+	DropOldest
+	// Disconnect closes the subscription, the subscriber sees everything up to the overflow
+	Disconnect
+)
+
+// SubscribeOptions sets the buffer of a subscription, DefaultEventBuffer when 0, and what
+// happens once it is full
+type SubscribeOptions struct {
+	Buffer int
+	Policy SlowConsumerPolicy
+}
+
+// EventBus fans the events of a book out to subscribers without ever waiting for them.
+// Each subscriber has a bounded buffer drained by its own goroutine, so a slow subscriber
+// only holds up itself
+type EventBus struct {
+	mu   sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscription is the registration of a subscriber on an EventBus
+type Subscription struct {
+	Name    string
+	bus     *EventBus
+	sub     Subscriber
+	policy  SlowConsumerPolicy
+	events  chan Event
+	done    chan struct{}
+	dropped atomic.Uint64
+	// closed is guarded by the mutex of the bus
+	closed bool
+}
+
+// Subscribe registers sub for every event published from now on. The name labels the
+// dropped events metric
+func (b *EventBus) Subscribe(name string, sub Subscriber, opts SubscribeOptions) *Subscription {
+	buffer := opts.Buffer
+	if buffer <= 0 {
+		buffer = DefaultEventBuffer
+	}
+	s := &Subscription{
+		Name:   name,
+		bus:    b,
+		sub:    sub,
+		policy: opts.Policy,
+		events: make(chan Event, buffer),
+		done:   make(chan struct{}),
+	}
+	b.mu.Lock()
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+	go s.run()
+	return s
+}
+
+// Publish queues events for every subscriber, applying the policy of those with a full
+// buffer. Events must be published in sequence order
+func (b *EventBus) Publish(events ...Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, e := range events {
+		eventsPublished.Inc(string(e.Type))
+		for s := range b.subs {
+			s.offer(e)
+		}
+	}
+}
+
+// Close closes every subscription and waits for the subscribers to handle the events
+// already queued
+func (b *EventBus) Close() {
+	b.mu.Lock()
+	subs := make([]*Subscription, 0, len(b.subs))
+	for s := range b.subs {
+		subs = append(subs, s)
+		b.remove(s)
+	}
+	b.mu.Unlock()
+	for _, s := range subs {
+		<-s.done
+	}
+}
+
+// remove unregisters a subscription and ends its queue. Callers must hold mu
+func (b *EventBus) remove(s *Subscription) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	delete(b.subs, s)
+	close(s.events)
+}
+
+// offer queues an event according to the policy of the subscription. Callers must hold
+// the mutex of the bus, which makes the publisher the only sender
+func (s *Subscription) offer(e Event) {
+	select {
+	case s.events <- e:
+		return
+	default:
+	}
+	switch s.policy {
+	case DropOldest:
+		select {
+		case <-s.events:
+			s.drop()
+		default:
+		}
+		s.events <- e
+	case Disconnect:
+		s.drop()
+		s.bus.remove(s)
+	default:
+		s.drop()
+	}
+}
+
+func (s *Subscription) drop() {
+	s.dropped.Add(1)
+	eventsDropped.Inc(s.Name)
+}
+
+func (s *Subscription) run() {
+	defer close(s.done)
+	for e := range s.events {
+		s.sub.HandleEvent(e)
+	}
+}
+
+// Dropped returns the number of events the subscriber missed for being too slow
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Done is closed once the subscription is closed and the subscriber handled its last event
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close unsubscribes and waits for the subscriber to handle the events already queued.
+// It must not be called from the subscriber itself
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	s.bus.remove(s)
+	s.bus.mu.Unlock()
+	<-s.done
+}
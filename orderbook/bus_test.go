@@ -0,0 +1,103 @@
+package orderbook
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// blockedSubscriber records events, holding the first one until release is closed
+type blockedSubscriber struct {
+	release chan struct{}
+	mu      sync.Mutex
+	seqs    []uint64
+}
+
+func (s *blockedSubscriber) HandleEvent(e Event) {
+	<-s.release
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seqs = append(s.seqs, e.Seq)
+}
+
+func publishSeqs(bus *EventBus, from uint64, to uint64) {
+	for seq := from; seq <= to; seq++ {
+		bus.Publish(Event{Seq: seq, Type: EventTrade})
+	}
+}
+
+func TestEventBus_InOrder(t *testing.T) {
+	bus := NewEventBus()
+	received := make([][]uint64, 3)
+	subscriptions := make([]*Subscription, 3)
+	for i := range received {
+		i := i
+		subscriptions[i] = bus.Subscribe("ordered", SubscriberFunc(func(e Event) { received[i] = append(received[i], e.Seq) }), SubscribeOptions{Buffer: 16, Policy: SlowConsumerPolicy(i % 2)})
+	}
+	publishSeqs(bus, 1, 1000)
+	bus.Close()
+	// Subscribers that fall behind miss events, but never see them out of order
+	for i, seqs := range received {
+		require.Equal(t, 1000, len(seqs)+int(subscriptions[i].Dropped()))
+		for j := 1; j < len(seqs); j++ {
+			require.Greater(t, seqs[j], seqs[j-1])
+		}
+	}
+}
+
+func TestEventBus_SlowConsumerPolicies(t *testing.T) {
+	bus := NewEventBus()
+	fast := []uint64{}
+	bus.Subscribe("fast", SubscriberFunc(func(e Event) { fast = append(fast, e.Seq) }), SubscribeOptions{Buffer: 100})
+	subscribers := map[SlowConsumerPolicy]*blockedSubscriber{}
+	subscriptions := map[SlowConsumerPolicy]*Subscription{}
+	for _, policy := range []SlowConsumerPolicy{DropNewest, DropOldest, Disconnect} {
+		subscribers[policy] = &blockedSubscriber{release: make(chan struct{})}
+		subscriptions[policy] = bus.Subscribe("slow", subscribers[policy], SubscribeOptions{Buffer: 2, Policy: policy})
+	}
+
+	// Each slow subscriber takes the first event and holds on to it, then its buffer of two
+	// fills up behind it
+	publishSeqs(bus, 1, 1)
+	require.Eventually(t, func() bool {
+		for _, s := range subscriptions {
+			if len(s.events) > 0 {
+				return false
+			}
+		}
+		return true
+	}, time.Second, time.Millisecond)
+	publishSeqs(bus, 2, 6)
+	for _, s := range subscribers {
+		close(s.release)
+	}
+	bus.Close()
+	// The disconnected subscription already left the bus, which does not wait for it
+	select {
+	case <-subscriptions[Disconnect].Done():
+	case <-time.After(time.Second):
+		t.Fatal("disconnected subscription is not done")
+	}
+
+	require.Equal(t, []uint64{1, 2, 3, 4, 5, 6}, fast)
+	require.Equal(t, []uint64{1, 2, 3}, subscribers[DropNewest].seqs)
+	require.Equal(t, uint64(3), subscriptions[DropNewest].Dropped())
+	require.Equal(t, []uint64{1, 5, 6}, subscribers[DropOldest].seqs)
+	require.Equal(t, uint64(3), subscriptions[DropOldest].Dropped())
+	require.Equal(t, []uint64{1, 2, 3}, subscribers[Disconnect].seqs)
+	require.Equal(t, uint64(1), subscriptions[Disconnect].Dropped())
+}
+
+func TestEventBus_CloseSubscription(t *testing.T) {
+	bus := NewEventBus()
+	seqs := []uint64{}
+	s := bus.Subscribe("closed", SubscriberFunc(func(e Event) { seqs = append(seqs, e.Seq) }), SubscribeOptions{})
+	publishSeqs(bus, 1, 3)
+	s.Close()
+	publishSeqs(bus, 4, 5)
+	s.Close()
+	bus.Close()
+	require.Equal(t, []uint64{1, 2, 3}, seqs)
+}
@@ -0,0 +1,138 @@
+package orderbook
+
+import "time"
+
+// EventType names what an Event reports
+type EventType string
+
+const (
+	// EventOrderAccepted reports an order that passed validation and is about to match
+	EventOrderAccepted EventType = "OrderAccepted"
+	// EventOrderRejected reports an order refused by the book, with the reason
+	EventOrderRejected EventType = "OrderRejected"
+	// EventOrderFilled reports a fill of one side of a trade, with the order left after it
+	EventOrderFilled EventType = "OrderFilled"
+	// EventOrderCancelled reports an order leaving the book before it was filled
+	EventOrderCancelled EventType = "OrderCancelled"
+	// EventOrderReplaced reports a resting order modified into a new version
+	EventOrderReplaced EventType = "OrderReplaced"
+	// EventTrade reports a trade between two orders
+	EventTrade EventType = "Trade"
+	// EventBookLevelChanged reports the new total quantity of a price level, 0 once it is empty
+	EventBookLevelChanged EventType = "BookLevelChanged"
+)
+
+// Reasons an order is rejected
+const (
+	RejectDuplicateId  = "duplicate order id"
+	RejectQuantity     = "quantity must be positive"
+	RejectNoLiquidity  = "no liquidity for a market order"
+	RejectCannotMatch  = "fill and kill order cannot match"
+	RejectCannotFillUp = "fill or kill order cannot be filled completely"
+	RejectTickSize     = "price is not a multiple of the tick size"
+	RejectLotSize      = "quantity is not a multiple of the lot size"
+)
+
+// Rejection is the error of a command the book rejects, its reason one of the Reject
+// constants
+type Rejection string
+
+func (r Rejection) Error() string {
+	return string(r)
+}
+
+// Event is a change to a book. Seq numbers the events of a book in the order they
+// happened, without gaps. Which of the other fields are set depends on Type
+type Event struct {
+	Seq    uint64
+	Type   EventType
+	Symbol string
+	Time   time.Time
+	// Order is the order of order events as it is after the change, Old the version an
+	// OrderReplaced replaces
+	Order Order
+	Old   Order
+	// Reason is why an OrderRejected was refused
+	Reason string
+	// Qty and Price are the fill of an OrderFilled
+	Qty   Quantity
+	Price Price
+	// Trade is set on Trade events, Level on BookLevelChanged events
+	Trade *Trade
+	Level *LevelChange
+}
+
+// LevelChange is the quantity resting at a price level of one side
+type LevelChange struct {
+	Side     Side
+	Price    Price
+	Quantity Quantity
+}
+
+type levelKey struct {
+	side  Side
+	price Price
+}
+
+// begin opens a command on the book, events emitted until the matching end are published
+// together. Commands run inside another one, such as the cancel of a fill and kill
+// remainder, are part of the outer command
+func (ob *OrderBook) begin() {
+	ob.depth++
+}
+
+// end closes a command, publishing its events followed by the price levels it changed
+// once the outermost command is over
+func (ob *OrderBook) end() {
+	ob.depth--
+	if ob.depth > 0 {
+		return
+	}
+	for _, key := range ob.touchedOrder {
+		qty := ob.GetTotalQty(key.side, key.price)
+		if qty != ob.touched[key] {
+			ob.emit(Event{Type: EventBookLevelChanged, Level: &LevelChange{Side: key.side, Price: key.price, Quantity: qty}})
+		}
+	}
+	clear(ob.touched)
+	ob.touchedOrder = ob.touchedOrder[:0]
+	events := ob.pending
+	ob.pending = nil
+	if ob.Events != nil && len(events) > 0 {
+		ob.Events.Publish(events...)
+	}
+}
+
+// touch records the quantity of a price level before the current command changes it
+func (ob *OrderBook) touch(side Side, price Price) {
+	if ob.Events == nil {
+		return
+	}
+	key := levelKey{side, price}
+	if _, ok := ob.touched[key]; ok {
+		return
+	}
+	if ob.touched == nil {
+		ob.touched = make(map[levelKey]Quantity)
+	}
+	ob.touched[key] = ob.GetTotalQty(side, price)
+	ob.touchedOrder = append(ob.touchedOrder, key)
+}
+
+// emit numbers an event and queues it for the end of the current command. Nothing is
+// queued without an event bus, but the events are still numbered
+func (ob *OrderBook) emit(e Event) {
+	ob.eventSeq++
+	if ob.Events == nil {
+		return
+	}
+	e.Seq = ob.eventSeq
+	e.Symbol = ob.Symbol
+	e.Time = ob.Clock()
+	ob.pending = append(ob.pending, e)
+}
+
+// LastEventSeq returns the sequence number of the most recent event
+func (ob *OrderBook) LastEventSeq() uint64 {
+	return ob.eventSeq
+}
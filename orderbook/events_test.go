@@ -0,0 +1,75 @@
+package orderbook
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// describe renders the fields of an event that matter for its type
+func describe(e Event) string {
+	switch e.Type {
+	case EventTrade:
+		return fmt.Sprintf("Trade %d/%d %d@%v", e.Trade.BidTrade.OrderId, e.Trade.AskTrade.OrderId, e.Trade.Qty(), e.Trade.ExecPrice())
+	case EventOrderFilled:
+		return fmt.Sprintf("OrderFilled %d %d@%v left %d", e.Order.orderId, e.Qty, e.Price, e.Order.remainingQty)
+	case EventOrderRejected:
+		return fmt.Sprintf("OrderRejected %d %s", e.Order.orderId, e.Reason)
+	case EventOrderReplaced:
+		return fmt.Sprintf("OrderReplaced %d %dx%v -> %dx%v", e.Order.orderId, e.Old.remainingQty, e.Old.Price, e.Order.remainingQty, e.Order.Price)
+	case EventBookLevelChanged:
+		return fmt.Sprintf("BookLevelChanged %s %v %d", e.Level.Side, e.Level.Price, e.Level.Quantity)
+	default:
+		return fmt.Sprintf("%s %d %d", e.Type, e.Order.orderId, e.Order.remainingQty)
+	}
+}
+
+func TestOrderbook_Events(t *testing.T) {
+	orderbook := createOrderBook(t)
+	orderbook.Events = NewEventBus()
+	events := []Event{}
+	orderbook.Events.Subscribe("test", SubscriberFunc(func(e Event) { events = append(events, e) }), SubscribeOptions{})
+
+	orderbook.AddOrder(createOrderWithId(1, GoodTilCancelled, Sell, 100, 5))
+	orderbook.AddOrder(createOrderWithId(2, FillAndKill, Buy, 100, 8))
+	orderbook.AddOrder(createOrderWithId(3, FillOrKill, Buy, 100, 1))
+	orderbook.AddOrder(createOrderWithId(4, GoodTilCancelled, Buy, 90, 4))
+	order, _ := orderbook.GetOrder(4)
+	require.NoError(t, order.Amend(90, 2))
+	orderbook.ModifyOrder(order)
+	require.NoError(t, order.Amend(95, 2))
+	orderbook.ModifyOrder(order)
+	orderbook.CancelOrder(4)
+	orderbook.CancelOrder(4)
+	orderbook.Events.Close()
+
+	expected := []string{
+		"OrderAccepted 1 5",
+		"BookLevelChanged Sell 100 5",
+		"OrderAccepted 2 8",
+		"Trade 2/1 5@100",
+		"OrderFilled 2 5@100 left 3",
+		"OrderFilled 1 5@100 left 0",
+		"OrderCancelled 2 3",
+		"BookLevelChanged Sell 100 0",
+		"OrderRejected 3 " + RejectCannotFillUp,
+		"OrderAccepted 4 4",
+		"BookLevelChanged Buy 90 4",
+		"OrderReplaced 4 4x90 -> 2x90",
+		"BookLevelChanged Buy 90 2",
+		"OrderReplaced 4 2x90 -> 2x95",
+		"BookLevelChanged Buy 90 0",
+		"BookLevelChanged Buy 95 2",
+		"OrderCancelled 4 2",
+		"BookLevelChanged Buy 95 0",
+	}
+	actual := []string{}
+	for i, e := range events {
+		require.Equal(t, uint64(i+1), e.Seq)
+		require.Equal(t, DefaultSymbol, e.Symbol)
+		actual = append(actual, describe(e))
+	}
+	require.Equal(t, expected, actual)
+	require.Equal(t, uint64(len(expected)), orderbook.LastEventSeq())
+}
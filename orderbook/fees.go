@@ -0,0 +1,163 @@
+package orderbook
+
+import (
+	"sort"
+)
+
+type Liquidity int
+
+const (
+	Maker Liquidity = iota
+	Taker
+)
+
+func (l Liquidity) String() string {
+	switch l {
+	case Maker:
+		return "Maker"
+	case Taker:
+		return "Taker"
+	default:
+		return "Unknown"
+	}
+}
+
+// FeeTier holds the rates that apply once an account has traded at least MinVolume notional.
+// Rates are fractions of the trade notional, a negative MakerRate is a rebate
+type FeeTier struct {
+	MinVolume float64
+	MakerRate float64
+	TakerRate float64
+}
+
+type FeeSchedule struct {
+	Name  string
+	Tiers []FeeTier
+}
+
+// ZeroFeeSchedule charges nothing to either side of a trade
+var ZeroFeeSchedule = FeeSchedule{
+	Name:  "zero",
+	Tiers: []FeeTier{{MinVolume: 0, MakerRate: 0, TakerRate: 0}},
+}
+
+// StandardFeeSchedule pays makers a rebate and charges takers, both improving with volume
+var StandardFeeSchedule = FeeSchedule{
+	Name: "standard",
+	Tiers: []FeeTier{
+		{MinVolume: 0, MakerRate: -0.0001, TakerRate: 0.0005},
+		{MinVolume: 100000, MakerRate: -0.00015, TakerRate: 0.0004},
+		{MinVolume: 1000000, MakerRate: -0.0002, TakerRate: 0.0003},
+	},
+}
+
+// Rates returns the maker and taker rates for an account that has traded the given notional volume
+func (fs FeeSchedule) Rates(volume float64) (float64, float64) {
+	var maker, taker float64
+	for _, tier := range fs.Tiers {
+		if volume >= tier.MinVolume {
+			maker, taker = tier.MakerRate, tier.TakerRate
+		}
+	}
+	return maker, taker
+}
+
+// AccountFees accumulates the fees charged and rebates paid to a single account
+type AccountFees struct {
+	Account  string
+	Schedule string
+	Volume   float64
+	Fees     float64
+	Rebates  float64
+	Balance  float64
+}
+
+type FeeLedger struct {
+	Default   FeeSchedule
+	schedules map[string]FeeSchedule
+	accounts  map[string]*AccountFees
+}
+
+// NewFeeLedger creates a new FeeLedger charging every account the default schedule
+func NewFeeLedger(schedule FeeSchedule) *FeeLedger {
+	return &FeeLedger{
+		Default:   normalizeSchedule(schedule),
+		schedules: make(map[string]FeeSchedule),
+		accounts:  make(map[string]*AccountFees),
+	}
+}
+
+// SetSchedule assigns a fee schedule to an account, overriding the default
+func (fl *FeeLedger) SetSchedule(account string, schedule FeeSchedule) {
+	fl.schedules[account] = normalizeSchedule(schedule)
+	fl.account(account).Schedule = schedule.Name
+}
+
+// Schedule returns the fee schedule that applies to an account
+func (fl *FeeLedger) Schedule(account string) FeeSchedule {
+	if schedule, exists := fl.schedules[account]; exists {
+		return schedule
+	}
+	return fl.Default
+}
+
+// Deposit credits an account balance
+func (fl *FeeLedger) Deposit(account string, amount float64) {
+	fl.account(account).Balance += amount
+}
+
+// Charge computes the fee for one side of a trade and applies it to the account balance
+func (fl *FeeLedger) Charge(account string, liquidity Liquidity, notional float64) float64 {
+	acc := fl.account(account)
+	maker, taker := fl.Schedule(account).Rates(acc.Volume)
+	rate := taker
+	if liquidity == Maker {
+		rate = maker
+	}
+	fee := notional * rate
+	if fee >= 0 {
+		acc.Fees += fee
+	} else {
+		acc.Rebates -= fee
+	}
+	acc.Balance -= fee
+	acc.Volume += notional
+	return fee
+}
+
+// Get returns the fee totals for an account
+func (fl *FeeLedger) Get(account string) (AccountFees, bool) {
+	acc, exists := fl.accounts[account]
+	if !exists {
+		return AccountFees{}, false
+	}
+	return *acc, true
+}
+
+// Accounts returns the fee totals of every known account sorted by account name
+func (fl *FeeLedger) Accounts() []AccountFees {
+	accounts := make([]AccountFees, 0, len(fl.accounts))
+	for _, acc := range fl.accounts {
+		accounts = append(accounts, *acc)
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].Account < accounts[j].Account })
+	return accounts
+}
+
+func (fl *FeeLedger) account(account string) *AccountFees {
+	acc, exists := fl.accounts[account]
+	if !exists {
+		acc = &AccountFees{Account: account, Schedule: fl.Schedule(account).Name}
+		fl.accounts[account] = acc
+	}
+	return acc
+}
+
+// normalizeSchedule sorts the tiers by ascending volume so Rates can pick the last matching one
+func normalizeSchedule(schedule FeeSchedule) FeeSchedule {
+	tiers := make([]FeeTier, len(schedule.Tiers))
+	copy(tiers, schedule.Tiers)
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].MinVolume < tiers[j].MinVolume })
+	schedule.Tiers = tiers
+	return schedule
+}
@@ -0,0 +1,70 @@
+package orderbook
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeeScheduleTiers(t *testing.T) {
+	maker, taker := StandardFeeSchedule.Rates(0)
+	require.Equal(t, -0.0001, maker)
+	require.Equal(t, 0.0005, taker)
+	maker, taker = StandardFeeSchedule.Rates(250000)
+	require.Equal(t, -0.00015, maker)
+	require.Equal(t, 0.0004, taker)
+	maker, taker = StandardFeeSchedule.Rates(5000000)
+	require.Equal(t, -0.0002, maker)
+	require.Equal(t, 0.0003, taker)
+}
+
+func TestOrderbook_TradeLiquidityAndFees(t *testing.T) {
+	orderbook := createOrderBook(t)
+	orderbook.Fees = NewFeeLedger(FeeSchedule{
+		Name:  "flat",
+		Tiers: []FeeTier{{MinVolume: 0, MakerRate: -0.001, TakerRate: 0.002}},
+	})
+	ask := CreateOrder(GoodTilCancelled, Sell, 100, 10)
+	ask.Account = "maker"
+	bid := CreateOrder(GoodTilCancelled, Buy, 110, 10)
+	bid.orderId = ask.orderId + 1
+	bid.Account = "taker"
+	require.Len(t, orderbook.AddOrder(ask), 0)
+	trades := orderbook.AddOrder(bid)
+	require.Len(t, trades, 1)
+
+	require.Equal(t, Taker, trades[0].BidTrade.Liquidity)
+	require.Equal(t, Maker, trades[0].AskTrade.Liquidity)
+	require.Equal(t, "taker", trades[0].BidTrade.Account)
+	require.Equal(t, "maker", trades[0].AskTrade.Account)
+	// Notional is taken at the resting order's price
+	require.InDelta(t, 2.0, trades[0].BidTrade.Fee, 1e-9)
+	require.InDelta(t, -1.0, trades[0].AskTrade.Fee, 1e-9)
+
+	taker, ok := orderbook.Fees.Get("taker")
+	require.True(t, ok)
+	require.InDelta(t, 2.0, taker.Fees, 1e-9)
+	require.InDelta(t, -2.0, taker.Balance, 1e-9)
+	require.InDelta(t, 1000.0, taker.Volume, 1e-9)
+	maker, ok := orderbook.Fees.Get("maker")
+	require.True(t, ok)
+	require.InDelta(t, 1.0, maker.Rebates, 1e-9)
+	require.InDelta(t, 1.0, maker.Balance, 1e-9)
+}
+
+func TestFeeLedgerVolumeTiers(t *testing.T) {
+	ledger := NewFeeLedger(ZeroFeeSchedule)
+	ledger.SetSchedule("vip", StandardFeeSchedule)
+	ledger.Deposit("vip", 1000)
+
+	require.InDelta(t, 50.0, ledger.Charge("vip", Taker, 100000), 1e-9)
+	// The first trade pushed the account into the second tier
+	require.InDelta(t, 40.0, ledger.Charge("vip", Taker, 100000), 1e-9)
+	require.Equal(t, 0.0, ledger.Charge("other", Taker, 100000))
+
+	vip, ok := ledger.Get("vip")
+	require.True(t, ok)
+	require.Equal(t, "standard", vip.Schedule)
+	require.InDelta(t, 910.0, vip.Balance, 1e-9)
+	require.Len(t, ledger.Accounts(), 2)
+}
@@ -0,0 +1,73 @@
+package orderbook
+
+import "unsafe"
+
+// BookStats describes the size and position of a book, for inspecting a running engine
+type BookStats struct {
+	BidLevels int
+	AskLevels int
+	BidOrders int
+	AskOrders int
+	Orders    int
+	// LargestLevel is the level with the most resting quantity, nil when the book is empty
+	LargestLevel *LevelStats
+	// MemoryBytes estimates the memory held by the resting orders and their levels
+	MemoryBytes  int
+	LastOrderSeq uint64
+	LastEventSeq uint64
+	LastTradeId  TradeId
+}
+
+// LevelStats is the resting quantity and number of orders at a price level of one side
+type LevelStats struct {
+	Side     Side
+	Price    Price
+	Quantity Quantity
+	Orders   int
+}
+
+// Approximate sizes of the entries of the Go maps holding orders and levels, key and value
+// plus the tophash byte and the spare room of half full buckets
+const (
+	orderEntryBytes = int(2 * (unsafe.Sizeof(OrderId(0)) + unsafe.Sizeof(Order{}) + 1))
+	levelEntryBytes = int(2 * (unsafe.Sizeof(Price(0)) + unsafe.Sizeof([]Order{}) + 1))
+)
+
+// Stats counts the levels and orders of the book. The memory estimate covers the orders in
+// their levels and in the Orders index but not fees, trade statistics or queued events
+func (ob *OrderBook) Stats() BookStats {
+	stats := BookStats{
+		Orders:       len(ob.Orders),
+		LastOrderSeq: ob.nextSeq,
+		LastEventSeq: ob.eventSeq,
+		LastTradeId:  ob.lastTradeId,
+	}
+	stats.BidLevels, stats.BidOrders = ob.sideStats(Buy, ob.Bids, &stats)
+	stats.AskLevels, stats.AskOrders = ob.sideStats(Sell, ob.Asks, &stats)
+	stats.MemoryBytes += len(ob.Orders) * orderEntryBytes
+	for _, order := range ob.Orders {
+		stats.MemoryBytes += len(order.Account)
+	}
+	return stats
+}
+
+// sideStats returns the levels and orders of one side, adding the memory of its levels to
+// stats and replacing its largest level when one of the side is larger
+func (ob *OrderBook) sideStats(side Side, levels *OrderedMap, stats *BookStats) (int, int) {
+	keys := levels.Keys()
+	orders := 0
+	stats.MemoryBytes += cap(keys)*int(unsafe.Sizeof(Price(0))) + len(keys)*levelEntryBytes
+	for _, price := range keys {
+		level := levels.Values()[price]
+		orders += len(level)
+		stats.MemoryBytes += cap(level) * int(unsafe.Sizeof(Order{}))
+		var qty Quantity
+		for _, order := range level {
+			qty += order.remainingQty
+		}
+		if stats.LargestLevel == nil || qty > stats.LargestLevel.Quantity {
+			stats.LargestLevel = &LevelStats{Side: side, Price: price, Quantity: qty, Orders: len(level)}
+		}
+	}
+	return len(keys), orders
+}
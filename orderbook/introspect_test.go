@@ -0,0 +1,35 @@
+package orderbook
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderbook_Stats(t *testing.T) {
+	orderbook := createOrderBook(t)
+	empty := orderbook.Stats()
+	require.Nil(t, empty.LargestLevel)
+	require.Zero(t, empty.Orders)
+
+	orderbook.AddOrder(createOrderWithId(1, GoodTilCancelled, Sell, 101, 5))
+	orderbook.AddOrder(createOrderWithId(2, GoodTilCancelled, Sell, 101, 3))
+	orderbook.AddOrder(createOrderWithId(3, GoodTilCancelled, Sell, 102, 1))
+	orderbook.AddOrder(createOrderWithId(4, GoodTilCancelled, Buy, 99, 4))
+	orderbook.AddOrder(createOrderWithId(5, FillAndKill, Buy, 101, 2))
+
+	stats := orderbook.Stats()
+	require.Equal(t, 1, stats.BidLevels)
+	require.Equal(t, 2, stats.AskLevels)
+	require.Equal(t, 1, stats.BidOrders)
+	require.Equal(t, 3, stats.AskOrders)
+	require.Equal(t, 4, stats.Orders)
+	require.Equal(t, &LevelStats{Side: Sell, Price: 101, Quantity: 6, Orders: 2}, stats.LargestLevel)
+	require.Equal(t, TradeId(1), stats.LastTradeId)
+	require.Equal(t, orderbook.LastEventSeq(), stats.LastEventSeq)
+	require.Greater(t, stats.MemoryBytes, empty.MemoryBytes)
+
+	orderbook.CancelOrder(1)
+	orderbook.CancelOrder(2)
+	require.Less(t, orderbook.Stats().MemoryBytes, stats.MemoryBytes)
+}
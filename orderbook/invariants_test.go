@@ -0,0 +1,466 @@
+package orderbook
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Commands are decoded from 4 bytes each so that the fuzzer and the property test share
+// one encoding: the operation and side, the price, the quantity and the order a cancel
+// or modify applies to. Prices fall in a narrow band so that orders keep crossing
+const (
+	commandSize = 4
+	basePrice   = 95
+	priceBand   = 11
+	maxQty      = 16
+	// maxFuzzCommands keeps the fuzzer on sequences it can run thousands of times a second
+	maxFuzzCommands = 256
+)
+
+const (
+	opLimit byte = iota
+	opFillAndKill
+	opFillOrKill
+	opMarket
+	opCancel
+	opModify
+)
+
+type command struct {
+	op    byte
+	side  Side
+	price Price
+	qty   Quantity
+	pick  int
+}
+
+func (c command) String() string {
+	switch c.op {
+	case opCancel:
+		return fmt.Sprintf("cancel #%d", c.pick)
+	case opModify:
+		return fmt.Sprintf("modify #%d to %v x %d", c.pick, c.price, c.qty)
+	case opMarket:
+		return fmt.Sprintf("add %v Market %d", c.side, c.qty)
+	default:
+		return fmt.Sprintf("add %v %v %v x %d", c.side, c.orderType(), c.price, c.qty)
+	}
+}
+
+func (c command) orderType() orderType {
+	switch c.op {
+	case opFillAndKill:
+		return FillAndKill
+	case opFillOrKill:
+		return FillOrKill
+	case opMarket:
+		return Market
+	default:
+		return GoodTilCancelled
+	}
+}
+
+// decodeCommands reads a command from every 4 bytes, half of them limit orders
+func decodeCommands(data []byte) []command {
+	ops := []byte{opLimit, opLimit, opLimit, opLimit, opLimit, opFillAndKill, opFillOrKill, opMarket, opCancel, opModify}
+	commands := []command{}
+	for ; len(data) >= commandSize; data = data[commandSize:] {
+		commands = append(commands, command{
+			op:    ops[int(data[0])%len(ops)],
+			side:  Side(data[0] / byte(len(ops)) % 2),
+			price: Price(basePrice + int(data[1])%priceBand),
+			qty:   Quantity(int(data[2]) % maxQty),
+			pick:  int(data[3]),
+		})
+	}
+	return commands
+}
+
+// resting is an order waiting in the book, in the order it will be matched
+type resting struct {
+	id    OrderId
+	price Price
+	qty   Quantity
+}
+
+// tracked is what the checker knows about an order from the commands and the trades alone
+type tracked struct {
+	qty    Quantity
+	filled Quantity
+	// gone is the quantity cancelled, killed or rejected
+	gone Quantity
+}
+
+// checker runs commands against a book, checking the matching invariants after each one.
+// Orders are tracked until they leave the book
+type checker struct {
+	ob     *OrderBook
+	orders map[OrderId]*tracked
+	ids    []OrderId
+}
+
+func newChecker() *checker {
+	return &checker{ob: NewOrderBook(), orders: make(map[OrderId]*tracked)}
+}
+
+// runCommands returns the first invariant broken by the commands
+func runCommands(commands []command) error {
+	c := newChecker()
+	for i, cmd := range commands {
+		if err := c.step(cmd); err != nil {
+			return fmt.Errorf("step %d (%v): %w", i, cmd, err)
+		}
+		if err := c.checkBook(); err != nil {
+			return fmt.Errorf("step %d (%v): %w", i, cmd, err)
+		}
+	}
+	return nil
+}
+
+func (c *checker) step(cmd command) error {
+	switch cmd.op {
+	case opCancel:
+		if len(c.ids) == 0 {
+			return nil
+		}
+		id := c.ids[cmd.pick%len(c.ids)]
+		live, wasResting := c.ob.GetOrder(id)
+		c.ob.CancelOrder(id)
+		if wasResting {
+			c.orders[id].gone += live.remainingQty
+		}
+		if _, ok := c.ob.GetOrder(id); ok {
+			return fmt.Errorf("order %d still rests after its cancel", id)
+		}
+		return nil
+	case opModify:
+		if len(c.ids) == 0 {
+			return nil
+		}
+		id := c.ids[cmd.pick%len(c.ids)]
+		live, ok := c.ob.GetOrder(id)
+		if !ok {
+			return nil
+		}
+		order := live
+		if order.Amend(cmd.price, cmd.qty) != nil {
+			return nil
+		}
+		keepsPriority := order.Price == live.Price && order.remainingQty < live.remainingQty
+		queue := c.queue(order.Side)
+		trades := c.ob.ModifyOrder(order)
+		c.orders[id].qty = order.initialQty
+		if keepsPriority {
+			if len(trades) > 0 {
+				return fmt.Errorf("reducing order %d traded", id)
+			}
+			if after, _ := c.ob.GetOrder(id); after.seq != live.seq {
+				return fmt.Errorf("reducing order %d lost its time priority", id)
+			}
+			return nil
+		}
+		return c.checkIncoming(order, queue, trades)
+	default:
+		id := OrderId(len(c.ids) + 1)
+		order := createOrderWithId(id, cmd.orderType(), cmd.side, cmd.price, cmd.qty)
+		c.ids = append(c.ids, id)
+		c.orders[id] = &tracked{qty: cmd.qty}
+		queue := c.queue(cmd.side)
+		trades := c.ob.AddOrder(order)
+		return c.checkIncoming(order, queue, trades)
+	}
+}
+
+// queue lists the orders an incoming order on side can trade with, in priority order
+func (c *checker) queue(side Side) []resting {
+	levels := c.ob.Bids
+	if side == Buy {
+		levels = c.ob.Asks
+	}
+	queue := []resting{}
+	for _, price := range levels.Keys() {
+		for _, order := range levels.Values()[price] {
+			queue = append(queue, resting{id: order.orderId, price: price, qty: order.remainingQty})
+		}
+	}
+	return queue
+}
+
+// crosses reports whether an incoming order can trade with a resting order at price
+func crosses(order Order, price Price) bool {
+	switch {
+	case order.OrderType == Market:
+		return true
+	case order.Side == Buy:
+		return price <= order.Price
+	default:
+		return price >= order.Price
+	}
+}
+
+// checkIncoming checks the trades of an order matched on arrival against the opposite
+// side of the book as it was before: they must take the resting orders strictly in
+// price and time priority, only within the limit, filling as much as the book allows
+func (c *checker) checkIncoming(order Order, queue []resting, trades []Trade) error {
+	var available Quantity = 0
+	for _, r := range queue {
+		if crosses(order, r.price) {
+			available += r.qty
+		}
+	}
+	pos := 0
+	var filled Quantity = 0
+	for _, trade := range trades {
+		qty := trade.Qty()
+		if qty <= 0 || trade.BidTrade.Qty != trade.AskTrade.Qty {
+			return fmt.Errorf("trade %d exchanges %d against %d", trade.Id, trade.BidTrade.Qty, trade.AskTrade.Qty)
+		}
+		taker, maker := trade.BidTrade, trade.AskTrade
+		if order.Side == Sell {
+			taker, maker = maker, taker
+		}
+		if taker.OrderId != order.orderId {
+			return fmt.Errorf("trade %d does not involve incoming order %d", trade.Id, order.orderId)
+		}
+		if taker.Liquidity != Taker || maker.Liquidity != Maker {
+			return fmt.Errorf("trade %d flags incoming order %d as %v", trade.Id, order.orderId, taker.Liquidity)
+		}
+		if pos == len(queue) {
+			return fmt.Errorf("trade %d fills order %d which was not resting", trade.Id, maker.OrderId)
+		}
+		next := &queue[pos]
+		if maker.OrderId != next.id {
+			return fmt.Errorf("trade %d fills order %d ahead of order %d", trade.Id, maker.OrderId, next.id)
+		}
+		if !crosses(order, next.price) || trade.ExecPrice() != next.price {
+			return fmt.Errorf("trade %d executes at %v against order %d at %v with a limit of %v",
+				trade.Id, trade.ExecPrice(), next.id, next.price, order.Price)
+		}
+		if qty > next.qty {
+			return fmt.Errorf("trade %d fills %d of order %d with %d left", trade.Id, qty, next.id, next.qty)
+		}
+		next.qty -= qty
+		if next.qty == 0 {
+			pos++
+		}
+		filled += qty
+		c.orders[maker.OrderId].filled += qty
+	}
+	c.orders[order.orderId].filled += filled
+
+	expected := min(order.remainingQty, available)
+	if order.OrderType == FillOrKill && available < order.remainingQty {
+		expected = 0
+	}
+	if filled != expected {
+		return fmt.Errorf("incoming order %d filled %d of %d with %d available", order.orderId, filled, order.remainingQty, available)
+	}
+	_, rests := c.ob.GetOrder(order.orderId)
+	switch {
+	case order.OrderType == FillAndKill && rests:
+		return fmt.Errorf("fill and kill order %d rests", order.orderId)
+	case order.OrderType == FillOrKill && rests:
+		return fmt.Errorf("fill or kill order %d rests", order.orderId)
+	case !rests:
+		// Whatever did not trade was killed or rejected
+		c.orders[order.orderId].gone += order.remainingQty - filled
+	}
+	return nil
+}
+
+// checkBook checks that the book is not crossed, that both sides and the Orders index
+// agree, that each level is in time priority and that no quantity appeared or vanished
+func (c *checker) checkBook() error {
+	ob := c.ob
+	if !ob.Bids.IsEmpty() && !ob.Asks.IsEmpty() {
+		bid, _ := ob.Bids.FirstKey()
+		ask, _ := ob.Asks.FirstKey()
+		if bid >= ask {
+			return fmt.Errorf("book crossed with a bid at %v and an ask at %v", bid, ask)
+		}
+	}
+	seen := make(map[OrderId]bool)
+	for _, side := range []Side{Buy, Sell} {
+		levels := ob.Asks
+		if side == Buy {
+			levels = ob.Bids
+		}
+		keys, values := levels.Keys(), levels.Values()
+		if len(keys) != len(values) {
+			return fmt.Errorf("%v side has %d prices for %d levels", side, len(keys), len(values))
+		}
+		var total Quantity
+		for _, orders := range values {
+			for _, order := range orders {
+				total += order.remainingQty
+			}
+		}
+		if levels.TotalQty() != total {
+			return fmt.Errorf("%v side totals %d for %d resting", side, levels.TotalQty(), total)
+		}
+		for i, price := range keys {
+			if i > 0 && (side == Buy && price >= keys[i-1] || side == Sell && price <= keys[i-1]) {
+				return fmt.Errorf("%v level %v is out of order after %v", side, price, keys[i-1])
+			}
+			orders, ok := values[price]
+			if !ok || len(orders) == 0 {
+				return fmt.Errorf("%v level %v is empty", side, price)
+			}
+			for j, order := range orders {
+				id := order.orderId
+				switch {
+				case order.Price != price || order.Side != side:
+					return fmt.Errorf("order %d to %v at %v rests on the %v level %v", id, order.Side, order.Price, side, price)
+				case order.remainingQty <= 0:
+					return fmt.Errorf("order %d rests with %d remaining", id, order.remainingQty)
+				case order.OrderType != GoodTilCancelled:
+					return fmt.Errorf("%v order %d rests", order.OrderType, id)
+				case j > 0 && order.seq <= orders[j-1].seq:
+					return fmt.Errorf("order %d rests behind the later order %d at %v", orders[j-1].orderId, id, price)
+				case seen[id]:
+					return fmt.Errorf("order %d rests twice", id)
+				}
+				seen[id] = true
+				if c.orders[id] == nil {
+					return fmt.Errorf("order %d rests after leaving the book", id)
+				}
+				indexed, ok := ob.Orders[id]
+				if !ok {
+					return fmt.Errorf("order %d rests but is not in the index", id)
+				}
+				if indexed.Side != side || indexed.Price != price || indexed.seq != order.seq {
+					return fmt.Errorf("index has order %d to %v at %v, the book to %v at %v", id, indexed.Side, indexed.Price, side, price)
+				}
+			}
+		}
+	}
+	if len(seen) != len(ob.Orders) {
+		return fmt.Errorf("index has %d orders, the book %d", len(ob.Orders), len(seen))
+	}
+	for id, tr := range c.orders {
+		var remaining Quantity = 0
+		live, ok := ob.GetOrder(id)
+		if ok {
+			remaining = live.remainingQty
+			if live.GetFilledQty() != tr.filled || live.initialQty != tr.qty {
+				return fmt.Errorf("order %d rests with %d of %d filled, traded %d of %d",
+					id, live.GetFilledQty(), live.initialQty, tr.filled, tr.qty)
+			}
+		}
+		if tr.filled+remaining+tr.gone != tr.qty {
+			return fmt.Errorf("order %d of %d has %d filled, %d resting and %d cancelled",
+				id, tr.qty, tr.filled, remaining, tr.gone)
+		}
+		if !ok {
+			delete(c.orders, id)
+		}
+	}
+	return nil
+}
+
+// minimizeCommands shrinks a sequence while fails holds for it, dropping runs of commands
+// from the longest down to single ones and then lowering quantities
+func minimizeCommands(data []byte, fails func(commands []command) bool) []byte {
+	data = data[:len(data)/commandSize*commandSize]
+	for chunk := len(data) / commandSize / 2; chunk >= 1; chunk /= 2 {
+		size := chunk * commandSize
+		for start := 0; start+size <= len(data); {
+			candidate := append(append([]byte{}, data[:start]...), data[start+size:]...)
+			if fails(decodeCommands(candidate)) {
+				data = candidate
+			} else {
+				start += size
+			}
+		}
+	}
+	for i := 2; i < len(data); i += commandSize {
+		for data[i]%maxQty > 1 {
+			candidate := append([]byte{}, data...)
+			candidate[i] = data[i]%maxQty - 1
+			if !fails(decodeCommands(candidate)) {
+				break
+			}
+			data = candidate
+		}
+	}
+	return data
+}
+
+// writeReproducer saves a failing sequence to the seed corpus of FuzzOrderBook, where
+// go test replays it from then on
+func writeReproducer(t *testing.T, name string, data []byte) string {
+	dir := filepath.Join("testdata", "fuzz", "FuzzOrderBook")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	path := filepath.Join(dir, name)
+	content := "go test fuzz v1\n[]byte(" + strconv.Quote(string(data)) + ")\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func FuzzOrderBook(f *testing.F) {
+	// A resting bid and ask, an ask taking the bid, a partial FAK, a FOK and a market order
+	f.Add([]byte{0, 5, 10, 0, 10, 7, 10, 0, 10, 4, 4, 0, 15, 6, 12, 0, 16, 6, 3, 0, 7, 0, 5, 0})
+	// Orders queueing at one price, cancelled and modified out of and within their priority
+	f.Add([]byte{0, 5, 3, 0, 0, 5, 4, 0, 0, 5, 5, 0, 8, 0, 0, 0, 9, 5, 2, 1, 9, 6, 9, 2, 10, 5, 15, 0})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) > maxFuzzCommands*commandSize {
+			t.Skip()
+		}
+		if err := runCommands(decodeCommands(data)); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestOrderbook_Invariants(t *testing.T) {
+	sequences, length := 500, 200
+	if testing.Short() {
+		sequences = 50
+	}
+	for seed := 1; seed <= sequences; seed++ {
+		rng := rand.New(rand.NewSource(int64(seed)))
+		data := make([]byte, length*commandSize)
+		rng.Read(data)
+		if err := runCommands(decodeCommands(data)); err != nil {
+			data = minimizeCommands(data, func(commands []command) bool {
+				return runCommands(commands) != nil
+			})
+			path := writeReproducer(t, fmt.Sprintf("seed-%d", seed), data)
+			commands := decodeCommands(data)
+			t.Fatalf("seed %d: %v\nminimized to %d commands in %s:\n%v", seed, runCommands(commands), len(commands), path, commands)
+		}
+	}
+}
+
+func TestMinimizeCommands(t *testing.T) {
+	data := []byte{
+		0, 0, 9, 0, // bid 95 x 9
+		0, 5, 7, 0, // bid 100 x 7
+		8, 0, 0, 0, // cancel
+		10, 10, 4, 0, // ask 105 x 4
+		10, 4, 12, 0, // ask 99 x 12
+		0, 2, 3, 0, // bid 97 x 3
+	}
+	// Fails whenever an order trades
+	trades := func(commands []command) bool {
+		ob := NewOrderBook()
+		for i, cmd := range commands {
+			if cmd.op != opCancel && len(ob.AddOrder(createOrderWithId(OrderId(i+1), cmd.orderType(), cmd.side, cmd.price, cmd.qty))) > 0 {
+				return true
+			}
+		}
+		return false
+	}
+	require.True(t, trades(decodeCommands(data)))
+	minimized := decodeCommands(minimizeCommands(data, trades))
+	require.Equal(t, []command{
+		{op: opLimit, side: Buy, price: 100, qty: 1},
+		{op: opLimit, side: Sell, price: 99, qty: 1},
+	}, minimized)
+}
@@ -0,0 +1,63 @@
+package orderbook
+
+// BookListener is told about every change to the orders displayed in a book, in the order
+// the changes happen. An incoming order is only displayed once it rests, the executions it
+// takes while matching on arrival are reported through OrderTraded instead
+type BookListener interface {
+	// OrderAdded reports an order resting in the book with its remaining quantity
+	OrderAdded(order Order)
+	// OrderExecuted reports a fill of a displayed order at the given price
+	OrderExecuted(order Order, qty Quantity, price Price, tradeId TradeId)
+	// OrderTraded reports a fill of an incoming order that was not displayed yet
+	OrderTraded(order Order, qty Quantity, price Price, tradeId TradeId)
+	// OrderCancelled reports a reduction in the quantity of an order that keeps resting
+	OrderCancelled(order Order, qty Quantity)
+	// OrderDeleted reports an order leaving the book without being filled
+	OrderDeleted(order Order)
+	// OrderReplaced reports a modified order taking the place of old in the book
+	OrderReplaced(old Order, order Order)
+}
+
+// AddListener registers l to be notified of every change to the book. l is first told of
+// the orders already resting, such as those of a restored snapshot, as added oldest first
+func (ob *OrderBook) AddListener(l BookListener) {
+	for _, order := range ob.resting() {
+		l.OrderAdded(order)
+	}
+	ob.listeners = append(ob.listeners, l)
+}
+
+// notifyFill reports one side of a trade, as an execution when the order was displayed
+func (ob *OrderBook) notifyFill(order *Order, trade Trade) {
+	for _, l := range ob.listeners {
+		if ob.incoming != nil && order.orderId == ob.incoming.orderId {
+			l.OrderTraded(*order, trade.Qty(), trade.ExecPrice(), trade.Id)
+		} else {
+			l.OrderExecuted(*order, trade.Qty(), trade.ExecPrice(), trade.Id)
+		}
+	}
+}
+
+// notifyRested reports an incoming order once matching is over, as a new order, as the
+// replacement of the order it modifies or as the removal of that order if nothing rests
+func (ob *OrderBook) notifyRested(orderId OrderId) {
+	order, resting := ob.GetOrder(orderId)
+	replacing := ob.replacing
+	ob.replacing = nil
+	for _, l := range ob.listeners {
+		switch {
+		case resting && replacing != nil:
+			l.OrderReplaced(*replacing, order)
+		case resting:
+			l.OrderAdded(order)
+		case replacing != nil:
+			l.OrderDeleted(*replacing)
+		}
+	}
+}
+
+// silent reports whether a cancel of orderId happens before the order was ever displayed
+func (ob *OrderBook) silent(orderId OrderId) bool {
+	return (ob.incoming != nil && ob.incoming.orderId == orderId) ||
+		(ob.replacing != nil && ob.replacing.orderId == orderId)
+}
@@ -0,0 +1,34 @@
+package orderbook
+
+import (
+	"github.com/EliasManj/orderbook/metrics"
+)
+
+// Outcomes of adding and cancelling orders, used as metric labels
+const (
+	OutcomeRejected  = "rejected"
+	OutcomeResting   = "resting"
+	OutcomePartial   = "partial"
+	OutcomeFilled    = "filled"
+	OutcomeCancelled = "cancelled"
+	OutcomeNotFound  = "not_found"
+)
+
+var (
+	ordersTotal   = metrics.NewCounterVec("orderbook_orders_total", "Orders added to the book by type, side and outcome.", "type", "side", "outcome")
+	cancelsTotal  = metrics.NewCounterVec("orderbook_cancels_total", "Cancel requests by outcome.", "outcome")
+	tradesTotal   = metrics.NewCounterVec("orderbook_trades_total", "Trades executed.", "symbol")
+	tradedVolume  = metrics.NewCounterVec("orderbook_traded_volume_total", "Quantity traded.", "symbol")
+	bookDepth     = metrics.NewGaugeVec("orderbook_depth", "Resting quantity per side of the book.", "symbol", "side")
+	bookLevels    = metrics.NewGaugeVec("orderbook_levels", "Price levels per side of the book.", "symbol", "side")
+	matchDuration = metrics.NewHistogramVec("orderbook_match_duration_seconds", "Time spent matching orders.", metrics.LatencyBuckets)
+)
+
+// updateDepthMetrics sets the depth gauges from the running totals of each side, without
+// walking the book
+func (ob *OrderBook) updateDepthMetrics() {
+	bookDepth.Set(float64(ob.Bids.TotalQty()), ob.Symbol, Buy.String())
+	bookDepth.Set(float64(ob.Asks.TotalQty()), ob.Symbol, Sell.String())
+	bookLevels.Set(float64(len(ob.Bids.Keys())), ob.Symbol, Buy.String())
+	bookLevels.Set(float64(len(ob.Asks.Keys())), ob.Symbol, Sell.String())
+}
@@ -2,6 +2,9 @@ package orderbook
 
 import (
 	"errors"
+	"math"
+	"sort"
+	"time"
 )
 
 // Enumerations and types
@@ -10,6 +13,7 @@ type Side int
 type Quantity int32
 type Price float64
 type OrderId int
+type TradeId int64
 
 const (
 	GoodTilCancelled orderType = iota
@@ -73,6 +77,8 @@ type Order struct {
 	Price        Price
 	initialQty   Quantity
 	remainingQty Quantity
+	Account      string
+	seq          uint64
 }
 
 func (o *Order) GetOrderId() OrderId {
@@ -98,10 +104,35 @@ func NewOrder(otype string, side string, price float64, qty int) *Order {
 	}
 }
 
+// NewOrderWithId creates an order with a given id, used to replay orders recorded elsewhere
+func NewOrderWithId(id OrderId, otype string, side string, price float64, qty int) *Order {
+	order := NewOrder(otype, side, price, qty)
+	if order != nil {
+		order.orderId = id
+	}
+	return order
+}
+
 func (o *Order) GetInitialQty() Quantity {
 	return o.initialQty
 }
 
+func (o *Order) GetRemainingQty() Quantity {
+	return o.remainingQty
+}
+
+// Amend changes the price and total quantity of an order keeping its id and filled quantity
+func (o *Order) Amend(price Price, qty Quantity) error {
+	filled := o.GetFilledQty()
+	if qty <= filled {
+		return errors.New("cannot amend quantity to less than the filled quantity")
+	}
+	o.Price = price
+	o.initialQty = qty
+	o.remainingQty = qty - filled
+	return nil
+}
+
 func (o *Order) GetFilledQty() Quantity {
 	return o.initialQty - o.remainingQty
 }
@@ -119,32 +150,108 @@ func (o *Order) IsFilled() bool {
 }
 
 type TradeInfo struct {
-	OrderId OrderId
-	Price   Price
-	Qty     Quantity
+	OrderId   OrderId
+	Price     Price
+	Qty       Quantity
+	Account   string
+	Liquidity Liquidity
+	Fee       float64
 }
 
 type Trade struct {
-	BidTrade TradeInfo
-	AskTrade TradeInfo
+	Id        TradeId
+	Timestamp time.Time
+	BidTrade  TradeInfo
+	AskTrade  TradeInfo
+}
+
+// ExecPrice returns the price the trade executed at, the price of the resting order
+func (t Trade) ExecPrice() Price {
+	if t.BidTrade.Liquidity == Maker {
+		return t.BidTrade.Price
+	}
+	return t.AskTrade.Price
+}
+
+// Qty returns the quantity exchanged in the trade
+func (t Trade) Qty() Quantity {
+	return t.BidTrade.Qty
 }
 
-var Trades = []Trade{}
-var Orders = []Trade{}
+// VisibleTo returns the trade as the owner of account may see it, without the account and
+// fee of the orders of others. VisibleTo("") is the trade as the public feeds publish it
+func (t Trade) VisibleTo(account string) Trade {
+	if account == "" || t.BidTrade.Account != account {
+		t.BidTrade.Account, t.BidTrade.Fee = "", 0
+	}
+	if account == "" || t.AskTrade.Account != account {
+		t.AskTrade.Account, t.AskTrade.Fee = "", 0
+	}
+	return t
+}
+
+// DefaultSymbol is the symbol of an OrderBook created by NewOrderBook
+const DefaultSymbol = "DEFAULT"
 
 // Order definition end
 type OrderBook struct {
-	Bids   *OrderedMap
-	Asks   *OrderedMap
-	Orders map[OrderId]Order
+	Symbol      string
+	Bids        *OrderedMap
+	Asks        *OrderedMap
+	Orders      map[OrderId]Order
+	Fees        *FeeLedger
+	Clock       func() time.Time
+	nextSeq     uint64
+	lastTradeId TradeId
+	stats       tradeStats
+	listeners   []BookListener
+	// incoming is the order being matched on arrival, replacing the order it modifies
+	incoming  *Order
+	replacing *Order
+	// lastOutcome and lastReason are what became of the last order added or modified
+	lastOutcome string
+	lastReason  string
+	// TickSize and LotSize are the increments of prices and quantities, any when 0
+	TickSize Price
+	LotSize  Quantity
+	// Events receives the events of every command when set
+	Events   *EventBus
+	eventSeq uint64
+	// depth counts the commands in progress, pending holds their events and touched the
+	// quantity of the levels they changed as it was before
+	depth        int
+	pending      []Event
+	touched      map[levelKey]Quantity
+	touchedOrder []levelKey
 }
 
 // NewOrderBook creates a new OrderBook with Bids in ascending order and Asks in descending order
 func NewOrderBook() *OrderBook {
 	return &OrderBook{
+		Symbol: DefaultSymbol,
 		Bids:   NewOrderedMap(Descending),
 		Asks:   NewOrderedMap(Ascending),
 		Orders: make(map[OrderId]Order),
+		Fees:   NewFeeLedger(ZeroFeeSchedule),
+		Clock:  time.Now,
+	}
+}
+
+// LastOutcome returns what became of the last order added, or of the new version of the
+// last order modified: one of the Outcome constants, with the reason when it was rejected
+func (ob *OrderBook) LastOutcome() (outcome string, reason string) {
+	return ob.lastOutcome, ob.lastReason
+}
+
+// LastTradeId returns the id given to the most recent trade
+func (ob *OrderBook) LastTradeId() TradeId {
+	return ob.lastTradeId
+}
+
+// ResumeTradeIds makes the next trade id follow last, used when restoring from history
+func (ob *OrderBook) ResumeTradeIds(last TradeId) {
+	if last > ob.lastTradeId {
+		ob.lastTradeId = last
 	}
 }
 
@@ -181,25 +288,32 @@ func (ob *OrderBook) GetTotalQty(side Side, price Price) Quantity {
 	return sum
 }
 
+// CanMatchCompletely reports whether the opposite side holds at least quantity over all
+// the levels within the limit price
 func (ob *OrderBook) CanMatchCompletely(side Side, price Price, quantity Quantity) bool {
+	levels := ob.Bids
 	if side == Buy {
-		if len(ob.Asks.Keys()) == 0 {
-			return false
+		levels = ob.Asks
+	}
+	var available Quantity = 0
+	for _, level := range levels.Keys() {
+		if side == Buy && level > price || side == Sell && level < price {
+			break
 		}
-		bestAskPrice, _ := ob.Asks.FirstKey()
-		maxQty := ob.GetTotalQty(Sell, price)
-		return price >= bestAskPrice && quantity <= maxQty
-	} else {
-		if len(ob.Bids.Keys()) == 0 {
-			return false
+		for _, order := range levels.Values()[level] {
+			available += order.remainingQty
+		}
+		if available >= quantity {
+			return true
 		}
-		bestBidPrice, _ := ob.Bids.FirstKey()
-		maxQty := ob.GetTotalQty(Buy, price)
-		return price <= bestBidPrice && quantity <= maxQty
 	}
+	return false
 }
 
 func (ob *OrderBook) MatchOrders() []Trade {
+	defer matchDuration.ObserveSince(time.Now())
+	ob.begin()
+	defer ob.end()
 	trades := []Trade{}
 	for {
 		if ob.Bids.IsEmpty() || ob.Asks.IsEmpty() {
@@ -214,8 +328,12 @@ func (ob *OrderBook) MatchOrders() []Trade {
 			bid := &bids[0]
 			ask := &asks[0]
 			quantity := min(bid.remainingQty, ask.remainingQty)
+			ob.touch(Buy, bidPrice)
+			ob.touch(Sell, askPrice)
 			bid.Fill(quantity)
 			ask.Fill(quantity)
+			ob.Bids.reduce(quantity)
+			ob.Asks.reduce(quantity)
 			if bid.IsFilled() {
 				ob.Bids.Values()[bidPrice] = ob.Bids.Values()[bidPrice][1:]
 				bids = bids[1:]
@@ -232,18 +350,13 @@ func (ob *OrderBook) MatchOrders() []Trade {
 			if len(ob.Asks.Values()[askPrice]) == 0 {
 				ob.Asks.Delete(askPrice)
 			}
-			trades = append(trades, Trade{
-				BidTrade: TradeInfo{
-					OrderId: bid.orderId,
-					Price:   bid.Price,
-					Qty:     quantity,
-				},
-				AskTrade: TradeInfo{
-					OrderId: ask.orderId,
-					Price:   ask.Price,
-					Qty:     quantity,
-				},
-			})
+			trade := ob.newTrade(bid, ask, quantity)
+			ob.notifyFill(bid, trade)
+			ob.notifyFill(ask, trade)
+			ob.emit(Event{Type: EventTrade, Trade: &trade})
+			ob.emit(Event{Type: EventOrderFilled, Order: *bid, Qty: quantity, Price: trade.ExecPrice()})
+			ob.emit(Event{Type: EventOrderFilled, Order: *ask, Qty: quantity, Price: trade.ExecPrice()})
+			trades = append(trades, trade)
 		}
 	}
 	if !ob.Bids.IsEmpty() {
@@ -263,9 +376,63 @@ func (ob *OrderBook) MatchOrders() []Trade {
 	return trades
 }
 
+// newTrade builds the trade between a bid and an ask, flagging the older order as the maker
+// and charging both accounts their fees on the notional at the maker's price
+func (ob *OrderBook) newTrade(bid *Order, ask *Order, quantity Quantity) Trade {
+	bidLiquidity, askLiquidity := Taker, Maker
+	execPrice := ask.Price
+	if bid.seq < ask.seq {
+		bidLiquidity, askLiquidity = Maker, Taker
+		execPrice = bid.Price
+	}
+	notional := float64(execPrice) * float64(quantity)
+	now := ob.Clock()
+	ob.lastTradeId++
+	ob.stats.add(statsTrade{time: now, price: execPrice, qty: quantity})
+	ob.stats.expire(now)
+	return Trade{
+		Id:        ob.lastTradeId,
+		Timestamp: now,
+		BidTrade: TradeInfo{
+			OrderId:   bid.orderId,
+			Price:     bid.Price,
+			Qty:       quantity,
+			Account:   bid.Account,
+			Liquidity: bidLiquidity,
+			Fee:       ob.Fees.Charge(bid.Account, bidLiquidity, notional),
+		},
+		AskTrade: TradeInfo{
+			OrderId:   ask.orderId,
+			Price:     ask.Price,
+			Qty:       quantity,
+			Account:   ask.Account,
+			Liquidity: askLiquidity,
+			Fee:       ob.Fees.Charge(ask.Account, askLiquidity, notional),
+		},
+	}
+}
+
 func (ob *OrderBook) AddOrder(order Order) []Trade {
+	ob.begin()
+	defer ob.end()
+	ob.lastReason = ""
+	trades, outcome := ob.addOrder(order)
+	ob.lastOutcome = outcome
+	ordersTotal.Inc(order.OrderType.String(), order.Side.String(), outcome)
+	for _, trade := range trades {
+		tradesTotal.Inc(ob.Symbol)
+		tradedVolume.Add(float64(trade.Qty()), ob.Symbol)
+	}
+	ob.updateDepthMetrics()
+	return trades
+}
+
+func (ob *OrderBook) addOrder(order Order) ([]Trade, string) {
 	if ob.Orders[order.orderId] != (Order{}) {
-		return nil
+		return ob.reject(order, RejectDuplicateId)
+	}
+	if reason := ob.Check(order); reason != "" {
+		return ob.reject(order, reason)
 	}
 	if order.OrderType == Market {
 		if order.Side == Buy && !ob.Asks.IsEmpty() {
@@ -277,39 +444,229 @@ func (ob *OrderBook) AddOrder(order Order) []Trade {
 			order.Price = worstBidPrice
 			order.OrderType = GoodTilCancelled
 		} else {
-			return nil
+			return ob.reject(order, RejectNoLiquidity)
 		}
 	}
 	if order.OrderType == FillAndKill && !ob.CanMatch(order.Side, order.Price) {
-		return nil
+		return ob.reject(order, RejectCannotMatch)
 	}
 	if order.OrderType == FillOrKill && !ob.CanMatchCompletely(order.Side, order.Price, order.initialQty) {
-		return nil
+		return ob.reject(order, RejectCannotFillUp)
+	}
+	ob.nextSeq++
+	order.seq = ob.nextSeq
+	if ob.replacing != nil && ob.replacing.orderId == order.orderId {
+		ob.emit(Event{Type: EventOrderReplaced, Order: order, Old: *ob.replacing})
+	} else {
+		ob.emit(Event{Type: EventOrderAccepted, Order: order})
 	}
+	ob.touch(order.Side, order.Price)
 	if order.Side == Buy {
 		ob.Bids.Add(order.Price, order)
 	} else {
 		ob.Asks.Add(order.Price, order)
 	}
 	ob.Orders[order.orderId] = order
-	return ob.MatchOrders()
+	ob.incoming = &order
+	trades := ob.MatchOrders()
+	ob.incoming = nil
+	ob.notifyRested(order.orderId)
+	var filled Quantity = 0
+	for _, trade := range trades {
+		if trade.BidTrade.OrderId == order.orderId || trade.AskTrade.OrderId == order.orderId {
+			filled += trade.Qty()
+		}
+	}
+	switch {
+	case filled == 0:
+		return trades, OutcomeResting
+	case filled < order.initialQty:
+		return trades, OutcomePartial
+	default:
+		return trades, OutcomeFilled
+	}
+}
+
+// onTick reports whether price is a multiple of the tick size, allowing for the rounding
+// of float prices
+func (ob *OrderBook) onTick(price Price) bool {
+	if ob.TickSize <= 0 {
+		return true
+	}
+	ticks := float64(price / ob.TickSize)
+	return price > 0 && math.Abs(ticks-math.Round(ticks)) < 1e-6
+}
+
+// reject refuses an order that never reaches the book
+func (ob *OrderBook) reject(order Order, reason string) ([]Trade, string) {
+	ob.lastReason = reason
+	ob.emit(Event{Type: EventOrderRejected, Order: order, Reason: reason})
+	return nil, OutcomeRejected
 }
 
 func (ob *OrderBook) CancelOrder(orderId OrderId) {
 	order := ob.Orders[orderId]
 	if order == (Order{}) {
+		cancelsTotal.Inc(OutcomeNotFound)
 		return
 	}
+	ob.begin()
+	defer ob.end()
+	live, _ := ob.GetOrder(orderId)
+	if !ob.silent(orderId) {
+		for _, l := range ob.listeners {
+			l.OrderDeleted(live)
+		}
+	}
+	if ob.replacing == nil || ob.replacing.orderId != orderId {
+		ob.emit(Event{Type: EventOrderCancelled, Order: live})
+	}
+	ob.touch(order.Side, order.Price)
 	if order.Side == Buy {
 		ob.Bids.DeleteOrder(order)
 	} else {
 		ob.Asks.DeleteOrder(order)
 	}
+	delete(ob.Orders, orderId)
+	cancelsTotal.Inc(OutcomeCancelled)
+	ob.updateDepthMetrics()
+}
+
+// CancelOrders cancels every resting order matching match, in the order they arrived, and
+// returns them as they were before the cancel
+func (ob *OrderBook) CancelOrders(match func(Order) bool) []Order {
+	cancelled := []Order{}
+	for id := range ob.Orders {
+		if order, ok := ob.GetOrder(id); ok && match(order) {
+			cancelled = append(cancelled, order)
+		}
+	}
+	sortBySeq(cancelled)
+	for _, order := range cancelled {
+		ob.CancelOrder(order.orderId)
+	}
+	return cancelled
+}
+
+// sortBySeq sorts orders in the order they arrived
+func sortBySeq(orders []Order) {
+	sort.Slice(orders, func(i, j int) bool { return orders[i].seq < orders[j].seq })
+}
+
+// Check returns why the book rejects order whatever rests in it: a quantity that is not
+// positive or not a multiple of the lot size, or a price off the tick size. It is empty
+// when the order passes
+func (ob *OrderBook) Check(order Order) string {
+	switch {
+	case order.remainingQty <= 0:
+		return RejectQuantity
+	case ob.LotSize > 0 && order.initialQty%ob.LotSize != 0:
+		return RejectLotSize
+	case order.OrderType != Market && !ob.onTick(order.Price):
+		return RejectTickSize
+	}
+	return ""
 }
 
-func (ob *OrderBook) ModifyOrder(order Order) {
+// ModifyOrder replaces a resting order. Reducing the quantity at the same price keeps
+// the time priority of the order, any other change makes the new version lose it. A new
+// version that fails Check is rejected and leaves the resting order as it was
+func (ob *OrderBook) ModifyOrder(order Order) []Trade {
+	old, exists := ob.GetOrder(order.orderId)
+	if !exists {
+		return ob.AddOrder(order)
+	}
+	ob.begin()
+	defer ob.end()
+	if reason := ob.Check(order); reason != "" {
+		ob.reject(order, reason)
+		ob.lastOutcome = OutcomeRejected
+		ordersTotal.Inc(order.OrderType.String(), order.Side.String(), OutcomeRejected)
+		return nil
+	}
+	if order.Side == old.Side && order.Price == old.Price && order.remainingQty < old.remainingQty {
+		ob.reduceOrder(order)
+		for _, l := range ob.listeners {
+			l.OrderCancelled(order, old.remainingQty-order.remainingQty)
+		}
+		reduced, _ := ob.GetOrder(order.orderId)
+		ob.emit(Event{Type: EventOrderReplaced, Order: reduced, Old: old})
+		ob.lastOutcome, ob.lastReason = OutcomeResting, ""
+		return nil
+	}
+	ob.replacing = &old
 	ob.CancelOrder(order.orderId)
-	ob.AddOrder(order)
+	trades := ob.AddOrder(order)
+	if ob.replacing != nil {
+		// The new version was rejected by a check that depends on the book, once the old
+		// one was gone
+		for _, l := range ob.listeners {
+			l.OrderDeleted(old)
+		}
+		ob.replacing = nil
+		ob.emit(Event{Type: EventOrderCancelled, Order: old})
+	}
+	return trades
+}
+
+// reduceOrder updates the quantities of a resting order in place
+func (ob *OrderBook) reduceOrder(order Order) {
+	levels := ob.Asks
+	if order.Side == Buy {
+		levels = ob.Bids
+	}
+	ob.touch(order.Side, order.Price)
+	orders, _ := levels.Get(order.Price)
+	for i := range orders {
+		if orders[i].orderId == order.orderId {
+			levels.reduce(orders[i].remainingQty - order.remainingQty)
+			orders[i].initialQty = order.initialQty
+			orders[i].remainingQty = order.remainingQty
+			ob.Orders[order.orderId] = orders[i]
+		}
+	}
+	ob.updateDepthMetrics()
+}
+
+// GetOrder returns a resting order with its current remaining quantity
+func (ob *OrderBook) GetOrder(orderId OrderId) (Order, bool) {
+	order, exists := ob.Orders[orderId]
+	if !exists {
+		return Order{}, false
+	}
+	levels := ob.Asks
+	if order.Side == Buy {
+		levels = ob.Bids
+	}
+	orders, _ := levels.Get(order.Price)
+	for _, o := range orders {
+		if o.orderId == orderId {
+			return o, true
+		}
+	}
+	return Order{}, false
+}
+
+// QueueAhead returns the quantity resting before a resting order at its price, which has
+// to trade before the order can be filled
+func (ob *OrderBook) QueueAhead(orderId OrderId) (Quantity, bool) {
+	order, exists := ob.Orders[orderId]
+	if !exists {
+		return 0, false
+	}
+	levels := ob.Asks
+	if order.Side == Buy {
+		levels = ob.Bids
+	}
+	orders, _ := levels.Get(order.Price)
+	var ahead Quantity = 0
+	for _, o := range orders {
+		if o.orderId == orderId {
+			return ahead, true
+		}
+		ahead += o.remainingQty
+	}
+	return 0, false
 }
 
 func (ob *OrderBook) Size() int {
@@ -340,3 +697,27 @@ func (ob *OrderBook) GetOrderInfos() OrderBookLevelInfos {
 		Asks: asks,
 	}
 }
+
+// Depth returns the total quantity at each price, best price first, limited to the
+// given number of levels per side. A limit of 0 returns every level
+func (ob *OrderBook) Depth(levels int) OrderBookLevelInfos {
+	return OrderBookLevelInfos{
+		Bids: depth(ob.Bids, levels),
+		Asks: depth(ob.Asks, levels),
+	}
+}
+
+func depth(side *OrderedMap, levels int) []LevelInfo {
+	infos := []LevelInfo{}
+	for _, price := range side.Keys() {
+		if levels > 0 && len(infos) == levels {
+			break
+		}
+		var qty Quantity = 0
+		for _, order := range side.Values()[price] {
+			qty += order.remainingQty
+		}
+		infos = append(infos, LevelInfo{Price: price, Quantity: qty})
+	}
+	return infos
+}
@@ -2,7 +2,10 @@ package orderbook
 
 import (
 	"bufio"
+	"flag"
+	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
@@ -10,61 +13,424 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func testOrderBookFromFile(t *testing.T, filename string) {
-	orderBook := createOrderBook(t)
+// Each scenario has a .golden file next to it holding every trade and the final book order
+// by order, so that any change in matching shows up even where nothing asserts it. Run
+// go test -run TestScenarios -update to rewrite them after an intended change
+var update = flag.Bool("update", false, "rewrite the .golden files of the scenarios in testcases")
 
-	file, err := os.Open(filename)
-	require.NoError(t, err)
-	defer file.Close()
+// Scenario files in testcases describe a session against one OrderBook, one command or
+// assertion per line. Blank lines and anything after a # are ignored
+//
+//	add <name> <side> <type> <price> <qty>  add an order, a Market order takes - as price
+//	cancel <name>                           cancel a resting order
+//	modify <name> <price> <qty>             change the price and total quantity of a resting order
+//	trade <bid> <ask> <price> <qty>         the next trade of the last command
+//	reject                                  the book refused the last add or modify
+//	depth bids|asks [<price>x<qty> ...]     every level of one side, best price first
+//	count <total> <bids> <asks>             resting orders and price levels on each side
+//
+// Every trade of a command has to be asserted before the next command. The original
+// A <side> <type> <price> <qty> and R <total> <bids> <asks> lines are still understood, an
+// A line adds an unnamed order whose trades are not checked
+type scenario struct {
+	file    string
+	line    int
+	ob      *OrderBook
+	ids     map[string]OrderId
+	names   map[OrderId]string
+	lastId  OrderId
+	trades  []Trade
+	pending []Trade
+	// rejected is whether the book refused the last add or modify
+	rejected bool
+}
 
-	scanner := bufio.NewScanner(file)
-	var expectedTotal, expectedBids, expectedAsks int
+func newScenario(file string) *scenario {
+	return &scenario{
+		file:  file,
+		ob:    NewOrderBook(),
+		ids:   make(map[string]OrderId),
+		names: make(map[OrderId]string),
+	}
+}
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		fields := strings.Fields(line)
+// runScenario executes a scenario file, failing the test at the first line that does
+// not hold
+func runScenario(t *testing.T, file string) *scenario {
+	f, err := os.Open(file)
+	require.NoError(t, err)
+	defer f.Close()
 
+	s := newScenario(file)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		s.line++
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(text)
 		if len(fields) == 0 {
 			continue
 		}
+		if err := s.exec(fields); err != nil {
+			t.Fatalf("%s:%d: %v", filepath.Base(file), s.line, err)
+		}
+	}
+	require.NoError(t, scanner.Err())
+	if err := s.checkAsserted(); err != nil {
+		t.Fatalf("%s: end of file: %v", filepath.Base(file), err)
+	}
+	return s
+}
 
-		switch fields[0] {
-		case "A":
-			side, err := StringToOrderSide(fields[1])
-			require.NoError(t, err)
-			orderType, err := StringToOrderType(fields[2])
-			require.NoError(t, err)
-			price, err := strconv.Atoi(fields[3])
-			require.NoError(t, err)
-			qty, err := strconv.Atoi(fields[4])
-			require.NoError(t, err)
-			order := CreateOrder(orderType, side, Price(price), Quantity(qty))
-			orderBook.AddOrder(order)
-		case "R":
-			expectedTotal, err = strconv.Atoi(fields[1])
-			require.NoError(t, err)
-			expectedBids, err = strconv.Atoi(fields[2])
-			require.NoError(t, err)
-			expectedAsks, err = strconv.Atoi(fields[3])
-			require.NoError(t, err)
-		default:
-			t.Fatalf("unknown line prefix: %s", fields[0])
+func (s *scenario) exec(fields []string) error {
+	command, args := fields[0], fields[1:]
+	switch command {
+	case "add", "cancel", "modify", "A":
+		if err := s.checkAsserted(); err != nil {
+			return err
+		}
+	}
+	switch command {
+	case "add":
+		if len(args) != 5 {
+			return fmt.Errorf("add takes a name, side, type, price and quantity, got %q", args)
+		}
+		return s.add(args[0], args[1:])
+	case "A":
+		if len(args) != 4 {
+			return fmt.Errorf("A takes a side, type, price and quantity, got %q", args)
+		}
+		err := s.add("", args)
+		s.pending = nil
+		return err
+	case "cancel":
+		if len(args) != 1 {
+			return fmt.Errorf("cancel takes a name, got %q", args)
+		}
+		id, err := s.resting(args[0])
+		if err != nil {
+			return err
+		}
+		s.ob.CancelOrder(id)
+		return nil
+	case "modify":
+		if len(args) != 3 {
+			return fmt.Errorf("modify takes a name, price and quantity, got %q", args)
+		}
+		return s.modify(args[0], args[1], args[2])
+	case "trade":
+		if len(args) != 4 {
+			return fmt.Errorf("trade takes a bid, ask, price and quantity, got %q", args)
+		}
+		return s.expectTrade(args)
+	case "reject":
+		if len(args) != 0 {
+			return fmt.Errorf("reject takes no arguments, got %q", args)
 		}
+		if !s.rejected {
+			return fmt.Errorf("last order was not rejected")
+		}
+		return nil
+	case "depth":
+		if len(args) == 0 {
+			return fmt.Errorf("depth takes a side and levels, got %q", args)
+		}
+		return s.expectDepth(args[0], args[1:])
+	case "count", "R":
+		if len(args) != 3 {
+			return fmt.Errorf("%s takes a total and the bid and ask levels, got %q", command, args)
+		}
+		return s.expectCount(args)
+	default:
+		return fmt.Errorf("unknown command %q", command)
 	}
+}
 
-	require.NoError(t, scanner.Err())
+// checkAsserted fails when trades of the last command were not asserted
+func (s *scenario) checkAsserted() error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+	unasserted := []string{}
+	for _, trade := range s.pending {
+		unasserted = append(unasserted, s.formatTrade(trade))
+	}
+	return fmt.Errorf("trades not asserted: %s", strings.Join(unasserted, ", "))
+}
+
+func (s *scenario) add(name string, args []string) error {
+	side, err := StringToOrderSide(args[0])
+	if err != nil {
+		return err
+	}
+	orderType, err := StringToOrderType(args[1])
+	if err != nil {
+		return err
+	}
+	var price Price = 0
+	if args[2] != "-" {
+		if price, err = parsePrice(args[2]); err != nil {
+			return err
+		}
+	}
+	qty, err := parseQuantity(args[3])
+	if err != nil {
+		return err
+	}
+	// Adding a name again reuses its id, which the book rejects while the order rests
+	id, named := s.ids[name]
+	if !named {
+		s.lastId++
+		id = s.lastId
+		if name != "" {
+			s.ids[name] = id
+			s.names[id] = name
+		}
+	}
+	s.apply(s.ob.AddOrder(createOrderWithId(id, orderType, side, price, qty)))
+	outcome, _ := s.ob.LastOutcome()
+	s.rejected = outcome == OutcomeRejected
+	return nil
+}
+
+func (s *scenario) modify(name string, priceArg string, qtyArg string) error {
+	id, err := s.resting(name)
+	if err != nil {
+		return err
+	}
+	price, err := parsePrice(priceArg)
+	if err != nil {
+		return err
+	}
+	qty, err := parseQuantity(qtyArg)
+	if err != nil {
+		return err
+	}
+	order, _ := s.ob.GetOrder(id)
+	if err := order.Amend(price, qty); err != nil {
+		return err
+	}
+	s.apply(s.ob.ModifyOrder(order))
+	outcome, _ := s.ob.LastOutcome()
+	s.rejected = outcome == OutcomeRejected
+	return nil
+}
 
-	actualTotal := len(orderBook.Orders)
-	actualBids := len(orderBook.Bids.Values())
-	actualAsks := len(orderBook.Asks.Values())
+// apply records the trades of a command for the assertions that follow
+func (s *scenario) apply(trades []Trade) {
+	s.trades = append(s.trades, trades...)
+	s.pending = trades
+}
 
-	require.Equal(t, expectedTotal, actualTotal, "Total orders mismatch")
-	require.Equal(t, expectedBids, actualBids, "Bid orders mismatch")
-	require.Equal(t, expectedAsks, actualAsks, "Ask orders mismatch")
+// resting returns the id of a named order that is in the book
+func (s *scenario) resting(name string) (OrderId, error) {
+	id, named := s.ids[name]
+	if !named {
+		return 0, fmt.Errorf("unknown order %q", name)
+	}
+	if _, ok := s.ob.GetOrder(id); !ok {
+		return 0, fmt.Errorf("order %q is not resting", name)
+	}
+	return id, nil
 }
 
-func TestCase1(t *testing.T) {
-	testOrderBookFromFile(t, "testcases/case1.txt")
-	testOrderBookFromFile(t, "testcases/case2.txt")
-	testOrderBookFromFile(t, "testcases/case3.txt")
+func (s *scenario) name(id OrderId) string {
+	if name, named := s.names[id]; named {
+		return name
+	}
+	return "#" + strconv.Itoa(int(id))
+}
+
+func (s *scenario) formatTrade(trade Trade) string {
+	return fmt.Sprintf("%s %s %v %d", s.name(trade.BidTrade.OrderId), s.name(trade.AskTrade.OrderId), trade.ExecPrice(), trade.Qty())
+}
+
+func (s *scenario) expectTrade(args []string) error {
+	price, err := parsePrice(args[2])
+	if err != nil {
+		return err
+	}
+	qty, err := parseQuantity(args[3])
+	if err != nil {
+		return err
+	}
+	want := fmt.Sprintf("%s %s %v %d", args[0], args[1], price, qty)
+	if len(s.pending) == 0 {
+		return fmt.Errorf("expected trade %s, no trade left", want)
+	}
+	trade := s.pending[0]
+	s.pending = s.pending[1:]
+	if got := s.formatTrade(trade); got != want {
+		return fmt.Errorf("expected trade %s, got %s", want, got)
+	}
+	return nil
+}
+
+func (s *scenario) expectDepth(sideArg string, args []string) error {
+	depth := s.ob.Depth(0)
+	var levels []LevelInfo
+	switch sideArg {
+	case "bids":
+		levels = depth.Bids
+	case "asks":
+		levels = depth.Asks
+	default:
+		return fmt.Errorf("depth side must be bids or asks, got %q", sideArg)
+	}
+	want := []string{}
+	for _, arg := range args {
+		priceArg, qtyArg, ok := strings.Cut(arg, "x")
+		if !ok {
+			return fmt.Errorf("depth level must be <price>x<qty>, got %q", arg)
+		}
+		price, err := parsePrice(priceArg)
+		if err != nil {
+			return err
+		}
+		qty, err := parseQuantity(qtyArg)
+		if err != nil {
+			return err
+		}
+		want = append(want, fmt.Sprintf("%vx%d", price, qty))
+	}
+	got := []string{}
+	for _, level := range levels {
+		got = append(got, fmt.Sprintf("%vx%d", level.Price, level.Quantity))
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		return fmt.Errorf("expected %s [%s], got [%s]", sideArg, strings.Join(want, " "), strings.Join(got, " "))
+	}
+	return nil
+}
+
+func (s *scenario) expectCount(args []string) error {
+	want := make([]int, len(args))
+	for i, arg := range args {
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return err
+		}
+		want[i] = n
+	}
+	got := []int{len(s.ob.Orders), len(s.ob.Bids.Values()), len(s.ob.Asks.Values())}
+	for i, what := range []string{"orders", "bid levels", "ask levels"} {
+		if got[i] != want[i] {
+			return fmt.Errorf("expected %d %s, got %d", want[i], what, got[i])
+		}
+	}
+	return nil
+}
+
+// golden writes out every trade and then the book order by order in priority, bids first
+func (s *scenario) golden() string {
+	var sb strings.Builder
+	for _, trade := range s.trades {
+		taker := "buy"
+		if trade.AskTrade.Liquidity == Taker {
+			taker = "sell"
+		}
+		fmt.Fprintf(&sb, "trade %d %s %s\n", trade.Id, s.formatTrade(trade), taker)
+	}
+	for _, side := range []Side{Buy, Sell} {
+		levels, label := s.ob.Bids, "bid"
+		if side == Sell {
+			levels, label = s.ob.Asks, "ask"
+		}
+		for _, price := range levels.Keys() {
+			for _, order := range levels.Values()[price] {
+				fmt.Fprintf(&sb, "%s %v %s %d/%d\n", label, price, s.name(order.orderId), order.remainingQty, order.initialQty)
+			}
+		}
+	}
+	return sb.String()
+}
+
+// checkGolden compares the outcome of a scenario with its .golden file, or rewrites the
+// file with -update
+func checkGolden(t *testing.T, s *scenario) {
+	path := strings.TrimSuffix(s.file, filepath.Ext(s.file)) + ".golden"
+	got := s.golden()
+	if *update {
+		require.NoError(t, os.WriteFile(path, []byte(got), 0644))
+		return
+	}
+	content, err := os.ReadFile(path)
+	require.NoError(t, err, "run go test -run TestScenarios -update to create it")
+	if diff := diffLines(string(content), got); diff != "" {
+		t.Fatalf("%s differs, run go test -run TestScenarios -update if the change is intended\n%s", filepath.Base(path), diff)
+	}
+}
+
+// diffLines lists the lines of want and got that differ, by line number
+func diffLines(want string, got string) string {
+	wantLines := strings.Split(strings.TrimSuffix(want, "\n"), "\n")
+	gotLines := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+	var sb strings.Builder
+	for i := 0; i < max(len(wantLines), len(gotLines)); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g {
+			fmt.Fprintf(&sb, "%d:\n-%s\n+%s\n", i+1, w, g)
+		}
+	}
+	return sb.String()
+}
+
+func parsePrice(s string) (Price, error) {
+	price, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid price %q", s)
+	}
+	return Price(price), nil
+}
+
+func parseQuantity(s string) (Quantity, error) {
+	qty, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid quantity %q", s)
+	}
+	return Quantity(qty), nil
+}
+
+func TestScenarios(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testcases", "*.txt"))
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+	for _, file := range files {
+		t.Run(strings.TrimSuffix(filepath.Base(file), ".txt"), func(t *testing.T) {
+			checkGolden(t, runScenario(t, file))
+		})
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	require.Empty(t, diffLines("a\nb\n", "a\nb\n"))
+	require.Equal(t, "2:\n-b\n+c\n3:\n-\n+d\n", diffLines("a\nb\n", "a\nc\nd\n"))
+}
+
+func TestScenario_Failures(t *testing.T) {
+	for _, tc := range []struct {
+		lines []string
+		err   string
+	}{
+		{[]string{"add a B GoodTilCancelled 100 10", "add b S GoodTilCancelled 100 4", "add c B GoodTilCancelled 99 1"}, "trades not asserted: a b 100 4"},
+		{[]string{"add a B GoodTilCancelled 100 10", "add b S GoodTilCancelled 100 4", "trade a b 100 5"}, "expected trade a b 100 5, got a b 100 4"},
+		{[]string{"add a B GoodTilCancelled 100 10", "reject"}, "last order was not rejected"},
+		{[]string{"add a B GoodTilCancelled 100 10", "depth bids 100x9"}, "expected bids [100x9], got [100x10]"},
+		{[]string{"cancel a"}, `unknown order "a"`},
+		{[]string{"frobnicate"}, `unknown command "frobnicate"`},
+	} {
+		s := newScenario("inline")
+		var err error
+		for _, line := range tc.lines {
+			if err = s.exec(strings.Fields(line)); err != nil {
+				break
+			}
+		}
+		require.EqualError(t, err, tc.err, "%q", tc.lines)
+	}
 }
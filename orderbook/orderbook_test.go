@@ -105,3 +105,163 @@ func TestOrderbook_BidAskMatch(t *testing.T) {
 	require.Equal(t, trades[0].BidTrade.OrderId, bid.orderId)
 	require.Equal(t, trades[0].AskTrade.OrderId, ask.orderId)
 }
+
+func TestOrderbook_CancelAndModify(t *testing.T) {
+	orderbook := createOrderBook(t)
+	bid := createOrderWithId(1, GoodTilCancelled, Buy, 100, 10)
+	ask := createOrderWithId(2, GoodTilCancelled, Sell, 105, 4)
+	orderbook.AddOrder(bid)
+	orderbook.AddOrder(ask)
+
+	// Lifting part of the bid leaves the remainder resting
+	trades := orderbook.AddOrder(createOrderWithId(3, GoodTilCancelled, Sell, 100, 3))
+	require.Len(t, trades, 1)
+	resting, ok := orderbook.GetOrder(bid.orderId)
+	require.True(t, ok)
+	require.Equal(t, Quantity(7), resting.GetRemainingQty())
+
+	require.NoError(t, resting.Amend(105, 8))
+	require.Error(t, resting.Amend(105, 3))
+	trades = orderbook.ModifyOrder(resting)
+	require.Len(t, trades, 1)
+	require.Equal(t, Quantity(4), trades[0].Qty())
+	modified, ok := orderbook.GetOrder(bid.orderId)
+	require.True(t, ok)
+	require.Equal(t, Price(105), modified.Price)
+	require.Equal(t, Quantity(1), modified.GetRemainingQty())
+
+	orderbook.CancelOrder(bid.orderId)
+	_, ok = orderbook.GetOrder(bid.orderId)
+	require.False(t, ok)
+	require.Equal(t, 0, orderbook.Size())
+	require.True(t, orderbook.Bids.IsEmpty())
+
+	// Reducing at the same price keeps the place in the queue
+	orderbook.AddOrder(createOrderWithId(10, GoodTilCancelled, Buy, 100, 5))
+	orderbook.AddOrder(createOrderWithId(11, GoodTilCancelled, Buy, 100, 5))
+	reduced, _ := orderbook.GetOrder(10)
+	require.NoError(t, reduced.Amend(100, 2))
+	require.Empty(t, orderbook.ModifyOrder(reduced))
+	trades = orderbook.AddOrder(createOrderWithId(12, GoodTilCancelled, Sell, 100, 1))
+	require.Len(t, trades, 1)
+	require.Equal(t, OrderId(10), trades[0].BidTrade.OrderId)
+	require.Equal(t, Quantity(6), orderbook.Bids.TotalQty())
+
+	orderbook.AddOrder(createOrderWithId(13, GoodTilCancelled, Buy, 99, 3))
+	orderbook.AddOrder(createOrderWithId(14, GoodTilCancelled, Buy, 98, 3))
+	require.Equal(t, []LevelInfo{{Price: 100, Quantity: 6}, {Price: 99, Quantity: 3}}, orderbook.Depth(2).Bids)
+	orderbook.AddOrder(createOrderWithId(15, GoodTilCancelled, Sell, 102, 2))
+	orderbook.AddOrder(createOrderWithId(16, GoodTilCancelled, Sell, 101, 2))
+	orderbook.AddOrder(createOrderWithId(17, GoodTilCancelled, Sell, 101, 1))
+	require.Equal(t, []LevelInfo{{Price: 101, Quantity: 3}, {Price: 102, Quantity: 2}}, orderbook.Depth(0).Asks)
+
+	ahead, ok := orderbook.QueueAhead(17)
+	require.True(t, ok)
+	require.Equal(t, Quantity(2), ahead)
+	ahead, _ = orderbook.QueueAhead(16)
+	require.Equal(t, Quantity(0), ahead)
+	_, ok = orderbook.QueueAhead(12)
+	require.False(t, ok)
+}
+
+func TestOrderbook_CancelOrders(t *testing.T) {
+	orderbook := createOrderBook(t)
+	for i, account := range []string{"alice", "bob", "alice", "alice"} {
+		order := createOrderWithId(OrderId(i+1), GoodTilCancelled, Side(i%2), Price(100+i%2*50+i), 5)
+		order.Account = account
+		orderbook.AddOrder(order)
+	}
+	cancelled := orderbook.CancelOrders(func(o Order) bool { return o.Account == "alice" && o.Side == Buy })
+	require.Len(t, cancelled, 2)
+	require.Equal(t, OrderId(1), cancelled[0].GetOrderId())
+	require.Equal(t, OrderId(3), cancelled[1].GetOrderId())
+	require.Equal(t, 2, orderbook.Size())
+	require.Empty(t, orderbook.CancelOrders(func(o Order) bool { return o.Account == "carol" }))
+}
+
+func TestOrderbook_FillOrKillAcrossLevels(t *testing.T) {
+	orderbook := createOrderBook(t)
+	require.Empty(t, orderbook.AddOrder(createOrderWithId(1, GoodTilCancelled, Sell, 100, 3)))
+	require.Empty(t, orderbook.AddOrder(createOrderWithId(2, GoodTilCancelled, Sell, 101, 3)))
+	require.False(t, orderbook.CanMatchCompletely(Buy, 101, 7), "6 available up to 101")
+	require.True(t, orderbook.CanMatchCompletely(Buy, 100.5, 3), "the limit need not be a level")
+	require.False(t, orderbook.CanMatchCompletely(Sell, 99, 1), "no bids")
+
+	// The quantity of every level up to the limit counts, not only the level at the limit
+	require.Empty(t, orderbook.AddOrder(createOrderWithId(3, FillOrKill, Buy, 101, 7)))
+	outcome, reason := orderbook.LastOutcome()
+	require.Equal(t, OutcomeRejected, outcome)
+	require.Equal(t, RejectCannotFillUp, reason)
+	require.Equal(t, 2, orderbook.Size())
+	trades := orderbook.AddOrder(createOrderWithId(4, FillOrKill, Buy, 101, 5))
+	require.Len(t, trades, 2)
+	outcome, _ = orderbook.LastOutcome()
+	require.Equal(t, OutcomeFilled, outcome)
+	order, ok := orderbook.GetOrder(2)
+	require.True(t, ok)
+	require.Equal(t, Quantity(1), order.GetRemainingQty())
+}
+
+func TestOrderbook_RejectZeroQuantity(t *testing.T) {
+	orderbook := createOrderBook(t)
+	require.Empty(t, orderbook.AddOrder(createOrderWithId(1, GoodTilCancelled, Buy, 100, 0)))
+	outcome, reason := orderbook.LastOutcome()
+	require.Equal(t, OutcomeRejected, outcome)
+	require.Equal(t, RejectQuantity, reason)
+	require.Equal(t, 0, orderbook.Size())
+	require.True(t, orderbook.Bids.IsEmpty())
+}
+
+func TestOrderbook_TickAndLotSize(t *testing.T) {
+	orderbook := createOrderBook(t)
+	orderbook.TickSize = 0.05
+	orderbook.LotSize = 10
+	require.Empty(t, orderbook.AddOrder(createOrderWithId(1, GoodTilCancelled, Buy, 100.05, 20)))
+	require.Empty(t, orderbook.AddOrder(createOrderWithId(2, GoodTilCancelled, Buy, 100.07, 20)))
+	outcome, reason := orderbook.LastOutcome()
+	require.Equal(t, OutcomeRejected, outcome)
+	require.Equal(t, RejectTickSize, reason)
+	require.Empty(t, orderbook.AddOrder(createOrderWithId(3, GoodTilCancelled, Buy, 100.10, 15)))
+	require.Len(t, orderbook.AddOrder(createOrderWithId(4, Market, Sell, 0, 10)), 1)
+	outcome, reason = orderbook.LastOutcome()
+	require.Equal(t, OutcomeFilled, outcome)
+	require.Empty(t, reason)
+	_, ok := orderbook.GetOrder(1)
+	require.True(t, ok)
+	require.Equal(t, 1, orderbook.Size())
+
+	// A rejected modify leaves the resting order as it was
+	before, _ := orderbook.GetOrder(1)
+	order := before
+	require.NoError(t, order.Amend(100.01, 20))
+	require.Empty(t, orderbook.ModifyOrder(order))
+	outcome, reason = orderbook.LastOutcome()
+	require.Equal(t, OutcomeRejected, outcome)
+	require.Equal(t, RejectTickSize, reason)
+	after, ok := orderbook.GetOrder(1)
+	require.True(t, ok, "the order still rests after a modify off the tick")
+	require.Equal(t, before, after)
+
+	require.Empty(t, orderbook.AddOrder(createOrderWithId(5, GoodTilCancelled, Sell, 101.00, 20)))
+	before, _ = orderbook.GetOrder(5)
+	order = before
+	require.NoError(t, order.Amend(101.00, 15))
+	require.Empty(t, orderbook.ModifyOrder(order))
+	outcome, reason = orderbook.LastOutcome()
+	require.Equal(t, OutcomeRejected, outcome)
+	require.Equal(t, RejectLotSize, reason)
+	after, ok = orderbook.GetOrder(5)
+	require.True(t, ok, "the order still rests after a reduction off the lot size")
+	require.Equal(t, before, after)
+	require.Equal(t, 2, orderbook.Size())
+
+	require.Empty(t, orderbook.AddOrder(createOrderWithId(6, GoodTilCancelled, Sell, 101.00, 30)))
+	order, _ = orderbook.GetOrder(6)
+	require.NoError(t, order.Amend(101.00, 10))
+	orderbook.ModifyOrder(order)
+	reduced, ok := orderbook.GetOrder(6)
+	require.True(t, ok)
+	require.Equal(t, Quantity(10), reduced.GetRemainingQty())
+	outcome, _ = orderbook.LastOutcome()
+	require.Equal(t, OutcomeResting, outcome)
+}
@@ -15,6 +15,8 @@ type OrderedMap struct {
 	keys   []Price
 	values map[Price][]Order
 	order  MapOrder
+	// total is the remaining quantity of every order in the map
+	total Quantity
 }
 
 // NewOrderedMap creates a new OrderedMap with the specified order
@@ -33,6 +35,7 @@ func (om *OrderedMap) Add(key Price, value Order) {
 		om.sortKeys()
 	}
 	om.values[key] = append(om.values[key], value)
+	om.total += value.remainingQty
 }
 
 // Get retrieves a value by key
@@ -43,7 +46,10 @@ func (om *OrderedMap) Get(key Price) ([]Order, bool) {
 
 // Delete removes a key-value pair from the map and updates the sorted order of keys
 func (om *OrderedMap) Delete(key Price) {
-	if _, exists := om.values[key]; exists {
+	if orders, exists := om.values[key]; exists {
+		for _, order := range orders {
+			om.total -= order.remainingQty
+		}
 		delete(om.values, key)
 		for i, k := range om.keys {
 			if k == key {
@@ -61,6 +67,7 @@ func (om *OrderedMap) DeleteOrder(order Order) {
 	if orders, exists := om.values[key]; exists {
 		for i, o := range orders {
 			if o.orderId == order.orderId {
+				om.total -= o.remainingQty
 				om.values[key] = append(om.values[key][:i], om.values[key][i+1:]...)
 				break
 			}
@@ -146,6 +153,16 @@ func (om *OrderedMap) LastPrice() (Price, []Order) {
 	return lastKey, om.values[lastKey]
 }
 
+// TotalQty returns the remaining quantity of every order in the map
+func (om *OrderedMap) TotalQty() Quantity {
+	return om.total
+}
+
+// reduce takes qty off the total of the map, for the orders filled or reduced in place
+func (om *OrderedMap) reduce(qty Quantity) {
+	om.total -= qty
+}
+
 // IsEmpty checks if the OrderedMap is empty
 func (om *OrderedMap) IsEmpty() bool {
 	return len(om.keys) == 0
@@ -135,3 +135,22 @@ func TestOrderedmapLastValues(t *testing.T) {
 	worstPrice, _ = om.LastKey()
 	require.Equal(t, Price(100.0), worstPrice)
 }
+
+func TestOrderedMapTotalQty(t *testing.T) {
+	om := NewOrderedMap(Ascending)
+	om.Add(100.0, Order{orderId: 1, Price: 100.0, remainingQty: 5})
+	om.Add(100.0, Order{orderId: 2, Price: 100.0, remainingQty: 3})
+	om.Add(101.0, Order{orderId: 3, Price: 101.0, remainingQty: 7})
+	require.Equal(t, Quantity(15), om.TotalQty())
+	om.DeleteOrder(Order{orderId: 1, Price: 100.0})
+	require.Equal(t, Quantity(10), om.TotalQty())
+	orders, _ := om.Get(100.0)
+	orders[0].remainingQty -= 2
+	om.reduce(2)
+	require.Equal(t, Quantity(8), om.TotalQty())
+	om.Delete(101.0)
+	require.Equal(t, Quantity(1), om.TotalQty())
+	om.DeleteOrder(Order{orderId: 2, Price: 100.0})
+	require.Equal(t, Quantity(0), om.TotalQty())
+	require.True(t, om.IsEmpty())
+}
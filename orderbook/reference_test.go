@@ -0,0 +1,271 @@
+package orderbook
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// referenceBook is a matcher written to be obviously correct rather than fast: every
+// resting order sits in one slice in arrival order and every question is a linear scan.
+// The differential test holds OrderBook to the trades and depth it produces
+type referenceBook struct {
+	orders      []Order
+	nextSeq     uint64
+	lastTradeId TradeId
+	now         time.Time
+}
+
+func (rb *referenceBook) find(id OrderId) int {
+	for i, order := range rb.orders {
+		if order.orderId == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// best returns the index of the resting order an incoming order trades with next: the
+// best crossing price on the opposite side, the earliest arrival among equal prices
+func (rb *referenceBook) best(incoming Order) int {
+	best := -1
+	for i, order := range rb.orders {
+		if order.Side == incoming.Side || !crosses(incoming, order.Price) {
+			continue
+		}
+		if best == -1 || betterPrice(order.Side, order.Price, rb.orders[best].Price) {
+			best = i
+		}
+	}
+	return best
+}
+
+// betterPrice reports whether price comes before other on side
+func betterPrice(side Side, price Price, other Price) bool {
+	if side == Buy {
+		return price > other
+	}
+	return price < other
+}
+
+// available returns the quantity resting on the opposite side within the limit of an order
+func (rb *referenceBook) available(incoming Order) Quantity {
+	var qty Quantity = 0
+	for _, order := range rb.orders {
+		if order.Side != incoming.Side && crosses(incoming, order.Price) {
+			qty += order.remainingQty
+		}
+	}
+	return qty
+}
+
+func (rb *referenceBook) add(order Order) []Trade {
+	if rb.find(order.orderId) != -1 || order.remainingQty <= 0 {
+		return nil
+	}
+	if order.OrderType == Market {
+		// A market order becomes a limit order at the worst price on the opposite side
+		worst := -1
+		for i, resting := range rb.orders {
+			if resting.Side != order.Side && (worst == -1 || betterPrice(resting.Side, rb.orders[worst].Price, resting.Price)) {
+				worst = i
+			}
+		}
+		if worst == -1 {
+			return nil
+		}
+		order.Price = rb.orders[worst].Price
+		order.OrderType = GoodTilCancelled
+	}
+	available := rb.available(order)
+	if order.OrderType == FillAndKill && available == 0 {
+		return nil
+	}
+	if order.OrderType == FillOrKill && available < order.remainingQty {
+		return nil
+	}
+	rb.nextSeq++
+	order.seq = rb.nextSeq
+	trades := []Trade{}
+	for order.remainingQty > 0 {
+		i := rb.best(order)
+		if i == -1 {
+			break
+		}
+		resting := &rb.orders[i]
+		qty := min(order.remainingQty, resting.remainingQty)
+		order.remainingQty -= qty
+		resting.remainingQty -= qty
+		trades = append(trades, rb.trade(order, *resting, qty))
+		if resting.remainingQty == 0 {
+			rb.orders = append(rb.orders[:i], rb.orders[i+1:]...)
+		}
+	}
+	if order.remainingQty > 0 && order.OrderType == GoodTilCancelled {
+		rb.orders = append(rb.orders, order)
+	}
+	return trades
+}
+
+// trade builds the trade between an incoming taker and a resting maker at the maker's price
+func (rb *referenceBook) trade(taker Order, maker Order, qty Quantity) Trade {
+	rb.lastTradeId++
+	trade := Trade{Id: rb.lastTradeId, Timestamp: rb.now}
+	takerInfo := TradeInfo{OrderId: taker.orderId, Price: taker.Price, Qty: qty, Account: taker.Account, Liquidity: Taker}
+	makerInfo := TradeInfo{OrderId: maker.orderId, Price: maker.Price, Qty: qty, Account: maker.Account, Liquidity: Maker}
+	if taker.Side == Buy {
+		trade.BidTrade, trade.AskTrade = takerInfo, makerInfo
+	} else {
+		trade.BidTrade, trade.AskTrade = makerInfo, takerInfo
+	}
+	return trade
+}
+
+func (rb *referenceBook) cancel(id OrderId) {
+	if i := rb.find(id); i != -1 {
+		rb.orders = append(rb.orders[:i], rb.orders[i+1:]...)
+	}
+}
+
+// modify reduces an order in place when only its quantity goes down, otherwise it cancels
+// the order and adds the new version at the back of the queue
+func (rb *referenceBook) modify(order Order) []Trade {
+	i := rb.find(order.orderId)
+	if i == -1 {
+		return rb.add(order)
+	}
+	old := rb.orders[i]
+	if order.Side == old.Side && order.Price == old.Price && order.remainingQty > 0 && order.remainingQty < old.remainingQty {
+		rb.orders[i].initialQty = order.initialQty
+		rb.orders[i].remainingQty = order.remainingQty
+		return nil
+	}
+	rb.cancel(order.orderId)
+	return rb.add(order)
+}
+
+// depth sums the resting quantity at each price, best price first
+func (rb *referenceBook) depth() OrderBookLevelInfos {
+	infos := OrderBookLevelInfos{Bids: []LevelInfo{}, Asks: []LevelInfo{}}
+	for _, side := range []Side{Buy, Sell} {
+		totals := map[Price]Quantity{}
+		for _, order := range rb.orders {
+			if order.Side == side {
+				totals[order.Price] += order.remainingQty
+			}
+		}
+		levels := []LevelInfo{}
+		for price, qty := range totals {
+			levels = append(levels, LevelInfo{Price: price, Quantity: qty})
+		}
+		sort.Slice(levels, func(i, j int) bool { return betterPrice(side, levels[i].Price, levels[j].Price) })
+		if side == Buy {
+			infos.Bids = levels
+		} else {
+			infos.Asks = levels
+		}
+	}
+	return infos
+}
+
+// runDifferential feeds the commands to an OrderBook and a referenceBook and returns the
+// first step where their trades or depth differ
+func runDifferential(commands []command) error {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ob := NewOrderBook()
+	ob.Clock = func() time.Time { return now }
+	rb := &referenceBook{now: now}
+	ids := []OrderId{}
+	for i, cmd := range commands {
+		var got, want []Trade
+		switch cmd.op {
+		case opCancel:
+			if len(ids) == 0 {
+				continue
+			}
+			id := ids[cmd.pick%len(ids)]
+			ob.CancelOrder(id)
+			rb.cancel(id)
+		case opModify:
+			if len(ids) == 0 {
+				continue
+			}
+			j := rb.find(ids[cmd.pick%len(ids)])
+			if j == -1 {
+				continue
+			}
+			order := rb.orders[j]
+			if order.Amend(cmd.price, cmd.qty) != nil {
+				continue
+			}
+			got, want = ob.ModifyOrder(order), rb.modify(order)
+		default:
+			id := OrderId(len(ids) + 1)
+			ids = append(ids, id)
+			order := createOrderWithId(id, cmd.orderType(), cmd.side, cmd.price, cmd.qty)
+			got, want = ob.AddOrder(order), rb.add(order)
+		}
+		if len(got) != 0 || len(want) != 0 {
+			if !reflect.DeepEqual(got, want) {
+				return fmt.Errorf("step %d (%v): traded\n%+v\nthe reference traded\n%+v", i, cmd, got, want)
+			}
+		}
+		if got, want := ob.Depth(0), rb.depth(); !reflect.DeepEqual(got, want) {
+			return fmt.Errorf("step %d (%v): depth is\n%+v\nthe reference depth is\n%+v", i, cmd, got, want)
+		}
+	}
+	return nil
+}
+
+func TestOrderbook_MatchesReference(t *testing.T) {
+	// A million commands, split into sequences short enough to keep both books small
+	sequences, length := 1000, 1000
+	if testing.Short() {
+		sequences = 50
+	}
+	for seed := 1; seed <= sequences; seed++ {
+		rng := rand.New(rand.NewSource(int64(seed)))
+		data := make([]byte, length*commandSize)
+		rng.Read(data)
+		if err := runDifferential(decodeCommands(data)); err != nil {
+			data = minimizeCommands(data, func(commands []command) bool {
+				return runDifferential(commands) != nil
+			})
+			commands := decodeCommands(data)
+			t.Fatalf("seed %d: %v\nminimized to %d commands:\n%v", seed, runDifferential(commands), len(commands), commands)
+		}
+	}
+}
+
+func TestReferenceBook(t *testing.T) {
+	rb := &referenceBook{}
+	rb.add(createOrderWithId(1, GoodTilCancelled, Sell, 101, 5))
+	rb.add(createOrderWithId(2, GoodTilCancelled, Sell, 100, 5))
+	rb.add(createOrderWithId(3, GoodTilCancelled, Sell, 100, 5))
+	rb.add(createOrderWithId(4, GoodTilCancelled, Buy, 98, 5))
+
+	trades := rb.add(createOrderWithId(5, GoodTilCancelled, Buy, 101, 12))
+	require.Len(t, trades, 3)
+	for i, want := range []struct {
+		maker OrderId
+		price Price
+		qty   Quantity
+	}{{2, 100, 5}, {3, 100, 5}, {1, 101, 2}} {
+		require.Equal(t, want.maker, trades[i].AskTrade.OrderId)
+		require.Equal(t, want.price, trades[i].ExecPrice())
+		require.Equal(t, want.qty, trades[i].Qty())
+	}
+	require.Equal(t, OrderBookLevelInfos{
+		Bids: []LevelInfo{{Price: 98, Quantity: 5}},
+		Asks: []LevelInfo{{Price: 101, Quantity: 3}},
+	}, rb.depth())
+
+	require.Nil(t, rb.add(createOrderWithId(6, FillOrKill, Buy, 101, 4)), "3 available")
+	require.Len(t, rb.add(createOrderWithId(7, FillAndKill, Sell, 97, 8)), 1)
+	require.Equal(t, -1, rb.find(7), "fill and kill order rests")
+}
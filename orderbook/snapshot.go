@@ -0,0 +1,117 @@
+package orderbook
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Snapshot is what a book needs to start again where it stopped: the resting orders in time
+// priority, the fees accrued by every account and the last trade and event numbers
+type Snapshot struct {
+	Symbol       string          `json:"symbol"`
+	LastTradeId  TradeId         `json:"last_trade_id"`
+	LastEventSeq uint64          `json:"last_event_seq"`
+	Orders       []SnapshotOrder `json:"orders"`
+	Fees         []SnapshotFees  `json:"fees,omitempty"`
+}
+
+// SnapshotOrder is a resting order of a Snapshot
+type SnapshotOrder struct {
+	OrderId      OrderId  `json:"order_id"`
+	OrderType    string   `json:"order_type"`
+	Side         string   `json:"side"`
+	Price        Price    `json:"price"`
+	InitialQty   Quantity `json:"initial_qty"`
+	RemainingQty Quantity `json:"remaining_qty"`
+	Account      string   `json:"account,omitempty"`
+}
+
+// SnapshotFees is the fee totals of an account in a Snapshot. The schedule is not saved,
+// the book it is restored into charges the account its own
+type SnapshotFees struct {
+	Account string  `json:"account"`
+	Volume  float64 `json:"volume"`
+	Fees    float64 `json:"fees"`
+	Rebates float64 `json:"rebates"`
+	Balance float64 `json:"balance"`
+}
+
+// Snapshot returns the resting orders of the book, oldest first, and the fee ledger
+func (ob *OrderBook) Snapshot() Snapshot {
+	orders := ob.resting()
+	snapshot := Snapshot{Symbol: ob.Symbol, LastTradeId: ob.lastTradeId, LastEventSeq: ob.eventSeq, Orders: []SnapshotOrder{}}
+	for _, order := range orders {
+		snapshot.Orders = append(snapshot.Orders, SnapshotOrder{
+			OrderId:      order.orderId,
+			OrderType:    order.OrderType.String(),
+			Side:         order.Side.String(),
+			Price:        order.Price,
+			InitialQty:   order.initialQty,
+			RemainingQty: order.remainingQty,
+			Account:      order.Account,
+		})
+	}
+	for _, acc := range ob.Fees.Accounts() {
+		snapshot.Fees = append(snapshot.Fees, SnapshotFees{
+			Account: acc.Account,
+			Volume:  acc.Volume,
+			Fees:    acc.Fees,
+			Rebates: acc.Rebates,
+			Balance: acc.Balance,
+		})
+	}
+	return snapshot
+}
+
+// resting returns the resting orders of the book with their remaining quantity, oldest first
+func (ob *OrderBook) resting() []Order {
+	orders := make([]Order, 0, len(ob.Orders))
+	for id := range ob.Orders {
+		if order, ok := ob.GetOrder(id); ok {
+			orders = append(orders, order)
+		}
+	}
+	sortBySeq(orders)
+	return orders
+}
+
+// Restore puts the orders of a snapshot back into an empty book, keeping their time
+// priority. The orders go straight to their levels, without matching, listeners or events,
+// so listeners registered after the restore hear of them instead
+func (ob *OrderBook) Restore(snapshot Snapshot) error {
+	if len(ob.Orders) > 0 {
+		return errors.New("cannot restore a snapshot into a book with orders")
+	}
+	if snapshot.Symbol != ob.Symbol {
+		return fmt.Errorf("snapshot of %s cannot be restored into the book of %s", snapshot.Symbol, ob.Symbol)
+	}
+	for _, o := range snapshot.Orders {
+		order := NewOrderWithId(o.OrderId, o.OrderType, o.Side, float64(o.Price), int(o.InitialQty))
+		if order == nil || o.RemainingQty <= 0 || o.RemainingQty > o.InitialQty {
+			return fmt.Errorf("invalid order %d in snapshot", o.OrderId)
+		}
+		if _, exists := ob.Orders[order.orderId]; exists {
+			return fmt.Errorf("duplicate order %d in snapshot", o.OrderId)
+		}
+		order.remainingQty = o.RemainingQty
+		order.Account = o.Account
+		ob.nextSeq++
+		order.seq = ob.nextSeq
+		if order.Side == Buy {
+			ob.Bids.Add(order.Price, *order)
+		} else {
+			ob.Asks.Add(order.Price, *order)
+		}
+		ob.Orders[order.orderId] = *order
+	}
+	for _, f := range snapshot.Fees {
+		acc := ob.Fees.account(f.Account)
+		acc.Volume, acc.Fees, acc.Rebates, acc.Balance = f.Volume, f.Fees, f.Rebates, f.Balance
+	}
+	ob.ResumeTradeIds(snapshot.LastTradeId)
+	if snapshot.LastEventSeq > ob.eventSeq {
+		ob.eventSeq = snapshot.LastEventSeq
+	}
+	ob.updateDepthMetrics()
+	return nil
+}
@@ -0,0 +1,51 @@
+package orderbook
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderbook_SnapshotRestore(t *testing.T) {
+	orderbook := createOrderBook(t)
+	orderbook.Fees = NewFeeLedger(StandardFeeSchedule)
+	maker := createOrderWithId(1, GoodTilCancelled, Sell, 101, 5)
+	maker.Account = "maker"
+	orderbook.AddOrder(maker)
+	orderbook.AddOrder(createOrderWithId(2, GoodTilCancelled, Sell, 101, 3))
+	orderbook.AddOrder(createOrderWithId(3, GoodTilCancelled, Buy, 99, 4))
+	taker := createOrderWithId(4, FillAndKill, Buy, 101, 2)
+	taker.Account = "taker"
+	orderbook.AddOrder(taker)
+	orderbook.Fees.Deposit("taker", 50)
+
+	data, err := json.Marshal(orderbook.Snapshot())
+	require.NoError(t, err)
+	var snapshot Snapshot
+	require.NoError(t, json.Unmarshal(data, &snapshot))
+	restored := createOrderBook(t)
+	restored.Fees = NewFeeLedger(StandardFeeSchedule)
+	require.NoError(t, restored.Restore(snapshot))
+	require.Equal(t, orderbook.Depth(0), restored.Depth(0))
+	require.Len(t, restored.Fees.Accounts(), 2)
+	require.Equal(t, orderbook.Fees.Accounts(), restored.Fees.Accounts())
+	require.Equal(t, orderbook.LastTradeId(), restored.LastTradeId())
+	partial, ok := restored.GetOrder(1)
+	require.True(t, ok)
+	require.Equal(t, Quantity(3), partial.GetRemainingQty())
+	require.Equal(t, Quantity(5), partial.GetInitialQty())
+
+	// Time priority survives: order 1 is still ahead of order 2 at 101
+	trades := restored.AddOrder(createOrderWithId(5, FillAndKill, Buy, 101, 4))
+	require.Len(t, trades, 2)
+	require.Equal(t, OrderId(1), trades[0].AskTrade.OrderId)
+	require.Equal(t, orderbook.LastTradeId()+1, trades[0].Id)
+
+	require.ErrorContains(t, restored.Restore(snapshot), "book with orders")
+	other := createOrderBook(t)
+	other.Symbol = "OTHER"
+	require.ErrorContains(t, other.Restore(snapshot), "cannot be restored")
+	snapshot.Orders[0].RemainingQty = 0
+	require.ErrorContains(t, createOrderBook(t).Restore(snapshot), "invalid order 1")
+}
@@ -0,0 +1,131 @@
+package orderbook
+
+import (
+	"time"
+)
+
+// StatsWindow is the length of the rolling window used for high, low, volume and turnover
+const StatsWindow = 24 * time.Hour
+
+type Ticker struct {
+	Symbol        string
+	LastPrice     Price
+	LastQty       Quantity
+	LastTradeTime time.Time
+	BestBid       Price
+	BestBidQty    Quantity
+	BestAsk       Price
+	BestAskQty    Quantity
+	Spread        Price
+	Mid           Price
+	Microprice    Price
+	VWAP          Price
+	High          Price
+	Low           Price
+	Volume        Quantity
+	Turnover      float64
+	BidInterest   Quantity
+	AskInterest   Quantity
+}
+
+type statsTrade struct {
+	time  time.Time
+	price Price
+	qty   Quantity
+}
+
+// tradeStats keeps the running trade statistics of a book. The rolling window is a queue of
+// trades, with monotonic queues giving the window high and low without rescanning it
+type tradeStats struct {
+	last            statsTrade
+	sessionVolume   Quantity
+	sessionTurnover float64
+	window          []statsTrade
+	highs           []statsTrade
+	lows            []statsTrade
+	volume          Quantity
+	turnover        float64
+}
+
+func (ts *tradeStats) add(trade statsTrade) {
+	ts.last = trade
+	ts.sessionVolume += trade.qty
+	ts.sessionTurnover += float64(trade.price) * float64(trade.qty)
+	ts.window = append(ts.window, trade)
+	ts.volume += trade.qty
+	ts.turnover += float64(trade.price) * float64(trade.qty)
+	for len(ts.highs) > 0 && ts.highs[len(ts.highs)-1].price <= trade.price {
+		ts.highs = ts.highs[:len(ts.highs)-1]
+	}
+	ts.highs = append(ts.highs, trade)
+	for len(ts.lows) > 0 && ts.lows[len(ts.lows)-1].price >= trade.price {
+		ts.lows = ts.lows[:len(ts.lows)-1]
+	}
+	ts.lows = append(ts.lows, trade)
+}
+
+// expire drops the trades that fell out of the window ending at now
+func (ts *tradeStats) expire(now time.Time) {
+	cutoff := now.Add(-StatsWindow)
+	for len(ts.window) > 0 && !ts.window[0].time.After(cutoff) {
+		old := ts.window[0]
+		ts.window = ts.window[1:]
+		ts.volume -= old.qty
+		ts.turnover -= float64(old.price) * float64(old.qty)
+	}
+	for len(ts.highs) > 0 && !ts.highs[0].time.After(cutoff) {
+		ts.highs = ts.highs[1:]
+	}
+	for len(ts.lows) > 0 && !ts.lows[0].time.After(cutoff) {
+		ts.lows = ts.lows[1:]
+	}
+	if len(ts.window) == 0 {
+		ts.turnover = 0
+	}
+}
+
+// RestoreStats rebuilds the trade statistics from past trades in time order
+func (ob *OrderBook) RestoreStats(trades []Trade) {
+	for _, trade := range trades {
+		ob.stats.add(statsTrade{time: trade.Timestamp, price: trade.ExecPrice(), qty: trade.Qty()})
+	}
+	ob.stats.expire(ob.Clock())
+}
+
+// Ticker returns the current market statistics of the book
+func (ob *OrderBook) Ticker() Ticker {
+	ob.stats.expire(ob.Clock())
+	ticker := Ticker{
+		Symbol:        ob.Symbol,
+		LastPrice:     ob.stats.last.price,
+		LastQty:       ob.stats.last.qty,
+		LastTradeTime: ob.stats.last.time,
+		Volume:        ob.stats.volume,
+		Turnover:      ob.stats.turnover,
+		BidInterest:   ob.Bids.TotalQty(),
+		AskInterest:   ob.Asks.TotalQty(),
+	}
+	if ob.stats.sessionVolume > 0 {
+		ticker.VWAP = Price(ob.stats.sessionTurnover / float64(ob.stats.sessionVolume))
+	}
+	if len(ob.stats.highs) > 0 {
+		ticker.High = ob.stats.highs[0].price
+		ticker.Low = ob.stats.lows[0].price
+	}
+	if bestBid, ok := ob.Bids.FirstKey(); ok {
+		ticker.BestBid = bestBid
+		ticker.BestBidQty = ob.GetTotalQty(Buy, bestBid)
+	}
+	if bestAsk, ok := ob.Asks.FirstKey(); ok {
+		ticker.BestAsk = bestAsk
+		ticker.BestAskQty = ob.GetTotalQty(Sell, bestAsk)
+	}
+	if ticker.BestBidQty > 0 && ticker.BestAskQty > 0 {
+		ticker.Spread = ticker.BestAsk - ticker.BestBid
+		ticker.Mid = (ticker.BestBid + ticker.BestAsk) / 2
+		// The microprice leans towards the side with less resting quantity
+		bidQty, askQty := Price(ticker.BestBidQty), Price(ticker.BestAskQty)
+		ticker.Microprice = (ticker.BestBid*askQty + ticker.BestAsk*bidQty) / (bidQty + askQty)
+	}
+	return ticker
+}
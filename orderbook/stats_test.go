@@ -0,0 +1,71 @@
+package orderbook
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func createOrderWithId(id OrderId, orderType orderType, side Side, price Price, qty Quantity) Order {
+	order := CreateOrder(orderType, side, price, qty)
+	order.orderId = id
+	return order
+}
+
+func TestOrderbook_TickerQuotes(t *testing.T) {
+	orderbook := createOrderBook(t)
+	orderbook.AddOrder(createOrderWithId(1, GoodTilCancelled, Buy, 99, 30))
+	orderbook.AddOrder(createOrderWithId(2, GoodTilCancelled, Buy, 98, 5))
+	orderbook.AddOrder(createOrderWithId(3, GoodTilCancelled, Sell, 101, 10))
+
+	ticker := orderbook.Ticker()
+	require.Equal(t, DefaultSymbol, ticker.Symbol)
+	require.Equal(t, Price(99), ticker.BestBid)
+	require.Equal(t, Quantity(30), ticker.BestBidQty)
+	require.Equal(t, Price(101), ticker.BestAsk)
+	require.Equal(t, Price(2), ticker.Spread)
+	require.Equal(t, Price(100), ticker.Mid)
+	// More resting on the bid pulls the microprice towards the ask
+	require.InDelta(t, 100.5, float64(ticker.Microprice), 1e-9)
+	require.Equal(t, Quantity(35), ticker.BidInterest)
+	require.Equal(t, Quantity(10), ticker.AskInterest)
+	require.Equal(t, Price(0), ticker.LastPrice)
+}
+
+func TestOrderbook_TickerTradeStats(t *testing.T) {
+	orderbook := createOrderBook(t)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	orderbook.Clock = func() time.Time { return now }
+
+	orderbook.AddOrder(createOrderWithId(1, GoodTilCancelled, Sell, 100, 10))
+	orderbook.AddOrder(createOrderWithId(2, GoodTilCancelled, Buy, 100, 10))
+	now = now.Add(12 * time.Hour)
+	orderbook.AddOrder(createOrderWithId(3, GoodTilCancelled, Sell, 110, 30))
+	orderbook.AddOrder(createOrderWithId(4, GoodTilCancelled, Buy, 115, 30))
+
+	ticker := orderbook.Ticker()
+	require.Equal(t, Price(110), ticker.LastPrice)
+	require.Equal(t, Quantity(30), ticker.LastQty)
+	require.Equal(t, now, ticker.LastTradeTime)
+	require.Equal(t, Price(107.5), ticker.VWAP)
+	require.Equal(t, Price(110), ticker.High)
+	require.Equal(t, Price(100), ticker.Low)
+	require.Equal(t, Quantity(40), ticker.Volume)
+	require.InDelta(t, 4300.0, ticker.Turnover, 1e-9)
+
+	// The first trade leaves the rolling window but still counts towards the session VWAP
+	now = now.Add(13 * time.Hour)
+	ticker = orderbook.Ticker()
+	require.Equal(t, Price(110), ticker.High)
+	require.Equal(t, Price(110), ticker.Low)
+	require.Equal(t, Quantity(30), ticker.Volume)
+	require.InDelta(t, 3300.0, ticker.Turnover, 1e-9)
+	require.Equal(t, Price(107.5), ticker.VWAP)
+
+	now = now.Add(24 * time.Hour)
+	ticker = orderbook.Ticker()
+	require.Equal(t, Quantity(0), ticker.Volume)
+	require.Equal(t, Price(0), ticker.High)
+	require.Equal(t, Price(110), ticker.LastPrice)
+}
@@ -0,0 +1,147 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+// Requests are limited separately for order entry and for market data reads
+type Class string
+
+const (
+	Orders Class = "orders"
+	Reads  Class = "reads"
+)
+
+// DefaultTier is the tier of API keys that do not name one
+const DefaultTier = "default"
+
+// Rate lets through PerSecond requests on average and up to Burst at once.
+// A PerSecond of 0 does not limit anything
+type Rate struct {
+	PerSecond float64 `json:"per_second" yaml:"per_second"`
+	Burst     int     `json:"burst" yaml:"burst"`
+}
+
+// Tier holds the rates of each class of request
+type Tier struct {
+	Orders Rate `json:"orders" yaml:"orders"`
+	Reads  Rate `json:"reads" yaml:"reads"`
+}
+
+func (t Tier) rate(class Class) Rate {
+	if class == Orders {
+		return t.Orders
+	}
+	return t.Reads
+}
+
+// Config holds the tiers API keys are assigned to and the tier applied per IP address to
+// requests without a key
+type Config struct {
+	IP    Tier            `json:"ip" yaml:"ip"`
+	Tiers map[string]Tier `json:"tiers" yaml:"tiers"`
+}
+
+// DefaultConfig limits every client well below what the engine sustains, with a premium
+// tier for market makers and an unlimited one for operators and tools such as obload
+func DefaultConfig() Config {
+	return Config{
+		IP: Tier{Orders: Rate{PerSecond: 50, Burst: 100}, Reads: Rate{PerSecond: 100, Burst: 200}},
+		Tiers: map[string]Tier{
+			DefaultTier: {Orders: Rate{PerSecond: 50, Burst: 100}, Reads: Rate{PerSecond: 100, Burst: 200}},
+			"premium":   {Orders: Rate{PerSecond: 500, Burst: 1000}, Reads: Rate{PerSecond: 1000, Burst: 2000}},
+			"unlimited": {},
+		},
+	}
+}
+
+// LoadConfig reads a Config from a JSON file. Tiers it names replace the default ones of
+// the same name, the other default tiers are kept
+func LoadConfig(path string) (Config, error) {
+	cfg := DefaultConfig()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// bucket holds up to burst tokens, refilled at rate per second
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter keeps a token bucket per client and class of request
+type Limiter struct {
+	Config Config
+	Clock  func() time.Time
+	mu     sync.Mutex
+	// buckets is keyed by client and class
+	buckets   map[string]*bucket
+	nextSweep time.Time
+}
+
+// sweepInterval is how often buckets left full by idle clients are dropped
+const sweepInterval = time.Minute
+
+func New(cfg Config) *Limiter {
+	return &Limiter{Config: cfg, Clock: time.Now, buckets: make(map[string]*bucket)}
+}
+
+// Tier returns the tier called name, or the default tier when there is none by that name
+func (l *Limiter) Tier(name string) Tier {
+	if tier, ok := l.Config.Tiers[name]; ok {
+		return tier
+	}
+	return l.Config.Tiers[DefaultTier]
+}
+
+// Allow takes a token from the bucket of client for class under tier. When the bucket is
+// empty it returns false and how long until the next token
+func (l *Limiter) Allow(client string, tier Tier, class Class) (bool, time.Duration) {
+	rate := tier.rate(class)
+	if rate.PerSecond <= 0 {
+		return true, 0
+	}
+	burst := math.Max(float64(rate.Burst), 1)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.Clock()
+	l.sweep(now)
+	key := string(class) + " " + client
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate.PerSecond)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / rate.PerSecond * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep drops the buckets untouched for a sweep interval. Dropping a bucket refills it,
+// which a minute of idling does at any practical rate anyway. Callers must hold mu
+func (l *Limiter) sweep(now time.Time) {
+	if now.Before(l.nextSweep) {
+		return
+	}
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= sweepInterval {
+			delete(l.buckets, key)
+		}
+	}
+	l.nextSweep = now.Add(sweepInterval)
+}
@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := New(DefaultConfig())
+	l.Clock = func() time.Time { return now }
+	tier := Tier{Orders: Rate{PerSecond: 2, Burst: 3}}
+
+	for i := 0; i < 3; i++ {
+		allowed, _ := l.Allow("alice", tier, Orders)
+		require.True(t, allowed, "burst request %d", i)
+	}
+	allowed, wait := l.Allow("alice", tier, Orders)
+	require.False(t, allowed)
+	require.Equal(t, 500*time.Millisecond, wait)
+
+	// Other clients and classes have their own buckets, a zero rate is unlimited
+	allowed, _ = l.Allow("bob", tier, Orders)
+	require.True(t, allowed)
+	for i := 0; i < 100; i++ {
+		allowed, _ = l.Allow("alice", tier, Reads)
+		require.True(t, allowed)
+	}
+
+	now = now.Add(250 * time.Millisecond)
+	allowed, wait = l.Allow("alice", tier, Orders)
+	require.False(t, allowed)
+	require.Equal(t, 250*time.Millisecond, wait)
+	now = now.Add(250 * time.Millisecond)
+	allowed, _ = l.Allow("alice", tier, Orders)
+	require.True(t, allowed)
+
+	// Idle buckets are dropped, full
+	now = now.Add(2 * sweepInterval)
+	l.Allow("carol", tier, Orders)
+	require.Len(t, l.buckets, 1)
+}
+
+func TestLimiter_Tier(t *testing.T) {
+	l := New(DefaultConfig())
+	require.Equal(t, Rate{PerSecond: 500, Burst: 1000}, l.Tier("premium").Orders)
+	require.Equal(t, l.Config.Tiers[DefaultTier], l.Tier("missing"))
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ratelimits.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"ip": {"orders": {"per_second": 5, "burst": 5}}, "tiers": {"premium": {"orders": {"per_second": 1000, "burst": 10}}}}`), 0644))
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+	require.Equal(t, Rate{PerSecond: 5, Burst: 5}, cfg.IP.Orders)
+	require.Equal(t, DefaultConfig().IP.Reads, cfg.IP.Reads)
+	require.Equal(t, Tier{Orders: Rate{PerSecond: 1000, Burst: 10}}, cfg.Tiers["premium"])
+	require.Equal(t, DefaultConfig().Tiers[DefaultTier], cfg.Tiers[DefaultTier])
+}
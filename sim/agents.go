@@ -0,0 +1,205 @@
+package sim
+
+import (
+	"github.com/EliasManj/orderbook/orderbook"
+)
+
+// Agent is a participant of the simulated market
+type Agent interface {
+	// Name is also the account the agent trades under
+	Name() string
+	// Act is called when the agent is picked to trade
+	Act(s *Simulator) error
+	// OnFill reports an execution of one of the agent's orders
+	OnFill(side orderbook.Side, price orderbook.Price, qty orderbook.Quantity)
+	// Position returns the net quantity held, negative when short
+	Position() int64
+	// PnL values the trading of the agent with its position marked at mark
+	PnL(mark orderbook.Price) float64
+}
+
+// trader keeps the account of an agent and the orders it left in the book
+type trader struct {
+	name     string
+	position int64
+	cash     float64
+	live     []orderbook.OrderId
+}
+
+func (t *trader) Name() string {
+	return t.name
+}
+
+func (t *trader) OnFill(side orderbook.Side, price orderbook.Price, qty orderbook.Quantity) {
+	if side == orderbook.Buy {
+		t.position += int64(qty)
+		t.cash -= float64(price) * float64(qty)
+	} else {
+		t.position -= int64(qty)
+		t.cash += float64(price) * float64(qty)
+	}
+}
+
+func (t *trader) Position() int64 {
+	return t.position
+}
+
+func (t *trader) PnL(mark orderbook.Price) float64 {
+	return t.cash + float64(t.position)*float64(mark)
+}
+
+// prune forgets the orders that are no longer resting
+func (t *trader) prune(s *Simulator) {
+	live := t.live[:0]
+	for _, id := range t.live {
+		if s.Live(id) {
+			live = append(live, id)
+		}
+	}
+	t.live = live
+}
+
+// place sends a limit order, remembering it while it rests
+func (t *trader) place(s *Simulator, agent Agent, side orderbook.Side, price orderbook.Price, qty int) error {
+	id, err := s.Submit(agent, Order{Type: "GoodTilCancelled", Side: side, Price: price, Qty: orderbook.Quantity(qty)})
+	if err != nil {
+		return err
+	}
+	if s.Live(id) {
+		t.live = append(t.live, id)
+	}
+	return nil
+}
+
+// NoiseConfig sets up the traders that buy and sell at random around the fundamental
+type NoiseConfig struct {
+	Count int
+	// MarketRatio is the share of orders sent at market
+	MarketRatio float64
+	// Offset is the average distance of limit prices from the fundamental, in ticks
+	Offset float64
+	MaxQty int
+	// CancelRatio is the chance that an action cancels a resting order instead of trading
+	CancelRatio float64
+}
+
+// NoiseTrader trades in random directions and sizes, mostly with limit orders scattered
+// around the fundamental, some of them marketable
+type NoiseTrader struct {
+	trader
+	cfg NoiseConfig
+}
+
+func (n *NoiseTrader) Act(s *Simulator) error {
+	rng := s.Rand()
+	n.prune(s)
+	if len(n.live) > 0 && rng.Float64() < n.cfg.CancelRatio {
+		i := rng.Intn(len(n.live))
+		id := n.live[i]
+		n.live = append(n.live[:i], n.live[i+1:]...)
+		return s.Cancel(id)
+	}
+	side := orderbook.Buy
+	if rng.Intn(2) == 1 {
+		side = orderbook.Sell
+	}
+	qty := 1 + rng.Intn(max(n.cfg.MaxQty, 1))
+	if rng.Float64() < n.cfg.MarketRatio {
+		_, err := s.Submit(n, Order{Type: "Market", Side: side, Qty: orderbook.Quantity(qty)})
+		return err
+	}
+	// Exponential distances shifted so that about a fifth of the orders cross the fundamental
+	distance := (rng.ExpFloat64() - 0.2) * n.cfg.Offset * s.TickSize()
+	price := s.Fundamental() - distance
+	if side == orderbook.Sell {
+		price = s.Fundamental() + distance
+	}
+	return n.place(s, n, side, s.Tick(price), qty)
+}
+
+// MakerConfig sets up the market makers quoting both sides around the fundamental
+type MakerConfig struct {
+	Count int
+	// Spread is the distance between the bid and the ask, in ticks
+	Spread int
+	Size   int
+	// Skew moves both quotes against the inventory, in ticks per unit held
+	Skew float64
+	// MaxPosition stops the quote that would grow the position beyond it
+	MaxPosition int64
+}
+
+// MarketMaker replaces its bid and ask around the fundamental every time it acts,
+// leaning them against its inventory
+type MarketMaker struct {
+	trader
+	cfg MakerConfig
+}
+
+func (m *MarketMaker) Act(s *Simulator) error {
+	m.prune(s)
+	for _, id := range m.live {
+		if err := s.Cancel(id); err != nil {
+			return err
+		}
+	}
+	m.live = m.live[:0]
+	tick := s.TickSize()
+	mid := s.Fundamental() - m.cfg.Skew*float64(m.position)*tick
+	bid := s.Tick(mid - float64(m.cfg.Spread)*tick/2)
+	ask := bid + orderbook.Price(float64(max(m.cfg.Spread, 1))*tick)
+	if m.position < m.cfg.MaxPosition {
+		if err := m.place(s, m, orderbook.Buy, bid, m.cfg.Size); err != nil {
+			return err
+		}
+	}
+	if m.position > -m.cfg.MaxPosition {
+		if err := m.place(s, m, orderbook.Sell, s.Tick(float64(ask)), m.cfg.Size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MomentumConfig sets up the traders that follow the trend of the last trade price
+type MomentumConfig struct {
+	Count int
+	// Fast and Slow are the periods of the moving averages, in actions of the trader
+	Fast int
+	Slow int
+	// Threshold is the gap between the averages that triggers an order, as a fraction of the price
+	Threshold   float64
+	Size        int
+	MaxPosition int64
+}
+
+// MomentumTrader sends market orders in the direction of the trend whenever the fast
+// average of the last trade price moves away from the slow one
+type MomentumTrader struct {
+	trader
+	cfg  MomentumConfig
+	fast float64
+	slow float64
+}
+
+func (m *MomentumTrader) Act(s *Simulator) error {
+	last := float64(s.LastPrice())
+	if last == 0 {
+		return nil
+	}
+	if m.slow == 0 {
+		m.fast, m.slow = last, last
+		return nil
+	}
+	m.fast += (last - m.fast) * 2 / float64(max(m.cfg.Fast, 1)+1)
+	m.slow += (last - m.slow) * 2 / float64(max(m.cfg.Slow, 1)+1)
+	switch {
+	case m.fast > m.slow*(1+m.cfg.Threshold) && m.position < m.cfg.MaxPosition:
+		_, err := s.Submit(m, Order{Type: "Market", Side: orderbook.Buy, Qty: orderbook.Quantity(m.cfg.Size)})
+		return err
+	case m.fast < m.slow*(1-m.cfg.Threshold) && m.position > -m.cfg.MaxPosition:
+		_, err := s.Submit(m, Order{Type: "Market", Side: orderbook.Sell, Qty: orderbook.Quantity(m.cfg.Size)})
+		return err
+	}
+	return nil
+}
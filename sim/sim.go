@@ -0,0 +1,251 @@
+// Package sim simulates a market of trading agents sending orders to the engine, either in
+// process or through the HTTP API. Noise traders, market makers and momentum traders trade
+// around a fundamental price that follows a random walk, all driven by a seeded RNG so that
+// a run against the in-process engine can be repeated exactly
+package sim
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/EliasManj/orderbook/orderbook"
+)
+
+// FundamentalConfig sets up the random walk of the fair value agents trade around
+type FundamentalConfig struct {
+	Start float64
+	// Volatility is the standard deviation of the moves over one second
+	Volatility float64
+}
+
+// Config sets up a simulation
+type Config struct {
+	Seed int64
+	// Rate is the number of agent actions per second, also the pace of the simulated clock.
+	// Run sends them as fast as the target allows when it is 0
+	Rate        float64
+	TickSize    float64
+	Fundamental FundamentalConfig
+	Noise       NoiseConfig
+	Makers      MakerConfig
+	Momentum    MomentumConfig
+}
+
+// DefaultConfig returns a market of mostly noise traders with a few market makers and
+// momentum traders around a price of 100
+func DefaultConfig() Config {
+	return Config{
+		Seed:        1,
+		Rate:        200,
+		TickSize:    0.01,
+		Fundamental: FundamentalConfig{Start: 100, Volatility: 0.2},
+		Noise:       NoiseConfig{Count: 20, MarketRatio: 0.1, Offset: 20, MaxQty: 20, CancelRatio: 0.3},
+		Makers:      MakerConfig{Count: 3, Spread: 4, Size: 10, Skew: 0.05, MaxPosition: 200},
+		Momentum:    MomentumConfig{Count: 3, Fast: 5, Slow: 30, Threshold: 0.0005, Size: 5, MaxPosition: 100},
+	}
+}
+
+// defaultStep is the simulated time between actions when the rate is not set
+const defaultStep = time.Millisecond
+
+// Stats counts what a simulation sent and caused
+type Stats struct {
+	Actions int
+	Orders  int
+	Cancels int
+	Trades  int
+	Volume  int64
+	// SimTime is the time elapsed on the simulated clock
+	SimTime time.Duration
+}
+
+// owned tracks the remaining quantity of an order resting for an agent
+type owned struct {
+	agent     Agent
+	remaining orderbook.Quantity
+}
+
+// Simulator runs the agents of a market against a target
+type Simulator struct {
+	cfg         Config
+	target      Target
+	rng         *rand.Rand
+	agents      []Agent
+	owners      map[orderbook.OrderId]*owned
+	fundamental float64
+	last        orderbook.Price
+	step        time.Duration
+	stats       Stats
+}
+
+// New creates a simulator sending the orders of the agents described by cfg to target
+func New(cfg Config, target Target) *Simulator {
+	if cfg.TickSize <= 0 {
+		cfg.TickSize = 0.01
+	}
+	s := &Simulator{
+		cfg:         cfg,
+		target:      target,
+		rng:         rand.New(rand.NewSource(cfg.Seed)),
+		owners:      make(map[orderbook.OrderId]*owned),
+		fundamental: cfg.Fundamental.Start,
+		step:        defaultStep,
+	}
+	if cfg.Rate > 0 {
+		s.step = time.Duration(float64(time.Second) / cfg.Rate)
+	}
+	for i := 1; i <= cfg.Noise.Count; i++ {
+		s.agents = append(s.agents, &NoiseTrader{trader: trader{name: fmt.Sprintf("noise-%d", i)}, cfg: cfg.Noise})
+	}
+	for i := 1; i <= cfg.Makers.Count; i++ {
+		s.agents = append(s.agents, &MarketMaker{trader: trader{name: fmt.Sprintf("maker-%d", i)}, cfg: cfg.Makers})
+	}
+	for i := 1; i <= cfg.Momentum.Count; i++ {
+		s.agents = append(s.agents, &MomentumTrader{trader: trader{name: fmt.Sprintf("momentum-%d", i)}, cfg: cfg.Momentum})
+	}
+	return s
+}
+
+// Run steps the simulation at the configured rate until it took actions steps, or until ctx
+// is cancelled when actions is 0. It stops at the first error of the target
+func (s *Simulator) Run(ctx context.Context, actions int) (Stats, error) {
+	start := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+	for i := 0; actions == 0 || i < actions; i++ {
+		if s.cfg.Rate > 0 {
+			due := start.Add(time.Duration(float64(i) * float64(time.Second) / s.cfg.Rate))
+			if wait := time.Until(due); wait > 0 {
+				timer.Reset(wait)
+				select {
+				case <-ctx.Done():
+					return s.stats, nil
+				case <-timer.C:
+				}
+			}
+		}
+		if ctx.Err() != nil {
+			return s.stats, nil
+		}
+		if err := s.Step(); err != nil {
+			return s.stats, err
+		}
+	}
+	return s.stats, nil
+}
+
+// Step moves the fundamental price and lets one agent, picked at random, act
+func (s *Simulator) Step() error {
+	s.stats.Actions++
+	s.stats.SimTime += s.step
+	move := s.cfg.Fundamental.Volatility * math.Sqrt(s.step.Seconds()) * s.rng.NormFloat64()
+	s.fundamental = math.Max(s.fundamental+move, 10*s.cfg.TickSize)
+	if len(s.agents) == 0 {
+		return nil
+	}
+	agent := s.agents[s.rng.Intn(len(s.agents))]
+	return agent.Act(s)
+}
+
+// Stats returns the counts of the simulation so far
+func (s *Simulator) Stats() Stats {
+	return s.stats
+}
+
+// Agents returns the agents of the simulation
+func (s *Simulator) Agents() []Agent {
+	return s.agents
+}
+
+// Rand returns the random source agents draw from
+func (s *Simulator) Rand() *rand.Rand {
+	return s.rng
+}
+
+// Fundamental returns the fair value of the simulated market
+func (s *Simulator) Fundamental() float64 {
+	return s.fundamental
+}
+
+// LastPrice returns the price of the last trade the simulation saw, 0 before any trade
+func (s *Simulator) LastPrice() orderbook.Price {
+	return s.last
+}
+
+// Tick rounds a price to the tick size, never below one tick
+func (s *Simulator) Tick(price float64) orderbook.Price {
+	ticks := math.Max(math.Round(price/s.cfg.TickSize), 1)
+	// Dividing by a whole number of ticks per unit gives 99.74 where multiplying by 0.01
+	// gives 99.74000000000001, and the book keys its levels by exact prices
+	if perUnit := 1 / s.cfg.TickSize; perUnit == math.Round(perUnit) {
+		return orderbook.Price(ticks / perUnit)
+	}
+	return orderbook.Price(ticks * s.cfg.TickSize)
+}
+
+// TickSize returns the price increment of the market
+func (s *Simulator) TickSize() float64 {
+	return s.cfg.TickSize
+}
+
+// Live reports whether an order sent by an agent is still resting
+func (s *Simulator) Live(orderId orderbook.OrderId) bool {
+	_, ok := s.owners[orderId]
+	return ok
+}
+
+// Submit sends the order of an agent, settling the fills of every agent it traded with
+func (s *Simulator) Submit(agent Agent, order Order) (orderbook.OrderId, error) {
+	order.Account = agent.Name()
+	orderId, trades, err := s.target.Submit(order)
+	if err != nil {
+		return 0, err
+	}
+	s.stats.Orders++
+	s.owners[orderId] = &owned{agent: agent, remaining: order.Qty}
+	s.settle(trades)
+	own := s.owners[orderId]
+	// Only good til cancelled orders and the rest of market orders that traded stay in the book
+	if own != nil && !(order.Type == "GoodTilCancelled" || (order.Type == "Market" && own.remaining < order.Qty)) {
+		delete(s.owners, orderId)
+	}
+	return orderId, nil
+}
+
+// Cancel removes an order of an agent if it is still resting
+func (s *Simulator) Cancel(orderId orderbook.OrderId) error {
+	if !s.Live(orderId) {
+		return nil
+	}
+	delete(s.owners, orderId)
+	s.stats.Cancels++
+	return s.target.Cancel(orderId)
+}
+
+// settle reports the fills in trades to the agents that own the orders
+func (s *Simulator) settle(trades []orderbook.Trade) {
+	for _, trade := range trades {
+		s.stats.Trades++
+		s.stats.Volume += int64(trade.Qty())
+		s.last = trade.ExecPrice()
+		fills := []struct {
+			info orderbook.TradeInfo
+			side orderbook.Side
+		}{{trade.BidTrade, orderbook.Buy}, {trade.AskTrade, orderbook.Sell}}
+		for _, fill := range fills {
+			own, ok := s.owners[fill.info.OrderId]
+			if !ok {
+				continue
+			}
+			own.agent.OnFill(fill.side, trade.ExecPrice(), fill.info.Qty)
+			own.remaining -= fill.info.Qty
+			if own.remaining <= 0 {
+				delete(s.owners, fill.info.OrderId)
+			}
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package sim
+
+import (
+	"context"
+	"math"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/EliasManj/orderbook/api"
+	"github.com/EliasManj/orderbook/orderbook"
+	"github.com/stretchr/testify/require"
+)
+
+func runEngine(t *testing.T, cfg Config, actions int) (*Simulator, *Engine) {
+	engine := NewEngine()
+	s := New(cfg, engine)
+	stats, err := s.Run(context.Background(), actions)
+	require.NoError(t, err)
+	require.Equal(t, actions, stats.Actions)
+	return s, engine
+}
+
+func TestSeededRunsRepeat(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Rate = 0
+	first, firstEngine := runEngine(t, cfg, 5000)
+	second, secondEngine := runEngine(t, cfg, 5000)
+	require.Equal(t, first.Stats(), second.Stats())
+	require.Equal(t, firstEngine.Book.Depth(0), secondEngine.Book.Depth(0))
+	require.Equal(t, first.Fundamental(), second.Fundamental())
+
+	cfg.Seed = 2
+	other, _ := runEngine(t, cfg, 5000)
+	require.NotEqual(t, first.Stats(), other.Stats())
+}
+
+func TestBookShape(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Rate = 0
+	s, engine := runEngine(t, cfg, 20000)
+	stats := s.Stats()
+	require.Greater(t, stats.Trades, 1000)
+	require.Greater(t, stats.Cancels, 1000)
+	require.Equal(t, 20*time.Second, stats.SimTime, "one millisecond per action when unpaced")
+
+	depth := engine.Book.Depth(5)
+	require.Len(t, depth.Bids, 5)
+	require.Len(t, depth.Asks, 5)
+	bid, ask := float64(depth.Bids[0].Price), float64(depth.Asks[0].Price)
+	require.Less(t, bid, ask)
+	require.Less(t, ask-bid, 0.2, "market makers keep the spread tight")
+	require.Less(t, math.Abs((bid+ask)/2-s.Fundamental()), 0.5, "the book trades around the fundamental")
+	for _, level := range append(depth.Bids, depth.Asks...) {
+		require.Equal(t, level.Price, s.Tick(float64(level.Price)), "prices are on the tick grid")
+	}
+
+	var volume int64
+	for _, agent := range s.Agents() {
+		volume += agent.Position()
+		if maker, ok := agent.(*MarketMaker); ok {
+			require.LessOrEqual(t, maker.Position(), cfg.Makers.MaxPosition+int64(cfg.Makers.Size))
+			require.Greater(t, maker.PnL(s.LastPrice()), 0.0, "market makers earn the spread")
+		}
+	}
+	require.Equal(t, int64(0), volume, "every trade has a buyer and a seller among the agents")
+}
+
+func TestTick(t *testing.T) {
+	s := New(Config{TickSize: 0.01}, NewEngine())
+	require.Equal(t, orderbook.Price(99.74), s.Tick(99.7399999))
+	require.Equal(t, orderbook.Price(0.01), s.Tick(-3))
+	s = New(Config{TickSize: 0.25}, NewEngine())
+	require.Equal(t, orderbook.Price(100.25), s.Tick(100.3))
+}
+
+func TestHTTPTarget(t *testing.T) {
+	server := httptest.NewServer(api.NewRouter())
+	defer server.Close()
+
+	cfg := DefaultConfig()
+	cfg.Rate = 0
+	cfg.Fundamental.Start = 300
+	s := New(cfg, NewHTTP(server.URL))
+	stats, err := s.Run(context.Background(), 1000)
+	require.NoError(t, err)
+	require.Greater(t, stats.Trades, 0)
+	require.Greater(t, stats.Cancels, 0)
+	require.InDelta(t, 300, float64(s.LastPrice()), 5)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stats, err = s.Run(ctx, 0)
+	require.NoError(t, err)
+	require.Equal(t, 1000, stats.Actions, "a cancelled context stops the run")
+}
+
+func TestRate(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Rate = 1000
+	start := time.Now()
+	runEngine(t, cfg, 101)
+	require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+}
@@ -0,0 +1,186 @@
+package sim
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EliasManj/orderbook/auth"
+	"github.com/EliasManj/orderbook/orderbook"
+)
+
+// Order is an order sent by an agent
+type Order struct {
+	// Type is one of the names accepted by orderbook.StringToOrderType
+	Type    string
+	Side    orderbook.Side
+	Price   orderbook.Price
+	Qty     orderbook.Quantity
+	Account string
+}
+
+// Target is where the simulator sends its orders
+type Target interface {
+	// Submit places an order, returning its id and the trades it caused
+	Submit(order Order) (orderbook.OrderId, []orderbook.Trade, error)
+	// Cancel removes a resting order, cancelling an order that is gone is not an error
+	Cancel(orderId orderbook.OrderId) error
+}
+
+// Engine sends orders straight to an in-process order book, numbering them from 1
+type Engine struct {
+	Book   *orderbook.OrderBook
+	nextId orderbook.OrderId
+}
+
+// NewEngine creates a target driving a new order book
+func NewEngine() *Engine {
+	return &Engine{Book: orderbook.NewOrderBook()}
+}
+
+func (e *Engine) Submit(order Order) (orderbook.OrderId, []orderbook.Trade, error) {
+	e.nextId++
+	o := orderbook.NewOrderWithId(e.nextId, order.Type, order.Side.String(), float64(order.Price), int(order.Qty))
+	if o == nil {
+		return 0, nil, fmt.Errorf("invalid order type %q", order.Type)
+	}
+	o.Account = order.Account
+	return e.nextId, e.Book.AddOrder(*o), nil
+}
+
+func (e *Engine) Cancel(orderId orderbook.OrderId) error {
+	e.Book.CancelOrder(orderId)
+	return nil
+}
+
+// Modify changes the price and total quantity of a resting order, returning the trades it caused
+func (e *Engine) Modify(orderId orderbook.OrderId, price orderbook.Price, qty orderbook.Quantity) ([]orderbook.Trade, error) {
+	order, ok := e.Book.GetOrder(orderId)
+	if !ok {
+		return nil, nil
+	}
+	if err := order.Amend(price, qty); err != nil {
+		return nil, err
+	}
+	return e.Book.ModifyOrder(order), nil
+}
+
+// HTTP sends orders to the HTTP API
+type HTTP struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewHTTP creates a target for the HTTP API at baseURL, such as http://localhost:8080
+func NewHTTP(baseURL string) *HTTP {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = 64
+	return &HTTP{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: 10 * time.Second, Transport: transport},
+	}
+}
+
+// SignWith signs every request with an API key, for servers with authentication on.
+// The agents trade for several accounts so the key needs the admin permission
+func (h *HTTP) SignWith(key string, secret string) {
+	h.client.Transport = &auth.Transport{Key: key, Secret: secret, Base: h.client.Transport}
+}
+
+type httpOrder struct {
+	OrderType string  `json:"order_type"`
+	Side      string  `json:"side"`
+	Price     float64 `json:"price"`
+	Qty       int     `json:"qty"`
+	OrderId   int     `json:"order_id"`
+	Account   string  `json:"account"`
+}
+
+type httpOrderResponse struct {
+	Trades []orderbook.Trade `json:"trades"`
+	Order  httpOrder         `json:"order"`
+}
+
+func (h *HTTP) Submit(order Order) (orderbook.OrderId, []orderbook.Trade, error) {
+	body, err := json.Marshal(httpOrder{
+		OrderType: order.Type,
+		Side:      order.Side.String(),
+		Price:     float64(order.Price),
+		Qty:       int(order.Qty),
+		Account:   order.Account,
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	resp, err := h.client.Post(h.baseURL+"/order/", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return 0, nil, statusError(resp)
+	}
+	var result httpOrderResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, nil, err
+	}
+	return orderbook.OrderId(result.Order.OrderId), result.Trades, nil
+}
+
+func (h *HTTP) Cancel(orderId orderbook.OrderId) error {
+	req, err := http.NewRequest(http.MethodDelete, h.baseURL+"/order/"+strconv.Itoa(int(orderId)), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return statusError(resp)
+	}
+	return nil
+}
+
+// Modify changes the price and total quantity of a resting order, returning the trades it
+// caused. Modifying an order that is gone is not an error
+func (h *HTTP) Modify(orderId orderbook.OrderId, price orderbook.Price, qty orderbook.Quantity) ([]orderbook.Trade, error) {
+	body, err := json.Marshal(httpOrder{Price: float64(price), Qty: int(qty)})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPut, h.baseURL+"/order/"+strconv.Itoa(int(orderId)), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		io.Copy(io.Discard, resp.Body)
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+	var result httpOrderResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return result.Trades, nil
+}
+
+func statusError(resp *http.Response) error {
+	body, _ := io.ReadAll(resp.Body)
+	return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+}